@@ -0,0 +1,170 @@
+// Command backup makes, checks and restores encrypted backups of a
+// PesaLocal database.
+//
+//	go run ./cmd/backup create -out shop.plbk
+//	go run ./cmd/backup verify shop.plbk
+//	go run ./cmd/backup restore shop.plbk
+//
+// The database is $PESALOCAL_DB unless -db is given, and the passphrase
+// is $PESALOCAL_BACKUP_KEY or the contents of $PESALOCAL_BACKUP_KEY_FILE
+// (or -key-file). create works while the server is running; stop the
+// server before restore. restore keeps the replaced database beside it as
+// <db>.before-restore.
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"pesalocal/internal/backup"
+	"pesalocal/internal/repo"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		usage()
+	}
+	cmd := os.Args[1]
+
+	flags := flag.NewFlagSet(cmd, flag.ExitOnError)
+	dbPath := flags.String("db", os.Getenv("PESALOCAL_DB"), "database file")
+	keyFile := flags.String("key-file", os.Getenv("PESALOCAL_BACKUP_KEY_FILE"), "file holding the backup passphrase")
+	out := flags.String("out", "", "archive to write (create; default pesalocal-<time>.plbk)")
+	flags.Parse(os.Args[2:])
+
+	passphrase, err := backup.Passphrase(os.Getenv("PESALOCAL_BACKUP_KEY"), *keyFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(passphrase) == 0 {
+		log.Fatal("no passphrase: set PESALOCAL_BACKUP_KEY or PESALOCAL_BACKUP_KEY_FILE")
+	}
+
+	switch cmd {
+	case "create":
+		if *dbPath == "" {
+			log.Fatal("no database: set PESALOCAL_DB or -db")
+		}
+		if *out == "" {
+			*out = "pesalocal-" + time.Now().Format("20060102-150405") + backup.Extension
+		}
+		m, err := create(*dbPath, *out, passphrase)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("backed up %s to %s\n", *dbPath, *out)
+		printTables(m)
+	case "verify":
+		archive := flags.Arg(0)
+		if archive == "" {
+			usage()
+		}
+		m, err := verify(archive, passphrase)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("%s is intact, made %s\n", archive, m.CreatedAt.Local().Format(time.RFC1123))
+		printTables(m)
+	case "restore":
+		archive := flags.Arg(0)
+		if archive == "" {
+			usage()
+		}
+		if *dbPath == "" {
+			log.Fatal("no database: set PESALOCAL_DB or -db")
+		}
+		f, err := os.Open(archive)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		m, err := backup.Restore(f, passphrase, *dbPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("restored %s from %s, made %s\n", *dbPath, archive, m.CreatedAt.Local().Format(time.RFC1123))
+		printTables(m)
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	log.Fatal("usage: backup create [-db file] [-out archive] | verify <archive> | restore [-db file] <archive>")
+}
+
+// create snapshots a database, live or not, into an archive
+func create(dbPath, out string, passphrase []byte) (*backup.Manifest, error) {
+	// wait out the server's writes rather than failing on a live database
+	db, err := sql.Open("sqlite3", "file:"+dbPath+"?_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	tmp, err := os.MkdirTemp(filepath.Dir(out), ".backup-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+	snapshot := filepath.Join(tmp, "snapshot.db")
+	if err := repo.NewBackupRepo(db).Snapshot(snapshot); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	m, err := backup.Write(f, snapshot, passphrase)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(out)
+		return nil, err
+	}
+	return m, nil
+}
+
+// verify checks an archive opens and its database is intact, without
+// touching any database in use
+func verify(archive string, passphrase []byte) (*backup.Manifest, error) {
+	f, err := os.Open(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tmp, err := os.MkdirTemp("", "pesalocal-verify-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	m, path, err := backup.Extract(f, passphrase, tmp)
+	if err != nil {
+		return nil, err
+	}
+	return m, backup.Check(path, m)
+}
+
+func printTables(m *backup.Manifest) {
+	names := make([]string, 0, len(m.Tables))
+	for name := range m.Tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("  %-24s %d\n", name, m.Tables[name])
+	}
+}
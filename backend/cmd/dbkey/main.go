@@ -0,0 +1,32 @@
+// Command dbkey makes a key for encrypting personal data in a PesaLocal
+// database.
+//
+//	go run ./cmd/dbkey -id 2026-10 >> /etc/pesalocal/db.keys
+//
+// It prints the key as id:base64, the form $PESALOCAL_DB_KEY and
+// $PESALOCAL_DB_KEY_FILE take. The first key listed encrypts; keys after
+// it are only read. To rotate, put a new key first and keep the old one
+// after it: the server re-encrypts everything under the new key when it
+// starts, and logs what it rewrote. The old key can then be removed.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"pesalocal/internal/fieldcrypt"
+)
+
+func main() {
+	log.SetFlags(0)
+	id := flag.String("id", time.Now().Format("2006-01-02"), "key id, stored with every value it encrypts")
+	flag.Parse()
+
+	key, err := fieldcrypt.NewKey(*id)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(key)
+}
@@ -0,0 +1,92 @@
+// Command export downloads CSV or XLSX exports from a running PesaLocal
+// server for the accountant.
+//
+//	go run ./cmd/export -format xlsx -from 2026-01-01 -to 2026-03-31 sales purchases
+//
+// Each export is written to <name>.<format> in -dir; with no arguments
+// sales, purchases and products are exported. -dir - writes a single
+// export to stdout.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+func main() {
+	server := flag.String("url", "http://localhost:8080", "PesaLocal server base URL")
+	format := flag.String("format", "csv", "csv or xlsx")
+	from := flag.String("from", "", "first day (YYYY-MM-DD) or time (RFC 3339)")
+	to := flag.String("to", "", "last day (YYYY-MM-DD) or time (RFC 3339)")
+	dir := flag.String("dir", ".", "directory to write to, or - for stdout")
+	flag.Parse()
+
+	names := flag.Args()
+	if len(names) == 0 {
+		names = []string{"sales", "purchases", "products"}
+	}
+	if *dir == "-" && len(names) > 1 {
+		log.Fatal("-dir - takes a single export")
+	}
+
+	q := url.Values{"format": {*format}}
+	if *from != "" {
+		q.Set("from", *from)
+	}
+	if *to != "" {
+		q.Set("to", *to)
+	}
+
+	for _, name := range names {
+		target := *server + "/export/" + url.PathEscape(name) + "?" + q.Encode()
+		if *dir == "-" {
+			if err := download(os.Stdout, target); err != nil {
+				log.Fatalf("%s: %v", name, err)
+			}
+			continue
+		}
+
+		path := filepath.Join(*dir, name+"."+*format)
+		if err := downloadFile(path, target); err != nil {
+			log.Fatalf("%s: %v", name, err)
+		}
+		fmt.Printf("%s -> %s\n", name, path)
+	}
+}
+
+// downloadFile writes an export to path, leaving nothing behind if it fails
+func downloadFile(path, target string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := download(f, target); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
+
+// download copies an export as it arrives, without holding it in memory
+func download(out io.Writer, target string) error {
+	resp, err := http.Get(target)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s %s", resp.Status, bytes.TrimSpace(body))
+	}
+	_, err = io.Copy(out, resp.Body)
+	return err
+}
@@ -0,0 +1,76 @@
+// Command print-receipt prints sale receipts on a thermal printer. It asks a
+// running PesaLocal server for each sale as ESC/POS and writes the bytes to
+// the printer's device file.
+//
+//	go run ./cmd/print-receipt -device /dev/usb/lp0 -width 58 <sale-id>...
+//
+// Bluetooth printers bound with rfcomm show up as /dev/rfcomm0. -device -
+// writes to stdout, for piping or saving the bytes.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+func main() {
+	server := flag.String("url", "http://localhost:8080", "PesaLocal server base URL")
+	device := flag.String("device", "/dev/usb/lp0", "printer device file, or - for stdout")
+	width := flag.String("width", "80", "roll width in mm: 58 or 80")
+	kind := flag.String("kind", "", "receipt, invoice or iou (default: by sale)")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		log.Fatal("usage: print-receipt [flags] <sale-id>...")
+	}
+
+	out := os.Stdout
+	if *device != "-" {
+		f, err := os.OpenFile(*device, os.O_WRONLY|os.O_APPEND, 0)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	for _, id := range flag.Args() {
+		q := url.Values{"format": {"escpos"}, "width": {*width}}
+		if *kind != "" {
+			q.Set("kind", *kind)
+		}
+		target := *server + "/sales/" + url.PathEscape(id) + "/receipt?" + q.Encode()
+		if err := printReceipt(out, target); err != nil {
+			log.Fatalf("%s: %v", id, err)
+		}
+		if out != os.Stdout {
+			fmt.Printf("%s -> %s\n", id, *device)
+		}
+	}
+}
+
+// printReceipt copies one receipt from the server to the printer. The whole
+// receipt is read first so a failed request prints nothing.
+func printReceipt(out io.Writer, target string) error {
+	resp, err := http.Get(target)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s", resp.Status, bytes.TrimSpace(body))
+	}
+	_, err = out.Write(body)
+	return err
+}
@@ -4,11 +4,17 @@ import (
 	"database/sql"
 	"log"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
 	"time"
 
+	"pesalocal/internal/backup"
+	"pesalocal/internal/fieldcrypt"
 	handlers "pesalocal/internal/handler"
 	"pesalocal/internal/repo"
 	"pesalocal/internal/service"
+	"pesalocal/internal/tariff"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -19,47 +25,329 @@ func main() {
 	// Initialize DB
 	// For demo/hackathon, SQLite in-memory or file-based DB
 	dbPath := "/home/aochuka/Projects/pesalocal/pesalocal.db"
-	db, err := sql.Open("sqlite3", dbPath)
+	if p := os.Getenv("PESALOCAL_DB"); p != "" {
+		dbPath = p
+	}
+	// WAL lets exports and backups read while sync writes; writers wait
+	// on the busy timeout instead of failing with "database is locked",
+	// and take the write lock when their transaction begins so two of
+	// them never deadlock upgrading from a read. Secure delete overwrites
+	// deleted rows so erased or re-encrypted personal data doesn't linger.
+	db, err := sql.Open("sqlite3", "file:"+dbPath+"?_journal_mode=WAL&_busy_timeout=5000&_txlock=immediate&_secure_delete=true")
 	if err != nil {
 		log.Fatalf("failed to open DB: %v", err)
 	}
 	defer db.Close()
 
-	if err := initDB(db); err != nil {
+	if err := repo.Migrate(db); err != nil {
 		log.Fatalf("failed to initialize DB: %v", err)
 	}
+	log.Println("Database initialized successfully.")
 
 	// Optional: set connection pool if needed
 	db.SetMaxOpenConns(10)
 	db.SetConnMaxLifetime(time.Hour)
 
+	// M-PESA tariffs: shipped tables unless a directory of data files is given
+	tariffs, err := tariff.Default()
+	if dir := os.Getenv("PESALOCAL_TARIFF_DIR"); dir != "" {
+		tariffs, err = tariff.LoadDir(dir)
+	}
+	if err != nil {
+		log.Fatalf("failed to load M-PESA tariffs: %v", err)
+	}
+
+	// Backups: encrypted with a passphrase, kept beside the database unless
+	// told otherwise, daily unless told otherwise (0 turns the schedule off)
+	backupDir := filepath.Join(filepath.Dir(dbPath), "backups")
+	if d := os.Getenv("PESALOCAL_BACKUP_DIR"); d != "" {
+		backupDir = d
+	}
+	backupKey, err := backup.Passphrase(os.Getenv("PESALOCAL_BACKUP_KEY"), os.Getenv("PESALOCAL_BACKUP_KEY_FILE"))
+	if err != nil {
+		log.Fatalf("failed to read backup key: %v", err)
+	}
+	backupKeep, _ := strconv.Atoi(os.Getenv("PESALOCAL_BACKUP_KEEP"))
+	backupInterval := 24 * time.Hour
+	if v := os.Getenv("PESALOCAL_BACKUP_INTERVAL"); v != "" {
+		if backupInterval, err = time.ParseDuration(v); err != nil {
+			log.Fatalf("invalid PESALOCAL_BACKUP_INTERVAL: %v", err)
+		}
+	}
+
+	// Personal data (emails, phone numbers, M-PESA details) is encrypted in
+	// the database when keys are given: the first encrypts, any after it
+	// are older keys still being read
+	dbKeys, err := fieldcrypt.Load(os.Getenv("PESALOCAL_DB_KEY"), os.Getenv("PESALOCAL_DB_KEY_FILE"))
+	if err != nil {
+		log.Fatalf("failed to read database keys: %v", err)
+	}
+
+	// End-to-end encrypted sync: devices encrypt payloads with a shop key
+	// and the server only relays them
+	syncE2E := false
+	if v := os.Getenv("PESALOCAL_SYNC_E2E"); v != "" {
+		if syncE2E, err = strconv.ParseBool(v); err != nil {
+			log.Fatalf("invalid PESALOCAL_SYNC_E2E: %v", err)
+		}
+	}
+
 	// Initialize Repositories with DB
 	productRepo := repo.NewProductRepo(db)
 	saleRepo := repo.NewSaleRepo(db)
 	saleItemRepo := repo.NewSaleItemRepo(db)
 	purchaseRepo := repo.NewPurchaseRepo(db)
 	purchaseItemRepo := repo.NewPurchaseItemRepo(db)
-	userRepo := repo.NewUserRepo(db)
-	syncRepo := repo.NewSyncOperationRepo(db)
+	userRepo := repo.NewUserRepo(db, dbKeys)
+	syncRepo := repo.NewSyncOperationRepo(db, dbKeys)
+	encryptedOpRepo := repo.NewEncryptedOperationRepo(db)
+	mpesaRepo := repo.NewMpesaTransactionRepo(db, dbKeys)
+	movementRepo := repo.NewStockMovementRepo(db)
+	stockTakeRepo := repo.NewStockTakeRepo(db)
+	batchRepo := repo.NewStockBatchRepo(db)
+	settingsRepo := repo.NewSettingsRepo(db)
+	categoryRepo := repo.NewCategoryRepo(db)
+	unitRepo := repo.NewUnitConversionRepo(db)
+	supplierRepo := repo.NewSupplierRepo(db, dbKeys)
+	supplierPaymentRepo := repo.NewSupplierPaymentRepo(db)
+	priceRepo := repo.NewPriceChangeRepo(db)
+	reportRepo := repo.NewReportRepo(db)
+	dayCloseRepo := repo.NewDayCloseRepo(db)
+	returnRepo := repo.NewReturnRepo(db)
+	promotionRepo := repo.NewPromotionRepo(db)
+	receiptRepo := repo.NewReceiptRepo(db)
+	exportRepo := repo.NewExportRepo(db)
+	backupRepo := repo.NewBackupRepo(db)
+	privacyRepo := repo.NewPrivacyRepo(db, dbKeys)
+	encryptionRepo := repo.NewEncryptionRepo(db, dbKeys)
+
+	// Bring personal data under the current key: this encrypts it when
+	// keys are first given and re-encrypts it when they are rotated
+	rekeyed, err := encryptionRepo.Rekey()
+	if err != nil {
+		log.Fatalf("failed to encrypt personal data: %v", err)
+	}
+	for column, n := range rekeyed {
+		log.Printf("encrypted %d values of %s under key %q", n, column, dbKeys.Current())
+	}
+	if dbKeys.Enabled() {
+		log.Printf("personal data is encrypted under key %q", dbKeys.Current())
+	}
 
 	// Initialize Services
-	productSvc := service.NewProductService(productRepo)
-	saleSvc := service.NewSaleService(saleRepo, saleItemRepo, productSvc)
-	purchaseSvc := service.NewPurchaseService(purchaseRepo, purchaseItemRepo, productSvc)
+	productSvc := service.NewProductService(productRepo, movementRepo, batchRepo, categoryRepo, unitRepo, priceRepo)
+	promotionSvc := service.NewPromotionService(promotionRepo, productSvc, userRepo, settingsRepo)
+	saleSvc := service.NewSaleService(saleRepo, saleItemRepo, productSvc, dayCloseRepo, promotionSvc)
+	returnSvc := service.NewReturnService(returnRepo, saleRepo, saleItemRepo, dayCloseRepo)
+	receiptSvc := service.NewReceiptService(receiptRepo, settingsRepo)
+	documentSvc := service.NewDocumentService(saleSvc, productSvc, settingsRepo, userRepo, mpesaRepo)
+	priceSvc := service.NewPriceService(productSvc, priceRepo, purchaseItemRepo)
+	reportSvc := service.NewReportService(reportRepo, settingsRepo, dayCloseRepo)
+	analyticsSvc := service.NewAnalyticsService(reportRepo)
+	exportSvc := service.NewExportService(exportRepo)
+	backupSvc := service.NewBackupService(backupRepo, backupDir, backupKey, backupKeep)
+	privacySvc := service.NewPrivacyService(privacyRepo)
+	supplierSvc := service.NewSupplierService(supplierRepo, supplierPaymentRepo, purchaseRepo)
+	purchaseSvc := service.NewPurchaseService(purchaseRepo, purchaseItemRepo, productSvc, supplierSvc)
 	userSvc := service.NewUserService(userRepo)
-	syncSvc := service.NewSyncService(syncRepo, productSvc, saleSvc, purchaseSvc, userSvc)
+	stockTakeSvc := service.NewStockTakeService(stockTakeRepo, productSvc)
+	reorderSvc := service.NewReorderService(productSvc, saleItemRepo, settingsRepo)
+	syncSvc := service.NewSyncService(syncRepo, productSvc, saleSvc, purchaseSvc, userSvc, stockTakeSvc, reorderSvc, supplierSvc, priceSvc, returnSvc, promotionSvc, receiptSvc)
+	encryptedSyncSvc := service.NewEncryptedSyncService(encryptedOpRepo, syncE2E)
+	mpesaSvc := service.NewMpesaService(mpesaRepo)
+	feeSvc := service.NewFeeService(tariffs, mpesaRepo)
+	darajaSvc := service.NewDarajaService(mpesaSvc, saleSvc)
 
 	// Initialize Handlers
-	syncHandler := handlers.NewSyncHandler(syncSvc)
+	syncHandler := handlers.NewSyncHandler(syncSvc, encryptedSyncSvc)
+	productHandler := handlers.NewProductHandler(productSvc)
+	stockTakeHandler := handlers.NewStockTakeHandler(stockTakeSvc)
+	reorderHandler := handlers.NewReorderHandler(reorderSvc)
+	supplierHandler := handlers.NewSupplierHandler(supplierSvc)
+	priceHandler := handlers.NewPriceHandler(priceSvc)
+	returnHandler := handlers.NewReturnHandler(returnSvc)
+	promotionHandler := handlers.NewPromotionHandler(promotionSvc)
+	receiptHandler := handlers.NewReceiptHandler(receiptSvc)
+	documentHandler := handlers.NewDocumentHandler(documentSvc)
+	reportHandler := handlers.NewReportHandler(reportSvc)
+	analyticsHandler := handlers.NewAnalyticsHandler(analyticsSvc)
+	exportHandler := handlers.NewExportHandler(exportSvc)
+	backupHandler := handlers.NewBackupHandler(backupSvc)
+	privacyHandler := handlers.NewPrivacyHandler(privacySvc, os.Getenv("PESALOCAL_ADMIN_KEY"))
+	settingsHandler := handlers.NewSettingsHandler(settingsRepo)
+	mpesaHandler := handlers.NewMpesaHandler(mpesaSvc)
+	feeHandler := handlers.NewFeeHandler(feeSvc)
+	darajaHandler := handlers.NewDarajaHandler(darajaSvc, os.Getenv("PESALOCAL_DARAJA_SECRET"))
 
 	// Setup Router
 	r := chi.NewRouter()
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
-	r.Use(middleware.Timeout(15 * time.Second))
 
-	//  Public / Demo Endpoint
-	r.Post("/sync/push", syncHandler.Push)
+	// Backups and exports are streamed for as long as the data takes;
+	// everything else must answer within 15 seconds
+	r.Group(func(r chi.Router) {
+		r.Use(privacyHandler.RequireAdminKey)
+		r.Post("/backups", backupHandler.Create)
+		r.Get("/backups/{name}", backupHandler.Download)
+		r.Get("/privacy/users/{id}/export", privacyHandler.ExportUser)
+		r.Get("/privacy/shop/export", privacyHandler.ExportShop)
+	})
+	// CSV and XLSX exports for the accountant
+	r.With(syncHandler.RequirePlaintext).Get("/export/{name}", exportHandler.Export)
+
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.Timeout(15 * time.Second))
+
+		//  Public / Demo Endpoint
+		r.Post("/sync/push", syncHandler.Push)
+		r.Get("/sync/pull", syncHandler.Pull)
+
+		// Encrypted backups and data protection (erasure), for the shop owner
+		// only
+		r.Group(func(r chi.Router) {
+			r.Use(privacyHandler.RequireAdminKey)
+			r.Get("/backups", backupHandler.List)
+			r.Get("/privacy/erasures", privacyHandler.Erasures)
+			r.Post("/privacy/users/{id}/erase", privacyHandler.EraseUser)
+			r.Post("/privacy/shop/erase", privacyHandler.EraseShop)
+		})
+
+		// Everything else works on the shop's data, which the server doesn't
+		// have when sync is end-to-end encrypted
+		r.Group(func(r chi.Router) {
+			r.Use(syncHandler.RequirePlaintext)
+
+			// Shop settings
+			r.Get("/settings", settingsHandler.List)
+			r.Put("/settings/{key}", settingsHandler.Set)
+
+			// Products
+			r.Get("/products", productHandler.List)
+			r.Post("/products/import", productHandler.Import)
+			r.Get("/products/barcode/{barcode}", productHandler.GetByBarcode)
+			r.Get("/products/{id}", productHandler.Get)
+			r.Get("/products/{id}/movements", productHandler.Movements)
+			r.Post("/products/{id}/adjustments", stockTakeHandler.Adjust)
+			r.Get("/products/{id}/batches", productHandler.Batches)
+			r.Get("/products/{id}/prices", priceHandler.History)
+			r.Post("/products/{id}/prices", priceHandler.Set)
+			r.Post("/price-changes/{id}/cancel", priceHandler.Cancel)
+
+			// Printable receipts, invoices, IOUs and quotes
+			r.Get("/sales/{id}/receipt", documentHandler.SaleReceipt)
+			r.Post("/quotes", documentHandler.Quote)
+
+			// Returns and refunds
+			r.Post("/sales/{id}/returns", returnHandler.Create)
+			r.Get("/sales/{id}/returns", returnHandler.ForSale)
+			r.Get("/returns", returnHandler.List)
+			r.Get("/returns/{id}", returnHandler.Get)
+
+			// Receipt numbering
+			r.Get("/devices/{id}/receipt-ranges", receiptHandler.Ranges)
+			r.Post("/devices/{id}/receipt-ranges", receiptHandler.Allocate)
+			r.Get("/receipts/audit", receiptHandler.Audit)
+
+			// Promotions
+			r.Get("/promotions", promotionHandler.List)
+			r.Post("/promotions", promotionHandler.Save)
+
+			// Categories
+			r.Get("/categories", productHandler.Categories)
+			r.Post("/categories", productHandler.SaveCategory)
+
+			// Suppliers
+			r.Get("/suppliers", supplierHandler.List)
+			r.Post("/suppliers", supplierHandler.Save)
+			r.Get("/suppliers/{id}", supplierHandler.Get)
+			r.Get("/suppliers/{id}/purchases", supplierHandler.Purchases)
+			r.Get("/suppliers/{id}/prices", supplierHandler.Prices)
+			r.Get("/suppliers/{id}/payments", supplierHandler.Payments)
+			r.Post("/suppliers/{id}/payments", supplierHandler.RecordPayment)
+
+			// Units of measure
+			r.Get("/units/conversions", productHandler.UnitConversions)
+			r.Post("/units/conversions", productHandler.SaveUnitConversion)
+
+			// Perishable stock batches
+			r.Get("/batches/expiring", productHandler.Expiring)
+			r.Post("/batches/{id}/write-off", productHandler.WriteOff)
+
+			// Reports
+			r.Get("/reports/margin/sales", reportHandler.SaleMargins)
+			r.Get("/reports/margin/products", reportHandler.ProductMargins)
+			r.Get("/reports/margin/daily", reportHandler.DailyMargins)
+			r.Get("/reports/sales/series", analyticsHandler.SalesSeries)
+			r.Get("/reports/promotions", reportHandler.Promotions)
+			r.Get("/reports/discounts/flagged", reportHandler.FlaggedDiscounts)
+			r.Get("/reports/z", reportHandler.ZReport)
+			r.Get("/reports/z/closes", reportHandler.DayCloses)
+			r.Post("/reports/z/close", reportHandler.CloseDay)
+			r.Post("/reports/z/adjustments", reportHandler.AddAdjustment)
+
+			// Low-stock alerts and reorder suggestions
+			r.Get("/stock/alerts", reorderHandler.Alerts)
+
+			// Stock takes
+			r.Post("/stock-takes", stockTakeHandler.Open)
+			r.Get("/stock-takes", stockTakeHandler.List)
+			r.Get("/stock-takes/{id}", stockTakeHandler.Get)
+			r.Post("/stock-takes/{id}/counts", stockTakeHandler.RecordCounts)
+			r.Post("/stock-takes/{id}/commit", stockTakeHandler.Commit)
+			r.Post("/stock-takes/{id}/cancel", stockTakeHandler.Cancel)
+
+			// M-PESA
+			r.Post("/mpesa/import", mpesaHandler.Import)
+			r.Get("/mpesa/transactions", mpesaHandler.List)
+			r.Get("/mpesa/tariffs", feeHandler.Tariffs)
+			r.Get("/mpesa/fees", feeHandler.Compute)
+			r.Get("/mpesa/fees/audit", feeHandler.Audit)
+
+			// Daraja callbacks (C2B and STK Push), guarded by a shared secret
+			r.Route("/daraja", func(r chi.Router) {
+				r.Use(darajaHandler.RequireSecret)
+				r.Post("/c2b/validation", darajaHandler.C2BValidation)
+				r.Post("/c2b/confirmation", darajaHandler.C2BConfirmation)
+				r.Post("/stk/callback", darajaHandler.STKCallback)
+			})
+		})
+	})
+
+	// Apply scheduled price changes as they fall due
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for ; ; <-ticker.C {
+			if n, err := priceSvc.ApplyDuePriceChanges(time.Now()); err != nil {
+				log.Printf("applying scheduled prices: %v", err)
+			} else if n > 0 {
+				log.Printf("applied %d scheduled price changes", n)
+			}
+		}
+	}()
+
+	if encryptedSyncSvc.Enabled() {
+		log.Printf("sync is end-to-end encrypted: operations are relayed, not applied")
+	}
+
+	// Back up on start and then on a schedule, keeping the newest few
+	switch {
+	case !backupSvc.Enabled():
+		log.Printf("backups are off: %v", service.ErrBackupsDisabled)
+	case backupInterval > 0:
+		go func() {
+			ticker := time.NewTicker(backupInterval)
+			defer ticker.Stop()
+			for ; ; <-ticker.C {
+				if b, err := backupSvc.CreateBackup(); err != nil {
+					log.Printf("backing up: %v", err)
+				} else {
+					log.Printf("backed up to %s", filepath.Join(backupDir, b.Name))
+				}
+			}
+		}()
+	}
 
 	// Start Server
 	addr := ":8080"
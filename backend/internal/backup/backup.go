@@ -0,0 +1,308 @@
+// Package backup writes and restores encrypted archives of a shop's
+// database.
+//
+// An archive is a gzipped tar of manifest.json and a consistent snapshot
+// of the SQLite database (which holds every entity), encrypted with a key
+// derived from a passphrase. The snapshot is portable: it opens with any
+// SQLite on any machine.
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Extension names backup archives
+const Extension = ".plbk"
+
+// Format is the archive format this package writes
+const Format = 1
+
+const (
+	manifestName = "manifest.json"
+	databaseName = "pesalocal.db"
+)
+
+var ErrEmptyPassphrase = errors.New("backup passphrase is empty")
+
+// Manifest describes what an archive holds, so a restore can check it got
+// everything
+type Manifest struct {
+	Format    int              `json:"format"`
+	CreatedAt time.Time        `json:"created_at"`
+	Tables    map[string]int64 `json:"tables"` // rows per table
+	Size      int64            `json:"size"`   // bytes of the database
+	SHA256    string           `json:"sha256"` // of the database
+}
+
+// Write archives a database snapshot to w, encrypted with passphrase.
+// snapshot must not be in use; see repo.BackupRepo.Snapshot.
+func Write(w io.Writer, snapshot string, passphrase []byte) (*Manifest, error) {
+	if len(passphrase) == 0 {
+		return nil, ErrEmptyPassphrase
+	}
+	tables, err := CountRows(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	m := &Manifest{Format: Format, CreatedAt: time.Now().UTC(), Tables: tables}
+	if m.Size, m.SHA256, err = hashFile(f); err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	enc, err := newEncryptWriter(w, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	gz := gzip.NewWriter(enc)
+	tw := tar.NewWriter(gz)
+	if err := tw.WriteHeader(&tar.Header{Name: manifestName, Mode: 0o600, Size: int64(len(manifest)), ModTime: m.CreatedAt}); err != nil {
+		return nil, err
+	}
+	if _, err := tw.Write(manifest); err != nil {
+		return nil, err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: databaseName, Mode: 0o600, Size: m.Size, ModTime: m.CreatedAt}); err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(tw, f); err != nil {
+		return nil, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return m, enc.Close()
+}
+
+// Extract decrypts an archive and writes its database to dir, checking it
+// against the manifest. It returns the manifest and the database's path.
+func Extract(r io.Reader, passphrase []byte, dir string) (*Manifest, string, error) {
+	if len(passphrase) == 0 {
+		return nil, "", ErrEmptyPassphrase
+	}
+	dec, err := newDecryptReader(r, passphrase)
+	if err != nil {
+		return nil, "", err
+	}
+	gz, err := gzip.NewReader(dec)
+	if err != nil {
+		return nil, "", corrupt(err)
+	}
+	tr := tar.NewReader(gz)
+
+	var m *Manifest
+	path := filepath.Join(dir, databaseName)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, "", corrupt(err)
+		}
+		switch h.Name {
+		case manifestName:
+			m = &Manifest{}
+			if err := json.NewDecoder(tr).Decode(m); err != nil {
+				return nil, "", corrupt(err)
+			}
+		case databaseName:
+			if err := writeFile(path, tr); err != nil {
+				return nil, "", corrupt(err)
+			}
+		}
+	}
+	// the decrypter only reports truncation once read to the end
+	if _, err := io.Copy(io.Discard, dec); err != nil {
+		return nil, "", err
+	}
+
+	if m == nil {
+		return nil, "", fmt.Errorf("%w: no manifest", ErrCorrupt)
+	}
+	if m.Format != Format {
+		return nil, "", fmt.Errorf("%w: format %d is not supported", ErrNotBackup, m.Format)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: no database", ErrCorrupt)
+	}
+	size, sum, err := hashFile(f)
+	f.Close()
+	if err != nil {
+		return nil, "", err
+	}
+	if size != m.Size || sum != m.SHA256 {
+		return nil, "", fmt.Errorf("%w: database doesn't match its manifest", ErrCorrupt)
+	}
+	return m, path, nil
+}
+
+// Check opens an extracted database and checks it is intact and holds
+// the rows the manifest lists
+func Check(path string, m *Manifest) error {
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var result string
+	if err := db.QueryRow("PRAGMA integrity_check").Scan(&result); err != nil {
+		return corrupt(err)
+	}
+	if result != "ok" {
+		return fmt.Errorf("%w: %s", ErrCorrupt, result)
+	}
+
+	tables, err := CountRows(path)
+	if err != nil {
+		return corrupt(err)
+	}
+	for table, want := range m.Tables {
+		if got, ok := tables[table]; !ok || got != want {
+			return fmt.Errorf("%w: table %s has %d rows, manifest says %d", ErrCorrupt, table, got, want)
+		}
+	}
+	return nil
+}
+
+// Restore checks an archive and replaces the database at target with it.
+// Nothing may have the database open. The old database is kept beside it
+// as target + ".before-restore".
+func Restore(r io.Reader, passphrase []byte, target string) (*Manifest, error) {
+	dir, err := os.MkdirTemp(filepath.Dir(target), ".restore-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	m, path, err := Extract(r, passphrase, dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := Check(path, m); err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Stat(target); err == nil {
+		if err := os.Rename(target, target+".before-restore"); err != nil {
+			return nil, err
+		}
+	}
+	// journals belong to the database being replaced
+	for _, suffix := range []string{"-wal", "-shm", "-journal"} {
+		if err := os.Remove(target + suffix); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return m, os.Rename(path, target)
+}
+
+// CountRows counts the rows of every table in a database file
+func CountRows(path string) (map[string]int64, error) {
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT name FROM sqlite_master WHERE type='table' AND name NOT LIKE 'sqlite_%' ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	tables := map[string]int64{}
+	for _, name := range names {
+		var n int64
+		if err := db.QueryRow(`SELECT COUNT(*) FROM "` + name + `"`).Scan(&n); err != nil {
+			return nil, err
+		}
+		tables[name] = n
+	}
+	return tables, nil
+}
+
+func hashFile(f *os.File) (int64, string, error) {
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", err
+	}
+	return n, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func writeFile(path string, r io.Reader) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// corrupt reports a failure reading an archive. Errors from the decrypter
+// already say what went wrong.
+func corrupt(err error) error {
+	if errors.Is(err, ErrCorrupt) || errors.Is(err, ErrBadPassphrase) {
+		return err
+	}
+	return fmt.Errorf("%w: %v", ErrCorrupt, err)
+}
+
+// Passphrase returns the passphrase given directly, or else the contents
+// of file without surrounding whitespace. It is empty when neither is set.
+func Passphrase(value, file string) ([]byte, error) {
+	if value != "" || file == "" {
+		return []byte(value), nil
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(strings.TrimSpace(string(b))), nil
+}
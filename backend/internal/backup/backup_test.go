@@ -0,0 +1,204 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var passphrase = []byte("correct horse battery staple")
+
+func TestCryptRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		size int
+	}{
+		{"empty", 0},
+		{"one byte", 1},
+		{"just under a chunk", chunkSize - 1},
+		{"exactly a chunk", chunkSize},
+		{"just over a chunk", chunkSize + 1},
+		{"several chunks", 3*chunkSize + 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plain := make([]byte, tt.size)
+			rand.Read(plain)
+
+			var archive bytes.Buffer
+			enc, err := newEncryptWriter(&archive, passphrase)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// written in odd-sized pieces, as gzip does
+			for rest := plain; len(rest) > 0; {
+				n := min(len(rest), 1000)
+				if _, err := enc.Write(rest[:n]); err != nil {
+					t.Fatal(err)
+				}
+				rest = rest[n:]
+			}
+			if err := enc.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Contains(archive.Bytes(), plain) && tt.size > 0 {
+				t.Fatal("archive holds the plaintext")
+			}
+
+			dec, err := newDecryptReader(&archive, passphrase)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(dec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, plain) {
+				t.Errorf("read back %d bytes, want %d", len(got), len(plain))
+			}
+		})
+	}
+}
+
+// testDatabase writes a small shop database, with enough incompressible
+// data to span several chunks
+func testDatabase(t *testing.T, path string) {
+	t.Helper()
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, stmt := range []string{
+		"CREATE TABLE products (id TEXT PRIMARY KEY, name TEXT, price REAL)",
+		"CREATE TABLE blobs (id INTEGER PRIMARY KEY, data BLOB)",
+		"CREATE TABLE empty (id TEXT)",
+		"INSERT INTO products VALUES ('p1', 'Sukari 1kg', 200), ('p2', 'Maziwa', 65)",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 50; i++ {
+		data := make([]byte, 4096)
+		rand.Read(data)
+		if _, err := db.Exec("INSERT INTO blobs (data) VALUES (?)", data); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	snapshot := filepath.Join(dir, "snapshot.db")
+	testDatabase(t, snapshot)
+	want, err := os.ReadFile(snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var archive bytes.Buffer
+	m, err := Write(&archive, snapshot, passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Tables["products"] != 2 || m.Tables["blobs"] != 50 || m.Tables["empty"] != 0 || m.Size != int64(len(want)) {
+		t.Errorf("manifest %+v", m)
+	}
+	if archive.Len() < 2*chunkSize {
+		t.Fatalf("archive is %d bytes; the test wants several chunks", archive.Len())
+	}
+
+	// restore over a database in use before, with its journals
+	target := filepath.Join(dir, "pesalocal.db")
+	for name, content := range map[string]string{"": "old database", "-wal": "old wal", "-shm": "old shm"} {
+		if err := os.WriteFile(target+name, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	restored, err := Restore(bytes.NewReader(archive.Bytes()), passphrase, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.SHA256 != m.SHA256 {
+		t.Errorf("restored manifest %+v, want %+v", restored, m)
+	}
+
+	got, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("restored database differs from the snapshot")
+	}
+	if before, _ := os.ReadFile(target + ".before-restore"); string(before) != "old database" {
+		t.Errorf("old database kept as %q", before)
+	}
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if _, err := os.Stat(target + suffix); !os.IsNotExist(err) {
+			t.Errorf("%s left behind: %v", suffix, err)
+		}
+	}
+	leftovers, _ := filepath.Glob(filepath.Join(dir, ".restore-*"))
+	if len(leftovers) > 0 {
+		t.Errorf("left behind %v", leftovers)
+	}
+}
+
+func TestRestoreRejects(t *testing.T) {
+	dir := t.TempDir()
+	snapshot := filepath.Join(dir, "snapshot.db")
+	testDatabase(t, snapshot)
+	var buf bytes.Buffer
+	if _, err := Write(&buf, snapshot, passphrase); err != nil {
+		t.Fatal(err)
+	}
+	archive := buf.Bytes()
+
+	edit := func(f func(b []byte) []byte) []byte {
+		return f(append([]byte{}, archive...))
+	}
+	tests := []struct {
+		name       string
+		archive    []byte
+		passphrase []byte
+		want       error
+	}{
+		{"wrong passphrase", archive, []byte("wrong"), ErrBadPassphrase},
+		{"no passphrase", archive, nil, ErrEmptyPassphrase},
+		{"not a backup", []byte("SQLite format 3\x00 and then some more bytes"), passphrase, ErrNotBackup},
+		{"cut off", archive[:len(archive)-100], passphrase, ErrCorrupt},
+		{"last chunk dropped", archive[:headerSize+4+chunkSize+16], passphrase, ErrCorrupt},
+		{"byte flipped in a later chunk", edit(func(b []byte) []byte {
+			b[len(b)-50] ^= 1
+			return b
+		}), passphrase, ErrCorrupt},
+		{"data after the last chunk", edit(func(b []byte) []byte {
+			return append(b, 0)
+		}), passphrase, ErrCorrupt},
+		{"header tampered", edit(func(b []byte) []byte {
+			b[headerSize-1] ^= 1 // nonce prefix, authenticated with every chunk
+			return b
+		}), passphrase, ErrBadPassphrase},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := filepath.Join(t.TempDir(), "pesalocal.db")
+			if err := os.WriteFile(target, []byte("current database"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			_, err := Restore(bytes.NewReader(tt.archive), tt.passphrase, target)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+			if got, _ := os.ReadFile(target); string(got) != "current database" {
+				t.Error("a failed restore replaced the database")
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package backup
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// An archive is encrypted in chunks so it can be written and read as a
+// stream. The header names the key derivation and is authenticated with
+// every chunk:
+//
+//	magic "PLBK" | version 1 | scrypt logN, r, p | salt (16) | nonce prefix (7)
+//
+// Each chunk is a 4-byte big-endian length, its top bit set on the last
+// chunk, then AES-256-GCM ciphertext. A chunk's nonce is the prefix, the
+// chunk's 4-byte counter and a final-chunk flag, so chunks can't be
+// reordered, dropped or cut off without the archive failing to open.
+const (
+	magic       = "PLBK"
+	version     = 1
+	headerSize  = 4 + 1 + 3 + 16 + 7
+	chunkSize   = 64 << 10
+	finalBit    = 1 << 31
+	scryptLogN  = 15
+	scryptR     = 8
+	scryptP     = 1
+	keySize     = 32
+	prefixSize  = 7
+	saltSize    = 16
+	maxChunkLen = chunkSize + 16 // plaintext and GCM tag
+)
+
+var (
+	ErrNotBackup     = errors.New("not a PesaLocal backup")
+	ErrBadPassphrase = errors.New("wrong backup passphrase, or the backup is damaged")
+	ErrCorrupt       = errors.New("backup is damaged or incomplete")
+)
+
+func newAEAD(passphrase, salt []byte, logN, r, p int) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, salt, 1<<logN, r, p, keySize)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func chunkNonce(prefix []byte, counter uint32, final bool) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[prefixSize:], counter)
+	if final {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// encryptWriter encrypts everything written to it. Close writes the last
+// chunk; without it the archive is incomplete.
+type encryptWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	header  []byte
+	prefix  []byte
+	counter uint32
+	buf     []byte
+}
+
+func newEncryptWriter(w io.Writer, passphrase []byte) (*encryptWriter, error) {
+	header := make([]byte, 0, headerSize)
+	header = append(header, magic...)
+	header = append(header, version, scryptLogN, scryptR, scryptP)
+	random := make([]byte, saltSize+prefixSize)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	header = append(header, random...)
+	salt, prefix := header[8:8+saltSize], header[8+saltSize:]
+
+	aead, err := newAEAD(passphrase, salt, scryptLogN, scryptR, scryptP)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &encryptWriter{w: w, aead: aead, header: header, prefix: prefix, buf: make([]byte, 0, 2*chunkSize)}, nil
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	e.buf = append(e.buf, p...)
+	// hold back a full chunk: it may turn out to be the last one
+	for len(e.buf) > chunkSize {
+		if err := e.seal(e.buf[:chunkSize], false); err != nil {
+			return 0, err
+		}
+		e.buf = append(e.buf[:0], e.buf[chunkSize:]...)
+	}
+	return len(p), nil
+}
+
+func (e *encryptWriter) Close() error {
+	return e.seal(e.buf, true)
+}
+
+func (e *encryptWriter) seal(plain []byte, final bool) error {
+	sealed := e.aead.Seal(nil, chunkNonce(e.prefix, e.counter, final), plain, e.header)
+	e.counter++
+
+	length := uint32(len(sealed))
+	if final {
+		length |= finalBit
+	}
+	var prefix [4]byte
+	binary.BigEndian.PutUint32(prefix[:], length)
+	if _, err := e.w.Write(prefix[:]); err != nil {
+		return err
+	}
+	_, err := e.w.Write(sealed)
+	return err
+}
+
+// decryptReader reads what an encryptWriter wrote, failing on any chunk
+// that doesn't authenticate and on archives that end early
+type decryptReader struct {
+	r       *bufio.Reader
+	aead    cipher.AEAD
+	header  []byte
+	prefix  []byte
+	counter uint32
+	plain   []byte
+	done    bool
+}
+
+func newDecryptReader(r io.Reader, passphrase []byte) (*decryptReader, error) {
+	br := bufio.NewReader(r)
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(br, header); err != nil || string(header[:4]) != magic {
+		return nil, ErrNotBackup
+	}
+	if header[4] != version {
+		return nil, ErrNotBackup
+	}
+	logN, rr, p := int(header[5]), int(header[6]), int(header[7])
+	if logN < 10 || logN > 22 || rr < 1 || rr > 32 || p < 1 || p > 16 {
+		return nil, ErrNotBackup
+	}
+	aead, err := newAEAD(passphrase, header[8:8+saltSize], logN, rr, p)
+	if err != nil {
+		return nil, err
+	}
+	return &decryptReader{r: br, aead: aead, header: header, prefix: header[8+saltSize:]}, nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+func (d *decryptReader) open() error {
+	var prefix [4]byte
+	if _, err := io.ReadFull(d.r, prefix[:]); err != nil {
+		return ErrCorrupt
+	}
+	length := binary.BigEndian.Uint32(prefix[:])
+	final := length&finalBit != 0
+	length &^= finalBit
+	if length > maxChunkLen {
+		return ErrCorrupt
+	}
+	sealed := make([]byte, length)
+	if _, err := io.ReadFull(d.r, sealed); err != nil {
+		return ErrCorrupt
+	}
+
+	plain, err := d.aead.Open(sealed[:0], chunkNonce(d.prefix, d.counter, final), sealed, d.header)
+	if err != nil {
+		if d.counter == 0 {
+			return ErrBadPassphrase
+		}
+		return ErrCorrupt
+	}
+	d.counter++
+	d.plain = plain
+	if final {
+		d.done = true
+		if _, err := d.r.ReadByte(); err != io.EOF {
+			return ErrCorrupt // data after the last chunk
+		}
+	}
+	return nil
+}
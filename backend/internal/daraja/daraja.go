@@ -0,0 +1,174 @@
+// Package daraja holds the payload shapes Safaricom's Daraja API posts to
+// C2B and STK Push callback URLs, and converts them to M-PESA transactions.
+package daraja
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"pesalocal/internal/model"
+)
+
+// Result codes returned to Daraja from C2B validation
+const (
+	ResultAccepted      = "0"
+	ResultInvalidAmount = "C2B00013"
+	ResultOtherError    = "C2B00016"
+)
+
+// Sources recorded on transactions received through callbacks
+const (
+	SourceC2B = "c2b"
+	SourceSTK = "stk"
+)
+
+var ErrPaymentFailed = errors.New("STK push was not completed")
+
+// Daraja timestamps are local (EAT) yyyyMMddHHmmss
+var eat = time.FixedZone("EAT", 3*60*60)
+
+const timeLayout = "20060102150405"
+
+// C2BRequest is posted to both the validation and confirmation URLs
+type C2BRequest struct {
+	TransactionType   string `json:"TransactionType"`
+	TransID           string `json:"TransID"`
+	TransTime         string `json:"TransTime"`
+	TransAmount       string `json:"TransAmount"`
+	BusinessShortCode string `json:"BusinessShortCode"`
+	BillRefNumber     string `json:"BillRefNumber"`
+	InvoiceNumber     string `json:"InvoiceNumber"`
+	OrgAccountBalance string `json:"OrgAccountBalance"`
+	ThirdPartyTransID string `json:"ThirdPartyTransID"`
+	MSISDN            string `json:"MSISDN"`
+	FirstName         string `json:"FirstName"`
+	MiddleName        string `json:"MiddleName"`
+	LastName          string `json:"LastName"`
+}
+
+// C2BResponse acknowledges a C2B callback
+type C2BResponse struct {
+	ResultCode string `json:"ResultCode"`
+	ResultDesc string `json:"ResultDesc"`
+}
+
+// STKCallback is posted to the STK Push CallBackURL
+type STKCallback struct {
+	Body struct {
+		StkCallback struct {
+			MerchantRequestID string `json:"MerchantRequestID"`
+			CheckoutRequestID string `json:"CheckoutRequestID"`
+			ResultCode        int    `json:"ResultCode"`
+			ResultDesc        string `json:"ResultDesc"`
+			CallbackMetadata  struct {
+				Item []STKItem `json:"Item"`
+			} `json:"CallbackMetadata"`
+		} `json:"stkCallback"`
+	} `json:"Body"`
+}
+
+// STKItem is a name/value pair in the callback metadata. Values are
+// numbers or strings depending on the item.
+type STKItem struct {
+	Name  string      `json:"Name"`
+	Value interface{} `json:"Value"`
+}
+
+// Amount parses the transaction amount
+func (c *C2BRequest) Amount() (float64, error) {
+	return strconv.ParseFloat(strings.TrimSpace(c.TransAmount), 64)
+}
+
+// Transaction converts a C2B confirmation to a received M-PESA transaction
+func (c *C2BRequest) Transaction() (*model.MpesaTransaction, error) {
+	amount, err := c.Amount()
+	if err != nil {
+		return nil, fmt.Errorf("TransAmount: %w", err)
+	}
+	when, err := time.ParseInLocation(timeLayout, c.TransTime, eat)
+	if err != nil {
+		return nil, fmt.Errorf("TransTime: %w", err)
+	}
+	if c.TransID == "" {
+		return nil, errors.New("missing TransID")
+	}
+	balance, _ := strconv.ParseFloat(c.OrgAccountBalance, 64)
+
+	name := strings.Join(strings.Fields(c.FirstName+" "+c.MiddleName+" "+c.LastName), " ")
+	return &model.MpesaTransaction{
+		ReceiptNo:      c.TransID,
+		CompletionTime: when,
+		Type:           model.MpesaReceiveMoney,
+		Description:    fmt.Sprintf("%s from %s ref %s", c.TransactionType, c.MSISDN, c.BillRefNumber),
+		Counterparty:   name,
+		Amount:         amount,
+		Balance:        balance,
+		Source:         SourceC2B,
+	}, nil
+}
+
+// Transaction converts a successful STK Push result to a received M-PESA
+// transaction. Cancelled or failed pushes return ErrPaymentFailed.
+func (c *STKCallback) Transaction() (*model.MpesaTransaction, error) {
+	cb := c.Body.StkCallback
+	if cb.ResultCode != 0 {
+		return nil, fmt.Errorf("%w: %s", ErrPaymentFailed, cb.ResultDesc)
+	}
+
+	tx := &model.MpesaTransaction{
+		Type:   model.MpesaReceiveMoney,
+		Source: SourceSTK,
+	}
+	var phone string
+	for _, item := range cb.CallbackMetadata.Item {
+		value := itemString(item.Value)
+		switch item.Name {
+		case "Amount":
+			amount, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("Amount: %w", err)
+			}
+			tx.Amount = amount
+		case "MpesaReceiptNumber":
+			tx.ReceiptNo = value
+		case "TransactionDate":
+			when, err := time.ParseInLocation(timeLayout, value, eat)
+			if err != nil {
+				return nil, fmt.Errorf("TransactionDate: %w", err)
+			}
+			tx.CompletionTime = when
+		case "PhoneNumber":
+			phone = value
+		case "Balance":
+			tx.Balance, _ = strconv.ParseFloat(value, 64)
+		}
+	}
+
+	if tx.ReceiptNo == "" {
+		return nil, errors.New("missing MpesaReceiptNumber")
+	}
+	if tx.CompletionTime.IsZero() {
+		tx.CompletionTime = time.Now()
+	}
+	tx.Counterparty = phone
+	tx.Description = fmt.Sprintf("STK Push %s from %s", cb.CheckoutRequestID, phone)
+	return tx, nil
+}
+
+// itemString formats a metadata value without float exponents, so that
+// phone numbers and dates decoded as float64 keep all their digits
+func itemString(v interface{}) string {
+	switch v := v.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		return v
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,257 @@
+package daraja
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"pesalocal/internal/model"
+)
+
+// sample decodes one of the payloads the stand-in server posts
+func sample(t *testing.T, name string, v interface{}) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("..", "..", "cmd", "daraja-standin", "samples", name+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestC2BTransaction(t *testing.T) {
+	var confirmation, validation C2BRequest
+	sample(t, "c2b_confirmation", &confirmation)
+	sample(t, "c2b_validation", &validation)
+
+	edit := func(c C2BRequest, f func(c *C2BRequest)) *C2BRequest {
+		f(&c)
+		return &c
+	}
+	tests := []struct {
+		name    string
+		req     *C2BRequest
+		want    *model.MpesaTransaction
+		wantErr bool
+	}{
+		{
+			name: "confirmation",
+			req:  &confirmation,
+			want: &model.MpesaTransaction{
+				ReceiptNo:      "SGR7K2LQ4B",
+				CompletionTime: time.Date(2024, 3, 15, 10, 15, 30, 0, eat),
+				Type:           model.MpesaReceiveMoney,
+				Description:    "Pay Bill from 2547*****149 ref ",
+				Counterparty:   "Wanjiku Kamau",
+				Amount:         350,
+				Balance:        12850,
+				Source:         SourceC2B,
+			},
+		},
+		{
+			name: "validation carries no balance",
+			req:  &validation,
+			want: &model.MpesaTransaction{
+				ReceiptNo:      "SGR7K2LQ4B",
+				CompletionTime: time.Date(2024, 3, 15, 10, 15, 30, 0, eat),
+				Type:           model.MpesaReceiveMoney,
+				Description:    "Pay Bill from 2547*****149 ref ",
+				Counterparty:   "Wanjiku Kamau",
+				Amount:         350,
+				Source:         SourceC2B,
+			},
+		},
+		{
+			name: "till payment with an account reference and a middle name",
+			req: edit(confirmation, func(c *C2BRequest) {
+				c.TransactionType, c.BillRefNumber = "Buy Goods", "sale-42"
+				c.MiddleName, c.TransAmount = " Njeri ", " 1200 "
+			}),
+			want: &model.MpesaTransaction{
+				ReceiptNo:      "SGR7K2LQ4B",
+				CompletionTime: time.Date(2024, 3, 15, 10, 15, 30, 0, eat),
+				Type:           model.MpesaReceiveMoney,
+				Description:    "Buy Goods from 2547*****149 ref sale-42",
+				Counterparty:   "Wanjiku Njeri Kamau",
+				Amount:         1200,
+				Balance:        12850,
+				Source:         SourceC2B,
+			},
+		},
+		{
+			name:    "amount not a number",
+			req:     edit(confirmation, func(c *C2BRequest) { c.TransAmount = "KES 350" }),
+			wantErr: true,
+		},
+		{
+			name:    "time not in Daraja's layout",
+			req:     edit(confirmation, func(c *C2BRequest) { c.TransTime = "2024-03-15T10:15:30" }),
+			wantErr: true,
+		},
+		{
+			name:    "no receipt",
+			req:     edit(confirmation, func(c *C2BRequest) { c.TransID = "" }),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.req.Transaction()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *got != *tt.want {
+				t.Errorf("got  %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSTKTransaction(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string // a sample name, or the callback itself
+		want    *model.MpesaTransaction
+		wantErr error
+	}{
+		{
+			name:    "stk_callback",
+			payload: "stk_callback",
+			want: &model.MpesaTransaction{
+				ReceiptNo:      "SGR8M3NP5C",
+				CompletionTime: time.Date(2024, 3, 15, 10, 21, 15, 0, eat),
+				Type:           model.MpesaReceiveMoney,
+				Description:    "STK Push ws_CO_15032024102115363925 from 254708374149",
+				Counterparty:   "254708374149",
+				Amount:         120,
+				Source:         SourceSTK,
+			},
+		},
+		{
+			name:    "cancelled by the customer",
+			payload: "stk_callback_cancelled",
+			wantErr: ErrPaymentFailed,
+		},
+		{
+			name: "insufficient funds",
+			payload: `{"Body":{"stkCallback":{"MerchantRequestID":"29115-34620561-3","CheckoutRequestID":"ws_CO_15032024103000363927",
+				"ResultCode":1,"ResultDesc":"The balance is insufficient for the transaction."}}}`,
+			wantErr: ErrPaymentFailed,
+		},
+		{
+			name: "values sent as strings, with a balance",
+			payload: `{"Body":{"stkCallback":{"CheckoutRequestID":"ws_CO_1","ResultCode":0,"CallbackMetadata":{"Item":[
+				{"Name":"Amount","Value":"99.50"},{"Name":"MpesaReceiptNumber","Value":"SGR9P4QR6D"},
+				{"Name":"Balance","Value":"1000.25"},{"Name":"TransactionDate","Value":"20240315235959"},
+				{"Name":"PhoneNumber","Value":"254708374149"}]}}}}`,
+			want: &model.MpesaTransaction{
+				ReceiptNo:      "SGR9P4QR6D",
+				CompletionTime: time.Date(2024, 3, 15, 23, 59, 59, 0, eat),
+				Type:           model.MpesaReceiveMoney,
+				Description:    "STK Push ws_CO_1 from 254708374149",
+				Counterparty:   "254708374149",
+				Amount:         99.5,
+				Balance:        1000.25,
+				Source:         SourceSTK,
+			},
+		},
+		{
+			name: "no receipt",
+			payload: `{"Body":{"stkCallback":{"ResultCode":0,"CallbackMetadata":{"Item":[
+				{"Name":"Amount","Value":120},{"Name":"TransactionDate","Value":20240315102115}]}}}}`,
+		},
+		{
+			name: "amount not a number",
+			payload: `{"Body":{"stkCallback":{"ResultCode":0,"CallbackMetadata":{"Item":[
+				{"Name":"Amount","Value":"lots"},{"Name":"MpesaReceiptNumber","Value":"SGR8M3NP5C"}]}}}}`,
+		},
+		{
+			name: "date not in Daraja's layout",
+			payload: `{"Body":{"stkCallback":{"ResultCode":0,"CallbackMetadata":{"Item":[
+				{"Name":"MpesaReceiptNumber","Value":"SGR8M3NP5C"},{"Name":"TransactionDate","Value":"15/03/2024"}]}}}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cb STKCallback
+			if tt.payload[0] == '{' {
+				if err := json.Unmarshal([]byte(tt.payload), &cb); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				sample(t, tt.payload, &cb)
+			}
+
+			got, err := cb.Transaction()
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got %v, want %v", err, tt.wantErr)
+				}
+				return
+			case tt.want == nil:
+				if err == nil {
+					t.Fatalf("got %+v, want an error", got)
+				}
+				if errors.Is(err, ErrPaymentFailed) {
+					t.Errorf("a malformed callback reported as a failed payment: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *got != *tt.want {
+				t.Errorf("got  %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+
+	// a successful push without a date is stamped when received
+	var cb STKCallback
+	sample(t, "stk_callback", &cb)
+	items := cb.Body.StkCallback.CallbackMetadata.Item[:0]
+	for _, item := range cb.Body.StkCallback.CallbackMetadata.Item {
+		if item.Name != "TransactionDate" {
+			items = append(items, item)
+		}
+	}
+	cb.Body.StkCallback.CallbackMetadata.Item = items
+	before := time.Now()
+	got, err := cb.Transaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.CompletionTime.Before(before) || got.CompletionTime.After(time.Now()) {
+		t.Errorf("undated push stamped %v", got.CompletionTime)
+	}
+}
+
+func TestItemString(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  string
+	}{
+		{float64(254708374149), "254708374149"},
+		{float64(20240315102115), "20240315102115"},
+		{120.5, "120.5"},
+		{"SGR8M3NP5C", "SGR8M3NP5C"},
+		{nil, ""},
+		{true, "true"},
+	}
+	for _, tt := range tests {
+		if got := itemString(tt.value); got != tt.want {
+			t.Errorf("itemString(%v) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
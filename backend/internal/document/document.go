@@ -0,0 +1,112 @@
+// Package document renders sales, quotes and IOUs as printable documents:
+// plain text laid out for 58mm and 80mm thermal rolls, ESC/POS for thermal
+// printers, and PDF.
+package document
+
+import "time"
+
+// Document kinds
+const (
+	KindReceipt = "receipt" // a paid sale
+	KindInvoice = "invoice" // a sale as a tax invoice
+	KindIOU     = "iou"     // a credit sale the customer still owes for
+	KindQuote   = "quote"   // prices offered, nothing sold yet
+)
+
+// Output formats
+const (
+	FormatText = "text"
+	FormatPDF  = "pdf"
+)
+
+// Characters per line on thermal rolls
+const (
+	Width58 = 32 // 58mm roll
+	Width80 = 48 // 80mm roll
+)
+
+// ValidKind reports whether k is a known document kind
+func ValidKind(k string) bool {
+	switch k {
+	case KindReceipt, KindInvoice, KindIOU, KindQuote:
+		return true
+	}
+	return false
+}
+
+// Document is everything printed on a receipt, invoice, IOU or quote.
+// Amounts are in shillings and include VAT.
+type Document struct {
+	Kind       string
+	Number     string
+	Date       time.Time
+	ValidUntil *time.Time // quotes
+	Shop       Shop
+	Cashier    string
+	Customer   string
+	Lines      []*Line
+	Subtotal   float64       // before discounts
+	Discounts  []*Adjustment // on the whole basket
+	Discount   float64       // everything taken off, lines and basket
+	Total      float64
+	VAT        VAT
+	Payment    Payment
+	Footer     string
+}
+
+// Shop is the branding at the top of every document
+type Shop struct {
+	Name    string
+	Address string
+	Phone   string
+	Email   string
+	KRAPin  string
+}
+
+// Line is one item
+type Line struct {
+	Name      string
+	Quantity  float64
+	Unit      string
+	Price     float64
+	Total     float64       // after discounts
+	Discounts []*Adjustment // promotions and manual discounts on the line
+}
+
+// Adjustment is a named amount taken off
+type Adjustment struct {
+	Name   string
+	Amount float64
+}
+
+// VAT splits the total into the tax it includes and the rest
+type VAT struct {
+	Rate   float64 // percent; 0 prints no VAT breakdown
+	Net    float64
+	Amount float64
+}
+
+// Payment is how the sale was or can be paid
+type Payment struct {
+	Method       string // cash, mpesa, credit
+	Status       string
+	MpesaReceipt string
+	MpesaPayer   string
+	Till         string // where to pay by M-PESA, for IOUs and quotes
+	Paybill      string
+	Account      string
+	Owing        float64
+}
+
+// Title is the heading printed for the document's kind
+func (d *Document) Title() string {
+	switch d.Kind {
+	case KindInvoice:
+		return "TAX INVOICE"
+	case KindIOU:
+		return "CREDIT SALE - IOU"
+	case KindQuote:
+		return "QUOTATION"
+	}
+	return "SALES RECEIPT"
+}
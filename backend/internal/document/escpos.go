@@ -0,0 +1,103 @@
+package document
+
+import (
+	"bytes"
+	"io"
+)
+
+// FormatESCPOS is raw ESC/POS for thermal receipt printers
+const FormatESCPOS = "escpos"
+
+// ESC/POS commands
+var (
+	escInit        = []byte{0x1b, '@'}             // ESC @: reset the printer
+	escCodePage    = []byte{0x1b, 't', 16}         // ESC t 16: WPC1252 code page
+	escBoldOn      = []byte{0x1b, 'E', 1}          // ESC E 1
+	escBoldOff     = []byte{0x1b, 'E', 0}          // ESC E 0
+	escAlignLeft   = []byte{0x1b, 'a', 0}          // ESC a 0
+	escAlignCenter = []byte{0x1b, 'a', 1}          // ESC a 1
+	escFeedCut     = []byte{0x1d, 'V', 66, 3}      // GS V 66 3: feed past the cutter, partial cut
+	escDrawerKick  = []byte{0x1b, 'p', 0, 25, 250} // ESC p 0: pulse drawer pin 2, 50ms on, 500ms off
+)
+
+// RenderESCPOS writes a document as an ESC/POS byte stream for a roll of
+// the given width: the text layout with bold headings, a QR code of the
+// document number and a cut. Cash receipts then open the cash drawer. The
+// same document always gives the same bytes.
+func RenderESCPOS(w io.Writer, d *Document, width int) error {
+	rows, err := Layout(d, width)
+	if err != nil {
+		return err
+	}
+
+	var b bytes.Buffer
+	b.Write(escInit)
+	b.Write(escCodePage)
+	for _, row := range rows {
+		if row.Bold {
+			b.Write(escBoldOn)
+		}
+		b.Write(encode1252(row.Text))
+		if row.Bold {
+			b.Write(escBoldOff)
+		}
+		b.WriteByte('\n')
+	}
+
+	if d.Number != "" {
+		moduleSize := byte(6)
+		if width < Width80 {
+			moduleSize = 4
+		}
+		b.Write(escAlignCenter)
+		writeQR(&b, d.Number, moduleSize)
+		b.Write(escAlignLeft)
+		b.WriteByte('\n')
+	}
+	b.Write(escFeedCut)
+	if d.Kind == KindReceipt && d.Payment.Method == "cash" {
+		b.Write(escDrawerKick)
+	}
+
+	_, err = w.Write(b.Bytes())
+	return err
+}
+
+// writeQR stores and prints a QR code with GS ( k: model 2, the given
+// module size and error correction level M
+func writeQR(b *bytes.Buffer, data string, moduleSize byte) {
+	qr := func(fn byte, params ...byte) {
+		n := len(params) + 2
+		b.Write([]byte{0x1d, '(', 'k', byte(n), byte(n >> 8), 49, fn})
+		b.Write(params)
+	}
+	qr(65, 50, 0)                          // model 2
+	qr(67, moduleSize)                     // module size in dots
+	qr(69, 49)                             // error correction M
+	qr(80, append([]byte{48}, data...)...) // store the data
+	qr(81, 48)                             // print it
+}
+
+// cp1252 maps the characters above Latin-1 that WPC1252 can print
+var cp1252 = map[rune]byte{
+	'€': 0x80, '‚': 0x82, '„': 0x84, '…': 0x85, '‘': 0x91, '’': 0x92,
+	'“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, '™': 0x99,
+}
+
+// encode1252 encodes text for the WPC1252 code page. Swahili needs nothing
+// beyond ASCII, but names often carry an apostrophe (ng’ombe) or an
+// accented letter; anything the printer can't show becomes "?".
+func encode1252(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r >= 0x20 && r < 0x7f, r >= 0xa0 && r <= 0xff:
+			out = append(out, byte(r))
+		case cp1252[r] != 0:
+			out = append(out, cp1252[r])
+		default:
+			out = append(out, '?')
+		}
+	}
+	return out
+}
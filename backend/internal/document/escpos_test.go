@@ -0,0 +1,145 @@
+package document
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func testReceipt() *Document {
+	return &Document{
+		Kind:   KindReceipt,
+		Number: "RCP-000123",
+		Date:   time.Date(2026, 10, 18, 14, 5, 0, 0, time.UTC),
+		Shop: Shop{
+			Name:    "Mama Njeri Duka",
+			Address: "Tom Mboya St, Nairobi",
+			Phone:   "0712 345 678",
+			KRAPin:  "P051234567X",
+		},
+		Cashier: "Wanjiru",
+		Lines: []*Line{
+			{Name: "Maziwa ya ng’ombe – Brookside", Quantity: 2, Unit: "pkt", Price: 65, Total: 130},
+			{Name: "Café Java €", Quantity: 1, Price: 250, Total: 225,
+				Discounts: []*Adjustment{{Name: "Manual discount", Amount: 25}}},
+		},
+		Subtotal: 380,
+		Discount: 25,
+		Total:    355,
+		VAT:      VAT{Rate: 16, Net: 306.03, Amount: 48.97},
+		Payment:  Payment{Method: "cash", Status: "paid"},
+		Footer:   "Asante kwa kununua!",
+	}
+}
+
+func TestRenderESCPOSGolden(t *testing.T) {
+	tests := []struct {
+		name   string
+		golden string
+		width  int
+		edit   func(d *Document)
+	}{
+		{"cash receipt 80mm", "receipt_cash_80.escpos", Width80, func(d *Document) {}},
+		{"cash receipt 58mm", "receipt_cash_58.escpos", Width58, func(d *Document) {}},
+		{"mpesa receipt 58mm", "receipt_mpesa_58.escpos", Width58, func(d *Document) {
+			d.Payment = Payment{Method: "mpesa", Status: "paid", MpesaReceipt: "QJK3ABCD12"}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := testReceipt()
+			tt.edit(d)
+			var got bytes.Buffer
+			if err := RenderESCPOS(&got, d, tt.width); err != nil {
+				t.Fatal(err)
+			}
+
+			path := filepath.Join("testdata", tt.golden)
+			if *update {
+				if err := os.WriteFile(path, got.Bytes(), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got.Bytes(), want) {
+				t.Errorf("bytes differ from %s; run go test -update and review the diff", path)
+			}
+		})
+	}
+}
+
+func TestRenderESCPOSCommands(t *testing.T) {
+	tests := []struct {
+		name      string
+		kind      string
+		method    string
+		wantKick  bool
+		wantBytes [][]byte
+	}{
+		{"cash receipt opens the drawer", KindReceipt, "cash", true, nil},
+		{"mpesa receipt", KindReceipt, "mpesa", false, nil},
+		{"quote paid in cash", KindQuote, "cash", false, nil},
+		{"non-ASCII is WPC1252", KindReceipt, "mpesa", false, [][]byte{
+			[]byte("ng\x92ombe \x96 Brookside"), // ’ and –
+			[]byte("Caf\xe9 Java \x80"),         // é and €
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := testReceipt()
+			d.Kind, d.Payment.Method = tt.kind, tt.method
+			var b bytes.Buffer
+			if err := RenderESCPOS(&b, d, Width80); err != nil {
+				t.Fatal(err)
+			}
+			out := b.Bytes()
+
+			if !bytes.HasPrefix(out, append(append([]byte{}, escInit...), escCodePage...)) {
+				t.Errorf("doesn't start with reset and code page: % x", out[:5])
+			}
+			end := escFeedCut
+			if tt.wantKick {
+				end = append(append([]byte{}, escFeedCut...), escDrawerKick...)
+			}
+			if !bytes.HasSuffix(out, end) {
+				t.Errorf("ends % x, want % x", out[len(out)-len(end):], end)
+			}
+			if n := bytes.Count(out, escDrawerKick); n != 0 && !tt.wantKick {
+				t.Errorf("drawer kicked %d times", n)
+			}
+			for _, want := range tt.wantBytes {
+				if !bytes.Contains(out, want) {
+					t.Errorf("missing % x", want)
+				}
+			}
+		})
+	}
+}
+
+func TestEncode1252(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"Sukari 2kg", "Sukari 2kg"},
+		{"ng’ombe", "ng\x92ombe"},
+		{"“Bei nafuu”", "\x93Bei nafuu\x94"},
+		{"Crème brûlée", "Cr\xe8me br\xfbl\xe9e"},
+		{"KSh 1,000 — €5", "KSh 1,000 \x97 \x805"},
+		{"Chai ☕", "Chai ?"},
+		{"tab\there", "tab?here"},
+	}
+	for _, tt := range tests {
+		if got := string(encode1252(tt.in)); got != tt.want {
+			t.Errorf("encode1252(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package document
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Page geometry in points (1/72 inch)
+const (
+	a4Width    = 595.0
+	a4Height   = 842.0
+	a4Margin   = 56.0
+	a4Columns  = 80
+	rollWidth  = 226.8 // 80mm
+	rollMargin = 8.0
+
+	courierAdvance = 0.6 // Courier glyph width, in ems
+)
+
+// RenderPDF writes a document as a PDF. Invoices go on A4 pages; other
+// kinds on a single page the width of an 80mm roll and as long as they
+// need.
+func RenderPDF(w io.Writer, d *Document) error {
+	if d.Kind == KindInvoice {
+		rows, err := Layout(d, a4Columns)
+		if err != nil {
+			return err
+		}
+		fontSize := (a4Width - 2*a4Margin) / a4Columns / courierAdvance
+		leading := fontSize * 1.25
+		perPage := int((a4Height - 2*a4Margin) / leading)
+		var pages [][]Row
+		for len(rows) > perPage {
+			pages, rows = append(pages, rows[:perPage]), rows[perPage:]
+		}
+		pages = append(pages, rows)
+		return writePDF(w, pages, a4Width, a4Height, a4Margin, fontSize, leading)
+	}
+
+	rows, err := Layout(d, Width80)
+	if err != nil {
+		return err
+	}
+	fontSize := (rollWidth - 2*rollMargin) / Width80 / courierAdvance
+	leading := fontSize * 1.25
+	height := float64(len(rows))*leading + 2*rollMargin
+	return writePDF(w, [][]Row{rows}, rollWidth, height, rollMargin, fontSize, leading)
+}
+
+// writePDF writes rows of Courier text as a minimal PDF 1.4 file: a
+// catalog, a page tree, the two standard Courier fonts and one content
+// stream per page
+func writePDF(w io.Writer, pages [][]Row, width, height, margin, fontSize, leading float64) error {
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// objects 1-4 are fixed; each page then takes a page and a content object
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier-Bold /Encoding /WinAnsiEncoding >>")
+
+	for i, rows := range pages {
+		var content bytes.Buffer
+		fmt.Fprintf(&content, "BT\n%.2f TL\n%.2f %.2f Td\n", leading, margin, height-margin-fontSize)
+		bold := false
+		fmt.Fprintf(&content, "/F1 %.2f Tf\n", fontSize)
+		for _, row := range rows {
+			if row.Bold != bold {
+				bold = row.Bold
+				font := "/F1"
+				if bold {
+					font = "/F2"
+				}
+				fmt.Fprintf(&content, "%s %.2f Tf\n", font, fontSize)
+			}
+			fmt.Fprintf(&content, "(%s) Tj T*\n", pdfString(row.Text))
+		}
+		content.WriteString("ET")
+
+		object(fmt.Sprintf(
+			"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			width, height, 6+2*i,
+		))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len()+1, content.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// pdfString encodes text for a WinAnsi string literal. Latin-1 letters
+// print as themselves; anything else the standard fonts can't show
+// becomes "?".
+func pdfString(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteByte('\\')
+			b.WriteByte(byte(r))
+		case r >= 0x20 && r < 0x7f, r >= 0xa0 && r <= 0xff:
+			b.WriteByte(byte(r))
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
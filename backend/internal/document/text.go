@@ -0,0 +1,241 @@
+package document
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+)
+
+// boldMark starts a line printed in bold. Text output drops it; PDF and
+// ESC/POS output switch font.
+const boldMark = "\x02"
+
+// textTemplate lays out every kind of document. Each function that takes
+// the line width gets it from the template's closure.
+const textTemplate = `
+{{- bold (center .Shop.Name)}}
+{{- range wrap .Shop.Address}}
+{{center .}}{{end}}
+{{- if .Shop.Phone}}
+{{center (print "Tel: " .Shop.Phone)}}{{end}}
+{{- if .Shop.Email}}
+{{center .Shop.Email}}{{end}}
+{{- if .Shop.KRAPin}}
+{{center (print "PIN: " .Shop.KRAPin)}}{{end}}
+{{rule "="}}
+{{bold (center .Title)}}
+{{lr (print (numberLabel .Kind) ":") .Number}}
+{{lr "Date:" (.Date.Format "02 Jan 2006 15:04")}}
+{{- if .ValidUntil}}
+{{lr "Valid until:" (.ValidUntil.Format "02 Jan 2006")}}{{end}}
+{{- if .Cashier}}
+{{lr "Served by:" .Cashier}}{{end}}
+{{- if .Customer}}
+{{lr "Customer:" .Customer}}{{end}}
+{{rule "-"}}
+{{- range .Lines}}
+{{- range wrap .Name}}
+{{.}}{{end}}
+{{lr (print "  " (qty .Quantity) (unit .Unit) " x " (money .Price)) (money (gross .))}}
+{{- range .Discounts}}
+{{lr (print "  " .Name) (print "-" (money .Amount))}}{{end}}
+{{- end}}
+{{rule "-"}}
+{{lr "Subtotal" (money .Subtotal)}}
+{{- range .Discounts}}
+{{lr .Name (print "-" (money .Amount))}}{{end}}
+{{- if .Discount}}
+{{lr "You saved" (money .Discount)}}{{end}}
+{{bold (lr "TOTAL KSh" (money .Total))}}
+{{- if .VAT.Rate}}
+{{lr "VATable amount" (money .VAT.Net)}}
+{{lr (print "VAT " (qty .VAT.Rate) "%") (money .VAT.Amount)}}{{end}}
+{{rule "-"}}
+{{- if eq .Kind "quote"}}
+{{- range wrap "Prices include VAT and may change"}}
+{{center .}}{{end}}
+{{- else}}
+{{lr "Payment:" (method .Payment.Method)}}
+{{- if .Payment.MpesaReceipt}}
+{{lr "M-PESA ref:" .Payment.MpesaReceipt}}{{end}}
+{{- if .Payment.MpesaPayer}}
+{{lr "Paid by:" .Payment.MpesaPayer}}{{end}}
+{{- if .Payment.Owing}}
+{{bold (lr "AMOUNT OWING KSh" (money .Payment.Owing))}}{{end}}
+{{- end}}
+{{- if or .Payment.Till .Payment.Paybill}}
+{{- if or (eq .Kind "iou") (eq .Kind "quote") (eq .Kind "invoice")}}
+{{- if .Payment.Till}}
+{{lr "M-PESA Till:" .Payment.Till}}{{end}}
+{{- if .Payment.Paybill}}
+{{lr "M-PESA Paybill:" .Payment.Paybill}}
+{{lr "Account:" (or .Payment.Account .Number)}}{{end}}
+{{- end}}{{end}}
+{{- if eq .Kind "iou"}}
+
+{{"Customer signature:"}}
+
+{{rule "_"}}{{end}}
+{{- if .Footer}}
+{{rule "="}}
+{{- range wrap .Footer}}
+{{center .}}{{end}}{{end}}
+`
+
+// Row is one printed line
+type Row struct {
+	Text string
+	Bold bool
+}
+
+// Layout lays a document out in rows of at most width characters
+func Layout(d *Document, width int) ([]Row, error) {
+	if width < 24 {
+		width = 24
+	}
+	tmpl, err := template.New("document").Funcs(textFuncs(width)).Parse(textTemplate)
+	if err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, d); err != nil {
+		return nil, err
+	}
+
+	var rows []Row
+	for _, line := range strings.Split(b.String(), "\n") {
+		row := Row{Text: line}
+		if strings.HasPrefix(line, boldMark) {
+			row = Row{Text: strings.TrimPrefix(line, boldMark), Bold: true}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// RenderText writes a document as plain text for a roll of the given width
+func RenderText(w io.Writer, d *Document, width int) error {
+	rows, err := Layout(d, width)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if _, err := io.WriteString(w, row.Text+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func textFuncs(width int) template.FuncMap {
+	return template.FuncMap{
+		"bold": func(s string) string { return boldMark + s },
+		"center": func(s string) string {
+			s = truncate(s, width)
+			return strings.Repeat(" ", (width-utf8.RuneCountInString(s))/2) + s
+		},
+		"rule": func(c string) string { return strings.Repeat(c, width) },
+		// left and right justified on one line
+		"lr": func(left, right string) string {
+			right = truncate(right, width)
+			left = truncate(left, width-utf8.RuneCountInString(right)-1)
+			gap := width - utf8.RuneCountInString(left) - utf8.RuneCountInString(right)
+			return left + strings.Repeat(" ", gap) + right
+		},
+		"wrap":  func(s string) []string { return wrap(s, width) },
+		"money": Money,
+		"qty":   Quantity,
+		"unit": func(u string) string {
+			if u == "" {
+				return ""
+			}
+			return " " + u
+		},
+		"gross": func(l *Line) float64 {
+			gross := l.Total
+			for _, d := range l.Discounts {
+				gross += d.Amount
+			}
+			return gross
+		},
+		"method": func(m string) string {
+			switch m {
+			case "mpesa":
+				return "M-PESA"
+			case "credit":
+				return "Credit"
+			case "":
+				return "Cash"
+			}
+			return strings.ToUpper(m[:1]) + m[1:]
+		},
+		"numberLabel": func(kind string) string {
+			switch kind {
+			case KindInvoice:
+				return "Invoice No"
+			case KindQuote:
+				return "Quote No"
+			}
+			return "Receipt No"
+		},
+	}
+}
+
+// Money formats an amount with thousands separators and two decimals
+func Money(v float64) string {
+	s := strconv.FormatFloat(v, 'f', 2, 64)
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	whole, cents := s[:len(s)-3], s[len(s)-3:]
+	for i := len(whole) - 3; i > 0; i -= 3 {
+		whole = whole[:i] + "," + whole[i:]
+	}
+	return sign + whole + cents
+}
+
+// Quantity formats a quantity without trailing zeros
+func Quantity(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// wrap breaks text into lines of at most width characters at spaces
+func wrap(s string, width int) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(s) {
+		for utf8.RuneCountInString(word) > width {
+			r := []rune(word)
+			if line != "" {
+				lines, line = append(lines, line), ""
+			}
+			lines = append(lines, string(r[:width]))
+			word = string(r[width:])
+		}
+		switch {
+		case line == "":
+			line = word
+		case utf8.RuneCountInString(line)+1+utf8.RuneCountInString(word) <= width:
+			line += " " + word
+		default:
+			lines, line = append(lines, line), word
+		}
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func truncate(s string, width int) string {
+	if width < 0 {
+		width = 0
+	}
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	return string([]rune(s)[:width])
+}
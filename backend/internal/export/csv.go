@@ -0,0 +1,32 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+)
+
+type csvWriter struct {
+	w      *csv.Writer
+	record []string
+}
+
+func newCSVWriter(w io.Writer) *csvWriter {
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+func (c *csvWriter) Write(row ...any) error {
+	c.record = c.record[:0]
+	for _, v := range row {
+		s, number := text(v)
+		if !number {
+			s = safeText(s)
+		}
+		c.record = append(c.record, s)
+	}
+	return c.w.Write(c.record)
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
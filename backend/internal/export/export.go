@@ -0,0 +1,86 @@
+// Package export writes tables as CSV or XLSX one row at a time, so an
+// export never has to be held in memory.
+package export
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Formats
+const (
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+)
+
+var ErrInvalidFormat = errors.New("format must be csv or xlsx")
+
+// timeLayout is how times are written; they are local shop time
+const timeLayout = "2006-01-02 15:04:05"
+
+// Writer writes a table one row at a time. Cells may be strings, numbers,
+// times or nil time pointers (written empty). The output is incomplete
+// until Close.
+type Writer interface {
+	Write(row ...any) error
+	Close() error
+}
+
+// NewWriter returns a writer for format. sheet names the worksheet of an
+// XLSX file.
+func NewWriter(w io.Writer, format, sheet string) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w), nil
+	case FormatXLSX:
+		return newXLSXWriter(w, sheet)
+	}
+	return nil, ErrInvalidFormat
+}
+
+// ContentType is the MIME type of format
+func ContentType(format string) string {
+	if format == FormatXLSX {
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// text formats a cell as text, and reports whether it is a number
+func text(v any) (string, bool) {
+	switch v := v.(type) {
+	case nil:
+		return "", false
+	case string:
+		return v, false
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case int:
+		return strconv.Itoa(v), true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case time.Time:
+		if v.IsZero() {
+			return "", false
+		}
+		return v.Local().Format(timeLayout), false
+	case *time.Time:
+		if v == nil {
+			return "", false
+		}
+		return text(*v)
+	}
+	return "", false
+}
+
+// safeText keeps spreadsheets from reading names that start like a
+// formula (e.g. "=cmd|...") as one
+func safeText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
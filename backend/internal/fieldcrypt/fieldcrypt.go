@@ -0,0 +1,221 @@
+// Package fieldcrypt encrypts personal data in single database columns, so
+// a copy of the database taken from a stolen laptop doesn't give up phone
+// numbers, email addresses and M-PESA details.
+//
+// Values are encrypted with AES-256-GCM under the current key of a
+// keyring, bound to the column they are stored in, and kept as text:
+//
+//	enc1:<key id>:<base64 nonce and ciphertext>
+//
+// Values without the prefix were stored before encryption was turned on
+// and are read as they are. Older keys stay in the keyring to read values
+// written under them until they are re-encrypted; see repo.EncryptionRepo.
+package fieldcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const prefix = "enc1:"
+
+// KeySize is the length of a key, before base64
+const KeySize = 32
+
+var (
+	ErrInvalidKeyring = errors.New("database keys must be id:base64 pairs of 32-byte keys, the current key first")
+	ErrUnknownKey     = errors.New("value is encrypted with a database key that isn't configured")
+	ErrCorrupt        = errors.New("encrypted value is damaged or belongs to another column")
+)
+
+var keyID = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// Keyring holds the keys values are encrypted with. The first key encrypts;
+// all of them decrypt. A nil Keyring leaves values in plaintext.
+type Keyring struct {
+	current string
+	ids     []string
+	aeads   map[string]cipher.AEAD
+	index   map[string][]byte // blind index keys
+}
+
+// ParseKeyring reads keys written as id:base64, separated by commas or
+// whitespace, with the current key first. It returns nil when there are
+// none.
+func ParseKeyring(s string) (*Keyring, error) {
+	entries := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	})
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	k := &Keyring{aeads: map[string]cipher.AEAD{}, index: map[string][]byte{}}
+	for _, e := range entries {
+		id, encoded, ok := strings.Cut(e, ":")
+		if !ok || !keyID.MatchString(id) {
+			return nil, fmt.Errorf("%w: %q has no id", ErrInvalidKeyring, redact(e))
+		}
+		if _, dup := k.aeads[id]; dup {
+			return nil, fmt.Errorf("%w: key %s is given twice", ErrInvalidKeyring, id)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != KeySize {
+			return nil, fmt.Errorf("%w: key %s isn't 32 bytes of base64", ErrInvalidKeyring, id)
+		}
+		block, err := aes.NewCipher(derive(key, "pesalocal column encryption"))
+		if err != nil {
+			return nil, err
+		}
+		if k.aeads[id], err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+		k.index[id] = derive(key, "pesalocal blind index")
+		k.ids = append(k.ids, id)
+	}
+	k.current = k.ids[0]
+	return k, nil
+}
+
+// Load returns the keyring given directly, or else the one in file. It is
+// nil when neither is set.
+func Load(value, file string) (*Keyring, error) {
+	if value != "" || file == "" {
+		return ParseKeyring(value)
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return ParseKeyring(string(b))
+}
+
+// NewKey returns a random key in the form ParseKeyring reads
+func NewKey(id string) (string, error) {
+	if !keyID.MatchString(id) {
+		return "", fmt.Errorf("%w: %q isn't a key id", ErrInvalidKeyring, id)
+	}
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return id + ":" + base64.StdEncoding.EncodeToString(key), nil
+}
+
+// Enabled reports whether values are encrypted
+func (k *Keyring) Enabled() bool {
+	return k != nil
+}
+
+// Current returns the id of the key values are encrypted with
+func (k *Keyring) Current() string {
+	if k == nil {
+		return ""
+	}
+	return k.current
+}
+
+// Encrypt encrypts a value to store in column ("table.column"). Empty
+// values, and every value when the keyring is nil, are stored as they are.
+func (k *Keyring) Encrypt(column, value string) (string, error) {
+	if k == nil || value == "" {
+		return value, nil
+	}
+	aead := k.aeads[k.current]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(value), []byte(column))
+	return prefix + k.current + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt reads a value stored in column. Values stored in plaintext are
+// returned as they are.
+func (k *Keyring) Decrypt(column, stored string) (string, error) {
+	id, sealed, ok := parse(stored)
+	if !ok {
+		return stored, nil
+	}
+	if k == nil || k.aeads[id] == nil {
+		return "", fmt.Errorf("%w: %s", ErrUnknownKey, id)
+	}
+	b, err := base64.RawStdEncoding.DecodeString(sealed)
+	aead := k.aeads[id]
+	if err != nil || len(b) < aead.NonceSize() {
+		return "", ErrCorrupt
+	}
+	plain, err := aead.Open(nil, b[:aead.NonceSize()], b[aead.NonceSize():], []byte(column))
+	if err != nil {
+		return "", ErrCorrupt
+	}
+	return string(plain), nil
+}
+
+// KeyID returns the id of the key a stored value is encrypted with, or ""
+// for a value in plaintext
+func KeyID(stored string) string {
+	id, _, _ := parse(stored)
+	return id
+}
+
+// Blind returns the blind index of a value under the current key, for
+// finding it by equality without decrypting every row. It is empty when
+// the keyring is nil or the value is empty.
+func (k *Keyring) Blind(column, value string) string {
+	if k == nil || value == "" {
+		return ""
+	}
+	return blind(k.index[k.current], column, value)
+}
+
+// Blinds returns the blind index of a value under every key, to look it up
+// while some rows are still indexed under an older key
+func (k *Keyring) Blinds(column, value string) []string {
+	if k == nil || value == "" {
+		return nil
+	}
+	blinds := make([]string, len(k.ids))
+	for i, id := range k.ids {
+		blinds[i] = blind(k.index[id], column, value)
+	}
+	return blinds
+}
+
+func blind(key []byte, column, value string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(column + "\x00" + value))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+func derive(key []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+func parse(stored string) (id, sealed string, ok bool) {
+	rest, ok := strings.CutPrefix(stored, prefix)
+	if !ok {
+		return "", "", false
+	}
+	return strings.Cut(rest, ":")
+}
+
+// redact keeps key material out of error messages
+func redact(entry string) string {
+	if len(entry) > 4 {
+		return entry[:4] + "..."
+	}
+	return entry
+}
@@ -0,0 +1,213 @@
+package fieldcrypt
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func testKeyring(t *testing.T, ids ...string) (*Keyring, []string) {
+	t.Helper()
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		var err error
+		if keys[i], err = NewKey(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	k, err := ParseKeyring(strings.Join(keys, ","))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k, keys
+}
+
+func TestRoundTrip(t *testing.T) {
+	k, _ := testKeyring(t, "2026-10")
+
+	tests := []struct {
+		name   string
+		column string
+		value  string
+	}{
+		{"phone", "suppliers.phone", "0712345678"},
+		{"email", "users.email", "wanjiru@example.com"},
+		{"non-ASCII", "mpesa_transactions.counterparty", "Njeri Wa Kamau – Duka la ng’ombe"},
+		{"looks encrypted", "mpesa_transactions.description", "enc1:not:really"},
+		{"long", "sync_operations.payload", strings.Repeat(`{"id":"x"}`, 1000)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stored, err := k.Encrypt(tt.column, tt.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(stored, tt.value) || KeyID(stored) != "2026-10" {
+				t.Fatalf("stored as %q", stored)
+			}
+			again, _ := k.Encrypt(tt.column, tt.value)
+			if again == stored {
+				t.Error("encrypting twice gave the same ciphertext")
+			}
+
+			got, err := k.Decrypt(tt.column, stored)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.value {
+				t.Errorf("got %q, want %q", got, tt.value)
+			}
+
+			if _, err := k.Decrypt("other.column", stored); !errors.Is(err, ErrCorrupt) {
+				t.Errorf("read from another column: got %v, want ErrCorrupt", err)
+			}
+		})
+	}
+}
+
+func TestPlaintextAndNil(t *testing.T) {
+	k, _ := testKeyring(t, "k1")
+
+	tests := []struct {
+		name   string
+		keys   *Keyring
+		value  string
+		stored string
+	}{
+		{"empty stays empty", k, "", ""},
+		{"nil keyring stores plaintext", nil, "0712345678", "0712345678"},
+		{"nil keyring, empty", nil, "", ""},
+	}
+	for _, tt := range tests {
+		stored, err := tt.keys.Encrypt("suppliers.phone", tt.value)
+		if err != nil || stored != tt.stored {
+			t.Errorf("%s: Encrypt = %q, %v; want %q", tt.name, stored, err, tt.stored)
+		}
+		if got, err := tt.keys.Decrypt("suppliers.phone", stored); err != nil || got != tt.value {
+			t.Errorf("%s: Decrypt = %q, %v; want %q", tt.name, got, err, tt.value)
+		}
+		if b := tt.keys.Blind("suppliers.phone", tt.value); tt.value == "" && b != "" {
+			t.Errorf("%s: blind index of empty value is %q", tt.name, b)
+		}
+	}
+
+	// values stored before encryption was turned on still read
+	if got, err := k.Decrypt("suppliers.phone", "0712345678"); err != nil || got != "0712345678" {
+		t.Errorf("plaintext read as %q, %v", got, err)
+	}
+}
+
+func TestRotation(t *testing.T) {
+	old, oldKeys := testKeyring(t, "old")
+	stored, err := old.Encrypt("users.email", "owner@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newKey, err := NewKey("new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := ParseKeyring(newKey + "\n" + oldKeys[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated.Current() != "new" {
+		t.Fatalf("current key %q, want new", rotated.Current())
+	}
+	if got, err := rotated.Decrypt("users.email", stored); err != nil || got != "owner@example.com" {
+		t.Errorf("old value read as %q, %v", got, err)
+	}
+	restored, _ := rotated.Encrypt("users.email", "owner@example.com")
+	if KeyID(restored) != "new" {
+		t.Errorf("re-encrypted under %q", KeyID(restored))
+	}
+
+	// blind indexes under every key find rows not yet re-indexed
+	blinds := rotated.Blinds("users.email", "owner@example.com")
+	if len(blinds) != 2 || blinds[0] != rotated.Blind("users.email", "owner@example.com") || blinds[1] != old.Blind("users.email", "owner@example.com") {
+		t.Errorf("blinds %v", blinds)
+	}
+
+	dropped, _ := testKeyring(t, "new")
+	if _, err := dropped.Decrypt("users.email", stored); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("without the old key: got %v, want ErrUnknownKey", err)
+	}
+	if _, err := (*Keyring)(nil).Decrypt("users.email", stored); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("with no keys: got %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestTampered(t *testing.T) {
+	k, _ := testKeyring(t, "k1")
+	stored, err := k.Encrypt("suppliers.account", "254712345678")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed := stored[len("enc1:k1:"):]
+	raw, err := base64.RawStdEncoding.DecodeString(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	flip := func(i int) string {
+		b := append([]byte{}, raw...)
+		b[i] ^= 1
+		return base64.RawStdEncoding.EncodeToString(b)
+	}
+
+	for _, bad := range []string{
+		"enc1:k1:" + flip(0),          // nonce
+		"enc1:k1:" + flip(len(raw)/2), // ciphertext
+		"enc1:k1:" + flip(len(raw)-1), // tag
+		"enc1:k1:" + sealed[:10],
+		"enc1:k1:!!!",
+	} {
+		if _, err := k.Decrypt("suppliers.account", bad); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("Decrypt(%q): got %v, want ErrCorrupt", bad, err)
+		}
+	}
+}
+
+func TestParseKeyring(t *testing.T) {
+	key, err := NewKey("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _ := NewKey("b")
+
+	tests := []struct {
+		name    string
+		in      string
+		current string
+		wantErr bool
+	}{
+		{"none", "  \n", "", false},
+		{"one", key, "a", false},
+		{"comma separated, first is current", other + "," + key, "b", false},
+		{"whitespace separated", key + "\n\t" + other + "\n", "a", false},
+		{"missing id", key[len("a:"):], "", true},
+		{"bad id", "a/b" + key[1:], "", true},
+		{"short key", "a:c2hvcnQ=", "", true},
+		{"duplicate id", key + "," + key, "", true},
+	}
+	for _, tt := range tests {
+		k, err := ParseKeyring(tt.in)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidKeyring) {
+				t.Errorf("%s: got %v, want ErrInvalidKeyring", tt.name, err)
+			}
+			if err != nil && strings.Contains(err.Error(), key[len("a:"):]) {
+				t.Errorf("%s: error gives away the key: %v", tt.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if k.Current() != tt.current || k.Enabled() != (tt.current != "") {
+			t.Errorf("%s: current %q enabled %v, want %q", tt.name, k.Current(), k.Enabled(), tt.current)
+		}
+	}
+}
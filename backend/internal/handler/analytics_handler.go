@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"pesalocal/internal/model"
+	"pesalocal/internal/service"
+)
+
+type AnalyticsHandler struct {
+	analyticsService *service.AnalyticsService
+}
+
+func NewAnalyticsHandler(analyticsService *service.AnalyticsService) *AnalyticsHandler {
+	return &AnalyticsHandler{
+		analyticsService: analyticsService,
+	}
+}
+
+// GET /reports/sales/series?bucket=day[&from=&to=&product_id=&category=&user_id=&device_id=&compare=previous|year]
+// Without from/to, a range suited to the bucket ending now.
+func (h *AnalyticsHandler) SalesSeries(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	bucket := q.Get("bucket")
+	if bucket == "" {
+		bucket = model.BucketDay
+	}
+	if !model.ValidBucket(bucket) {
+		http.Error(w, service.ErrInvalidBucket.Error(), http.StatusBadRequest)
+		return
+	}
+
+	defFrom, defTo := service.DefaultSeriesRange(bucket, time.Now())
+	from, err := parseTimeParam(r, "from", defFrom)
+	if err != nil {
+		http.Error(w, "invalid from", http.StatusBadRequest)
+		return
+	}
+	to, err := parseTimeParam(r, "to", defTo)
+	if err != nil {
+		http.Error(w, "invalid to", http.StatusBadRequest)
+		return
+	}
+	if v := q.Get("to"); len(v) == len("2006-01-02") {
+		to = to.AddDate(0, 0, 1) // include the whole day
+	}
+
+	filter := model.SeriesFilter{
+		ProductID: q.Get("product_id"),
+		Category:  q.Get("category"),
+		UserID:    q.Get("user_id"),
+		DeviceID:  q.Get("device_id"),
+	}
+	series, err := h.analyticsService.GetSalesSeries(bucket, from, to, filter, q.Get("compare"))
+	switch {
+	case errors.Is(err, service.ErrInvalidCompare), errors.Is(err, service.ErrInvalidRange), errors.Is(err, service.ErrSeriesTooLong):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		writeJSON(w, http.StatusOK, series)
+	}
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"pesalocal/internal/service"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type BackupHandler struct {
+	backupService *service.BackupService
+}
+
+func NewBackupHandler(backupService *service.BackupService) *BackupHandler {
+	return &BackupHandler{
+		backupService: backupService,
+	}
+}
+
+// GET /backups
+func (h *BackupHandler) List(w http.ResponseWriter, r *http.Request) {
+	backups, err := h.backupService.GetBackups()
+	if err != nil {
+		writeBackupError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, backups)
+}
+
+// POST /backups
+// Backs up now, as the scheduled job does.
+func (h *BackupHandler) Create(w http.ResponseWriter, r *http.Request) {
+	b, err := h.backupService.CreateBackup()
+	if err != nil {
+		writeBackupError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, b)
+}
+
+// GET /backups/{name}
+// Downloads an archive, to keep a copy off the device.
+func (h *BackupHandler) Download(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	path, err := h.backupService.BackupPath(name)
+	if err != nil {
+		writeBackupError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	http.ServeFile(w, r, path)
+}
+
+func writeBackupError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrBackupNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrBackupsDisabled):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"pesalocal/internal/daraja"
+	"pesalocal/internal/service"
+)
+
+type DarajaHandler struct {
+	darajaService *service.DarajaService
+	secret        string
+}
+
+func NewDarajaHandler(darajaService *service.DarajaService, secret string) *DarajaHandler {
+	return &DarajaHandler{
+		darajaService: darajaService,
+		secret:        secret,
+	}
+}
+
+// RequireSecret rejects callbacks that don't carry the shared secret.
+// Daraja callback URLs can't set headers, so the secret is accepted in the
+// "secret" query parameter as well as the X-Webhook-Secret header.
+func (h *DarajaHandler) RequireSecret(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.secret == "" {
+			http.Error(w, "webhook secret not configured", http.StatusServiceUnavailable)
+			return
+		}
+		given := r.Header.Get("X-Webhook-Secret")
+		if given == "" {
+			given = r.URL.Query().Get("secret")
+		}
+		if subtle.ConstantTimeCompare([]byte(given), []byte(h.secret)) != 1 {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// POST /daraja/c2b/validation
+func (h *DarajaHandler) C2BValidation(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var req daraja.C2BRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusOK, &daraja.C2BResponse{ResultCode: daraja.ResultOtherError, ResultDesc: "Rejected"})
+		return
+	}
+	writeJSON(w, http.StatusOK, h.darajaService.ValidateC2B(&req))
+}
+
+// POST /daraja/c2b/confirmation
+func (h *DarajaHandler) C2BConfirmation(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var req daraja.C2BRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.darajaService.ConfirmC2B(&req)
+	if err != nil {
+		log.Printf("daraja: C2B confirmation %s: %v", req.TransID, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	logPayment(result)
+	writeJSON(w, http.StatusOK, &daraja.C2BResponse{ResultCode: daraja.ResultAccepted, ResultDesc: "Success"})
+}
+
+// POST /daraja/stk/callback
+func (h *DarajaHandler) STKCallback(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var cb daraja.STKCallback
+	if err := json.NewDecoder(r.Body).Decode(&cb); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.darajaService.ConfirmSTK(&cb)
+	if err != nil {
+		// Daraja only needs an acknowledgement for cancelled pushes
+		if errors.Is(err, daraja.ErrPaymentFailed) {
+			log.Printf("daraja: %v", err)
+			writeJSON(w, http.StatusOK, &daraja.C2BResponse{ResultCode: daraja.ResultAccepted, ResultDesc: "Success"})
+			return
+		}
+		log.Printf("daraja: STK callback: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	logPayment(result)
+	writeJSON(w, http.StatusOK, &daraja.C2BResponse{ResultCode: daraja.ResultAccepted, ResultDesc: "Success"})
+}
+
+func logPayment(result *service.PaymentResult) {
+	switch {
+	case result.Duplicate:
+		log.Printf("daraja: %s already recorded", result.Transaction.ReceiptNo)
+	case result.Sale != nil:
+		log.Printf("daraja: %s matched to sale %s", result.Transaction.ReceiptNo, result.Sale.ID)
+	default:
+		log.Printf("daraja: %s recorded, no matching sale", result.Transaction.ReceiptNo)
+	}
+}
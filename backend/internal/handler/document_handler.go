@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"pesalocal/internal/document"
+	"pesalocal/internal/model"
+	"pesalocal/internal/repo"
+	"pesalocal/internal/service"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type DocumentHandler struct {
+	documentService *service.DocumentService
+}
+
+func NewDocumentHandler(documentService *service.DocumentService) *DocumentHandler {
+	return &DocumentHandler{
+		documentService: documentService,
+	}
+}
+
+// GET /sales/{id}/receipt[?format=text|pdf|escpos&width=58|80&kind=receipt|invoice|iou]
+// Plain text for an 80mm roll unless asked otherwise; escpos is the byte
+// stream to send to a thermal printer as is.
+func (h *DocumentHandler) SaleReceipt(w http.ResponseWriter, r *http.Request) {
+	d, err := h.documentService.SaleDocument(chi.URLParam(r, "id"), r.URL.Query().Get("kind"))
+	if err != nil {
+		writeDocumentError(w, err)
+		return
+	}
+	writeDocument(w, r, d)
+}
+
+// POST /quotes[?format=text|pdf|escpos&width=58|80]
+// Body: {"sale": {...}, "items": [...]} as for a sale; nothing is sold.
+func (h *DocumentHandler) Quote(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var req struct {
+		Sale  model.Sale        `json:"sale"`
+		Items []*model.SaleItem `json:"items"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	d, err := h.documentService.QuoteDocument(&req.Sale, req.Items)
+	if err != nil {
+		writeDocumentError(w, err)
+		return
+	}
+	writeDocument(w, r, d)
+}
+
+// writeDocument renders a document in the format and width the query asks
+// for
+func writeDocument(w http.ResponseWriter, r *http.Request, d *document.Document) {
+	q := r.URL.Query()
+	width := document.Width80
+	switch q.Get("width") {
+	case "", "80":
+	case "58":
+		width = document.Width58
+	default:
+		http.Error(w, "width must be 58 or 80", http.StatusBadRequest)
+		return
+	}
+
+	var buf bytes.Buffer
+	var err error
+	switch q.Get("format") {
+	case "", document.FormatText:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		err = document.RenderText(&buf, d, width)
+	case document.FormatPDF:
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", `inline; filename="`+d.Kind+"-"+d.Number+`.pdf"`)
+		err = document.RenderPDF(&buf, d)
+	case document.FormatESCPOS:
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+d.Kind+"-"+d.Number+`.bin"`)
+		err = document.RenderESCPOS(&buf, d, width)
+	default:
+		http.Error(w, "format must be text, pdf or escpos", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		w.Header().Del("Content-Disposition")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+func writeDocumentError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrSaleNotFound), errors.Is(err, repo.ErrProductNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrInvalidDocumentKind), errors.Is(err, service.ErrInvalidDiscount),
+		errors.Is(err, service.ErrDiscountNotAllowed), errors.Is(err, service.ErrUnknownConversion):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
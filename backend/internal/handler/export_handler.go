@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"pesalocal/internal/export"
+	"pesalocal/internal/service"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type ExportHandler struct {
+	exportService *service.ExportService
+}
+
+func NewExportHandler(exportService *service.ExportService) *ExportHandler {
+	return &ExportHandler{
+		exportService: exportService,
+	}
+}
+
+// GET /export/{name}[?format=csv|xlsx&from=&to=]
+// name is sales, purchases or products. The file is streamed as it is
+// read, so a failure part way through can only cut it short.
+func (h *ExportHandler) Export(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	if !service.ValidExport(name) {
+		http.Error(w, service.ErrInvalidExport.Error(), http.StatusNotFound)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = export.FormatCSV
+	}
+	if format != export.FormatCSV && format != export.FormatXLSX {
+		http.Error(w, export.ErrInvalidFormat.Error(), http.StatusBadRequest)
+		return
+	}
+	from, to, err := parseDateRange(r)
+	if err != nil {
+		http.Error(w, "invalid date range", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", export.ContentType(format))
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+"."+format+`"`)
+	if err := h.exportService.Export(w, name, format, from, to); err != nil {
+		log.Printf("export %s: %v", name, err)
+	}
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"pesalocal/internal/service"
+	"pesalocal/internal/tariff"
+)
+
+type FeeHandler struct {
+	feeService *service.FeeService
+}
+
+func NewFeeHandler(feeService *service.FeeService) *FeeHandler {
+	return &FeeHandler{
+		feeService: feeService,
+	}
+}
+
+// GET /mpesa/tariffs
+func (h *FeeHandler) Tariffs(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.feeService.GetTariffs())
+}
+
+// GET /mpesa/fees?type=Send%20Money&amount=1000[&at=2024-03-01]
+func (h *FeeHandler) Compute(w http.ResponseWriter, r *http.Request) {
+	amount, err := strconv.ParseFloat(r.URL.Query().Get("amount"), 64)
+	if err != nil {
+		http.Error(w, "invalid amount", http.StatusBadRequest)
+		return
+	}
+	at, err := parseTimeParam(r, "at", time.Now())
+	if err != nil {
+		http.Error(w, "invalid time", http.StatusBadRequest)
+		return
+	}
+
+	quote, err := h.feeService.ComputeFee(r.URL.Query().Get("type"), amount, at)
+	if err != nil {
+		if errors.Is(err, tariff.ErrNoTariff) || errors.Is(err, tariff.ErrUnknownType) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, quote)
+}
+
+// GET /mpesa/fees/audit[?from=2024-01-01&to=2024-01-31]
+func (h *FeeHandler) Audit(w http.ResponseWriter, r *http.Request) {
+	from, to, err := parseDateRange(r)
+	if err != nil {
+		http.Error(w, "invalid date range", http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.feeService.AuditFees(from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
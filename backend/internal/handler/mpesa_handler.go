@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"pesalocal/internal/mpesa"
+	"pesalocal/internal/service"
+)
+
+// Uploaded statements are small; cap them well above a year of history
+const maxImportSize = 10 << 20
+
+type MpesaHandler struct {
+	mpesaService *service.MpesaService
+}
+
+func NewMpesaHandler(mpesaService *service.MpesaService) *MpesaHandler {
+	return &MpesaHandler{
+		mpesaService: mpesaService,
+	}
+}
+
+// POST /mpesa/import?format=csv|statement|sms
+// Accepts the export as the raw request body or as a multipart "file" field.
+// The format is detected from the content when not given.
+func (h *MpesaHandler) Import(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	body, ok := uploadBody(w, r, maxImportSize)
+	if !ok {
+		return
+	}
+	defer body.Close()
+
+	summary, err := h.mpesaService.Import(r.URL.Query().Get("format"), body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.Is(err, mpesa.ErrUnknownFormat):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.As(err, &tooLarge):
+			http.Error(w, "file too large", http.StatusRequestEntityTooLarge)
+		default:
+			http.Error(w, "import failed: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, summary)
+}
+
+// GET /mpesa/transactions
+func (h *MpesaHandler) List(w http.ResponseWriter, r *http.Request) {
+	txs, err := h.mpesaService.GetAllTransactions()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, txs)
+}
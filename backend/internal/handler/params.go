@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// farFuture is the open end of a date range
+var farFuture = time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// parseTimeParam reads a query parameter as an RFC 3339 time or a
+// YYYY-MM-DD date. Missing parameters return def.
+func parseTimeParam(r *http.Request, name string, def time.Time) (time.Time, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", v, time.Local)
+}
+
+// parseDateRange reads the from/to query parameters. A "to" date without a
+// time includes that whole day.
+func parseDateRange(r *http.Request) (time.Time, time.Time, error) {
+	from, err := parseTimeParam(r, "from", time.Time{})
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	to, err := parseTimeParam(r, "to", farFuture)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if v := r.URL.Query().Get("to"); len(v) == len("2006-01-02") {
+		to = to.AddDate(0, 0, 1)
+	}
+	return from, to, nil
+}
+
+// multipartOverhead allows for the form's boundaries and headers on top of
+// the file itself
+const multipartOverhead = 64 << 10
+
+// uploadBody returns an uploaded file: the raw request body, or the "file"
+// field of a multipart form. Either way no more than maxSize is read from
+// the client. It writes the error response and returns false when there
+// is no file or the form is too large.
+func uploadBody(w http.ResponseWriter, r *http.Request, maxSize int64) (io.ReadCloser, bool) {
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		return http.MaxBytesReader(w, r.Body, maxSize), true
+	}
+	// ParseMultipartForm only bounds the memory it uses; larger forms
+	// spill to temporary files unless the body itself is capped
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+multipartOverhead)
+	if err := r.ParseMultipartForm(maxSize); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "file too large", http.StatusRequestEntityTooLarge)
+		} else {
+			http.Error(w, "invalid upload", http.StatusBadRequest)
+		}
+		return nil, false
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "missing file", http.StatusBadRequest)
+		return nil, false
+	}
+	return file, true
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"pesalocal/internal/model"
+	"pesalocal/internal/repo"
+	"pesalocal/internal/service"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type PriceHandler struct {
+	priceService *service.PriceService
+}
+
+func NewPriceHandler(priceService *service.PriceService) *PriceHandler {
+	return &PriceHandler{
+		priceService: priceService,
+	}
+}
+
+// GET /products/{id}/prices[?from=&to=]
+// Price changes over the range next to the average cost of purchases.
+func (h *PriceHandler) History(w http.ResponseWriter, r *http.Request) {
+	from, to, err := parseDateRange(r)
+	if err != nil {
+		http.Error(w, "invalid date range", http.StatusBadRequest)
+		return
+	}
+	history, err := h.priceService.GetPriceHistory(chi.URLParam(r, "id"), from, to)
+	if err != nil {
+		writePriceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, history)
+}
+
+// POST /products/{id}/prices
+// {"price": 120, "effective_at": "...", "changed_by": "user-id"}; without
+// a future effective_at the price changes immediately.
+func (h *PriceHandler) Set(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var c model.PriceChange
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	c.ProductID = chi.URLParam(r, "id")
+	if err := h.priceService.SetPrice(&c); err != nil {
+		writePriceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, c)
+}
+
+// POST /price-changes/{id}/cancel
+func (h *PriceHandler) Cancel(w http.ResponseWriter, r *http.Request) {
+	c, err := h.priceService.CancelPriceChange(chi.URLParam(r, "id"))
+	if err != nil {
+		writePriceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, c)
+}
+
+func writePriceError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrPriceChangeNotFound), errors.Is(err, repo.ErrProductNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrPriceChangeClosed), errors.Is(err, repo.ErrProductConflict):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, service.ErrInvalidPrice):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
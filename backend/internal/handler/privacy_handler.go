@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"pesalocal/internal/model"
+	"pesalocal/internal/service"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type PrivacyHandler struct {
+	privacyService *service.PrivacyService
+	adminKey       string
+}
+
+func NewPrivacyHandler(privacyService *service.PrivacyService, adminKey string) *PrivacyHandler {
+	return &PrivacyHandler{
+		privacyService: privacyService,
+		adminKey:       adminKey,
+	}
+}
+
+// RequireAdminKey rejects requests that don't carry the server's admin
+// key in the X-Admin-Key header. Erasure can't be undone, so without a
+// key configured it is turned off.
+func (h *PrivacyHandler) RequireAdminKey(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.adminKey == "" {
+			http.Error(w, "admin key not configured", http.StatusServiceUnavailable)
+			return
+		}
+		given := r.Header.Get("X-Admin-Key")
+		if subtle.ConstantTimeCompare([]byte(given), []byte(h.adminKey)) != 1 {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type erasureRequest struct {
+	RequestedBy string `json:"requested_by"`
+	Reason      string `json:"reason"`
+	Confirm     string `json:"confirm"` // shop erasure only
+}
+
+// GET /privacy/users/{id}/export
+// Everything held about a user, as a JSON download.
+func (h *PrivacyHandler) ExportUser(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	h.export(w, "user-"+id, func(w http.ResponseWriter) error {
+		return h.privacyService.ExportUser(w, id)
+	})
+}
+
+// GET /privacy/shop/export
+// Every table, as a JSON download.
+func (h *PrivacyHandler) ExportShop(w http.ResponseWriter, r *http.Request) {
+	h.export(w, "shop", func(w http.ResponseWriter) error {
+		return h.privacyService.ExportShop(w)
+	})
+}
+
+// export streams an export once it is known there is something to send;
+// a failure part way through can only cut it short
+func (h *PrivacyHandler) export(w http.ResponseWriter, name string, write func(http.ResponseWriter) error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="pesalocal-`+name+`.json"`)
+	err := write(w)
+	if errors.Is(err, service.ErrSubjectNotFound) {
+		w.Header().Del("Content-Disposition")
+		writePrivacyError(w, err)
+		return
+	}
+	if err != nil {
+		log.Printf("privacy export %s: %v", name, err)
+	}
+}
+
+// POST /privacy/users/{id}/erase, with the admin key
+// Body: {"requested_by": "user-id", "reason": "..."}
+func (h *PrivacyHandler) EraseUser(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var req erasureRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	e, err := h.privacyService.EraseUser(chi.URLParam(r, "id"), req.RequestedBy, req.Reason)
+	if err != nil {
+		writeErasureError(w, e, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, e)
+}
+
+// POST /privacy/shop/erase, with the admin key
+// Body: {"requested_by": "user-id", "reason": "...", "confirm": "erase all shop data"}
+// Deletes everything but the erasure log.
+func (h *PrivacyHandler) EraseShop(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var req erasureRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	e, err := h.privacyService.EraseShop(req.RequestedBy, req.Reason, req.Confirm)
+	if err != nil {
+		writeErasureError(w, e, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, e)
+}
+
+// GET /privacy/erasures
+func (h *PrivacyHandler) Erasures(w http.ResponseWriter, r *http.Request) {
+	erasures, err := h.privacyService.GetErasures()
+	if err != nil {
+		writePrivacyError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, erasures)
+}
+
+// writeErasureError reports a failed erasure. One that ran but left data
+// behind was still logged; its record says what was removed.
+func writeErasureError(w http.ResponseWriter, e *model.Erasure, err error) {
+	if errors.Is(err, service.ErrErasureNotCompleted) && e != nil {
+		writeJSON(w, http.StatusInternalServerError, e)
+		return
+	}
+	writePrivacyError(w, err)
+}
+
+func writePrivacyError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrSubjectNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrErasureNotConfirmed), errors.Is(err, service.ErrErasureRequestedBy):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"pesalocal/internal/model"
+	"pesalocal/internal/service"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Wholesalers' price lists run to tens of thousands of rows
+const maxProductImportSize = 32 << 20
+
+type ProductHandler struct {
+	productService *service.ProductService
+}
+
+func NewProductHandler(productService *service.ProductService) *ProductHandler {
+	return &ProductHandler{
+		productService: productService,
+	}
+}
+
+// GET /products[?q=tomato&category=Vegetables]
+// q matches name, category or barcode.
+func (h *ProductHandler) List(w http.ResponseWriter, r *http.Request) {
+	products, err := h.productService.SearchProducts(r.URL.Query().Get("q"), r.URL.Query().Get("category"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, products)
+}
+
+// POST /products/import[?dry_run=true&user_id=]
+// Accepts a CSV as the raw request body or as a multipart "file" field,
+// with a header row naming its columns: name, category, unit, price, cost,
+// stock, barcode, supplier. If any row has errors nothing is imported and
+// the response is 422 with the errors by row.
+func (h *ProductHandler) Import(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	dryRun := false
+	if v := r.URL.Query().Get("dry_run"); v != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(v); err != nil {
+			http.Error(w, "dry_run must be true or false", http.StatusBadRequest)
+			return
+		}
+	}
+	body, ok := uploadBody(w, r, maxProductImportSize)
+	if !ok {
+		return
+	}
+	defer body.Close()
+
+	result, err := h.productService.ImportProducts(body, dryRun, r.URL.Query().Get("user_id"))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.Is(err, service.ErrInvalidImport):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.As(err, &tooLarge):
+			http.Error(w, "file too large", http.StatusRequestEntityTooLarge)
+		default:
+			http.Error(w, "import failed: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	status := http.StatusOK
+	if !dryRun && len(result.Errors) > 0 {
+		status = http.StatusUnprocessableEntity
+	}
+	writeJSON(w, status, result)
+}
+
+// GET /products/{id}
+func (h *ProductHandler) Get(w http.ResponseWriter, r *http.Request) {
+	product, err := h.productService.GetProduct(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if product == nil {
+		http.Error(w, "product not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, product)
+}
+
+// GET /products/barcode/{barcode}
+func (h *ProductHandler) GetByBarcode(w http.ResponseWriter, r *http.Request) {
+	product, err := h.productService.GetProductByBarcode(chi.URLParam(r, "barcode"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if product == nil {
+		http.Error(w, "product not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, product)
+}
+
+// GET /categories
+func (h *ProductHandler) Categories(w http.ResponseWriter, r *http.Request) {
+	categories, err := h.productService.GetAllCategories()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, categories)
+}
+
+// POST /categories
+func (h *ProductHandler) SaveCategory(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var c model.Category
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil || c.Name == "" {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	if err := h.productService.CreateOrUpdateCategory(&c); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, c)
+}
+
+// GET /units/conversions
+func (h *ProductHandler) UnitConversions(w http.ResponseWriter, r *http.Request) {
+	conversions, err := h.productService.GetAllUnitConversions()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, conversions)
+}
+
+// POST /units/conversions
+func (h *ProductHandler) SaveUnitConversion(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var c model.UnitConversion
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	err := h.productService.CreateOrUpdateUnitConversion(&c)
+	if errors.Is(err, service.ErrInvalidConversion) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, c)
+}
+
+// GET /products/{id}/movements
+func (h *ProductHandler) Movements(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	product, err := h.productService.GetProduct(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if product == nil {
+		http.Error(w, "product not found", http.StatusNotFound)
+		return
+	}
+
+	movements, err := h.productService.GetStockMovements(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"product":   product,
+		"movements": movements,
+	})
+}
+
+// GET /products/{id}/batches
+func (h *ProductHandler) Batches(w http.ResponseWriter, r *http.Request) {
+	batches, err := h.productService.GetBatches(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, batches)
+}
+
+// GET /batches/expiring[?days=3]
+// Lists batches expiring within the window and stock that has already expired.
+func (h *ProductHandler) Expiring(w http.ResponseWriter, r *http.Request) {
+	days := 3
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid days", http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+
+	report, err := h.productService.GetExpiryReport(days)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// POST /batches/{id}/write-off
+// Body (optional): {"reason": "spoiled", "device_id": "..."}
+func (h *ProductHandler) WriteOff(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var req struct {
+		Reason   string `json:"reason"`
+		DeviceID string `json:"device_id"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid payload", http.StatusBadRequest)
+			return
+		}
+	}
+
+	m, err := h.productService.WriteOffBatch(chi.URLParam(r, "id"), req.Reason, req.DeviceID)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrBatchNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, service.ErrInsufficientStock):
+			http.Error(w, "batch has no stock left", http.StatusConflict)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	writeJSON(w, http.StatusOK, m)
+}
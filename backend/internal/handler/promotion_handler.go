@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"pesalocal/internal/model"
+	"pesalocal/internal/service"
+)
+
+type PromotionHandler struct {
+	promotionService *service.PromotionService
+}
+
+func NewPromotionHandler(promotionService *service.PromotionService) *PromotionHandler {
+	return &PromotionHandler{
+		promotionService: promotionService,
+	}
+}
+
+// GET /promotions
+func (h *PromotionHandler) List(w http.ResponseWriter, r *http.Request) {
+	promotions, err := h.promotionService.GetAllPromotions()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, promotions)
+}
+
+// POST /promotions
+// Creates a promotion, or edits one when the version is newer.
+func (h *PromotionHandler) Save(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var p model.Promotion
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	err := h.promotionService.CreateOrUpdatePromotion(&p)
+	switch {
+	case errors.Is(err, service.ErrInvalidPromotion):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		writeJSON(w, http.StatusOK, p)
+	}
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"pesalocal/internal/service"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type ReceiptHandler struct {
+	receiptService *service.ReceiptService
+}
+
+func NewReceiptHandler(receiptService *service.ReceiptService) *ReceiptHandler {
+	return &ReceiptHandler{
+		receiptService: receiptService,
+	}
+}
+
+// GET /devices/{id}/receipt-ranges
+func (h *ReceiptHandler) Ranges(w http.ResponseWriter, r *http.Request) {
+	ranges, err := h.receiptService.GetRanges(chi.URLParam(r, "id"))
+	if err != nil {
+		writeReceiptError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, ranges)
+}
+
+// POST /devices/{id}/receipt-ranges
+// Body (optional): {"size": 500}
+func (h *ReceiptHandler) Allocate(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var req struct {
+		Size int64 `json:"size"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid payload", http.StatusBadRequest)
+			return
+		}
+	}
+	rr, err := h.receiptService.AllocateRange(chi.URLParam(r, "id"), req.Size)
+	if err != nil {
+		writeReceiptError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, rr)
+}
+
+// GET /receipts/audit[?device_id=]
+func (h *ReceiptHandler) Audit(w http.ResponseWriter, r *http.Request) {
+	audit, err := h.receiptService.Audit(r.URL.Query().Get("device_id"))
+	if err != nil {
+		writeReceiptError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, audit)
+}
+
+func writeReceiptError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrDeviceRequired), errors.Is(err, service.ErrInvalidRangeSize):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
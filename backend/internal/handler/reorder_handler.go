@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"pesalocal/internal/service"
+)
+
+type ReorderHandler struct {
+	reorderService *service.ReorderService
+}
+
+func NewReorderHandler(reorderService *service.ReorderService) *ReorderHandler {
+	return &ReorderHandler{
+		reorderService: reorderService,
+	}
+}
+
+// GET /stock/alerts[?window=28&cover=7]
+// window: days of sales used for velocity; cover: days an order should last
+// after delivery.
+func (h *ReorderHandler) Alerts(w http.ResponseWriter, r *http.Request) {
+	window, err := intParam(r, "window", service.DefaultVelocityWindow)
+	if err != nil || window <= 0 {
+		http.Error(w, "invalid window", http.StatusBadRequest)
+		return
+	}
+	cover, err := intParam(r, "cover", service.DefaultCoverDays)
+	if err != nil || cover < 0 {
+		http.Error(w, "invalid cover", http.StatusBadRequest)
+		return
+	}
+
+	suggestions, err := h.reorderService.GetSuggestions(window, cover)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, suggestions)
+}
+
+func intParam(r *http.Request, name string, def int) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	return strconv.Atoi(v)
+}
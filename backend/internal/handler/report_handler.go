@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"pesalocal/internal/model"
+	"pesalocal/internal/service"
+)
+
+type ReportHandler struct {
+	reportService *service.ReportService
+}
+
+func NewReportHandler(reportService *service.ReportService) *ReportHandler {
+	return &ReportHandler{
+		reportService: reportService,
+	}
+}
+
+// GET /reports/margin/sales[?from=&to=]
+func (h *ReportHandler) SaleMargins(w http.ResponseWriter, r *http.Request) {
+	h.margins(w, r, h.reportService.GetSaleMargins)
+}
+
+// GET /reports/margin/products[?from=&to=]
+func (h *ReportHandler) ProductMargins(w http.ResponseWriter, r *http.Request) {
+	h.margins(w, r, h.reportService.GetProductMargins)
+}
+
+// GET /reports/margin/daily[?from=&to=]
+func (h *ReportHandler) DailyMargins(w http.ResponseWriter, r *http.Request) {
+	h.margins(w, r, h.reportService.GetDailyMargins)
+}
+
+func (h *ReportHandler) margins(w http.ResponseWriter, r *http.Request, get func(from, to time.Time) (*model.MarginReport, error)) {
+	from, to, err := parseDateRange(r)
+	if err != nil {
+		http.Error(w, "invalid date range", http.StatusBadRequest)
+		return
+	}
+	report, err := get(from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// GET /reports/promotions[?from=&to=]
+func (h *ReportHandler) Promotions(w http.ResponseWriter, r *http.Request) {
+	from, to, err := parseDateRange(r)
+	if err != nil {
+		http.Error(w, "invalid date range", http.StatusBadRequest)
+		return
+	}
+	usage, err := h.reportService.GetPromotionUsage(from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, usage)
+}
+
+// GET /reports/discounts/flagged[?from=&to=]
+func (h *ReportHandler) FlaggedDiscounts(w http.ResponseWriter, r *http.Request) {
+	from, to, err := parseDateRange(r)
+	if err != nil {
+		http.Error(w, "invalid date range", http.StatusBadRequest)
+		return
+	}
+	flagged, err := h.reportService.GetFlaggedDiscounts(from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, flagged)
+}
+
+// GET /reports/z?date=YYYY-MM-DD[&device_id=&opening_float=]
+// Without a date, today's report so far.
+func (h *ReportHandler) ZReport(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	date := q.Get("date")
+	if date == "" {
+		date = time.Now().Format("2006-01-02")
+	}
+	var openingFloat *float64
+	if v := q.Get("opening_float"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			http.Error(w, "invalid opening_float", http.StatusBadRequest)
+			return
+		}
+		openingFloat = &f
+	}
+
+	report, err := h.reportService.GetZReport(date, q.Get("device_id"), openingFloat)
+	if err != nil {
+		writeReportError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// GET /reports/z/closes[?from=YYYY-MM-DD&to=YYYY-MM-DD]
+func (h *ReportHandler) DayCloses(w http.ResponseWriter, r *http.Request) {
+	from, to := r.URL.Query().Get("from"), r.URL.Query().Get("to")
+	if to == "" {
+		to = "9999-12-31"
+	}
+	closes, err := h.reportService.GetDayCloses(from, to)
+	if err != nil {
+		writeReportError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, closes)
+}
+
+// POST /reports/z/close
+// {"date": "2024-05-01", "device_id": "", "opening_float": 2000, "counted_cash": 15350, "closed_by": "user-id"}
+func (h *ReportHandler) CloseDay(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var c model.DayClose
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	report, err := h.reportService.CloseDay(&c)
+	if err != nil {
+		writeReportError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, report)
+}
+
+// POST /reports/z/adjustments
+func (h *ReportHandler) AddAdjustment(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var a model.DayAdjustment
+	if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	if err := h.reportService.AddDayAdjustment(&a); err != nil {
+		writeReportError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, a)
+}
+
+func writeReportError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrDayClosed), errors.Is(err, service.ErrDayNotClosed):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, service.ErrInvalidDate), errors.Is(err, service.ErrInvalidDayAdjustment):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"pesalocal/internal/model"
+	"pesalocal/internal/service"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type ReturnHandler struct {
+	returnService *service.ReturnService
+}
+
+func NewReturnHandler(returnService *service.ReturnService) *ReturnHandler {
+	return &ReturnHandler{
+		returnService: returnService,
+	}
+}
+
+// POST /sales/{id}/returns
+// Without items, everything not yet returned comes back.
+func (h *ReturnHandler) Create(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var ret model.Return
+	if err := json.NewDecoder(r.Body).Decode(&ret); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	ret.SaleID = chi.URLParam(r, "id")
+	if err := h.returnService.CreateReturn(&ret); err != nil {
+		writeReturnError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, ret)
+}
+
+// GET /sales/{id}/returns
+func (h *ReturnHandler) ForSale(w http.ResponseWriter, r *http.Request) {
+	returns, err := h.returnService.GetSaleReturns(chi.URLParam(r, "id"))
+	if err != nil {
+		writeReturnError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, returns)
+}
+
+// GET /returns?from=&to=
+func (h *ReturnHandler) List(w http.ResponseWriter, r *http.Request) {
+	from, to, err := parseDateRange(r)
+	if err != nil {
+		http.Error(w, "invalid date range", http.StatusBadRequest)
+		return
+	}
+	returns, err := h.returnService.GetReturns(from, to)
+	if err != nil {
+		writeReturnError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, returns)
+}
+
+// GET /returns/{id}
+func (h *ReturnHandler) Get(w http.ResponseWriter, r *http.Request) {
+	ret, err := h.returnService.GetReturn(chi.URLParam(r, "id"))
+	if err != nil {
+		writeReturnError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, ret)
+}
+
+func writeReturnError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrSaleNotFound), errors.Is(err, service.ErrReturnNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrReturnExceedsSale), errors.Is(err, service.ErrSaleNotPaid):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, service.ErrInvalidReturn), errors.Is(err, service.ErrInvalidDisposition), errors.Is(err, service.ErrInvalidRefundMethod):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"pesalocal/internal/model"
+	"pesalocal/internal/repo"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type SettingsHandler struct {
+	settingsRepo *repo.SettingsRepo
+}
+
+func NewSettingsHandler(settingsRepo *repo.SettingsRepo) *SettingsHandler {
+	return &SettingsHandler{
+		settingsRepo: settingsRepo,
+	}
+}
+
+// GET /settings
+func (h *SettingsHandler) List(w http.ResponseWriter, r *http.Request) {
+	settings, err := h.settingsRepo.GetAll()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, settings)
+}
+
+// PUT /settings/{key}
+// Body: {"value": "10"}
+func (h *SettingsHandler) Set(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var req struct {
+		Value string `json:"value"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	key := chi.URLParam(r, "key")
+	if key == model.SettingCostingMethod && !model.ValidCostingMethod(req.Value) {
+		http.Error(w, "costing_method must be average or fifo", http.StatusBadRequest)
+		return
+	}
+	if key == model.SettingCashierDiscountLimit {
+		if limit, err := strconv.ParseFloat(req.Value, 64); err != nil || limit < 0 || limit > 100 {
+			http.Error(w, "cashier_discount_limit must be a percentage from 0 to 100", http.StatusBadRequest)
+			return
+		}
+	}
+	if err := h.settingsRepo.Set(key, req.Value); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{key: req.Value})
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"pesalocal/internal/model"
+	"pesalocal/internal/repo"
+	"pesalocal/internal/service"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type StockTakeHandler struct {
+	stockTakeService *service.StockTakeService
+}
+
+func NewStockTakeHandler(stockTakeService *service.StockTakeService) *StockTakeHandler {
+	return &StockTakeHandler{
+		stockTakeService: stockTakeService,
+	}
+}
+
+// POST /stock-takes
+func (h *StockTakeHandler) Open(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var t model.StockTake
+	if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	if err := h.stockTakeService.OpenStockTake(&t); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusCreated, t)
+}
+
+// GET /stock-takes
+func (h *StockTakeHandler) List(w http.ResponseWriter, r *http.Request) {
+	takes, err := h.stockTakeService.GetAllStockTakes()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, takes)
+}
+
+// GET /stock-takes/{id}
+// Returns the session, its counts and the variances against current stock.
+func (h *StockTakeHandler) Get(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	t, counts, err := h.stockTakeService.GetStockTake(id)
+	if err != nil {
+		writeStockTakeError(w, err)
+		return
+	}
+	variances, err := h.stockTakeService.GetVariances(id)
+	if err != nil {
+		writeStockTakeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"stock_take": t,
+		"counts":     counts,
+		"variances":  variances,
+	})
+}
+
+// POST /stock-takes/{id}/counts
+func (h *StockTakeHandler) RecordCounts(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var counts []*model.StockCount
+	if err := json.NewDecoder(r.Body).Decode(&counts); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	if err := h.stockTakeService.RecordCounts(chi.URLParam(r, "id"), counts); err != nil {
+		writeStockTakeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// POST /stock-takes/{id}/commit
+func (h *StockTakeHandler) Commit(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var req service.CommitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	adjustments, err := h.stockTakeService.CommitStockTake(chi.URLParam(r, "id"), &req)
+	if err != nil {
+		writeStockTakeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":      model.StockTakeCommitted,
+		"adjustments": adjustments,
+	})
+}
+
+// POST /stock-takes/{id}/cancel
+func (h *StockTakeHandler) Cancel(w http.ResponseWriter, r *http.Request) {
+	if err := h.stockTakeService.CancelStockTake(chi.URLParam(r, "id")); err != nil {
+		writeStockTakeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": model.StockTakeCancelled})
+}
+
+// POST /products/{id}/adjustments
+// Body: {"quantity": -3, "reason": "damaged", "device_id": "..."}
+func (h *StockTakeHandler) Adjust(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var m model.StockMovement
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	m.ProductID = chi.URLParam(r, "id")
+	if m.Quantity == 0 {
+		http.Error(w, "quantity must not be zero", http.StatusBadRequest)
+		return
+	}
+	if err := h.stockTakeService.AdjustStock(&m); err != nil {
+		writeStockTakeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, m)
+}
+
+func writeStockTakeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrStockTakeNotFound), errors.Is(err, repo.ErrProductNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrStockTakeClosed), errors.Is(err, service.ErrInsufficientStock):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, service.ErrInvalidReason):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
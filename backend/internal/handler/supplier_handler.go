@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"pesalocal/internal/model"
+	"pesalocal/internal/service"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type SupplierHandler struct {
+	supplierService *service.SupplierService
+}
+
+func NewSupplierHandler(supplierService *service.SupplierService) *SupplierHandler {
+	return &SupplierHandler{
+		supplierService: supplierService,
+	}
+}
+
+// GET /suppliers
+func (h *SupplierHandler) List(w http.ResponseWriter, r *http.Request) {
+	suppliers, err := h.supplierService.GetAllSuppliers()
+	if err != nil {
+		writeSupplierError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, suppliers)
+}
+
+// POST /suppliers
+func (h *SupplierHandler) Save(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var s model.Supplier
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	if err := h.supplierService.CreateOrUpdateSupplier(&s); err != nil {
+		writeSupplierError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, s)
+}
+
+// GET /suppliers/{id}
+func (h *SupplierHandler) Get(w http.ResponseWriter, r *http.Request) {
+	summary, err := h.supplierService.GetSupplier(chi.URLParam(r, "id"))
+	if err != nil {
+		writeSupplierError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, summary)
+}
+
+// GET /suppliers/{id}/purchases
+func (h *SupplierHandler) Purchases(w http.ResponseWriter, r *http.Request) {
+	purchases, err := h.supplierService.GetPurchases(chi.URLParam(r, "id"))
+	if err != nil {
+		writeSupplierError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, purchases)
+}
+
+// GET /suppliers/{id}/prices
+// Last price paid per product, for comparing suppliers when reordering.
+func (h *SupplierHandler) Prices(w http.ResponseWriter, r *http.Request) {
+	prices, err := h.supplierService.GetLastPrices(chi.URLParam(r, "id"))
+	if err != nil {
+		writeSupplierError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, prices)
+}
+
+// GET /suppliers/{id}/payments
+func (h *SupplierHandler) Payments(w http.ResponseWriter, r *http.Request) {
+	payments, err := h.supplierService.GetPayments(chi.URLParam(r, "id"))
+	if err != nil {
+		writeSupplierError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, payments)
+}
+
+// POST /suppliers/{id}/payments
+func (h *SupplierHandler) RecordPayment(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var p model.SupplierPayment
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	p.SupplierID = chi.URLParam(r, "id")
+	if err := h.supplierService.RecordPayment(&p); err != nil {
+		writeSupplierError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, p)
+}
+
+func writeSupplierError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrSupplierNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrDuplicateSupplier), errors.Is(err, service.ErrOverpayment):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, service.ErrInvalidSupplier), errors.Is(err, service.ErrInvalidPayment):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -2,7 +2,9 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
 	"time"
 
 	"pesalocal/internal/model"
@@ -18,18 +20,36 @@ type IncomingSyncOperation struct {
 	DeviceID   string          `json:"device_id"`
 	CreatedAt  time.Time       `json:"created_at"`
 	RetryCount int             `json:"retry_count"`
+
+	// Encrypted sync only
+	Version int64  `json:"version"`
+	KeyID   string `json:"key_id"`
 }
 
 type SyncHandler struct {
-	syncService *service.SyncService
+	syncService      *service.SyncService
+	encryptedService *service.EncryptedSyncService
 }
 
-func NewSyncHandler(syncService *service.SyncService) *SyncHandler {
+func NewSyncHandler(syncService *service.SyncService, encryptedService *service.EncryptedSyncService) *SyncHandler {
 	return &SyncHandler{
-		syncService: syncService,
+		syncService:      syncService,
+		encryptedService: encryptedService,
 	}
 }
 
+// RequirePlaintext turns off endpoints that work on the shop's data when
+// the shop syncs end to end encrypted: the server has none to work on.
+func (h *SyncHandler) RequirePlaintext(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.encryptedService.Enabled() {
+			http.Error(w, service.ErrSyncEncrypted.Error(), http.StatusConflict)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 // POST /sync/push
 func (h *SyncHandler) Push(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
@@ -39,10 +59,19 @@ func (h *SyncHandler) Push(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid payload", http.StatusBadRequest)
 		return
 	}
+	if h.encryptedService.Enabled() {
+		h.pushEncrypted(w, incoming)
+		return
+	}
 
 	// Convert incoming to model.SyncOperation
 	ops := make([]*model.SyncOperation, 0, len(incoming))
 	for _, in := range incoming {
+		// a JSON string is an encrypted payload, which can't be applied
+		if len(in.Payload) > 0 && in.Payload[0] == '"' {
+			http.Error(w, service.ErrSyncNotEncrypted.Error(), http.StatusConflict)
+			return
+		}
 		op := &model.SyncOperation{
 			ID:         in.ID,
 			EntityType: in.EntityType,
@@ -80,3 +109,98 @@ func (h *SyncHandler) Push(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
+
+// pushEncrypted stores operations for an encrypted shop's other devices
+func (h *SyncHandler) pushEncrypted(w http.ResponseWriter, incoming []IncomingSyncOperation) {
+	ops := make([]*model.EncryptedOperation, 0, len(incoming))
+	for _, in := range incoming {
+		op := &model.EncryptedOperation{
+			ID:         in.ID,
+			EntityType: in.EntityType,
+			EntityID:   in.EntityID,
+			Version:    in.Version,
+			Operation:  in.Operation,
+			KeyID:      in.KeyID,
+			DeviceID:   in.DeviceID,
+		}
+		// the ciphertext arrives base64-encoded in a JSON string
+		if err := json.Unmarshal(in.Payload, &op.Payload); err != nil {
+			http.Error(w, service.ErrPayloadNotEncrypted.Error()+" (operation "+in.ID+")", http.StatusBadRequest)
+			return
+		}
+		ops = append(ops, op)
+	}
+
+	stored, err := h.encryptedService.Push(ops)
+	if err != nil {
+		writeSyncError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":    "ok",
+		"encrypted": true,
+		"stored":    stored,
+	})
+}
+
+// GET /sync/pull?since=2024-03-01T10:00:00Z[&device_id=]
+// GET /sync/pull?after=<cursor>[&device_id=][&limit=] for an encrypted shop
+func (h *SyncHandler) Pull(w http.ResponseWriter, r *http.Request) {
+	if h.encryptedService.Enabled() {
+		h.pullEncrypted(w, r)
+		return
+	}
+	since, err := parseTimeParam(r, "since", time.Time{})
+	if err != nil {
+		http.Error(w, "invalid since", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.syncService.Pull(since, r.URL.Query().Get("device_id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// pullEncrypted returns the operations an encrypted shop's devices pushed
+// after the cursor
+func (h *SyncHandler) pullEncrypted(w http.ResponseWriter, r *http.Request) {
+	var after int64
+	if v := r.URL.Query().Get("after"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid after", http.StatusBadRequest)
+			return
+		}
+		after = n
+	}
+	var limit int
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	result, err := h.encryptedService.Pull(after, r.URL.Query().Get("device_id"), limit)
+	if err != nil {
+		writeSyncError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func writeSyncError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrPayloadNotEncrypted), errors.Is(err, service.ErrInvalidOperation):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, service.ErrSyncEncrypted), errors.Is(err, service.ErrSyncNotEncrypted):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
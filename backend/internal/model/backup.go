@@ -0,0 +1,11 @@
+package model
+
+import "time"
+
+// Backup is an encrypted archive of the shop's database
+type Backup struct {
+	Name      string           `json:"name"`
+	Size      int64            `json:"size"` // bytes of the archive
+	CreatedAt time.Time        `json:"created_at"`
+	Tables    map[string]int64 `json:"tables,omitempty"` // rows per table; known for backups just made
+}
@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// Category groups products. Sub-categories name their parent.
+type Category struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	ParentID  string    `json:"parent_id,omitempty"`
+	Emoji     string    `json:"emoji,omitempty"`
+	Version   int       `json:"version"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
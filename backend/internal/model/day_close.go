@@ -0,0 +1,81 @@
+package model
+
+import "time"
+
+// DayClose locks a trading day once its Z-report has been taken. An empty
+// DeviceID closes the day for the whole shop.
+type DayClose struct {
+	ID           string    `json:"id"`
+	Date         string    `json:"date"` // YYYY-MM-DD, shop local time
+	DeviceID     string    `json:"device_id,omitempty"`
+	OpeningFloat float64   `json:"opening_float"`
+	CountedCash  float64   `json:"counted_cash"`
+	ClosedBy     string    `json:"closed_by,omitempty"`
+	ClosedAt     time.Time `json:"closed_at"`
+}
+
+// DayAdjustment corrects the takings of a closed day without reopening it.
+// Sales and returns synced after their day closed are recorded against it
+// as adjustments naming their source; they are already in the day's
+// takings, so they only explain how the day changed since it closed.
+type DayAdjustment struct {
+	ID         string    `json:"id"`
+	Date       string    `json:"date"`
+	DeviceID   string    `json:"device_id,omitempty"`
+	Amount     float64   `json:"amount"` // positive adds to takings
+	Method     string    `json:"method"` // tender it applies to: cash, mpesa, credit
+	Reason     string    `json:"reason"`
+	SourceType string    `json:"source_type,omitempty"` // sale or return, for late ones
+	SourceID   string    `json:"source_id,omitempty"`
+	CreatedBy  string    `json:"created_by,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Tender is the takings for one payment method
+type Tender struct {
+	Method string  `json:"method"`
+	Status string  `json:"status"` // pending M-PESA sales are listed apart
+	Count  int     `json:"count"`
+	Amount float64 `json:"amount"`
+}
+
+// ProductSales is how much of a product sold
+type ProductSales struct {
+	ProductID string  `json:"product_id"`
+	Name      string  `json:"name"`
+	Quantity  float64 `json:"quantity"`
+	Revenue   float64 `json:"revenue"`
+}
+
+// CashDrawer is the cash that should be in the drawer at close
+type CashDrawer struct {
+	OpeningFloat     float64  `json:"opening_float"`
+	CashSales        float64  `json:"cash_sales"`
+	CashRefunds      float64  `json:"cash_refunds"`
+	SupplierPayments float64  `json:"supplier_payments"` // paid out in cash
+	Adjustments      float64  `json:"adjustments"`
+	Expected         float64  `json:"expected"`
+	Counted          *float64 `json:"counted,omitempty"`
+	Variance         *float64 `json:"variance,omitempty"` // counted - expected
+}
+
+// ZReport is the end-of-day summary for the shop or one device
+type ZReport struct {
+	Date        string           `json:"date"`
+	DeviceID    string           `json:"device_id,omitempty"`
+	SalesCount  int              `json:"sales_count"`
+	ItemsSold   float64          `json:"items_sold"`
+	GrossSales  float64          `json:"gross_sales"`
+	RefundCount int              `json:"refund_count"`
+	Refunds     float64          `json:"refunds"`
+	NetSales    float64          `json:"net_sales"` // gross less refunds, tax included
+	TaxRate     float64          `json:"tax_rate"`  // percent, prices include tax
+	Tax         float64          `json:"tax"`
+	NetOfTax    float64          `json:"net_of_tax"`
+	Tenders     []*Tender        `json:"tenders"`
+	TopProducts []*ProductSales  `json:"top_products"`
+	Cash        CashDrawer       `json:"cash"`
+	Adjustments []*DayAdjustment `json:"adjustments"`
+	Close       *DayClose        `json:"close,omitempty"` // set once the day is closed
+	GeneratedAt time.Time        `json:"generated_at"`
+}
@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+// EncryptedOperation is a sync operation from a shop that syncs end to end
+// encrypted. Its payload is encrypted on the device with a shop key the
+// server never has; the server keeps only what it needs to relay it.
+type EncryptedOperation struct {
+	Seq        int64     `json:"seq"` // order the server received it in
+	ID         string    `json:"id"`
+	EntityType string    `json:"entity_type"`
+	EntityID   string    `json:"entity_id"`
+	Version    int64     `json:"version"` // the entity's version, for last-write-wins on devices
+	Operation  string    `json:"operation"`
+	KeyID      string    `json:"key_id,omitempty"` // which shop key, while keys are rotated
+	Payload    []byte    `json:"payload"`          // ciphertext; base64 in JSON
+	DeviceID   string    `json:"device_id"`
+	CreatedAt  time.Time `json:"created_at"` // when the server received it
+}
@@ -0,0 +1,55 @@
+package model
+
+import "time"
+
+// SaleLine is one item of a sale with the sale it belongs to, as exported
+// for the accountant
+type SaleLine struct {
+	SaleID        string
+	ReceiptNo     int64
+	CreatedAt     time.Time
+	UserID        string
+	DeviceID      string
+	PaymentMethod string
+	PaymentStatus string
+	MpesaReceipt  string
+	SaleTotal     float64
+	ItemID        string
+	ProductID     string
+	ProductName   string
+	Quantity      float64 // in the product's base unit
+	Price         float64
+	Discount      float64
+	Total         float64
+	Cost          float64
+}
+
+// PurchaseLine is one item of a purchase with the purchase it belongs to
+type PurchaseLine struct {
+	PurchaseID    string
+	CreatedAt     time.Time
+	SupplierID    string
+	Supplier      string
+	PaymentMethod string
+	PurchaseTotal float64
+	ItemID        string
+	ProductID     string
+	ProductName   string
+	Quantity      float64 // in the product's base unit
+	Price         float64
+	Total         float64
+	ExpiryDate    *time.Time
+}
+
+// ProductStock is a product's stock and what it is worth
+type ProductStock struct {
+	ID          string
+	Name        string
+	Category    string
+	Barcode     string
+	Price       float64
+	Stock       float64
+	AverageCost float64
+	StockValue  float64 // stock at average cost
+	RetailValue float64 // stock at selling price
+}
@@ -0,0 +1,59 @@
+package model
+
+import "time"
+
+// Costing methods, chosen with the costing_method setting
+const (
+	SettingCostingMethod = "costing_method"
+
+	CostingAverage = "average" // weighted-average cost of stock on hand
+	CostingFIFO    = "fifo"    // cost of the batches the stock is taken from
+)
+
+// ValidCostingMethod reports whether m is a known costing method
+func ValidCostingMethod(m string) bool {
+	return m == CostingAverage || m == CostingFIFO
+}
+
+// Margin is revenue against the cost of the goods sold, both net of
+// returns
+type Margin struct {
+	Revenue       float64 `json:"revenue"`
+	Cost          float64 `json:"cost"`
+	GrossMargin   float64 `json:"gross_margin"`
+	MarginPercent float64 `json:"margin_percent"` // of revenue
+}
+
+// SaleMargin is the margin made on one sale
+type SaleMargin struct {
+	SaleID    string    `json:"sale_id"`
+	CreatedAt time.Time `json:"created_at"`
+	Margin
+}
+
+// ProductMargin is the margin made on one product
+type ProductMargin struct {
+	ProductID string  `json:"product_id"`
+	Name      string  `json:"name"`
+	Quantity  float64 `json:"quantity"`
+	Margin
+}
+
+// DailyMargin is the margin made on one day
+type DailyMargin struct {
+	Date  string `json:"date"` // YYYY-MM-DD
+	Sales int    `json:"sales"`
+	Margin
+}
+
+// MarginReport is the gross margin over a date range, broken down by
+// sale, product or day
+type MarginReport struct {
+	CostingMethod string           `json:"costing_method"`
+	From          time.Time        `json:"from"`
+	To            time.Time        `json:"to"`
+	Total         Margin           `json:"total"`
+	Sales         []*SaleMargin    `json:"sales,omitempty"`
+	Products      []*ProductMargin `json:"products,omitempty"`
+	Days          []*DailyMargin   `json:"days,omitempty"`
+}
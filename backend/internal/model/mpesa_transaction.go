@@ -0,0 +1,30 @@
+package model
+
+import "time"
+
+// M-PESA transaction types, matching the categories used by the PWA parser
+const (
+	MpesaSendMoney    = "Send Money"
+	MpesaReceiveMoney = "Receive Money"
+	MpesaPaybill      = "Paybill"
+	MpesaBuyGoods     = "Buy Goods"
+	MpesaWithdrawal   = "Withdrawal"
+	MpesaAirtime      = "Airtime"
+	MpesaFuliza       = "Fuliza"
+	MpesaOther        = "Other"
+)
+
+type MpesaTransaction struct {
+	ID             string    `json:"id"`
+	ReceiptNo      string    `json:"receipt_no"` // unique M-PESA receipt code
+	CompletionTime time.Time `json:"completion_time"`
+	Type           string    `json:"type"` // one of the Mpesa* constants
+	Description    string    `json:"description"`
+	Counterparty   string    `json:"counterparty"`
+	Amount         float64   `json:"amount"`  // positive = received, negative = sent/paid
+	Fee            float64   `json:"fee"`     // transaction cost charged (0 if none)
+	Balance        float64   `json:"balance"` // running balance after this transaction
+	Source         string    `json:"source"`  // csv, statement, sms, c2b, stk
+	CreatedAt      time.Time `json:"created_at"`
+	SaleID         string    `json:"sale_id,omitempty"` // sale this payment settled, if matched
+}
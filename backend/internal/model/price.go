@@ -0,0 +1,42 @@
+package model
+
+import "time"
+
+// Price change statuses
+const (
+	PriceChangeApplied   = "applied"
+	PriceChangeScheduled = "scheduled" // waiting for EffectiveAt
+	PriceChangeCancelled = "cancelled"
+)
+
+// PriceChange is one change to a product's selling price. Edits to the
+// product are recorded as applied changes; a change with a future
+// EffectiveAt waits as scheduled until it falls due.
+type PriceChange struct {
+	ID          string    `json:"id"`
+	ProductID   string    `json:"product_id"`
+	OldPrice    float64   `json:"old_price"` // set when applied
+	Price       float64   `json:"price"`
+	Status      string    `json:"status"`
+	ChangedBy   string    `json:"changed_by,omitempty"` // user ID
+	DeviceID    string    `json:"device_id,omitempty"`
+	EffectiveAt time.Time `json:"effective_at"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// PurchaseCost is the average unit cost paid for a product on one day
+type PurchaseCost struct {
+	Date        string  `json:"date"` // YYYY-MM-DD
+	Quantity    float64 `json:"quantity"`
+	AverageCost float64 `json:"average_cost"` // weighted by quantity
+}
+
+// PriceHistory is a product's selling price over time next to what the
+// shop paid for it
+type PriceHistory struct {
+	Product       *Product        `json:"product"`
+	Changes       []*PriceChange  `json:"changes"`   // applied, oldest first
+	Scheduled     []*PriceChange  `json:"scheduled"` // upcoming, soonest first
+	PurchaseCosts []*PurchaseCost `json:"purchase_costs"`
+	AverageCost   float64         `json:"average_cost"` // over the whole range
+}
@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+// Erasure subjects
+const (
+	SubjectUser = "user" // a person using the system
+	SubjectShop = "shop" // everything the server holds
+)
+
+// Erasure records that a subject's data was deleted. It names the subject
+// but holds none of the deleted data.
+type Erasure struct {
+	ID          string           `json:"id"`
+	SubjectType string           `json:"subject_type"` // user, shop
+	SubjectID   string           `json:"subject_id,omitempty"`
+	RequestedBy string           `json:"requested_by"`
+	Reason      string           `json:"reason"`
+	Deleted     map[string]int64 `json:"deleted"`            // rows deleted per table
+	Scrubbed    map[string]int64 `json:"scrubbed,omitempty"` // rows kept with the subject removed, per table
+	Verified    bool             `json:"verified"`           // nothing of the subject was found afterwards
+	CreatedAt   time.Time        `json:"created_at"`
+}
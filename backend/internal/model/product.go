@@ -3,10 +3,24 @@ package model
 import "time"
 
 type Product struct {
-	ID        string    `json:"id"` // UUID
-	Name      string    `json:"name"`
-	Price     float64   `json:"price"`
-	Stock     int       `json:"stock"`
-	Version   int       `json:"version"` // for conflict resolution
-	UpdatedAt time.Time `json:"updated_at"`
+	ID              string    `json:"id"` // UUID
+	Name            string    `json:"name"`
+	Price           float64   `json:"price"`
+	Stock           float64   `json:"stock"`
+	Category        string    `json:"category"`
+	SubCategory     string    `json:"sub_category"`
+	PricePerUnit    string    `json:"price_per_unit"` // unit the price is quoted in: kg, bunch, piece...
+	Barcode         string    `json:"barcode"`        // unique within the shop when set
+	Supplier        string    `json:"supplier"`
+	Emoji           string    `json:"emoji"`
+	Description     string    `json:"description"`
+	IsPerishable    bool      `json:"is_perishable"`
+	RequiresCooling bool      `json:"requires_cooling"`
+	ShelfLifeDays   int       `json:"shelf_life_days,omitempty"` // default expiry for received batches
+	ReorderPoint    float64   `json:"reorder_point"`             // PWA lowStockAlert; 0 uses the shop default
+	LeadTimeDays    int       `json:"lead_time_days"`            // days from ordering to delivery
+	AverageCost     float64   `json:"average_cost"`              // weighted-average cost of stock; kept by the ledger
+	Version         int       `json:"version"`                   // for conflict resolution
+	UpdatedAt       time.Time `json:"updated_at"`
+	UpdatedBy       string    `json:"updated_by,omitempty"` // user who last edited the product
 }
@@ -0,0 +1,82 @@
+package model
+
+import "time"
+
+// Discount types, for manual line and basket discounts
+const (
+	DiscountPercent = "percent" // value is a percentage off
+	DiscountFixed   = "fixed"   // value is an amount off
+)
+
+// Promotion types
+const (
+	PromotionBuyXGetY  = "buy_x_get_y" // buy BuyQuantity, get GetQuantity more free
+	PromotionBundle    = "bundle"      // BundleQuantity for BundlePrice
+	PromotionTimePrice = "time_price"  // Price, or Percent off, during the daily window
+)
+
+// AppliedManual marks a manual discount among a sale's applied promotions
+const AppliedManual = "manual"
+
+// SettingCashierDiscountLimit is the most a non-admin user may take off a
+// line or basket by hand, as a percentage. 0 (the default) allows none.
+const SettingCashierDiscountLimit = "cashier_discount_limit"
+
+// Promotion is a rule the server applies when pricing a sale. It covers
+// one product, or every product in Category when ProductID is empty. A
+// line gets the single promotion that saves the most.
+type Promotion struct {
+	ID             string     `json:"id"`
+	Name           string     `json:"name"`
+	Type           string     `json:"type"` // buy_x_get_y, bundle, time_price
+	ProductID      string     `json:"product_id,omitempty"`
+	Category       string     `json:"category,omitempty"`
+	BuyQuantity    float64    `json:"buy_quantity,omitempty"`
+	GetQuantity    float64    `json:"get_quantity,omitempty"`
+	BundleQuantity float64    `json:"bundle_quantity,omitempty"`
+	BundlePrice    float64    `json:"bundle_price,omitempty"`
+	Price          float64    `json:"price,omitempty"`      // time_price: the unit price in the window
+	Percent        float64    `json:"percent,omitempty"`    // time_price: percent off when no price is set
+	StartTime      string     `json:"start_time,omitempty"` // HH:MM local; with EndTime, limits the promotion to part of each day
+	EndTime        string     `json:"end_time,omitempty"`
+	StartsAt       *time.Time `json:"starts_at,omitempty"`
+	EndsAt         *time.Time `json:"ends_at,omitempty"`
+	Active         bool       `json:"active"`
+	Version        int        `json:"version"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// SalePromotion records a promotion or manual discount applied to a sale.
+// SaleItemID is empty for basket discounts.
+type SalePromotion struct {
+	ID          string  `json:"id"`
+	SaleID      string  `json:"sale_id"`
+	SaleItemID  string  `json:"sale_item_id,omitempty"`
+	PromotionID string  `json:"promotion_id,omitempty"` // empty for manual discounts
+	Name        string  `json:"name"`
+	Type        string  `json:"type"` // promotion type, or manual
+	Amount      float64 `json:"amount"`
+	// Manual discount beyond what the selling user may give. The sale
+	// stands; the discount is listed for the owner to review.
+	OverLimit bool `json:"over_limit,omitempty"`
+}
+
+// FlaggedDiscount is a manual discount given beyond the user's limit
+type FlaggedDiscount struct {
+	SaleID     string    `json:"sale_id"`
+	SaleItemID string    `json:"sale_item_id,omitempty"` // empty for basket discounts
+	UserID     string    `json:"user_id"`
+	DeviceID   string    `json:"device_id"`
+	Name       string    `json:"name"`
+	Amount     float64   `json:"amount"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// PromotionUsage is how often a promotion was applied and what it gave away
+type PromotionUsage struct {
+	PromotionID string  `json:"promotion_id,omitempty"`
+	Name        string  `json:"name"`
+	Type        string  `json:"type"`
+	Sales       int     `json:"sales"`
+	Amount      float64 `json:"amount"`
+}
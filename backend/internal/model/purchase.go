@@ -3,19 +3,26 @@ package model
 import "time"
 
 type Purchase struct {
-	ID          string    `json:"id"`
-	Supplier    string    `json:"supplier"`
-	TotalAmount float64   `json:"total_amount"`
-	DeviceID    string    `json:"device_id"`
-	Version     int       `json:"version"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID            string    `json:"id"`
+	SupplierID    string    `json:"supplier_id"`
+	Supplier      string    `json:"supplier"` // supplier name
+	TotalAmount   float64   `json:"total_amount"`
+	PaymentMethod string    `json:"payment_method"` // cash, mpesa, credit
+	DeviceID      string    `json:"device_id"`
+	Version       int       `json:"version"`
+	CreatedAt     time.Time `json:"created_at"`
 }
 
 type PurchaseItem struct {
-	ID         string  `json:"id"`
-	PurchaseID string  `json:"purchase_id"`
-	ProductID  string  `json:"product_id"`
-	Quantity   int     `json:"quantity"`
-	Price      float64 `json:"price"`
-	Total      float64 `json:"total"`
+	ID         string     `json:"id"`
+	PurchaseID string     `json:"purchase_id"`
+	ProductID  string     `json:"product_id"`
+	Quantity   float64    `json:"quantity"` // in the product's base unit
+	Price      float64    `json:"price"`    // per base unit
+	Total      float64    `json:"total"`
+	ExpiryDate *time.Time `json:"expiry_date,omitempty"` // for perishable stock
+	// Unit and quantity as bought, when bought in another unit
+	// (e.g. 2 "crate" of a product stocked by the kg)
+	Unit         string  `json:"unit,omitempty"`
+	UnitQuantity float64 `json:"unit_quantity,omitempty"`
 }
@@ -0,0 +1,58 @@
+package model
+
+import "time"
+
+// SettingReceiptRangeSize is how many receipt numbers a device is given at
+// a time
+const SettingReceiptRangeSize = "receipt_range_size"
+
+// ReceiptRange is a block of receipt numbers allocated to one device.
+// Ranges never overlap, so a device can number receipts offline without
+// clashing with another, and numbers run on from one range to the next.
+type ReceiptRange struct {
+	ID          string    `json:"id"`
+	DeviceID    string    `json:"device_id"`
+	Start       int64     `json:"start"`
+	End         int64     `json:"end"`  // inclusive
+	Used        int       `json:"used"` // receipts synced with numbers in the range
+	Next        int64     `json:"next"` // after the highest number synced; End+1 once used up
+	AllocatedAt time.Time `json:"allocated_at"`
+}
+
+// Remaining returns how many numbers are left after the highest one used
+func (r *ReceiptRange) Remaining() int64 {
+	return r.End - r.Next + 1
+}
+
+// ReceiptGap is a run of receipt numbers a device skipped: numbers in its
+// ranges below the highest it has used that no synced sale carries
+type ReceiptGap struct {
+	DeviceID string `json:"device_id"`
+	From     int64  `json:"from"`
+	To       int64  `json:"to"`
+}
+
+// ReceiptDuplicate is a receipt number carried by more than one sale
+type ReceiptDuplicate struct {
+	ReceiptNo int64    `json:"receipt_no"`
+	SaleIDs   []string `json:"sale_ids"`
+}
+
+// ReceiptIssue is a sale whose receipt number wasn't allocated to the
+// device that issued it
+type ReceiptIssue struct {
+	SaleID    string `json:"sale_id"`
+	DeviceID  string `json:"device_id"`
+	ReceiptNo int64  `json:"receipt_no"`
+}
+
+// ReceiptAudit checks receipt numbering is continuous and unique
+type ReceiptAudit struct {
+	DeviceID    string              `json:"device_id,omitempty"`
+	CheckedAt   time.Time           `json:"checked_at"`
+	Ranges      []*ReceiptRange     `json:"ranges"`
+	Gaps        []*ReceiptGap       `json:"gaps"`
+	Duplicates  []*ReceiptDuplicate `json:"duplicates"`
+	Unallocated []*ReceiptIssue     `json:"unallocated"`
+	OK          bool                `json:"ok"`
+}
@@ -0,0 +1,14 @@
+package model
+
+// ReorderSuggestion flags a product running low and how much to order
+type ReorderSuggestion struct {
+	ProductID         string  `json:"product_id"`
+	Name              string  `json:"name"`
+	Stock             float64 `json:"stock"`
+	ReorderPoint      float64 `json:"reorder_point"`
+	DailyVelocity     float64 `json:"daily_velocity"`          // average units sold per day
+	DaysOfStock       float64 `json:"days_of_stock,omitempty"` // at current velocity; omitted when nothing sells
+	LeadTimeDays      int     `json:"lead_time_days"`
+	BelowReorderPoint bool    `json:"below_reorder_point"`
+	SuggestedQuantity float64 `json:"suggested_quantity"`
+}
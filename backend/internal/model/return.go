@@ -0,0 +1,41 @@
+package model
+
+import "time"
+
+// What happens to returned goods
+const (
+	ReturnRestock = "restock" // back on the shelf for resale
+	ReturnDamaged = "damaged" // written off, never back in stock
+)
+
+// Return reverses all or part of a sale. The customer is refunded in
+// RefundMethod, which defaults to how they paid.
+type Return struct {
+	ID           string        `json:"id"`
+	SaleID       string        `json:"sale_id"`
+	UserID       string        `json:"user_id"`
+	DeviceID     string        `json:"device_id"`
+	Reason       string        `json:"reason,omitempty"`
+	RefundMethod string        `json:"refund_method"` // cash, mpesa, credit
+	RefundTotal  float64       `json:"refund_total"`
+	MpesaReceipt string        `json:"mpesa_receipt,omitempty"` // reversal receipt for M-PESA refunds
+	Version      int           `json:"version"`
+	CreatedAt    time.Time     `json:"created_at"`  // when it was taken, by the device's clock
+	RecordedAt   time.Time     `json:"recorded_at"` // when the server recorded it
+	Items        []*ReturnItem `json:"items"`
+}
+
+// ReturnItem is a quantity of one sale item coming back. Price is what
+// was paid per unit after discounts; cost is that of the original sale.
+type ReturnItem struct {
+	ID          string  `json:"id"`
+	ReturnID    string  `json:"return_id"`
+	SaleItemID  string  `json:"sale_item_id"`
+	ProductID   string  `json:"product_id"`
+	Quantity    float64 `json:"quantity"` // in the product's base unit
+	Price       float64 `json:"price"`
+	Total       float64 `json:"total"`       // refunded
+	Disposition string  `json:"disposition"` // restock, damaged
+	UnitCost    float64 `json:"unit_cost"`
+	Cost        float64 `json:"cost"` // cost back in stock; 0 when written off
+}
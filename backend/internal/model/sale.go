@@ -2,20 +2,54 @@ package model
 
 import "time"
 
+// Payment methods
+const (
+	PaymentCash   = "cash"
+	PaymentMpesa  = "mpesa"
+	PaymentCredit = "credit"
+)
+
+// Payment statuses
+const (
+	PaymentPaid    = "paid"
+	PaymentPending = "pending" // awaiting M-PESA confirmation
+)
+
 type Sale struct {
-	ID        string    `json:"id"`
-	UserID    string    `json:"user_id"`
-	Total     float64   `json:"total"`
-	DeviceID  string    `json:"device_id"`
-	Version   int       `json:"version"`
-	CreatedAt time.Time `json:"created_at"`
+	ID            string    `json:"id"`
+	UserID        string    `json:"user_id"`
+	Total         float64   `json:"total"`
+	DeviceID      string    `json:"device_id"`
+	Version       int       `json:"version"`
+	CreatedAt     time.Time `json:"created_at"`
+	PaymentMethod string    `json:"payment_method"` // cash, mpesa, credit
+	PaymentStatus string    `json:"payment_status"` // paid, pending
+	MpesaReceipt  string    `json:"mpesa_receipt,omitempty"`
+	ReceiptNo     int64     `json:"receipt_no,omitempty"` // from a range allocated to the device
+	Subtotal      float64   `json:"subtotal"`             // before discounts; Total is what was charged
+	Discount      float64   `json:"discount"`             // promotions and manual discounts together
+	// Manual discount on the whole basket, as asked for at the till
+	DiscountType  string           `json:"discount_type,omitempty"` // percent, fixed
+	DiscountValue float64          `json:"discount_value,omitempty"`
+	Promotions    []*SalePromotion `json:"promotions,omitempty"` // what the discount is made of
 }
 
 type SaleItem struct {
 	ID        string  `json:"id"`
 	SaleID    string  `json:"sale_id"`
 	ProductID string  `json:"product_id"`
-	Quantity  int     `json:"quantity"`
-	Price     float64 `json:"price"`
-	Total     float64 `json:"total"`
+	Quantity  float64 `json:"quantity"` // in the product's base unit
+	Price     float64 `json:"price"`    // per base unit
+	Total     float64 `json:"total"`    // charged, after discounts
+	Discount  float64 `json:"discount"` // off the line, including its share of a basket discount
+	// Manual discount on the line, as asked for at the till. A bare
+	// discount from older clients is read as a fixed amount.
+	DiscountType  string  `json:"discount_type,omitempty"`
+	DiscountValue float64 `json:"discount_value,omitempty"`
+	UnitCost      float64 `json:"unit_cost"` // cost per base unit when sold
+	Cost          float64 `json:"cost"`      // cost of the goods sold
+	// Unit and quantity as entered at the till, when sold in another unit
+	// (e.g. 2 "dozen" of a product stocked by the piece)
+	Unit         string  `json:"unit,omitempty"`
+	UnitQuantity float64 `json:"unit_quantity,omitempty"`
 }
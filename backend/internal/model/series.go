@@ -0,0 +1,62 @@
+package model
+
+import "time"
+
+// Series bucket sizes
+const (
+	BucketHour  = "hour"
+	BucketDay   = "day"
+	BucketWeek  = "week" // weeks start on Monday
+	BucketMonth = "month"
+)
+
+// ValidBucket reports whether b is a known bucket size
+func ValidBucket(b string) bool {
+	switch b {
+	case BucketHour, BucketDay, BucketWeek, BucketMonth:
+		return true
+	}
+	return false
+}
+
+// SeriesFilter narrows a sales series. Empty fields don't filter.
+type SeriesFilter struct {
+	ProductID string `json:"product_id,omitempty"`
+	Category  string `json:"category,omitempty"`
+	UserID    string `json:"user_id,omitempty"` // cashier
+	DeviceID  string `json:"device_id,omitempty"`
+}
+
+// SeriesPoint is the sales in one bucket. With a product or category
+// filter, only the matching items count.
+type SeriesPoint struct {
+	Bucket      string    `json:"bucket,omitempty"` // label, e.g. "2024-05-01" or "2024-05-01 14:00"
+	Start       time.Time `json:"start"`
+	Sales       int       `json:"sales"`
+	Units       float64   `json:"units"`
+	Revenue     float64   `json:"revenue"`
+	Cost        float64   `json:"cost"`
+	GrossMargin float64   `json:"gross_margin"`
+}
+
+// SeriesChange is the percentage change from the comparison period. A
+// change from nothing is left out.
+type SeriesChange struct {
+	Sales       *float64 `json:"sales,omitempty"`
+	Units       *float64 `json:"units,omitempty"`
+	Revenue     *float64 `json:"revenue,omitempty"`
+	GrossMargin *float64 `json:"gross_margin,omitempty"`
+}
+
+// SalesSeries is sales over time in buckets, optionally with the same
+// figures for an earlier period to compare against
+type SalesSeries struct {
+	Bucket  string         `json:"bucket"`
+	From    time.Time      `json:"from"`
+	To      time.Time      `json:"to"`
+	Filter  SeriesFilter   `json:"filter"`
+	Points  []*SeriesPoint `json:"points"`
+	Total   SeriesPoint    `json:"total"`
+	Compare *SalesSeries   `json:"compare,omitempty"`
+	Change  *SeriesChange  `json:"change,omitempty"`
+}
@@ -0,0 +1,27 @@
+package model
+
+import "time"
+
+// StockBatch is a lot of a product received together, tracked so that
+// sales use up the stock closest to expiry first (FEFO)
+type StockBatch struct {
+	ID         string     `json:"id"`
+	ProductID  string     `json:"product_id"`
+	PurchaseID string     `json:"purchase_id,omitempty"`
+	Quantity   float64    `json:"quantity"`  // received
+	Remaining  float64    `json:"remaining"` // not yet sold or written off
+	UnitCost   float64    `json:"unit_cost"`
+	ExpiryDate *time.Time `json:"expiry_date,omitempty"`
+	ReceivedAt time.Time  `json:"received_at"`
+}
+
+// ExpiryReport lists batches nearing expiry and the value of stock that has
+// already expired
+type ExpiryReport struct {
+	AsOf             time.Time     `json:"as_of"`
+	Days             int           `json:"days"`
+	Expiring         []*StockBatch `json:"expiring"`
+	Expired          []*StockBatch `json:"expired"`
+	ExpiredCostValue float64       `json:"expired_cost_value"`
+	ExpiringValue    float64       `json:"expiring_cost_value"`
+}
@@ -0,0 +1,30 @@
+package model
+
+import "time"
+
+// Stock movement types
+const (
+	MovementSale       = "sale"
+	MovementPurchase   = "purchase"
+	MovementAdjustment = "adjustment"
+	MovementSpoilage   = "spoilage"
+	MovementReturn     = "return"
+	MovementTransfer   = "transfer"
+)
+
+// StockMovement is one entry in the inventory ledger. Product.Stock is the
+// running sum of a product's movements.
+type StockMovement struct {
+	ID              string    `json:"id"`
+	ProductID       string    `json:"product_id"`
+	Type            string    `json:"type"`                       // sale, purchase, adjustment, spoilage, return, transfer
+	Quantity        float64   `json:"quantity"`                   // positive adds stock, negative removes it
+	StockAfter      float64   `json:"stock_after"`                // product stock once applied
+	UnitCost        float64   `json:"unit_cost"`                  // cost per unit of the stock moved
+	ExpiredQuantity float64   `json:"expired_quantity,omitempty"` // of stock going out, how much was past its expiry date
+	SourceType      string    `json:"source_type,omitempty"`      // document that caused it, e.g. "sale"
+	SourceID        string    `json:"source_id,omitempty"`
+	Reason          string    `json:"reason,omitempty"`
+	DeviceID        string    `json:"device_id,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+}
@@ -0,0 +1,65 @@
+package model
+
+import "time"
+
+// Stock take statuses
+const (
+	StockTakeOpen      = "open"
+	StockTakeCommitted = "committed"
+	StockTakeCancelled = "cancelled"
+)
+
+// Reason codes for stock adjustments
+const (
+	ReasonCountCorrection = "count_correction"
+	ReasonDamaged         = "damaged"
+	ReasonSpoiled         = "spoiled"
+	ReasonTheft           = "theft"
+	ReasonFound           = "found"
+	ReasonOther           = "other"
+)
+
+// ValidAdjustmentReason reports whether code is a known reason code
+func ValidAdjustmentReason(code string) bool {
+	switch code {
+	case ReasonCountCorrection, ReasonDamaged, ReasonSpoiled, ReasonTheft, ReasonFound, ReasonOther:
+		return true
+	}
+	return false
+}
+
+// StockTake is a counting session. Devices record counts while it is open;
+// committing it turns variances into stock adjustments.
+type StockTake struct {
+	ID          string     `json:"id"`
+	Status      string     `json:"status"` // open, committed, cancelled
+	Note        string     `json:"note"`
+	UserID      string     `json:"user_id"`
+	DeviceID    string     `json:"device_id"`
+	Version     int        `json:"version"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CommittedAt *time.Time `json:"committed_at,omitempty"`
+}
+
+// StockCount is one device's count of a product during a stock take.
+// Counts from different devices (shelf, store room) are added together.
+// Expected is the product's stock when the server recorded the count.
+type StockCount struct {
+	ID          string    `json:"id"`
+	StockTakeID string    `json:"stock_take_id"`
+	ProductID   string    `json:"product_id"`
+	Counted     float64   `json:"counted"`
+	Expected    float64   `json:"expected"`
+	DeviceID    string    `json:"device_id"`
+	CountedAt   time.Time `json:"counted_at"`
+}
+
+// StockVariance compares the counted quantity of a product with its stock
+// when it was counted
+type StockVariance struct {
+	ProductID string  `json:"product_id"`
+	Name      string  `json:"name"`
+	Expected  float64 `json:"expected"`
+	Counted   float64 `json:"counted"`
+	Variance  float64 `json:"variance"` // counted - expected
+}
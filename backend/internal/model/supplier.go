@@ -0,0 +1,52 @@
+package model
+
+import "time"
+
+// Supplier is someone the shop buys stock from
+type Supplier struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Phone     string    `json:"phone,omitempty"`
+	Paybill   string    `json:"paybill,omitempty"` // M-PESA paybill number
+	Account   string    `json:"account,omitempty"` // account number for the paybill
+	Till      string    `json:"till,omitempty"`    // M-PESA Buy Goods till number
+	Notes     string    `json:"notes,omitempty"`
+	Version   int       `json:"version"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SupplierPayment settles money owed for purchases made on credit. It may
+// name the purchase it pays for, or just reduce the supplier's balance.
+type SupplierPayment struct {
+	ID         string    `json:"id"`
+	SupplierID string    `json:"supplier_id"`
+	PurchaseID string    `json:"purchase_id,omitempty"`
+	Amount     float64   `json:"amount"`
+	Method     string    `json:"method"`              // cash, mpesa
+	Reference  string    `json:"reference,omitempty"` // e.g. M-PESA receipt
+	DeviceID   string    `json:"device_id"`
+	PaidAt     time.Time `json:"paid_at"`
+}
+
+// SupplierSummary is a supplier with what the shop has spent with them
+// and still owes them
+type SupplierSummary struct {
+	*Supplier
+	PurchaseCount  int        `json:"purchase_count"`
+	TotalSpend     float64    `json:"total_spend"`
+	CreditTotal    float64    `json:"credit_total"` // bought on credit
+	Paid           float64    `json:"paid"`         // paid against credit
+	Balance        float64    `json:"balance"`      // still owed
+	LastPurchaseAt *time.Time `json:"last_purchase_at,omitempty"`
+}
+
+// SupplierPrice is the last price paid to a supplier for a product
+type SupplierPrice struct {
+	ProductID   string    `json:"product_id"`
+	Name        string    `json:"name"`
+	Unit        string    `json:"unit"`  // product's own unit
+	Price       float64   `json:"price"` // per unit
+	Quantity    float64   `json:"quantity"`
+	PurchaseID  string    `json:"purchase_id"`
+	PurchasedAt time.Time `json:"purchased_at"`
+}
@@ -0,0 +1,25 @@
+package model
+
+import (
+	"math"
+	"time"
+)
+
+// UnitConversion says how many ToUnit make one FromUnit, e.g. one "crate"
+// of tomatoes is 20 "kg". Conversions without a product apply to every
+// product (dozen -> piece).
+type UnitConversion struct {
+	ID        string    `json:"id"`
+	ProductID string    `json:"product_id,omitempty"`
+	FromUnit  string    `json:"from_unit"`
+	ToUnit    string    `json:"to_unit"`
+	Factor    float64   `json:"factor"`
+	Version   int       `json:"version"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// RoundQuantity rounds a quantity to grams/millilitres so that repeated
+// fractional movements don't drift
+func RoundQuantity(q float64) float64 {
+	return math.Round(q*1000) / 1000
+}
@@ -0,0 +1,467 @@
+package mpesa
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"pesalocal/internal/model"
+)
+
+// Supported import formats
+const (
+	FormatCSV       = "csv"
+	FormatStatement = "statement"
+	FormatSMS       = "sms"
+)
+
+var ErrUnknownFormat = errors.New("unknown M-PESA import format")
+
+// Statements and SMS carry local (EAT) times without a zone
+var eat = time.FixedZone("EAT", 3*60*60)
+
+// Result holds the transactions parsed from an export along with the
+// lines that looked like transactions but could not be read.
+type Result struct {
+	Transactions []*model.MpesaTransaction
+	Unparseable  []string
+}
+
+// Parse reads an export in the given format. An empty format is detected
+// from the content.
+func Parse(format string, r io.Reader) (*Result, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if format == "" {
+		format = DetectFormat(data)
+	}
+
+	switch format {
+	case FormatCSV:
+		return ParseCSV(bytes.NewReader(data))
+	case FormatStatement:
+		return ParseStatement(string(data)), nil
+	case FormatSMS:
+		return ParseSMS(string(data)), nil
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+// DetectFormat guesses the format of an export from its content
+func DetectFormat(data []byte) string {
+	text := string(data)
+	if smsStart.MatchString(text) {
+		return FormatSMS
+	}
+	firstLine, _, _ := strings.Cut(text, "\n")
+	if strings.Count(firstLine, ",") >= 3 || strings.Contains(text, "Receipt No.,") {
+		return FormatCSV
+	}
+	return FormatStatement
+}
+
+// ParseCSV reads a statement exported as CSV. Rows before the header row
+// (statement preamble) are skipped; columns are located by header name.
+func ParseCSV(r io.Reader) (*Result, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+
+	result := &Result{}
+	var cols map[string]int
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if cols == nil {
+			cols = csvHeader(record)
+			continue
+		}
+
+		line := strings.Join(record, ",")
+		if strings.TrimSpace(strings.ReplaceAll(line, ",", "")) == "" {
+			continue
+		}
+
+		field := func(name string) string {
+			i, ok := cols[name]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+
+		if status := field("status"); status != "" && !strings.EqualFold(status, "completed") {
+			continue
+		}
+
+		tx, ok := newTransaction(
+			field("receipt"), field("time"), field("details"),
+			field("paid_in"), field("withdrawn"), field("balance"),
+		)
+		if !ok {
+			result.Unparseable = append(result.Unparseable, line)
+			continue
+		}
+		tx.Source = FormatCSV
+		result.Transactions = append(result.Transactions, tx)
+	}
+
+	result.Transactions = mergeCharges(result.Transactions)
+	return result, nil
+}
+
+// csvHeader maps known column names to their index, or returns nil if the
+// record is not the header row
+func csvHeader(record []string) map[string]int {
+	cols := make(map[string]int)
+	for i, name := range record {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch {
+		case strings.HasPrefix(name, "receipt"):
+			cols["receipt"] = i
+		case strings.Contains(name, "completion") || name == "date":
+			cols["time"] = i
+		case strings.HasPrefix(name, "details") || strings.HasPrefix(name, "description"):
+			cols["details"] = i
+		case strings.Contains(name, "status"):
+			cols["status"] = i
+		case strings.HasPrefix(name, "paid in"):
+			cols["paid_in"] = i
+		case strings.HasPrefix(name, "withdrawn") || strings.HasPrefix(name, "paid out"):
+			cols["withdrawn"] = i
+		case strings.HasPrefix(name, "balance"):
+			cols["balance"] = i
+		}
+	}
+	if _, ok := cols["receipt"]; !ok {
+		return nil
+	}
+	return cols
+}
+
+// ParseStatement reads statement text extracted from the PDF. Lines that
+// don't look like transactions (headers, page footers) are ignored.
+func ParseStatement(text string) *Result {
+	result := &Result{}
+
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(whitespaceChars.ReplaceAllString(scanner.Text(), " "))
+		if line == "" {
+			continue
+		}
+
+		var tx *model.MpesaTransaction
+		ok := false
+		if m := statementLine.FindStringSubmatch(line); m != nil {
+			if m[4] != "" && !strings.EqualFold(m[4], "completed") {
+				continue
+			}
+			tx, ok = newTransaction(m[1], m[2], m[3], m[5], m[6], m[7])
+		} else if m := legacyStatementLine.FindStringSubmatch(line); m != nil {
+			tx, ok = newTransaction(m[2], m[1], m[3], m[4], m[5], m[6])
+		} else if !looksLikeTransaction(line) {
+			continue
+		}
+
+		if !ok {
+			result.Unparseable = append(result.Unparseable, line)
+			continue
+		}
+		tx.Source = FormatStatement
+		result.Transactions = append(result.Transactions, tx)
+	}
+
+	result.Transactions = mergeCharges(result.Transactions)
+	return result
+}
+
+// ParseSMS reads one or more pasted confirmation messages
+func ParseSMS(text string) *Result {
+	result := &Result{}
+
+	starts := smsStart.FindAllStringIndex(text, -1)
+	if len(starts) == 0 {
+		if strings.TrimSpace(text) != "" {
+			result.Unparseable = append(result.Unparseable, strings.TrimSpace(text))
+		}
+		return result
+	}
+
+	for i, start := range starts {
+		end := len(text)
+		if i+1 < len(starts) {
+			end = starts[i+1][0]
+		}
+		msg := strings.TrimSpace(whitespaceChars.ReplaceAllString(text[start[0]:end], " "))
+
+		tx, ok := parseSMSMessage(msg)
+		if !ok {
+			result.Unparseable = append(result.Unparseable, msg)
+			continue
+		}
+		result.Transactions = append(result.Transactions, tx)
+	}
+	return result
+}
+
+func parseSMSMessage(msg string) (*model.MpesaTransaction, bool) {
+	receipt := smsStart.FindStringSubmatch(msg)[1]
+
+	amountMatch := smsAmount.FindStringSubmatch(msg)
+	dateMatch := smsDate.FindStringSubmatch(msg)
+	if amountMatch == nil || dateMatch == nil {
+		return nil, false
+	}
+
+	amount, ok := parseAmount(amountMatch[1])
+	if !ok {
+		return nil, false
+	}
+	when, ok := parseTime(dateMatch[1] + " " + strings.ReplaceAll(dateMatch[2], " ", ""))
+	if !ok {
+		return nil, false
+	}
+
+	tx := &model.MpesaTransaction{
+		ReceiptNo:      receipt,
+		CompletionTime: when,
+		Description:    msg,
+		Source:         FormatSMS,
+	}
+
+	if m := smsBalance.FindStringSubmatch(msg); m != nil {
+		tx.Balance, _ = parseAmount(m[1])
+	}
+	if m := smsFee.FindStringSubmatch(msg); m != nil {
+		tx.Fee, _ = parseAmount(m[1])
+	}
+
+	var m []string
+	switch {
+	case smsReceived.MatchString(msg):
+		m = smsReceived.FindStringSubmatch(msg)
+		tx.Type = model.MpesaReceiveMoney
+	case smsPaybill.MatchString(msg):
+		m = smsPaybill.FindStringSubmatch(msg)
+		tx.Type = model.MpesaPaybill
+	case smsSent.MatchString(msg):
+		m = smsSent.FindStringSubmatch(msg)
+		tx.Type = model.MpesaSendMoney
+	case smsPaid.MatchString(msg):
+		m = smsPaid.FindStringSubmatch(msg)
+		tx.Type = model.MpesaBuyGoods
+	case smsWithdraw.MatchString(msg):
+		m = smsWithdraw.FindStringSubmatch(msg)
+		tx.Type = model.MpesaWithdrawal
+	case smsAirtime.MatchString(msg):
+		tx.Type = model.MpesaAirtime
+		tx.Counterparty = "Safaricom"
+	case smsFuliza.MatchString(msg):
+		tx.Type = model.MpesaFuliza
+	default:
+		tx.Type = model.MpesaOther
+	}
+	if m != nil {
+		tx.Counterparty = cleanCounterparty(m[1])
+	}
+
+	if tx.Type == model.MpesaReceiveMoney {
+		tx.Amount = amount
+	} else {
+		tx.Amount = -amount
+	}
+	return tx, true
+}
+
+// newTransaction builds a transaction from statement columns. Withdrawn
+// amounts may be given with or without a minus sign.
+func newTransaction(receipt, when, details, paidIn, withdrawn, balance string) (*model.MpesaTransaction, bool) {
+	if !isReceipt(receipt) {
+		return nil, false
+	}
+	completion, ok := parseTime(when)
+	if !ok {
+		return nil, false
+	}
+
+	in, okIn := parseAmount(paidIn)
+	out, okOut := parseAmount(withdrawn)
+	if !okIn && !okOut {
+		return nil, false
+	}
+	bal, _ := parseAmount(balance)
+
+	txType := DetectType(details)
+	return &model.MpesaTransaction{
+		ReceiptNo:      receipt,
+		CompletionTime: completion,
+		Type:           txType,
+		Description:    details,
+		Counterparty:   ExtractCounterparty(details, txType),
+		Amount:         math.Abs(in) - math.Abs(out),
+		Balance:        bal,
+	}, true
+}
+
+// mergeCharges folds statement charge rows ("Pay Bill Charge",
+// "Customer Transfer of Funds Charge") into the fee of the transaction
+// sharing their receipt number
+func mergeCharges(txs []*model.MpesaTransaction) []*model.MpesaTransaction {
+	byReceipt := make(map[string]*model.MpesaTransaction)
+	for _, tx := range txs {
+		if !typeCharge.MatchString(tx.Description) {
+			byReceipt[tx.ReceiptNo] = tx
+		}
+	}
+
+	merged := make([]*model.MpesaTransaction, 0, len(txs))
+	for _, tx := range txs {
+		if typeCharge.MatchString(tx.Description) {
+			if parent, ok := byReceipt[tx.ReceiptNo]; ok {
+				parent.Fee += math.Abs(tx.Amount)
+				// the statement balance after the charge is the true balance
+				parent.Balance = tx.Balance
+				continue
+			}
+		}
+		merged = append(merged, tx)
+	}
+	return merged
+}
+
+// DetectType classifies a transaction from its details text
+func DetectType(details string) string {
+	switch {
+	case typeCharge.MatchString(details):
+		return model.MpesaOther
+	case typeFuliza.MatchString(details):
+		return model.MpesaFuliza
+	case typeAirtime.MatchString(details):
+		return model.MpesaAirtime
+	case typeWithdraw.MatchString(details):
+		return model.MpesaWithdrawal
+	case typePaybill.MatchString(details):
+		return model.MpesaPaybill
+	case typeSendMoney.MatchString(details):
+		return model.MpesaSendMoney
+	case typeReceiveMoney.MatchString(details):
+		return model.MpesaReceiveMoney
+	case typeBuyGoods.MatchString(details):
+		return model.MpesaBuyGoods
+	default:
+		return model.MpesaOther
+	}
+}
+
+// ExtractCounterparty pulls the other party's name out of the details text
+func ExtractCounterparty(details, txType string) string {
+	switch txType {
+	case model.MpesaAirtime:
+		return "Safaricom"
+	case model.MpesaOther, model.MpesaFuliza:
+		return ""
+	}
+
+	m := counterpartyAfter.FindStringSubmatch(details)
+	if m == nil {
+		return ""
+	}
+	return cleanCounterparty(m[1])
+}
+
+// cleanCounterparty strips account numbers and phone numbers around a name,
+// e.g. "888880 - KPLC PREPAID Acc. 1234567" or "- 0712***456 JOHN DOE"
+func cleanCounterparty(name string) string {
+	if i := strings.LastIndex(name, " - "); i >= 0 {
+		name = name[i+3:]
+	}
+	name = strings.TrimPrefix(strings.TrimSpace(name), "- ")
+	name = leadingAccount.ReplaceAllString(name, "")
+	name = accountSuffix.ReplaceAllString(name, "")
+	name = trailingPhone.ReplaceAllString(name, "")
+	return strings.TrimRight(name, ". ")
+}
+
+// isReceipt reports whether s looks like an M-PESA receipt code: ten
+// upper-case letters and digits, with at least one letter
+func isReceipt(s string) bool {
+	if len(s) != 10 {
+		return false
+	}
+	hasLetter := false
+	for _, c := range s {
+		switch {
+		case c >= 'A' && c <= 'Z':
+			hasLetter = true
+		case c >= '0' && c <= '9':
+		default:
+			return false
+		}
+	}
+	return hasLetter
+}
+
+// looksLikeTransaction reports whether a line carries a receipt code and an
+// amount, i.e. it should have parsed as a transaction
+func looksLikeTransaction(line string) bool {
+	if !amountPattern.MatchString(line) {
+		return false
+	}
+	for _, f := range strings.Fields(line) {
+		if isReceipt(f) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseAmount(s string) (float64, bool) {
+	s = strings.TrimSpace(strings.ReplaceAll(s, ",", ""))
+	if s == "" {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false
+	}
+	return v, true
+}
+
+var timeLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2-1-2006 15:04",
+	"2/1/2006 15:04:05",
+	"2/1/2006 15:04",
+	"2/1/06 3:04PM",
+	"2/1/2006 3:04PM",
+}
+
+func parseTime(s string) (time.Time, bool) {
+	s = strings.TrimSpace(whitespaceChars.ReplaceAllString(s, " "))
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, eat); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,512 @@
+package mpesa
+
+import (
+	"errors"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"pesalocal/internal/model"
+)
+
+// want is what a test expects of a parsed transaction
+type want struct {
+	receipt      string
+	at           time.Time
+	txType       string
+	counterparty string
+	amount       float64
+	fee          float64
+	balance      float64
+}
+
+func eatTime(year int, month time.Month, day, hour, min, sec int) time.Time {
+	return time.Date(year, month, day, hour, min, sec, 0, eat)
+}
+
+func checkResult(t *testing.T, got *Result, source string, txs []want, unparseable []string) {
+	t.Helper()
+	if len(got.Transactions) != len(txs) {
+		for _, tx := range got.Transactions {
+			t.Logf("parsed %+v", tx)
+		}
+		t.Fatalf("parsed %d transactions, want %d", len(got.Transactions), len(txs))
+	}
+	for i, w := range txs {
+		tx := got.Transactions[i]
+		if tx.ReceiptNo != w.receipt || !tx.CompletionTime.Equal(w.at) || tx.Type != w.txType ||
+			tx.Counterparty != w.counterparty || tx.Amount != w.amount || tx.Fee != w.fee || tx.Balance != w.balance {
+			t.Errorf("transaction %d:\n got %s %s %q %q amount %v fee %v balance %v\nwant %s %s %q %q amount %v fee %v balance %v",
+				i, tx.ReceiptNo, tx.CompletionTime, tx.Type, tx.Counterparty, tx.Amount, tx.Fee, tx.Balance,
+				w.receipt, w.at, w.txType, w.counterparty, w.amount, w.fee, w.balance)
+		}
+		if tx.Source != source {
+			t.Errorf("transaction %d: source %q, want %q", i, tx.Source, source)
+		}
+	}
+	if len(got.Unparseable) != len(unparseable) {
+		t.Fatalf("unparseable %q, want %q", got.Unparseable, unparseable)
+	}
+	for i, line := range unparseable {
+		if got.Unparseable[i] != line {
+			t.Errorf("unparseable %d: %q, want %q", i, got.Unparseable[i], line)
+		}
+	}
+}
+
+func TestParseStatement(t *testing.T) {
+	tests := []struct {
+		name        string
+		text        string
+		txs         []want
+		unparseable []string
+	}{
+		{
+			name: "send money with its charge",
+			text: `SFC25AB3CD 2024-10-04 14:23:11 Customer Transfer to - 0712***678 JOHN DOE Completed 0.00 -500.00 1,234.50
+SFC25AB3CD 2024-10-04 14:23:11 Customer Transfer of Funds Charge Completed 0.00 -7.00 1,227.50`,
+			txs: []want{{"SFC25AB3CD", eatTime(2024, 10, 4, 14, 23, 11), model.MpesaSendMoney, "JOHN DOE", -500, 7, 1227.50}},
+		},
+		{
+			name: "paybill with its charge",
+			text: `SFC45EF6GH 2024-10-04 15:02:45 Pay Bill Online to 888880 - KPLC PREPAID Acc. 12345678901 Completed 0.00 -1,000.00 227.50
+SFC45EF6GH 2024-10-04 15:02:45 Pay Bill Charge Completed 0.00 -13.00 214.50`,
+			txs: []want{{"SFC45EF6GH", eatTime(2024, 10, 4, 15, 2, 45), model.MpesaPaybill, "KPLC PREPAID", -1000, 13, 214.50}},
+		},
+		{
+			name: "every type in one statement",
+			text: `SFD1AA2BB3 2024-10-05 08:10:00 Funds received from - 0722***111 MARY WANJIKU Completed 2,500.00 0.00 2,714.50
+SFD2CC3DD4 2024-10-05 09:30:12 Merchant Payment to 5123456 - MAMA MBOGA STORES Completed 0.00 -350.00 2,364.50
+SFD3EE4FF5 2024-10-05 11:45:00 Customer Withdrawal At Agent Till 123456 - JUJA SHOP Completed 0.00 -1,000.00 1,364.50
+SFD4GG5HH6 2024-10-05 12:00:00 Airtime Purchase Completed 0.00 -50.00 1,314.50
+SFD5JJ6KK7 2024-10-05 18:20 OverDraft of Credit Party Completed 300.00 0.00 1,614.50`,
+			txs: []want{
+				{"SFD1AA2BB3", eatTime(2024, 10, 5, 8, 10, 0), model.MpesaReceiveMoney, "MARY WANJIKU", 2500, 0, 2714.50},
+				{"SFD2CC3DD4", eatTime(2024, 10, 5, 9, 30, 12), model.MpesaBuyGoods, "MAMA MBOGA STORES", -350, 0, 2364.50},
+				{"SFD3EE4FF5", eatTime(2024, 10, 5, 11, 45, 0), model.MpesaWithdrawal, "", -1000, 0, 1364.50},
+				{"SFD4GG5HH6", eatTime(2024, 10, 5, 12, 0, 0), model.MpesaAirtime, "Safaricom", -50, 0, 1314.50},
+				{"SFD5JJ6KK7", eatTime(2024, 10, 5, 18, 20, 0), model.MpesaFuliza, "", 300, 0, 1614.50},
+			},
+		},
+		{
+			name: "headers, footers and failed rows are skipped",
+			text: `M-PESA STATEMENT
+Receipt No. Completion Time Details Transaction Status Paid In Withdrawn Balance
+SFE1AB2CD3 2024-10-06 10:00:00 Customer Transfer to - 0733***222 PETER OTIENO Failed 0.00 -200.00 1,614.50
+SFE2AB2CD3 2024-10-06 10:01:00 Customer Transfer to - 0733***222 PETER OTIENO COMPLETED 0.00 -200.00 1,414.50
+
+Page 1 of 3`,
+			txs: []want{{"SFE2AB2CD3", eatTime(2024, 10, 6, 10, 1, 0), model.MpesaSendMoney, "PETER OTIENO", -200, 0, 1414.50}},
+		},
+		{
+			name: "layout the PWA reads",
+			text: "04-10-2024 14:23 SFC25AB3CD Sent to JOHN DOE 0712345678 0.00 500.00 1,234.50",
+			txs:  []want{{"SFC25AB3CD", eatTime(2024, 10, 4, 14, 23, 0), model.MpesaSendMoney, "JOHN DOE", -500, 0, 1234.50}},
+		},
+		{
+			name: "text wrapped with tabs and runs of spaces",
+			text: "  SFC25AB3CD\t2024-10-04   14:23:11  Customer Transfer to - 0712***678 JOHN DOE\tCompleted 0.00\t-500.00 1,234.50  ",
+			txs:  []want{{"SFC25AB3CD", eatTime(2024, 10, 4, 14, 23, 11), model.MpesaSendMoney, "JOHN DOE", -500, 0, 1234.50}},
+		},
+		{
+			name: "a charge with no transaction is kept",
+			text: "SFF1AB2CD3 2024-10-07 07:00:00 Pay Bill Charge Completed 0.00 -13.00 1,401.50",
+			txs:  []want{{"SFF1AB2CD3", eatTime(2024, 10, 7, 7, 0, 0), model.MpesaOther, "", -13, 0, 1401.50}},
+		},
+		{
+			name: "malformed rows",
+			text: `SFG1AB2CD3 2024-13-04 14:23:11 Customer Transfer to - 0712***678 JOHN DOE Completed 0.00 -500.00 1,234.50
+SFG2AB2CD3 sent 500.00 somewhere
+sfg3ab2cd3 2024-10-04 14:23:11 Customer Transfer to JOHN DOE Completed 0.00 -500.00 1,234.50
+Opening balance 1,734.50`,
+			unparseable: []string{
+				"SFG1AB2CD3 2024-13-04 14:23:11 Customer Transfer to - 0712***678 JOHN DOE Completed 0.00 -500.00 1,234.50",
+				"SFG2AB2CD3 sent 500.00 somewhere",
+			},
+		},
+		{
+			name: "empty",
+			text: "\n\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkResult(t, ParseStatement(tt.text), FormatStatement, tt.txs, tt.unparseable)
+		})
+	}
+}
+
+func TestParseCSV(t *testing.T) {
+	tests := []struct {
+		name        string
+		csv         string
+		txs         []want
+		unparseable []string
+	}{
+		{
+			name: "statement export",
+			csv: `M-PESA STATEMENT,,,,,,
+Customer Name:,JOHN DOE,,,,,
+Statement Period:,01 Oct 2024 - 31 Oct 2024,,,,,
+Receipt No.,Completion Time,Details,Transaction Status,Paid In,Withdrawn,Balance
+SFC25AB3CD,2024-10-04 14:23:11,Customer Transfer to - 0712***678 JOHN DOE,Completed,,-500.00,"1,234.50"
+SFC25AB3CD,2024-10-04 14:23:11,Customer Transfer of Funds Charge,Completed,,-7.00,"1,227.50"
+SFD1AA2BB3,2024-10-05 08:10:00,Funds received from - 0722***111 MARY WANJIKU,Completed,"2,500.00",,"3,727.50"
+SFE1AB2CD3,2024-10-06 10:00:00,Customer Transfer to - 0733***222 PETER OTIENO,Failed,,-200.00,"3,727.50"
+,,,,,,
+SFH1AB2CD3,yesterday,Customer Transfer to - 0733***222 PETER OTIENO,Completed,,-200.00,"3,527.50"
+SFH2AB2CD3,2024-10-07 10:00:00,Customer Transfer to - 0733***222 PETER OTIENO,Completed,,,
+`,
+			txs: []want{
+				{"SFC25AB3CD", eatTime(2024, 10, 4, 14, 23, 11), model.MpesaSendMoney, "JOHN DOE", -500, 7, 1227.50},
+				{"SFD1AA2BB3", eatTime(2024, 10, 5, 8, 10, 0), model.MpesaReceiveMoney, "MARY WANJIKU", 2500, 0, 3727.50},
+			},
+			unparseable: []string{
+				"SFH1AB2CD3,yesterday,Customer Transfer to - 0733***222 PETER OTIENO,Completed,,-200.00,3,527.50",
+				"SFH2AB2CD3,2024-10-07 10:00:00,Customer Transfer to - 0733***222 PETER OTIENO,Completed,,,",
+			},
+		},
+		{
+			name: "columns in another order, withdrawn without a sign",
+			csv: `Completion Time, Receipt No, Details, Paid out, Paid in, Balance
+2024-10-04 14:23,SFC25AB3CD,Pay Bill Online to 888880 - KPLC PREPAID Acc. 12345678901,"1,000.00",,227.50`,
+			txs: []want{{"SFC25AB3CD", eatTime(2024, 10, 4, 14, 23, 0), model.MpesaPaybill, "KPLC PREPAID", -1000, 0, 227.50}},
+		},
+		{
+			name: "receipt that isn't one",
+			csv: `Receipt No.,Date,Details,Paid In,Withdrawn,Balance
+SFC25AB3C,2024-10-04 14:23:11,Customer Transfer to JOHN DOE,,-500.00,1234.50`,
+			unparseable: []string{"SFC25AB3C,2024-10-04 14:23:11,Customer Transfer to JOHN DOE,,-500.00,1234.50"},
+		},
+		{
+			name: "no header row",
+			csv:  "SFC25AB3CD,2024-10-04 14:23:11,Customer Transfer to JOHN DOE,Completed,,-500.00,1234.50\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCSV(strings.NewReader(tt.csv))
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkResult(t, got, FormatCSV, tt.txs, tt.unparseable)
+		})
+	}
+}
+
+func TestParseSMS(t *testing.T) {
+	tests := []struct {
+		name        string
+		text        string
+		txs         []want
+		unparseable []string
+	}{
+		{
+			name: "received",
+			text: "SJ44KL5M6N Confirmed.You have received Ksh1,500.00 from JOHN DOE 0712345678 on 4/10/24 at 3:45 PM New M-PESA balance is Ksh2,727.50. Earn interest daily on Ziidi MMF,Dial *334#",
+			txs:  []want{{"SJ44KL5M6N", eatTime(2024, 10, 4, 15, 45, 0), model.MpesaReceiveMoney, "JOHN DOE", 1500, 0, 2727.50}},
+		},
+		{
+			name: "sent",
+			text: "SJ45AB1CD2 Confirmed. Ksh500.00 sent to JANE WANJIRU 0722111222 on 5/10/24 at 9:05 AM. New M-PESA balance is Ksh2,220.50. Transaction cost, Ksh7.00. Amount you can transact within the day is 499,500.00.",
+			txs:  []want{{"SJ45AB1CD2", eatTime(2024, 10, 5, 9, 5, 0), model.MpesaSendMoney, "JANE WANJIRU", -500, 7, 2220.50}},
+		},
+		{
+			name: "paybill",
+			text: "SJ46AB1CD2 Confirmed. Ksh1,000.00 sent to KPLC PREPAID for account 12345678901 on 5/10/24 at 10:15 AM New M-PESA balance is Ksh1,213.50. Transaction cost, Ksh0.00.",
+			txs:  []want{{"SJ46AB1CD2", eatTime(2024, 10, 5, 10, 15, 0), model.MpesaPaybill, "KPLC PREPAID", -1000, 0, 1213.50}},
+		},
+		{
+			name: "buy goods",
+			text: "SJ47AB1CD2 Confirmed. Ksh350.00 paid to MAMA MBOGA STORES. on 5/10/24 at 12:30 PM.New M-PESA balance is Ksh863.50. Transaction cost, Ksh0.00.",
+			txs:  []want{{"SJ47AB1CD2", eatTime(2024, 10, 5, 12, 30, 0), model.MpesaBuyGoods, "MAMA MBOGA STORES", -350, 0, 863.50}},
+		},
+		{
+			name: "withdrawal",
+			text: "SJ48AB1CD2 Confirmed.on 5/10/24 at 6:10 PMWithdraw Ksh500.00 from 123456 - JUJA AGENT SHOP New M-PESA balance is Ksh334.50. Transaction cost, Ksh29.00.",
+			txs:  []want{{"SJ48AB1CD2", eatTime(2024, 10, 5, 18, 10, 0), model.MpesaWithdrawal, "JUJA AGENT SHOP", -500, 29, 334.50}},
+		},
+		{
+			name: "airtime",
+			text: "SJ49AB1CD2 confirmed.You bought Ksh50.00 of airtime on 5/10/2024 at 7:00 PM.New M-PESA balance is Ksh284.50. Transaction cost, Ksh0.00.",
+			txs:  []want{{"SJ49AB1CD2", eatTime(2024, 10, 5, 19, 0, 0), model.MpesaAirtime, "Safaricom", -50, 0, 284.50}},
+		},
+		{
+			name: "several pasted together",
+			text: `SJ44KL5M6N Confirmed.You have received Ksh1,500.00 from JOHN DOE 0712345678 on 4/10/24 at 3:45 PM New M-PESA balance is Ksh2,727.50.
+
+SJ45AB1CD2 Confirmed. Ksh500.00 sent to JANE WANJIRU 0722111222
+on 5/10/24 at 9:05 AM. New M-PESA balance is Ksh2,220.50. Transaction cost, Ksh7.00.`,
+			txs: []want{
+				{"SJ44KL5M6N", eatTime(2024, 10, 4, 15, 45, 0), model.MpesaReceiveMoney, "JOHN DOE", 1500, 0, 2727.50},
+				{"SJ45AB1CD2", eatTime(2024, 10, 5, 9, 5, 0), model.MpesaSendMoney, "JANE WANJIRU", -500, 7, 2220.50},
+			},
+		},
+		{
+			name: "wording not recognised",
+			text: "SJ50AB1CD2 Confirmed. Ksh20.00 reversed on 6/10/24 at 8:00 AM. New M-PESA balance is Ksh304.50.",
+			txs:  []want{{"SJ50AB1CD2", eatTime(2024, 10, 6, 8, 0, 0), model.MpesaOther, "", -20, 0, 304.50}},
+		},
+		{
+			name: "malformed messages",
+			text: `SJ51AB1CD2 Confirmed. Ksh500.00 sent to JANE WANJIRU on a day I forget.
+SJ52AB1CD2 Confirmed. Sent to JANE WANJIRU on 5/10/24 at 9:05 AM.
+SJ53AB1CD2 Confirmed. Ksh500.00 sent to JANE WANJIRU on 31/2/24 at 9:05 AM.`,
+			unparseable: []string{
+				"SJ51AB1CD2 Confirmed. Ksh500.00 sent to JANE WANJIRU on a day I forget.",
+				"SJ52AB1CD2 Confirmed. Sent to JANE WANJIRU on 5/10/24 at 9:05 AM.",
+				"SJ53AB1CD2 Confirmed. Ksh500.00 sent to JANE WANJIRU on 31/2/24 at 9:05 AM.",
+			},
+		},
+		{
+			name:        "not a confirmation",
+			text:        "  Dear customer, your M-PESA PIN has been reset.\n",
+			unparseable: []string{"Dear customer, your M-PESA PIN has been reset."},
+		},
+		{
+			name: "empty",
+			text: " \n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParseSMS(tt.text)
+			checkResult(t, got, FormatSMS, tt.txs, tt.unparseable)
+			for _, tx := range got.Transactions {
+				if !strings.HasPrefix(tx.Description, tx.ReceiptNo) {
+					t.Errorf("description %q is not the message", tx.Description)
+				}
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	sms := "SJ45AB1CD2 Confirmed. Ksh500.00 sent to JANE WANJIRU 0722111222 on 5/10/24 at 9:05 AM. New M-PESA balance is Ksh2,220.50."
+	csv := "Receipt No.,Completion Time,Details,Transaction Status,Paid In,Withdrawn,Balance\n" +
+		"SFC25AB3CD,2024-10-04 14:23:11,Customer Transfer to - 0712***678 JOHN DOE,Completed,,-500.00,1234.50\n"
+	statement := "SFC25AB3CD 2024-10-04 14:23:11 Customer Transfer to - 0712***678 JOHN DOE Completed 0.00 -500.00 1,234.50"
+
+	tests := []struct {
+		name    string
+		format  string
+		text    string
+		source  string
+		wantErr error
+	}{
+		{"sms detected", "", sms, FormatSMS, nil},
+		{"csv detected", "", csv, FormatCSV, nil},
+		{"statement detected", "", statement, FormatStatement, nil},
+		{"format given", FormatStatement, statement, FormatStatement, nil},
+		{"unknown format", "pdf", statement, "", ErrUnknownFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.format, strings.NewReader(tt.text))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got.Transactions) != 1 || got.Transactions[0].Source != tt.source {
+				t.Errorf("parsed %+v, want one %s transaction", got.Transactions, tt.source)
+			}
+		})
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"confirmation SMS", "SJ45AB1CD2 Confirmed. Ksh500.00 sent to JANE WANJIRU", FormatSMS},
+		{"airtime SMS", "SJ49AB1CD2 confirmed.You bought Ksh50.00 of airtime", FormatSMS},
+		{"SMS after other text", "Forwarded:\nSJ45AB1CD2 Confirmed. Ksh500.00 sent", FormatSMS},
+		{"CSV header first", "Receipt No.,Completion Time,Details,Transaction Status,Paid In,Withdrawn,Balance\n", FormatCSV},
+		{"CSV after a preamble", "M-PESA STATEMENT\nCustomer Name: JOHN DOE\nReceipt No.,Completion Time,Details\n", FormatCSV},
+		{"CSV without the usual header", "a,b,c,d\n1,2,3,4\n", FormatCSV},
+		{"statement text", "M-PESA STATEMENT\nSFC25AB3CD 2024-10-04 14:23:11 Customer Transfer to JOHN DOE Completed 0.00 -500.00 1,234.50", FormatStatement},
+		{"statement with a comma in the first line", "Name: DOE, JOHN\nSFC25AB3CD 2024-10-04 14:23:11 Sent 0.00 -500.00 1,234.50", FormatStatement},
+		{"empty", "", FormatStatement},
+	}
+	for _, tt := range tests {
+		if got := DetectFormat([]byte(tt.text)); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPatterns(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want []string // submatches after the full match; nil for no match
+	}{
+		{"statement line", "SFC25AB3CD 2024-10-04 14:23:11 Customer Transfer to JOHN DOE Completed 0.00 -500.00 1,234.50",
+			[]string{"SFC25AB3CD", "2024-10-04 14:23:11", "Customer Transfer to JOHN DOE", "Completed", "0.00", "-500.00", "1,234.50"}},
+		{"statement line without seconds or status", "SFC25AB3CD 2024-10-04 14:23 Airtime Purchase 0.00 -50.00 1,184.50",
+			[]string{"SFC25AB3CD", "2024-10-04 14:23", "Airtime Purchase", "", "0.00", "-50.00", "1,184.50"}},
+		{"statement line missing the balance", "SFC25AB3CD 2024-10-04 14:23:11 Airtime Purchase Completed 0.00 -50.00", nil},
+		{"statement line with amounts lacking cents", "SFC25AB3CD 2024-10-04 14:23:11 Airtime Purchase Completed 0 -50 1184", nil},
+	}
+	for _, tt := range tests {
+		m := statementLine.FindStringSubmatch(tt.line)
+		if tt.want == nil {
+			if m != nil {
+				t.Errorf("%s: matched %q", tt.name, m)
+			}
+			continue
+		}
+		if m == nil || !reflect.DeepEqual(m[1:], tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, m, tt.want)
+		}
+	}
+
+	legacy := legacyStatementLine.FindStringSubmatch("4-10-2024 9:05 SFC25AB3CD Sent to JOHN DOE 0.00 500.00 1,234.50")
+	if want := []string{"4-10-2024 9:05", "SFC25AB3CD", "Sent to JOHN DOE", "0.00", "500.00", "1,234.50"}; legacy == nil || !reflect.DeepEqual(legacy[1:], want) {
+		t.Errorf("legacy statement line: got %q, want %q", legacy, want)
+	}
+
+	sms := []struct {
+		name  string
+		re    *regexp.Regexp
+		text  string
+		match bool
+	}{
+		{"amount with a space", smsAmount, "Ksh 1,500.00", true},
+		{"amount without cents", smsAmount, "Ksh1500", false},
+		{"fee without a comma", smsFee, "Transaction cost Ksh7.00", true},
+		{"date with a four-digit year", smsDate, "on 5/10/2024 at 9:05AM", true},
+		{"date without a time", smsDate, "on 5/10/2024", false},
+		{"lower-case receipt", smsStart, "sj45ab1cd2 Confirmed.", false},
+		{"receipt too short", smsStart, "SJ45AB1CD Confirmed.", false},
+		{"phone after a name", trailingPhone, "JOHN DOE 0712***678", true},
+		{"short number after a name", trailingPhone, "SHOP 24", false},
+	}
+	for _, tt := range sms {
+		if got := tt.re.MatchString(tt.text); got != tt.match {
+			t.Errorf("%s: %q matched %v, want %v", tt.name, tt.text, got, tt.match)
+		}
+	}
+}
+
+func TestDetectType(t *testing.T) {
+	tests := []struct {
+		details      string
+		txType       string
+		counterparty string
+	}{
+		{"Customer Transfer to - 0712***678 JOHN DOE", model.MpesaSendMoney, "JOHN DOE"},
+		{"Customer Transfer of Funds Charge", model.MpesaOther, ""},
+		{"Funds received from - 0722***111 MARY WANJIKU", model.MpesaReceiveMoney, "MARY WANJIKU"},
+		{"Pay Bill Online to 888880 - KPLC PREPAID Acc. 12345678901", model.MpesaPaybill, "KPLC PREPAID"},
+		{"Pay Bill to 247247 - Equity Paybill Account Acc. 0712345678", model.MpesaPaybill, "Equity Paybill Account"},
+		{"Pay Bill Charge", model.MpesaOther, ""},
+		{"Merchant Payment to 5123456 - MAMA MBOGA STORES", model.MpesaBuyGoods, "MAMA MBOGA STORES"},
+		{"Merchant Payment to 5123456 - ACCESS HARDWARE", model.MpesaBuyGoods, "ACCESS HARDWARE"},
+		{"Buy Goods Till 5123456 paid to NAIVAS on 5/10/24", model.MpesaBuyGoods, "NAIVAS"},
+		{"Customer Withdrawal At Agent Till 123456 - JUJA SHOP", model.MpesaWithdrawal, ""},
+		{"Airtime Purchase", model.MpesaAirtime, "Safaricom"},
+		{"OverDraft of Credit Party", model.MpesaFuliza, ""},
+		{"Fuliza M-Pesa repayment", model.MpesaFuliza, ""},
+		{"Something new", model.MpesaOther, ""},
+	}
+	for _, tt := range tests {
+		txType := DetectType(tt.details)
+		if txType != tt.txType {
+			t.Errorf("DetectType(%q) = %q, want %q", tt.details, txType, tt.txType)
+			continue
+		}
+		if got := ExtractCounterparty(tt.details, txType); got != tt.counterparty {
+			t.Errorf("ExtractCounterparty(%q) = %q, want %q", tt.details, got, tt.counterparty)
+		}
+	}
+}
+
+func TestMergeCharges(t *testing.T) {
+	tx := func(receipt, details string, amount, balance float64) *model.MpesaTransaction {
+		return &model.MpesaTransaction{ReceiptNo: receipt, Description: details, Amount: amount, Balance: balance}
+	}
+	tests := []struct {
+		name string
+		in   []*model.MpesaTransaction
+		want []*model.MpesaTransaction
+	}{
+		{
+			name: "charge after its transaction",
+			in:   []*model.MpesaTransaction{tx("SFC25AB3CD", "Customer Transfer to JOHN DOE", -500, 1234.50), tx("SFC25AB3CD", "Customer Transfer of Funds Charge", -7, 1227.50)},
+			want: []*model.MpesaTransaction{{ReceiptNo: "SFC25AB3CD", Description: "Customer Transfer to JOHN DOE", Amount: -500, Fee: 7, Balance: 1227.50}},
+		},
+		{
+			// statements list the newest first, so the charge comes first
+			name: "charge before its transaction",
+			in:   []*model.MpesaTransaction{tx("SFC25AB3CD", "Pay Bill Charge", -13, 214.50), tx("SFC25AB3CD", "Pay Bill Online to KPLC", -1000, 227.50)},
+			want: []*model.MpesaTransaction{{ReceiptNo: "SFC25AB3CD", Description: "Pay Bill Online to KPLC", Amount: -1000, Fee: 13, Balance: 214.50}},
+		},
+		{
+			name: "charge without its transaction",
+			in:   []*model.MpesaTransaction{tx("SFC25AB3CD", "Pay Bill Charge", -13, 214.50), tx("SFD1AA2BB3", "Funds received from MARY", 100, 314.50)},
+			want: []*model.MpesaTransaction{tx("SFC25AB3CD", "Pay Bill Charge", -13, 214.50), tx("SFD1AA2BB3", "Funds received from MARY", 100, 314.50)},
+		},
+		{
+			name: "charged words inside a name aren't charges",
+			in:   []*model.MpesaTransaction{tx("SFC25AB3CD", "Merchant Payment to CHARGERS LTD", -900, 100), tx("SFC25AB3CD", "Pay Bill Charge", -5, 95)},
+			want: []*model.MpesaTransaction{{ReceiptNo: "SFC25AB3CD", Description: "Merchant Payment to CHARGERS LTD", Amount: -900, Fee: 5, Balance: 95}},
+		},
+		{
+			name: "none",
+			in:   []*model.MpesaTransaction{},
+			want: []*model.MpesaTransaction{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mergeCharges(tt.in)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Time
+		ok   bool
+	}{
+		{"2024-10-04 14:23:11", eatTime(2024, 10, 4, 14, 23, 11), true},
+		{"2024-10-04 14:23", eatTime(2024, 10, 4, 14, 23, 0), true},
+		{"4-10-2024 14:23", eatTime(2024, 10, 4, 14, 23, 0), true},
+		{"04-10-2024 09:05", eatTime(2024, 10, 4, 9, 5, 0), true},
+		{"4/10/2024 14:23:11", eatTime(2024, 10, 4, 14, 23, 11), true},
+		{"4/10/2024 14:23", eatTime(2024, 10, 4, 14, 23, 0), true},
+		{"4/10/24 3:45PM", eatTime(2024, 10, 4, 15, 45, 0), true},
+		{"4/10/24 12:05AM", eatTime(2024, 10, 4, 0, 5, 0), true},
+		{"4/10/2024 3:45PM", eatTime(2024, 10, 4, 15, 45, 0), true},
+		{" 2024-10-04\t 14:23:11 ", eatTime(2024, 10, 4, 14, 23, 11), true},
+		{"2024-10-04T14:23:11Z", time.Time{}, false},
+		{"2024-13-04 14:23:11", time.Time{}, false},
+		{"31/2/2024 10:00", time.Time{}, false},
+		{"4/10/24 3:45 PM", time.Time{}, false}, // the SMS parser joins the time first
+		{"yesterday", time.Time{}, false},
+		{"", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseTime(tt.in)
+		if ok != tt.ok || !got.Equal(tt.want) {
+			t.Errorf("parseTime(%q) = %v, %v; want %v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+		if ok && got.Location() != eat {
+			t.Errorf("parseTime(%q) in %v, want EAT", tt.in, got.Location())
+		}
+	}
+}
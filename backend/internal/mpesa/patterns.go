@@ -0,0 +1,48 @@
+package mpesa
+
+import "regexp"
+
+// Patterns mirror src/services/parser/mpesaPatterns.ts in the PWA, extended
+// with the wording Safaricom uses in full statements and confirmation SMS.
+var (
+	amountPattern = regexp.MustCompile(`-?[\d,]+\.\d{2}`)
+
+	// Statement text as extracted from the PDF, Safaricom layout:
+	// Receipt No. | Completion Time | Details | Status | Paid In | Withdrawn | Balance
+	statementLine = regexp.MustCompile(`^([A-Z0-9]{10})\s+(\d{4}-\d{2}-\d{2}\s+\d{2}:\d{2}(?::\d{2})?)\s+(.+?)\s+(?:((?i:completed|failed))\s+)?(-?[\d,]+\.\d{2})\s+(-?[\d,]+\.\d{2})\s+(-?[\d,]+\.\d{2})$`)
+
+	// Statement text in the layout the PWA parser expects:
+	// Date Time | Receipt | Details | Paid In | Withdrawn | Balance
+	legacyStatementLine = regexp.MustCompile(`^(\d{1,2}-\d{1,2}-\d{4}\s+\d{1,2}:\d{2})\s+([A-Z0-9]{10})\s+(.+?)\s+([\d,]+\.\d{2})\s+([\d,]+\.\d{2})\s+([\d,]+\.\d{2})$`)
+
+	// Transaction type detection
+	typeSendMoney    = regexp.MustCompile(`(?i)sent to|send to|transferred to|customer transfer to`)
+	typeReceiveMoney = regexp.MustCompile(`(?i)received from|you have received|funds received`)
+	typePaybill      = regexp.MustCompile(`(?i)pay ?bill|for account`)
+	typeBuyGoods     = regexp.MustCompile(`(?i)buy goods|till|merchant payment|paid to`)
+	typeWithdraw     = regexp.MustCompile(`(?i)withdraw`)
+	typeAirtime      = regexp.MustCompile(`(?i)airtime`)
+	typeFuliza       = regexp.MustCompile(`(?i)fuliza|overdraft`)
+	typeCharge       = regexp.MustCompile(`(?i)\bcharge\b`)
+
+	// Counterparty extraction
+	counterpartyAfter = regexp.MustCompile(`(?i)\b(?:to|from)\s+(.+?)(?:\s+on\s+\d|\s+at\s+\d|$)`)
+	leadingAccount    = regexp.MustCompile(`^[\d*]+\s*(?:-\s*)?`)
+	accountSuffix     = regexp.MustCompile(`(?i)\s+acc(?:ount)?(?:\.\s*|\s+)[\w-]+$`)
+
+	// Confirmation SMS
+	smsStart        = regexp.MustCompile(`\b([A-Z0-9]{10})\s+[Cc]onfirmed\b`) // airtime messages say "confirmed"
+	smsAmount       = regexp.MustCompile(`Ksh\s?([\d,]+\.\d{2})`)
+	smsBalance      = regexp.MustCompile(`(?i)balance is Ksh\s?([\d,]+\.\d{2})`)
+	smsFee          = regexp.MustCompile(`(?i)transaction cost,?\s*Ksh\s?([\d,]+\.\d{2})`)
+	smsDate         = regexp.MustCompile(`(?i)on (\d{1,2}/\d{1,2}/\d{2,4}) at (\d{1,2}:\d{2}\s?[AP]M)`)
+	smsReceived     = regexp.MustCompile(`(?i)received Ksh\s?[\d,]+\.\d{2} from (.+?) on \d`)
+	smsPaybill      = regexp.MustCompile(`(?i)Ksh\s?[\d,]+\.\d{2} sent to (.+?) for account`)
+	smsSent         = regexp.MustCompile(`(?i)Ksh\s?[\d,]+\.\d{2} sent to (.+?) on \d`)
+	smsPaid         = regexp.MustCompile(`(?i)Ksh\s?[\d,]+\.\d{2} paid to (.+?)\.? on \d`)
+	smsWithdraw     = regexp.MustCompile(`(?i)withdraw Ksh\s?[\d,]+\.\d{2} from (.+?)\s+New`)
+	smsAirtime      = regexp.MustCompile(`(?i)bought Ksh\s?[\d,]+\.\d{2} of airtime`)
+	smsFuliza       = regexp.MustCompile(`(?i)fuliza`)
+	trailingPhone   = regexp.MustCompile(`\s+[\d*]{9,13}$`)
+	whitespaceChars = regexp.MustCompile(`\s+`)
+)
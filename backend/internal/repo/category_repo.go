@@ -0,0 +1,159 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"pesalocal/internal/model"
+)
+
+const categoryColumns = "id, name, parent_id, emoji, version, updated_at"
+
+// categoryIDMatch matches a category by ID, or by an ID merged into it;
+// the ID is bound twice
+const categoryIDMatch = "id = COALESCE((SELECT category_id FROM category_aliases WHERE id=?), ?)"
+
+type CategoryRepo struct {
+	db *sql.DB
+}
+
+func NewCategoryRepo(db *sql.DB) *CategoryRepo {
+	return &CategoryRepo{db: db}
+}
+
+// CreateOrUpdate ensures idempotent behavior for sync. Names are unique,
+// so a category arriving under a new ID with the name of one already held
+// (made by another device, or by the server for an imported product) is
+// the same category: its ID is kept as an alias of the one held, and c.ID
+// is set to that. A parent given by an alias is stored as the category it
+// names. Times are stored in UTC so they compare correctly as text.
+func (r *CategoryRepo) CreateOrUpdate(c *model.Category) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if c.ParentID != "" {
+		if err := tx.QueryRow(
+			"SELECT COALESCE((SELECT category_id FROM category_aliases WHERE id=?), ?)", c.ParentID, c.ParentID,
+		).Scan(&c.ParentID); err != nil {
+			return err
+		}
+	}
+
+	existing, err := scanCategory(tx.QueryRow("SELECT "+categoryColumns+" FROM categories WHERE "+categoryIDMatch, c.ID, c.ID))
+	if errors.Is(err, sql.ErrNoRows) {
+		existing, err = scanCategory(tx.QueryRow("SELECT "+categoryColumns+" FROM categories WHERE name=? COLLATE NOCASE", c.Name))
+		if err == nil {
+			if _, err := tx.Exec("INSERT INTO category_aliases (id, category_id) VALUES (?, ?)", c.ID, existing.ID); err != nil {
+				return err
+			}
+		}
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		if _, err := tx.Exec(
+			"INSERT INTO categories ("+categoryColumns+") VALUES (?, ?, ?, ?, ?, ?)",
+			c.ID, c.Name, c.ParentID, c.Emoji, c.Version, c.UpdatedAt.UTC(),
+		); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+	if err != nil {
+		return err
+	}
+
+	merged := existing.ID != c.ID
+	c.ID = existing.ID
+	// Update only if version is newer; a merged category's details count
+	// when they are at least as new
+	if c.Version < existing.Version || (c.Version == existing.Version && !merged) {
+		if merged {
+			// the device that merged it pulls the ID to use
+			if _, err := tx.Exec("UPDATE categories SET updated_at=? WHERE id=?", c.UpdatedAt.UTC(), c.ID); err != nil {
+				return err
+			}
+		}
+		return tx.Commit()
+	}
+
+	if _, err := tx.Exec(
+		"UPDATE categories SET name=?, parent_id=?, emoji=?, version=?, updated_at=? WHERE id=?",
+		c.Name, c.ParentID, c.Emoji, c.Version, c.UpdatedAt.UTC(), c.ID,
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetByID returns a category by its ID or one merged into it, or nil if
+// it doesn't exist
+func (r *CategoryRepo) GetByID(id string) (*model.Category, error) {
+	row := r.db.QueryRow("SELECT "+categoryColumns+" FROM categories WHERE "+categoryIDMatch, id, id)
+	c, err := scanCategory(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil // not found
+	}
+	return c, err
+}
+
+// GetByName returns a category by name (case-insensitive), or nil
+func (r *CategoryRepo) GetByName(name string) (*model.Category, error) {
+	row := r.db.QueryRow("SELECT "+categoryColumns+" FROM categories WHERE name=? COLLATE NOCASE", name)
+	c, err := scanCategory(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil // not found
+	}
+	return c, err
+}
+
+// GetAll returns all categories by name
+func (r *CategoryRepo) GetAll() ([]*model.Category, error) {
+	rows, err := r.db.Query("SELECT " + categoryColumns + " FROM categories ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var categories []*model.Category
+	for rows.Next() {
+		c, err := scanCategory(rows)
+		if err != nil {
+			return nil, err
+		}
+		categories = append(categories, c)
+	}
+	return categories, rows.Err()
+}
+
+// GetUpdatedSince returns categories changed at or after t, by name
+func (r *CategoryRepo) GetUpdatedSince(t time.Time) ([]*model.Category, error) {
+	rows, err := r.db.Query("SELECT "+categoryColumns+" FROM categories WHERE updated_at >= ? ORDER BY name", t.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := []*model.Category{}
+	for rows.Next() {
+		c, err := scanCategory(rows)
+		if err != nil {
+			return nil, err
+		}
+		categories = append(categories, c)
+	}
+	return categories, rows.Err()
+}
+
+func scanCategory(row rowScanner) (*model.Category, error) {
+	c := &model.Category{}
+	var parentID, emoji sql.NullString
+	if err := row.Scan(&c.ID, &c.Name, &parentID, &emoji, &c.Version, &c.UpdatedAt); err != nil {
+		return nil, err
+	}
+	c.ParentID = parentID.String
+	c.Emoji = emoji.String
+	return c, nil
+}
@@ -0,0 +1,136 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+
+	"pesalocal/internal/model"
+)
+
+const (
+	dayCloseColumns      = "id, date, device_id, opening_float, counted_cash, closed_by, closed_at"
+	dayAdjustmentColumns = "id, date, device_id, amount, method, reason, source_type, source_id, created_by, created_at"
+)
+
+var ErrDayAlreadyClosed = errors.New("day already closed")
+
+// DayCloseRepo stores closed trading days and the adjustments made to them
+type DayCloseRepo struct {
+	db *sql.DB
+}
+
+func NewDayCloseRepo(db *sql.DB) *DayCloseRepo {
+	return &DayCloseRepo{db: db}
+}
+
+// Create records a day close. Each day closes once per device and once
+// for the whole shop.
+func (r *DayCloseRepo) Create(c *model.DayClose) error {
+	res, err := r.db.Exec(
+		"INSERT OR IGNORE INTO day_closes ("+dayCloseColumns+") VALUES (?, ?, ?, ?, ?, ?, ?)",
+		c.ID, c.Date, c.DeviceID, c.OpeningFloat, c.CountedCash, c.ClosedBy, c.ClosedAt,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrDayAlreadyClosed
+	}
+	return nil
+}
+
+// Get returns the close of a day for a device ("" for the whole shop), or
+// nil if it is still open
+func (r *DayCloseRepo) Get(date, deviceID string) (*model.DayClose, error) {
+	row := r.db.QueryRow("SELECT "+dayCloseColumns+" FROM day_closes WHERE date=? AND device_id=?", date, deviceID)
+	c := &model.DayClose{}
+	err := row.Scan(&c.ID, &c.Date, &c.DeviceID, &c.OpeningFloat, &c.CountedCash, &c.ClosedBy, &c.ClosedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil // still open
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// IsClosed reports whether a day is closed for a device, either on its
+// own or because the whole shop has closed
+func (r *DayCloseRepo) IsClosed(date, deviceID string) (bool, error) {
+	var n int
+	err := r.db.QueryRow(
+		"SELECT COUNT(*) FROM day_closes WHERE date=? AND (device_id='' OR device_id=?)",
+		date, deviceID,
+	).Scan(&n)
+	return n > 0, err
+}
+
+// GetBetween returns closes for dates in [from, to], oldest first
+func (r *DayCloseRepo) GetBetween(from, to string) ([]*model.DayClose, error) {
+	rows, err := r.db.Query(
+		"SELECT "+dayCloseColumns+" FROM day_closes WHERE date >= ? AND date <= ? ORDER BY date ASC, device_id ASC",
+		from, to,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	closes := []*model.DayClose{}
+	for rows.Next() {
+		c := &model.DayClose{}
+		if err := rows.Scan(&c.ID, &c.Date, &c.DeviceID, &c.OpeningFloat, &c.CountedCash, &c.ClosedBy, &c.ClosedAt); err != nil {
+			return nil, err
+		}
+		closes = append(closes, c)
+	}
+	return closes, rows.Err()
+}
+
+// AddAdjustment records a correction to a closed day
+func (r *DayCloseRepo) AddAdjustment(a *model.DayAdjustment) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := insertDayAdjustment(tx, a); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// insertDayAdjustment records a correction to a closed day as part of a
+// larger transaction, such as a sale synced after its day closed. Times
+// are stored in UTC so they compare correctly as text.
+func insertDayAdjustment(tx *sql.Tx, a *model.DayAdjustment) error {
+	_, err := tx.Exec(
+		"INSERT OR IGNORE INTO day_adjustments ("+dayAdjustmentColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		a.ID, a.Date, a.DeviceID, a.Amount, a.Method, a.Reason, a.SourceType, a.SourceID, a.CreatedBy, a.CreatedAt.UTC(),
+	)
+	return err
+}
+
+// GetAdjustments returns a day's adjustments. With a device, only that
+// device's adjustments; without, all of them.
+func (r *DayCloseRepo) GetAdjustments(date, deviceID string) ([]*model.DayAdjustment, error) {
+	rows, err := r.db.Query(
+		"SELECT "+dayAdjustmentColumns+" FROM day_adjustments WHERE date=? AND (?='' OR device_id=?) ORDER BY created_at ASC",
+		date, deviceID, deviceID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	adjustments := []*model.DayAdjustment{}
+	for rows.Next() {
+		a := &model.DayAdjustment{}
+		if err := rows.Scan(&a.ID, &a.Date, &a.DeviceID, &a.Amount, &a.Method, &a.Reason, &a.SourceType, &a.SourceID, &a.CreatedBy, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		adjustments = append(adjustments, a)
+	}
+	return adjustments, rows.Err()
+}
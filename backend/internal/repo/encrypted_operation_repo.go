@@ -0,0 +1,58 @@
+package repo
+
+import (
+	"database/sql"
+
+	"pesalocal/internal/model"
+)
+
+const encryptedOperationColumns = "seq, id, entity_type, entity_id, version, operation, key_id, payload, device_id, created_at"
+
+type EncryptedOperationRepo struct {
+	db *sql.DB
+}
+
+func NewEncryptedOperationRepo(db *sql.DB) *EncryptedOperationRepo {
+	return &EncryptedOperationRepo{db: db}
+}
+
+// Create stores an operation for relaying and sets its sequence number.
+// An operation already stored (a device retrying a push) is left as it
+// is, and reports false.
+func (r *EncryptedOperationRepo) Create(op *model.EncryptedOperation) (bool, error) {
+	res, err := r.db.Exec(
+		`INSERT OR IGNORE INTO encrypted_operations (id, entity_type, entity_id, version, operation, key_id, payload, device_id, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		op.ID, op.EntityType, op.EntityID, op.Version, op.Operation, op.KeyID, op.Payload, op.DeviceID, op.CreatedAt,
+	)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	op.Seq, err = res.LastInsertId()
+	return true, err
+}
+
+// GetAfter returns up to limit operations received after seq, oldest first
+func (r *EncryptedOperationRepo) GetAfter(seq int64, limit int) ([]*model.EncryptedOperation, error) {
+	rows, err := r.db.Query(
+		"SELECT "+encryptedOperationColumns+" FROM encrypted_operations WHERE seq > ? ORDER BY seq LIMIT ?",
+		seq, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ops := []*model.EncryptedOperation{}
+	for rows.Next() {
+		op := &model.EncryptedOperation{}
+		if err := rows.Scan(&op.Seq, &op.ID, &op.EntityType, &op.EntityID, &op.Version, &op.Operation, &op.KeyID, &op.Payload, &op.DeviceID, &op.CreatedAt); err != nil {
+			return nil, err
+		}
+		ops = append(ops, op)
+	}
+	return ops, rows.Err()
+}
@@ -0,0 +1,166 @@
+package repo
+
+import (
+	"database/sql"
+	"fmt"
+
+	"pesalocal/internal/fieldcrypt"
+)
+
+// Columns holding personal data, encrypted when database keys are
+// configured
+const (
+	colUserEmail         = "users.email"
+	colSupplierPhone     = "suppliers.phone"
+	colSupplierAccount   = "suppliers.account"
+	colMpesaCounterparty = "mpesa_transactions.counterparty"
+	colMpesaDescription  = "mpesa_transactions.description"
+	colSyncPayload       = "sync_operations.payload"
+)
+
+// encryptedColumns lists the encrypted columns by table, with the column
+// holding each one's blind index, if it has one
+var encryptedColumns = []struct {
+	table   string
+	columns []string
+	blinds  map[string]string
+}{
+	{"users", []string{"email"}, map[string]string{"email": "email_hash"}},
+	{"suppliers", []string{"phone", "account"}, nil},
+	{"mpesa_transactions", []string{"counterparty", "description"}, nil},
+	{"sync_operations", []string{"payload"}, nil},
+}
+
+// EncryptionRepo keeps the encrypted columns under the current key
+type EncryptionRepo struct {
+	db   *sql.DB
+	keys *fieldcrypt.Keyring
+}
+
+func NewEncryptionRepo(db *sql.DB, keys *fieldcrypt.Keyring) *EncryptionRepo {
+	return &EncryptionRepo{db: db, keys: keys}
+}
+
+// Rekey encrypts every value of the encrypted columns that isn't under the
+// current key: plaintext stored before encryption was turned on, and
+// values under a key being rotated out. Once it has run, only the current
+// key is needed. It returns the values rewritten by column.
+//
+// When it rewrites anything it vacuums the database afterwards, so the
+// old values don't survive in free pages or the write-ahead log.
+//
+// With no keys configured it only checks nothing is encrypted, since those
+// values couldn't be read.
+func (r *EncryptionRepo) Rekey() (map[string]int64, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rewritten := map[string]int64{}
+	for _, t := range encryptedColumns {
+		for _, column := range t.columns {
+			name := t.table + "." + column
+			n, err := r.rekeyColumn(tx, t.table, column, t.blinds[column])
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			if n > 0 {
+				rewritten[name] = n
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	if len(rewritten) == 0 {
+		return rewritten, nil
+	}
+	if _, err := r.db.Exec("VACUUM"); err != nil {
+		return nil, fmt.Errorf("vacuum: %w", err)
+	}
+	if _, err := r.db.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		return nil, fmt.Errorf("checkpoint: %w", err)
+	}
+	return rewritten, nil
+}
+
+func (r *EncryptionRepo) rekeyColumn(tx *sql.Tx, table, column, blindColumn string) (int64, error) {
+	name := table + "." + column
+	selectBlind := "''"
+	if blindColumn != "" {
+		selectBlind = blindColumn
+	}
+	rows, err := tx.Query(`SELECT id, COALESCE(` + column + `, ''), COALESCE(` + selectBlind + `, '') FROM ` + table)
+	if err != nil {
+		return 0, err
+	}
+	type change struct{ id, value, blind string }
+	var changes []change
+	for rows.Next() {
+		var id, stored, blind string
+		if err := rows.Scan(&id, &stored, &blind); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		plain, err := r.keys.Decrypt(name, stored)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		c := change{id: id, value: stored, blind: r.keys.Blind(name, plain)}
+		if stored != "" && fieldcrypt.KeyID(stored) != r.keys.Current() {
+			if c.value, err = r.keys.Encrypt(name, plain); err != nil {
+				rows.Close()
+				return 0, err
+			}
+		}
+		if c.value != stored || (blindColumn != "" && c.blind != blind) {
+			changes = append(changes, c)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, c := range changes {
+		var err error
+		if blindColumn != "" {
+			_, err = tx.Exec(`UPDATE `+table+` SET `+column+`=?, `+blindColumn+`=? WHERE id=?`, c.value, c.blind, c.id)
+		} else {
+			_, err = tx.Exec(`UPDATE `+table+` SET `+column+`=? WHERE id=?`, c.value, c.id)
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(changes)), nil
+}
+
+// decryptRow decrypts the encrypted columns of a row read by column name
+func decryptRow(keys *fieldcrypt.Keyring, table string, row map[string]interface{}) error {
+	for _, t := range encryptedColumns {
+		if t.table != table {
+			continue
+		}
+		for _, column := range t.columns {
+			var stored string
+			switch v := row[column].(type) {
+			case string:
+				stored = v
+			case []byte:
+				stored = string(v)
+			default:
+				continue
+			}
+			plain, err := keys.Decrypt(table+"."+column, stored)
+			if err != nil {
+				return err
+			}
+			row[column] = plain
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package repo
+
+import (
+	"database/sql"
+	"time"
+
+	"pesalocal/internal/model"
+)
+
+// ExportRepo reads rows for export one at a time, so exports of any size
+// don't have to fit in memory
+type ExportRepo struct {
+	db *sql.DB
+}
+
+func NewExportRepo(db *sql.DB) *ExportRepo {
+	return &ExportRepo{db: db}
+}
+
+// SaleLines calls fn for each item of the sales made in [from, to), oldest
+// sale first
+func (r *ExportRepo) SaleLines(from, to time.Time, fn func(*model.SaleLine) error) error {
+	rows, err := r.db.Query(
+		`SELECT s.id, COALESCE(s.receipt_no, 0), s.created_at, COALESCE(s.user_id, ''), COALESCE(s.device_id, ''),
+			COALESCE(s.payment_method, ''), COALESCE(s.payment_status, ''), COALESCE(s.mpesa_receipt, ''), s.total,
+			si.id, si.product_id, COALESCE(p.name, ''), si.quantity, si.price, COALESCE(si.discount, 0), si.total,
+			COALESCE(si.cost, 0)
+		FROM sales s JOIN sale_items si ON si.sale_id = s.id
+		LEFT JOIN products p ON p.id = si.product_id
+		WHERE s.created_at >= ? AND s.created_at < ?
+		ORDER BY s.created_at ASC, s.id, si.rowid`,
+		from.UTC(), to.UTC(),
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		l := &model.SaleLine{}
+		if err := rows.Scan(
+			&l.SaleID, &l.ReceiptNo, &l.CreatedAt, &l.UserID, &l.DeviceID,
+			&l.PaymentMethod, &l.PaymentStatus, &l.MpesaReceipt, &l.SaleTotal,
+			&l.ItemID, &l.ProductID, &l.ProductName, &l.Quantity, &l.Price, &l.Discount, &l.Total,
+			&l.Cost,
+		); err != nil {
+			return err
+		}
+		if err := fn(l); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// PurchaseLines calls fn for each item of the purchases made in [from, to),
+// oldest purchase first
+func (r *ExportRepo) PurchaseLines(from, to time.Time, fn func(*model.PurchaseLine) error) error {
+	rows, err := r.db.Query(
+		`SELECT pu.id, pu.created_at, COALESCE(pu.supplier_id, ''), COALESCE(pu.supplier, ''),
+			COALESCE(pu.payment_method, ''), pu.total_amount,
+			pi.id, pi.product_id, COALESCE(p.name, ''), pi.quantity, pi.price, pi.total, pi.expiry_date
+		FROM purchases pu JOIN purchase_items pi ON pi.purchase_id = pu.id
+		LEFT JOIN products p ON p.id = pi.product_id
+		WHERE pu.created_at >= ? AND pu.created_at < ?
+		ORDER BY pu.created_at ASC, pu.id, pi.rowid`,
+		from.UTC(), to.UTC(),
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		l := &model.PurchaseLine{}
+		var expiry sql.NullTime
+		if err := rows.Scan(
+			&l.PurchaseID, &l.CreatedAt, &l.SupplierID, &l.Supplier,
+			&l.PaymentMethod, &l.PurchaseTotal,
+			&l.ItemID, &l.ProductID, &l.ProductName, &l.Quantity, &l.Price, &l.Total, &expiry,
+		); err != nil {
+			return err
+		}
+		if expiry.Valid {
+			l.ExpiryDate = &expiry.Time
+		}
+		if err := fn(l); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// ProductStock calls fn for each product with its current stock and value,
+// by name
+func (r *ExportRepo) ProductStock(fn func(*model.ProductStock) error) error {
+	rows, err := r.db.Query(
+		`SELECT id, COALESCE(name, ''), COALESCE(category, ''), COALESCE(barcode, ''), COALESCE(price, 0),
+			COALESCE(stock, 0), COALESCE(average_cost, 0),
+			ROUND(COALESCE(stock, 0) * COALESCE(average_cost, 0), 2), ROUND(COALESCE(stock, 0) * COALESCE(price, 0), 2)
+		FROM products
+		ORDER BY name COLLATE NOCASE, id`,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p := &model.ProductStock{}
+		if err := rows.Scan(&p.ID, &p.Name, &p.Category, &p.Barcode, &p.Price, &p.Stock, &p.AverageCost,
+			&p.StockValue, &p.RetailValue); err != nil {
+			return err
+		}
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
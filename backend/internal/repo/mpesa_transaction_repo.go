@@ -0,0 +1,129 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"pesalocal/internal/fieldcrypt"
+	"pesalocal/internal/model"
+)
+
+type MpesaTransactionRepo struct {
+	db   *sql.DB
+	keys *fieldcrypt.Keyring // encrypts who was paid and the details
+}
+
+func NewMpesaTransactionRepo(db *sql.DB, keys *fieldcrypt.Keyring) *MpesaTransactionRepo {
+	return &MpesaTransactionRepo{db: db, keys: keys}
+}
+
+// Create inserts an M-PESA transaction. Completion times are stored in
+// UTC so they compare correctly as text.
+func (r *MpesaTransactionRepo) Create(t *model.MpesaTransaction) error {
+	description, err := r.keys.Encrypt(colMpesaDescription, t.Description)
+	if err != nil {
+		return err
+	}
+	counterparty, err := r.keys.Encrypt(colMpesaCounterparty, t.Counterparty)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(
+		`INSERT INTO mpesa_transactions
+		(id, receipt_no, completion_time, type, description, counterparty, amount, fee, balance, source, created_at, sale_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		t.ID, t.ReceiptNo, t.CompletionTime.UTC(), t.Type, description, counterparty,
+		t.Amount, t.Fee, t.Balance, t.Source, t.CreatedAt, t.SaleID,
+	)
+	return err
+}
+
+// GetByReceiptNo returns a transaction by its M-PESA receipt code
+func (r *MpesaTransactionRepo) GetByReceiptNo(receiptNo string) (*model.MpesaTransaction, error) {
+	row := r.db.QueryRow(
+		`SELECT id, receipt_no, completion_time, type, description, counterparty, amount, fee, balance, source, created_at, sale_id
+		FROM mpesa_transactions WHERE receipt_no=?`, receiptNo,
+	)
+	t := &model.MpesaTransaction{}
+	var saleID sql.NullString
+	err := row.Scan(
+		&t.ID, &t.ReceiptNo, &t.CompletionTime, &t.Type, &t.Description, &t.Counterparty,
+		&t.Amount, &t.Fee, &t.Balance, &t.Source, &t.CreatedAt, &saleID,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil // not found
+		}
+		return nil, err
+	}
+	t.SaleID = saleID.String
+	return t, decryptMpesaTransaction(t, r.keys)
+}
+
+// GetAll returns all M-PESA transactions, newest first
+func (r *MpesaTransactionRepo) GetAll() ([]*model.MpesaTransaction, error) {
+	rows, err := r.db.Query(
+		`SELECT id, receipt_no, completion_time, type, description, counterparty, amount, fee, balance, source, created_at, sale_id
+		FROM mpesa_transactions ORDER BY completion_time DESC`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanMpesaTransactions(rows, r.keys)
+}
+
+// GetBetween returns transactions completed in [from, to), oldest first
+func (r *MpesaTransactionRepo) GetBetween(from, to time.Time) ([]*model.MpesaTransaction, error) {
+	rows, err := r.db.Query(
+		`SELECT id, receipt_no, completion_time, type, description, counterparty, amount, fee, balance, source, created_at, sale_id
+		FROM mpesa_transactions WHERE completion_time >= ? AND completion_time < ? ORDER BY completion_time ASC`,
+		from.UTC(), to.UTC(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanMpesaTransactions(rows, r.keys)
+}
+
+func scanMpesaTransactions(rows *sql.Rows, keys *fieldcrypt.Keyring) ([]*model.MpesaTransaction, error) {
+	defer rows.Close()
+
+	var txs []*model.MpesaTransaction
+	for rows.Next() {
+		t := &model.MpesaTransaction{}
+		var saleID sql.NullString
+		if err := rows.Scan(
+			&t.ID, &t.ReceiptNo, &t.CompletionTime, &t.Type, &t.Description, &t.Counterparty,
+			&t.Amount, &t.Fee, &t.Balance, &t.Source, &t.CreatedAt, &saleID,
+		); err != nil {
+			return nil, err
+		}
+		t.SaleID = saleID.String
+		if err := decryptMpesaTransaction(t, keys); err != nil {
+			return nil, err
+		}
+		txs = append(txs, t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return txs, nil
+}
+
+// decryptMpesaTransaction reads a transaction's details as stored
+func decryptMpesaTransaction(t *model.MpesaTransaction, keys *fieldcrypt.Keyring) error {
+	var err error
+	if t.Description, err = keys.Decrypt(colMpesaDescription, t.Description); err != nil {
+		return err
+	}
+	t.Counterparty, err = keys.Decrypt(colMpesaCounterparty, t.Counterparty)
+	return err
+}
+
+// SetSaleID links a transaction to the sale it paid for
+func (r *MpesaTransactionRepo) SetSaleID(id, saleID string) error {
+	_, err := r.db.Exec("UPDATE mpesa_transactions SET sale_id=? WHERE id=?", saleID, id)
+	return err
+}
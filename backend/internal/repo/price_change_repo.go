@@ -0,0 +1,92 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"pesalocal/internal/model"
+)
+
+const priceChangeColumns = "id, product_id, old_price, price, status, changed_by, device_id, effective_at, created_at"
+
+type PriceChangeRepo struct {
+	db *sql.DB
+}
+
+func NewPriceChangeRepo(db *sql.DB) *PriceChangeRepo {
+	return &PriceChangeRepo{db: db}
+}
+
+// Save inserts a price change, or updates the status and old price of one
+// already recorded (a scheduled change being applied or cancelled).
+// Effective times are stored in UTC so they compare correctly as text.
+func (r *PriceChangeRepo) Save(c *model.PriceChange) error {
+	_, err := r.db.Exec(
+		"INSERT INTO price_changes ("+priceChangeColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?) "+
+			"ON CONFLICT(id) DO UPDATE SET old_price=excluded.old_price, status=excluded.status",
+		c.ID, c.ProductID, c.OldPrice, c.Price, c.Status, c.ChangedBy, c.DeviceID, c.EffectiveAt.UTC(), c.CreatedAt,
+	)
+	return err
+}
+
+// GetByID returns a price change, or nil if it doesn't exist
+func (r *PriceChangeRepo) GetByID(id string) (*model.PriceChange, error) {
+	row := r.db.QueryRow("SELECT "+priceChangeColumns+" FROM price_changes WHERE id=?", id)
+	c, err := scanPriceChange(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil // not found
+	}
+	return c, err
+}
+
+// GetApplied returns a product's applied changes in [from, to), oldest first
+func (r *PriceChangeRepo) GetApplied(productID string, from, to time.Time) ([]*model.PriceChange, error) {
+	return r.query(
+		"SELECT "+priceChangeColumns+" FROM price_changes WHERE product_id=? AND status=? AND effective_at >= ? AND effective_at < ? ORDER BY effective_at ASC",
+		productID, model.PriceChangeApplied, from.UTC(), to.UTC(),
+	)
+}
+
+// GetScheduled returns a product's scheduled changes, soonest first
+func (r *PriceChangeRepo) GetScheduled(productID string) ([]*model.PriceChange, error) {
+	return r.query(
+		"SELECT "+priceChangeColumns+" FROM price_changes WHERE product_id=? AND status=? ORDER BY effective_at ASC",
+		productID, model.PriceChangeScheduled,
+	)
+}
+
+// GetDue returns scheduled changes whose time has come, oldest first
+func (r *PriceChangeRepo) GetDue(now time.Time) ([]*model.PriceChange, error) {
+	return r.query(
+		"SELECT "+priceChangeColumns+" FROM price_changes WHERE status=? AND effective_at <= ? ORDER BY effective_at ASC",
+		model.PriceChangeScheduled, now.UTC(),
+	)
+}
+
+func (r *PriceChangeRepo) query(query string, args ...interface{}) ([]*model.PriceChange, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []*model.PriceChange{}
+	for rows.Next() {
+		c, err := scanPriceChange(rows)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, c)
+	}
+	return changes, rows.Err()
+}
+
+func scanPriceChange(row rowScanner) (*model.PriceChange, error) {
+	c := &model.PriceChange{}
+	err := row.Scan(&c.ID, &c.ProductID, &c.OldPrice, &c.Price, &c.Status, &c.ChangedBy, &c.DeviceID, &c.EffectiveAt, &c.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
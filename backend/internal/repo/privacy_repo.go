@@ -0,0 +1,339 @@
+package repo
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+
+	"pesalocal/internal/fieldcrypt"
+	"pesalocal/internal/model"
+)
+
+const erasureColumns = "id, subject_type, subject_id, requested_by, reason, deleted, scrubbed, verified, created_at"
+
+// userColumns are the columns recording which user did something, by
+// table. The rows are the shop's records; erasing a user clears these.
+var userColumns = []struct{ table, column string }{
+	{"sales", "user_id"},
+	{"returns", "user_id"},
+	{"stock_takes", "user_id"},
+	{"price_changes", "changed_by"},
+	{"day_closes", "closed_by"},
+	{"day_adjustments", "created_by"},
+	{"products", "updated_by"},
+}
+
+// userChildren are the rows belonging to rows a user made, exported with
+// them
+var userChildren = []struct{ table, column, parent, parentColumn string }{
+	{"sale_items", "sale_id", "sales", "user_id"},
+	{"sale_promotions", "sale_id", "sales", "user_id"},
+	{"return_items", "return_id", "returns", "user_id"},
+	{"stock_counts", "stock_take_id", "stock_takes", "user_id"},
+}
+
+// Columns never exported
+var secretColumns = map[string]map[string]bool{
+	"users": {"password": true, "email_hash": true},
+}
+
+// RowFilter selects rows of one table
+type RowFilter struct {
+	Table string
+	Where string
+	Args  []interface{}
+}
+
+type PrivacyRepo struct {
+	db   *sql.DB
+	keys *fieldcrypt.Keyring // exports are decrypted
+}
+
+func NewPrivacyRepo(db *sql.DB, keys *fieldcrypt.Keyring) *PrivacyRepo {
+	return &PrivacyRepo{db: db, keys: keys}
+}
+
+// UserRows selects everything recorded about a user: their account, what
+// they did, and the sync operations that mention them
+func (r *PrivacyRepo) UserRows(userID string) ([]RowFilter, error) {
+	filters := []RowFilter{{Table: "users", Where: "id=?", Args: []interface{}{userID}}}
+	for _, c := range userColumns {
+		filters = append(filters, RowFilter{Table: c.table, Where: c.column + "=?", Args: []interface{}{userID}})
+	}
+	for _, c := range userChildren {
+		filters = append(filters, RowFilter{
+			Table: c.table,
+			Where: c.column + " IN (SELECT id FROM " + c.parent + " WHERE " + c.parentColumn + "=?)",
+			Args:  []interface{}{userID},
+		})
+	}
+	ops, err := r.userSyncOperations(r.db, userID)
+	if err != nil {
+		return nil, err
+	}
+	return append(filters, ops...), nil
+}
+
+// userSyncOperations selects queued operations for the user or whose
+// payload names them. Payloads may be encrypted, so they are read and
+// matched here rather than in SQL. Device-encrypted operations can only be
+// found by their routing metadata.
+func (r *PrivacyRepo) userSyncOperations(q queryer, userID string) ([]RowFilter, error) {
+	rows, err := q.Query("SELECT id, COALESCE(payload, '') FROM sync_operations WHERE entity_type<>'user' OR entity_id<>?", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	where := "entity_type='user' AND entity_id=?"
+	args := []interface{}{userID}
+	for rows.Next() {
+		var id, stored string
+		if err := rows.Scan(&id, &stored); err != nil {
+			return nil, err
+		}
+		payload, err := r.keys.Decrypt(colSyncPayload, stored)
+		if err != nil {
+			return nil, err
+		}
+		if strings.Contains(payload, `"`+userID+`"`) {
+			where += " OR id=?"
+			args = append(args, id)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return []RowFilter{
+		{Table: "sync_operations", Where: where, Args: args},
+		{
+			Table: "encrypted_operations",
+			Where: "entity_type='user' AND entity_id=?",
+			Args:  []interface{}{userID},
+		},
+	}, nil
+}
+
+// ShopRows selects every row of every table
+func (r *PrivacyRepo) ShopRows() ([]RowFilter, error) {
+	tables, err := r.tables()
+	if err != nil {
+		return nil, err
+	}
+	filters := make([]RowFilter, len(tables))
+	for i, t := range tables {
+		filters[i] = RowFilter{Table: t, Where: "1=1"}
+	}
+	return filters, nil
+}
+
+func (r *PrivacyRepo) tables() ([]string, error) {
+	rows, err := r.db.Query("SELECT name FROM sqlite_master WHERE type='table' AND name NOT LIKE 'sqlite_%' ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		tables = append(tables, name)
+	}
+	return tables, rows.Err()
+}
+
+// Dump calls fn with each selected row as column name to value, with
+// encrypted columns decrypted. Secrets such as password hashes are left
+// out.
+func (r *PrivacyRepo) Dump(f RowFilter, fn func(map[string]interface{}) error) error {
+	rows, err := r.db.Query(`SELECT * FROM "`+f.Table+`" WHERE `+f.Where, f.Args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	values := make([]interface{}, len(columns))
+	ptrs := make([]interface{}, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return err
+		}
+		row := make(map[string]interface{}, len(columns))
+		for i, c := range columns {
+			if !secretColumns[f.Table][c] {
+				row[c] = values[i]
+			}
+		}
+		if err := decryptRow(r.keys, f.Table, row); err != nil {
+			return err
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// EraseUser deletes a user's account and the sync operations that mention
+// them, and clears them from the shop's records, in one transaction. It
+// returns the rows deleted and the rows cleared, by table.
+func (r *PrivacyRepo) EraseUser(userID string) (map[string]int64, map[string]int64, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	ops, err := r.userSyncOperations(tx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	deleted := map[string]int64{}
+	for _, f := range append([]RowFilter{{Table: "users", Where: "id=?", Args: []interface{}{userID}}}, ops...) {
+		res, err := tx.Exec(`DELETE FROM "`+f.Table+`" WHERE `+f.Where, f.Args...)
+		if err != nil {
+			return nil, nil, err
+		}
+		if deleted[f.Table], err = res.RowsAffected(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	scrubbed := map[string]int64{}
+	for _, c := range userColumns {
+		res, err := tx.Exec(`UPDATE "`+c.table+`" SET `+c.column+`='' WHERE `+c.column+`=?`, userID)
+		if err != nil {
+			return nil, nil, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return nil, nil, err
+		}
+		if n > 0 {
+			scrubbed[c.table] += n
+		}
+	}
+	return deleted, scrubbed, tx.Commit()
+}
+
+// UserRemnants counts the rows that still name a user
+func (r *PrivacyRepo) UserRemnants(userID string) (int64, error) {
+	ops, err := r.userSyncOperations(r.db, userID)
+	if err != nil {
+		return 0, err
+	}
+	filters := append([]RowFilter{{Table: "users", Where: "id=?", Args: []interface{}{userID}}}, ops...)
+	for _, c := range userColumns {
+		filters = append(filters, RowFilter{Table: c.table, Where: c.column + "=?", Args: []interface{}{userID}})
+	}
+	return r.count(filters)
+}
+
+// EraseShop deletes every row of every table but the erasure log, in one
+// transaction, and returns the rows deleted by table
+func (r *PrivacyRepo) EraseShop() (map[string]int64, error) {
+	tables, err := r.tables()
+	if err != nil {
+		return nil, err
+	}
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	deleted := map[string]int64{}
+	for _, t := range tables {
+		if t == "erasures" {
+			continue
+		}
+		res, err := tx.Exec(`DELETE FROM "` + t + `"`)
+		if err != nil {
+			return nil, err
+		}
+		if deleted[t], err = res.RowsAffected(); err != nil {
+			return nil, err
+		}
+	}
+	return deleted, tx.Commit()
+}
+
+// ShopRemnants counts the rows left in every table but the erasure log
+func (r *PrivacyRepo) ShopRemnants() (int64, error) {
+	filters, err := r.ShopRows()
+	if err != nil {
+		return 0, err
+	}
+	kept := filters[:0]
+	for _, f := range filters {
+		if f.Table != "erasures" {
+			kept = append(kept, f)
+		}
+	}
+	return r.count(kept)
+}
+
+func (r *PrivacyRepo) count(filters []RowFilter) (int64, error) {
+	var total int64
+	for _, f := range filters {
+		var n int64
+		if err := r.db.QueryRow(`SELECT COUNT(*) FROM "`+f.Table+`" WHERE `+f.Where, f.Args...).Scan(&n); err != nil {
+			return 0, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// AddErasure records an erasure
+func (r *PrivacyRepo) AddErasure(e *model.Erasure) error {
+	deleted, err := json.Marshal(e.Deleted)
+	if err != nil {
+		return err
+	}
+	scrubbed, err := json.Marshal(e.Scrubbed)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(
+		"INSERT INTO erasures ("+erasureColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		e.ID, e.SubjectType, e.SubjectID, e.RequestedBy, e.Reason, string(deleted), string(scrubbed), e.Verified, e.CreatedAt,
+	)
+	return err
+}
+
+// GetErasures returns the erasure log, newest first
+func (r *PrivacyRepo) GetErasures() ([]*model.Erasure, error) {
+	rows, err := r.db.Query("SELECT " + erasureColumns + " FROM erasures ORDER BY created_at DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	erasures := []*model.Erasure{}
+	for rows.Next() {
+		e := &model.Erasure{}
+		var deleted, scrubbed string
+		if err := rows.Scan(&e.ID, &e.SubjectType, &e.SubjectID, &e.RequestedBy, &e.Reason, &deleted, &scrubbed, &e.Verified, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(deleted), &e.Deleted); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(scrubbed), &e.Scrubbed); err != nil {
+			return nil, err
+		}
+		erasures = append(erasures, e)
+	}
+	return erasures, rows.Err()
+}
@@ -3,11 +3,23 @@ package repo
 import (
 	"database/sql"
 	"errors"
+	"strings"
+	"time"
 
 	"pesalocal/internal/model"
 )
 
-var ErrProductConflict = errors.New("product version conflict")
+var (
+	ErrProductConflict  = errors.New("product version conflict")
+	ErrDuplicateBarcode = errors.New("barcode already used by another product")
+)
+
+const productColumns = `id, name, price, stock, category, sub_category, price_per_unit, barcode, supplier, emoji, description,
+	is_perishable, requires_cooling, shelf_life_days, reorder_point, lead_time_days, version, updated_at, updated_by`
+
+// productSelectColumns adds what the ledger maintains; it is never written
+// from a product payload
+const productSelectColumns = productColumns + ", average_cost"
 
 type ProductRepo struct {
 	db *sql.DB
@@ -26,10 +38,12 @@ func (r *ProductRepo) CreateOrUpdate(p *model.Product) error {
 
 	if existing == nil {
 		_, err := r.db.Exec(
-			"INSERT INTO products (id, name, price, stock, version, updated_at) VALUES (?, ?, ?, ?, ?, ?)",
-			p.ID, p.Name, p.Price, p.Stock, p.Version, p.UpdatedAt,
+			"INSERT INTO products ("+productColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			p.ID, p.Name, p.Price, p.Stock, p.Category, p.SubCategory, p.PricePerUnit, p.Barcode, p.Supplier,
+			p.Emoji, p.Description, p.IsPerishable, p.RequiresCooling, p.ShelfLifeDays,
+			p.ReorderPoint, p.LeadTimeDays, p.Version, p.UpdatedAt, p.UpdatedBy,
 		)
-		return err
+		return barcodeError(err)
 	}
 
 	// Update only if version is newer
@@ -38,11 +52,15 @@ func (r *ProductRepo) CreateOrUpdate(p *model.Product) error {
 	}
 
 	res, err := r.db.Exec(
-		"UPDATE products SET name=?, price=?, stock=?, version=?, updated_at=? WHERE id=?",
-		p.Name, p.Price, p.Stock, p.Version, p.UpdatedAt, p.ID,
+		`UPDATE products SET name=?, price=?, stock=?, category=?, sub_category=?, price_per_unit=?, barcode=?,
+		supplier=?, emoji=?, description=?, is_perishable=?, requires_cooling=?, shelf_life_days=?,
+		reorder_point=?, lead_time_days=?, version=?, updated_at=?, updated_by=? WHERE id=?`,
+		p.Name, p.Price, p.Stock, p.Category, p.SubCategory, p.PricePerUnit, p.Barcode,
+		p.Supplier, p.Emoji, p.Description, p.IsPerishable, p.RequiresCooling, p.ShelfLifeDays,
+		p.ReorderPoint, p.LeadTimeDays, p.Version, p.UpdatedAt, p.UpdatedBy, p.ID,
 	)
 	if err != nil {
-		return err
+		return barcodeError(err)
 	}
 
 	affected, _ := res.RowsAffected()
@@ -52,11 +70,89 @@ func (r *ProductRepo) CreateOrUpdate(p *model.Product) error {
 	return nil
 }
 
+// Import saves an import in one transaction: the categories it adds, its
+// new and changed products, their price history, and the movements taking
+// their stock to the levels in the file. Products are written with the
+// stock they hold; the movements then move it. Nothing is saved if any
+// part fails.
+func (r *ProductRepo) Import(categories []*model.Category, products []*model.Product, changes []*model.PriceChange, movements []*model.StockMovement) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, c := range categories {
+		if _, err := tx.Exec(
+			"INSERT OR IGNORE INTO categories ("+categoryColumns+") VALUES (?, ?, ?, ?, ?, ?)",
+			c.ID, c.Name, c.ParentID, c.Emoji, c.Version, c.UpdatedAt.UTC(),
+		); err != nil {
+			return err
+		}
+	}
+
+	for _, p := range products {
+		if p.Version == 1 {
+			_, err = tx.Exec(
+				"INSERT INTO products ("+productColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+				p.ID, p.Name, p.Price, p.Stock, p.Category, p.SubCategory, p.PricePerUnit, p.Barcode, p.Supplier,
+				p.Emoji, p.Description, p.IsPerishable, p.RequiresCooling, p.ShelfLifeDays,
+				p.ReorderPoint, p.LeadTimeDays, p.Version, p.UpdatedAt, p.UpdatedBy,
+			)
+			if err != nil {
+				return barcodeError(err)
+			}
+			continue
+		}
+		// the product must still be as it was read when the file was checked
+		res, err := tx.Exec(
+			`UPDATE products SET name=?, price=?, category=?, sub_category=?, price_per_unit=?, barcode=?,
+			supplier=?, version=?, updated_at=?, updated_by=? WHERE id=? AND version=?`,
+			p.Name, p.Price, p.Category, p.SubCategory, p.PricePerUnit, p.Barcode,
+			p.Supplier, p.Version, p.UpdatedAt, p.UpdatedBy, p.ID, p.Version-1,
+		)
+		if err != nil {
+			return barcodeError(err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrProductConflict
+		}
+	}
+
+	for _, c := range changes {
+		if _, err := tx.Exec(
+			"INSERT INTO price_changes ("+priceChangeColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			c.ID, c.ProductID, c.OldPrice, c.Price, c.Status, c.ChangedBy, c.DeviceID, c.EffectiveAt.UTC(), c.CreatedAt,
+		); err != nil {
+			return err
+		}
+	}
+
+	for _, m := range movements {
+		if err := recordMovement(tx, m); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
 // GetByID returns a product by its ID
 func (r *ProductRepo) GetByID(id string) (*model.Product, error) {
-	row := r.db.QueryRow("SELECT id, name, price, stock, version, updated_at FROM products WHERE id=?", id)
-	p := &model.Product{}
-	err := row.Scan(&p.ID, &p.Name, &p.Price, &p.Stock, &p.Version, &p.UpdatedAt)
+	row := r.db.QueryRow("SELECT "+productSelectColumns+" FROM products WHERE id=?", id)
+	p, err := scanProduct(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil // not found
+		}
+		return nil, err
+	}
+	return p, nil
+}
+
+// GetByBarcode returns the product with the given barcode, or nil
+func (r *ProductRepo) GetByBarcode(barcode string) (*model.Product, error) {
+	row := r.db.QueryRow("SELECT "+productSelectColumns+" FROM products WHERE barcode=? AND barcode<>''", barcode)
+	p, err := scanProduct(row)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil // not found
@@ -66,18 +162,64 @@ func (r *ProductRepo) GetByID(id string) (*model.Product, error) {
 	return p, nil
 }
 
+// FindByName returns the products with the given name, ignoring case
+func (r *ProductRepo) FindByName(name string) ([]*model.Product, error) {
+	rows, err := r.db.Query("SELECT "+productSelectColumns+" FROM products WHERE name=? COLLATE NOCASE", name)
+	if err != nil {
+		return nil, err
+	}
+	return scanProducts(rows)
+}
+
 // GetAll returns all products
 func (r *ProductRepo) GetAll() ([]*model.Product, error) {
-	rows, err := r.db.Query("SELECT id, name, price, stock, version, updated_at FROM products")
+	rows, err := r.db.Query("SELECT " + productSelectColumns + " FROM products")
+	if err != nil {
+		return nil, err
+	}
+	return scanProducts(rows)
+}
+
+// Search returns products whose name, category, sub-category or barcode
+// contains query, optionally limited to one category
+func (r *ProductRepo) Search(query, category string) ([]*model.Product, error) {
+	sqlQuery := "SELECT " + productSelectColumns + " FROM products WHERE 1=1"
+	var args []interface{}
+
+	if query != "" {
+		like := "%" + escapeLike(query) + "%"
+		sqlQuery += ` AND (name LIKE ? ESCAPE '\' OR category LIKE ? ESCAPE '\'
+			OR sub_category LIKE ? ESCAPE '\' OR barcode LIKE ? ESCAPE '\')`
+		args = append(args, like, like, like, like)
+	}
+	if category != "" {
+		sqlQuery += " AND (category = ? COLLATE NOCASE OR sub_category = ? COLLATE NOCASE)"
+		args = append(args, category, category)
+	}
+	sqlQuery += " ORDER BY name"
+
+	rows, err := r.db.Query(sqlQuery, args...)
 	if err != nil {
 		return nil, err
 	}
+	return scanProducts(rows)
+}
+
+// GetUpdatedSince returns products changed after t
+func (r *ProductRepo) GetUpdatedSince(t time.Time) ([]*model.Product, error) {
+	rows, err := r.db.Query("SELECT "+productSelectColumns+" FROM products WHERE updated_at > ?", t)
+	if err != nil {
+		return nil, err
+	}
+	return scanProducts(rows)
+}
+
+func scanProducts(rows *sql.Rows) ([]*model.Product, error) {
 	defer rows.Close()
 
 	var products []*model.Product
 	for rows.Next() {
-		p := &model.Product{}
-		err := rows.Scan(&p.ID, &p.Name, &p.Price, &p.Stock, &p.Version, &p.UpdatedAt)
+		p, err := scanProduct(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -90,3 +232,28 @@ func (r *ProductRepo) GetAll() ([]*model.Product, error) {
 
 	return products, nil
 }
+
+func scanProduct(row rowScanner) (*model.Product, error) {
+	p := &model.Product{}
+	err := row.Scan(
+		&p.ID, &p.Name, &p.Price, &p.Stock, &p.Category, &p.SubCategory, &p.PricePerUnit, &p.Barcode,
+		&p.Supplier, &p.Emoji, &p.Description, &p.IsPerishable, &p.RequiresCooling, &p.ShelfLifeDays,
+		&p.ReorderPoint, &p.LeadTimeDays, &p.Version, &p.UpdatedAt, &p.UpdatedBy, &p.AverageCost,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// barcodeError maps a unique index violation on barcode to ErrDuplicateBarcode
+func barcodeError(err error) error {
+	if err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed: products.barcode") {
+		return ErrDuplicateBarcode
+	}
+	return err
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,143 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"pesalocal/internal/model"
+)
+
+const (
+	promotionColumns = "id, name, type, product_id, category, buy_quantity, get_quantity, bundle_quantity, bundle_price, " +
+		"price, percent, start_time, end_time, starts_at, ends_at, active, version, updated_at"
+	salePromotionColumns = "id, sale_id, sale_item_id, promotion_id, name, type, amount, over_limit"
+)
+
+// PromotionRepo stores promotions and the ones applied to sales
+type PromotionRepo struct {
+	db *sql.DB
+}
+
+func NewPromotionRepo(db *sql.DB) *PromotionRepo {
+	return &PromotionRepo{db: db}
+}
+
+// CreateOrUpdate ensures idempotent behavior for sync
+func (r *PromotionRepo) CreateOrUpdate(p *model.Promotion) error {
+	existing, err := r.GetByID(p.ID)
+	if err != nil {
+		return err
+	}
+
+	if existing == nil {
+		_, err := r.db.Exec(
+			"INSERT INTO promotions ("+promotionColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			p.ID, p.Name, p.Type, p.ProductID, p.Category, p.BuyQuantity, p.GetQuantity, p.BundleQuantity, p.BundlePrice,
+			p.Price, p.Percent, p.StartTime, p.EndTime, utcPtr(p.StartsAt), utcPtr(p.EndsAt), p.Active, p.Version, p.UpdatedAt,
+		)
+		return err
+	}
+
+	// Update only if version is newer
+	if p.Version <= existing.Version {
+		return nil
+	}
+
+	_, err = r.db.Exec(
+		`UPDATE promotions SET name=?, type=?, product_id=?, category=?, buy_quantity=?, get_quantity=?, bundle_quantity=?, bundle_price=?,
+			price=?, percent=?, start_time=?, end_time=?, starts_at=?, ends_at=?, active=?, version=?, updated_at=?
+		WHERE id=?`,
+		p.Name, p.Type, p.ProductID, p.Category, p.BuyQuantity, p.GetQuantity, p.BundleQuantity, p.BundlePrice,
+		p.Price, p.Percent, p.StartTime, p.EndTime, utcPtr(p.StartsAt), utcPtr(p.EndsAt), p.Active, p.Version, p.UpdatedAt,
+		p.ID,
+	)
+	return err
+}
+
+// GetByID returns a promotion, or nil if it doesn't exist
+func (r *PromotionRepo) GetByID(id string) (*model.Promotion, error) {
+	row := r.db.QueryRow("SELECT "+promotionColumns+" FROM promotions WHERE id=?", id)
+	p, err := scanPromotion(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil // not found
+	}
+	return p, err
+}
+
+// GetAll returns every promotion, by name
+func (r *PromotionRepo) GetAll() ([]*model.Promotion, error) {
+	return r.query("SELECT " + promotionColumns + " FROM promotions ORDER BY name")
+}
+
+// GetActive returns the active promotions running at t. Daily windows
+// are left to the caller.
+func (r *PromotionRepo) GetActive(t time.Time) ([]*model.Promotion, error) {
+	t = t.UTC()
+	return r.query(
+		"SELECT "+promotionColumns+" FROM promotions WHERE active=1 AND (starts_at IS NULL OR starts_at <= ?) AND (ends_at IS NULL OR ends_at > ?)",
+		t, t,
+	)
+}
+
+// GetApplied returns what was applied to a sale
+func (r *PromotionRepo) GetApplied(saleID string) ([]*model.SalePromotion, error) {
+	rows, err := r.db.Query("SELECT "+salePromotionColumns+" FROM sale_promotions WHERE sale_id=?", saleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := []*model.SalePromotion{}
+	for rows.Next() {
+		a := &model.SalePromotion{}
+		if err := rows.Scan(&a.ID, &a.SaleID, &a.SaleItemID, &a.PromotionID, &a.Name, &a.Type, &a.Amount, &a.OverLimit); err != nil {
+			return nil, err
+		}
+		applied = append(applied, a)
+	}
+	return applied, rows.Err()
+}
+
+func (r *PromotionRepo) query(query string, args ...interface{}) ([]*model.Promotion, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	promotions := []*model.Promotion{}
+	for rows.Next() {
+		p, err := scanPromotion(rows)
+		if err != nil {
+			return nil, err
+		}
+		promotions = append(promotions, p)
+	}
+	return promotions, rows.Err()
+}
+
+func scanPromotion(row rowScanner) (*model.Promotion, error) {
+	p := &model.Promotion{}
+	var startsAt, endsAt sql.NullTime
+	err := row.Scan(&p.ID, &p.Name, &p.Type, &p.ProductID, &p.Category, &p.BuyQuantity, &p.GetQuantity, &p.BundleQuantity, &p.BundlePrice,
+		&p.Price, &p.Percent, &p.StartTime, &p.EndTime, &startsAt, &endsAt, &p.Active, &p.Version, &p.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if startsAt.Valid {
+		p.StartsAt = &startsAt.Time
+	}
+	if endsAt.Valid {
+		p.EndsAt = &endsAt.Time
+	}
+	return p, nil
+}
+
+// utcPtr stores optional times in UTC so they compare correctly as text
+func utcPtr(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC()
+}
@@ -2,6 +2,8 @@ package repo
 
 import (
 	"database/sql"
+	"time"
+
 	"pesalocal/internal/model"
 )
 
@@ -13,19 +15,10 @@ func NewPurchaseItemRepo(db *sql.DB) *PurchaseItemRepo {
 	return &PurchaseItemRepo{db: db}
 }
 
-// Create inserts a purchase item
-func (r *PurchaseItemRepo) Create(item *model.PurchaseItem) error {
-	_, err := r.db.Exec(
-		"INSERT INTO purchase_items (id, purchase_id, product_id, quantity, price, total) VALUES (?, ?, ?, ?, ?, ?)",
-		item.ID, item.PurchaseID, item.ProductID, item.Quantity, item.Price, item.Total,
-	)
-	return err
-}
-
 // GetByPurchaseID fetches all items for a purchase
 func (r *PurchaseItemRepo) GetByPurchaseID(purchaseID string) ([]*model.PurchaseItem, error) {
 	rows, err := r.db.Query(
-		"SELECT id, purchase_id, product_id, quantity, price, total FROM purchase_items WHERE purchase_id=?",
+		"SELECT id, purchase_id, product_id, quantity, price, total, expiry_date, unit, unit_quantity FROM purchase_items WHERE purchase_id=?",
 		purchaseID,
 	)
 	if err != nil {
@@ -36,7 +29,17 @@ func (r *PurchaseItemRepo) GetByPurchaseID(purchaseID string) ([]*model.Purchase
 	var items []*model.PurchaseItem
 	for rows.Next() {
 		i := &model.PurchaseItem{}
-		rows.Scan(&i.ID, &i.PurchaseID, &i.ProductID, &i.Quantity, &i.Price, &i.Total)
+		var expiry sql.NullTime
+		var unit sql.NullString
+		var unitQty sql.NullFloat64
+		if err := rows.Scan(&i.ID, &i.PurchaseID, &i.ProductID, &i.Quantity, &i.Price, &i.Total, &expiry, &unit, &unitQty); err != nil {
+			return nil, err
+		}
+		if expiry.Valid {
+			i.ExpiryDate = &expiry.Time
+		}
+		i.Unit = unit.String
+		i.UnitQuantity = unitQty.Float64
 		items = append(items, i)
 	}
 	return items, nil
@@ -47,3 +50,42 @@ func (r *PurchaseItemRepo) DeleteByPurchaseID(purchaseID string) error {
 	_, err := r.db.Exec("DELETE FROM purchase_items WHERE purchase_id=?", purchaseID)
 	return err
 }
+
+// GetDailyCosts returns the quantity-weighted average unit cost paid for a
+// product on each day it was bought in [from, to), oldest first
+func (r *PurchaseItemRepo) GetDailyCosts(productID string, from, to time.Time) ([]*model.PurchaseCost, error) {
+	rows, err := r.db.Query(
+		`SELECT p.created_at, pi.quantity, pi.price
+		FROM purchase_items pi JOIN purchases p ON p.id = pi.purchase_id
+		WHERE pi.product_id = ? AND p.created_at >= ? AND p.created_at < ?
+		ORDER BY p.created_at ASC`,
+		productID, from.UTC(), to.UTC(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	costs := []*model.PurchaseCost{}
+	var day *model.PurchaseCost
+	var spent float64
+	for rows.Next() {
+		var at time.Time
+		var qty, price float64
+		if err := rows.Scan(&at, &qty, &price); err != nil {
+			return nil, err
+		}
+		date := at.Local().Format("2006-01-02")
+		if day == nil || day.Date != date {
+			day = &model.PurchaseCost{Date: date}
+			spent = 0
+			costs = append(costs, day)
+		}
+		day.Quantity += qty
+		spent += qty * price
+		if day.Quantity > 0 {
+			day.AverageCost = spent / day.Quantity
+		}
+	}
+	return costs, rows.Err()
+}
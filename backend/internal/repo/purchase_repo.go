@@ -7,6 +7,9 @@ import (
 )
 
 var ErrPurchaseConflict = errors.New("purchase version conflict")
+var ErrPurchaseExists = errors.New("purchase already recorded")
+
+const purchaseColumns = "id, supplier_id, supplier, total_amount, payment_method, device_id, version, created_at"
 
 type PurchaseRepo struct {
 	db *sql.DB
@@ -16,32 +19,65 @@ func NewPurchaseRepo(db *sql.DB) *PurchaseRepo {
 	return &PurchaseRepo{db: db}
 }
 
-// Create inserts a new purchase record
-func (r *PurchaseRepo) Create(p *model.Purchase) error {
-	_, err := r.db.Exec(
-		"INSERT INTO purchases (id, supplier, total_amount, device_id, version, created_at) VALUES (?, ?, ?, ?, ?, ?)",
-		p.ID, p.Supplier, p.TotalAmount, p.DeviceID, p.Version, p.CreatedAt,
+// Create inserts a purchase with its items, and the movements and batches
+// bringing them into stock, in one transaction. movements[i] and
+// batches[i] belong to items[i]. A purchase already recorded (replayed by
+// sync) gives ErrPurchaseExists and receives no stock. Times are stored
+// in UTC so they compare correctly as text.
+func (r *PurchaseRepo) Create(p *model.Purchase, items []*model.PurchaseItem, movements []*model.StockMovement, batches []*model.StockBatch) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		"INSERT OR IGNORE INTO purchases ("+purchaseColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		p.ID, p.SupplierID, p.Supplier, p.TotalAmount, p.PaymentMethod, p.DeviceID, p.Version, p.CreatedAt.UTC(),
 	)
-	return err
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrPurchaseExists
+	}
+
+	for i, item := range items {
+		if err := recordMovement(tx, movements[i]); err != nil {
+			return err
+		}
+		if err := insertBatch(tx, batches[i]); err != nil {
+			return err
+		}
+		item.PurchaseID = p.ID
+		if _, err := tx.Exec(
+			"INSERT INTO purchase_items (id, purchase_id, product_id, quantity, price, total, expiry_date, unit, unit_quantity) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			item.ID, item.PurchaseID, item.ProductID, item.Quantity, item.Price, item.Total, item.ExpiryDate, item.Unit, item.UnitQuantity,
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
 }
 
 // GetByID fetches a purchase by its ID
 func (r *PurchaseRepo) GetByID(id string) (*model.Purchase, error) {
-	row := r.db.QueryRow(
-		"SELECT id, supplier, total_amount, device_id, version, created_at FROM purchases WHERE id=?",
-		id,
-	)
-	p := &model.Purchase{}
-	err := row.Scan(&p.ID, &p.Supplier, &p.TotalAmount, &p.DeviceID, &p.Version, &p.CreatedAt)
-	if err != nil {
-		return nil, err
-	}
-	return p, nil
+	row := r.db.QueryRow("SELECT "+purchaseColumns+" FROM purchases WHERE id=?", id)
+	return scanPurchase(row)
 }
 
 // GetAll fetches all purchases
 func (r *PurchaseRepo) GetAll() ([]*model.Purchase, error) {
-	rows, err := r.db.Query("SELECT id, supplier, total_amount, device_id, version, created_at FROM purchases")
+	return r.query("SELECT " + purchaseColumns + " FROM purchases")
+}
+
+// GetBySupplierID fetches a supplier's purchases, newest first
+func (r *PurchaseRepo) GetBySupplierID(supplierID string) ([]*model.Purchase, error) {
+	return r.query("SELECT "+purchaseColumns+" FROM purchases WHERE supplier_id=? ORDER BY created_at DESC", supplierID)
+}
+
+func (r *PurchaseRepo) query(query string, args ...interface{}) ([]*model.Purchase, error) {
+	rows, err := r.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -49,18 +85,20 @@ func (r *PurchaseRepo) GetAll() ([]*model.Purchase, error) {
 
 	var purchases []*model.Purchase
 	for rows.Next() {
-		p := &model.Purchase{}
-		rows.Scan(&p.ID, &p.Supplier, &p.TotalAmount, &p.DeviceID, &p.Version, &p.CreatedAt)
+		p, err := scanPurchase(rows)
+		if err != nil {
+			return nil, err
+		}
 		purchases = append(purchases, p)
 	}
-	return purchases, nil
+	return purchases, rows.Err()
 }
 
 // Update updates a purchase record with optimistic concurrency
 func (r *PurchaseRepo) Update(p *model.Purchase) error {
 	res, err := r.db.Exec(
-		"UPDATE purchases SET supplier=?, total_amount=?, device_id=?, version=?, created_at=? WHERE id=? AND version=?",
-		p.Supplier, p.TotalAmount, p.DeviceID, p.Version+1, p.CreatedAt, p.ID, p.Version,
+		"UPDATE purchases SET supplier_id=?, supplier=?, total_amount=?, payment_method=?, device_id=?, version=?, created_at=? WHERE id=? AND version=?",
+		p.SupplierID, p.Supplier, p.TotalAmount, p.PaymentMethod, p.DeviceID, p.Version+1, p.CreatedAt.UTC(), p.ID, p.Version,
 	)
 	if err != nil {
 		return err
@@ -78,3 +116,18 @@ func (r *PurchaseRepo) Delete(id string) error {
 	_, err := r.db.Exec("DELETE FROM purchases WHERE id=?", id)
 	return err
 }
+
+func scanPurchase(row rowScanner) (*model.Purchase, error) {
+	p := &model.Purchase{}
+	var supplierID, supplier, method sql.NullString
+	var total sql.NullFloat64
+	err := row.Scan(&p.ID, &supplierID, &supplier, &total, &method, &p.DeviceID, &p.Version, &p.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	p.SupplierID = supplierID.String
+	p.Supplier = supplier.String
+	p.TotalAmount = total.Float64
+	p.PaymentMethod = method.String
+	return p, nil
+}
@@ -0,0 +1,144 @@
+package repo
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"pesalocal/internal/model"
+)
+
+// ReceiptRepo allocates receipt number ranges and checks the numbers sales
+// carry against them
+type ReceiptRepo struct {
+	db *sql.DB
+}
+
+func NewReceiptRepo(db *sql.DB) *ReceiptRepo {
+	return &ReceiptRepo{db: db}
+}
+
+// Allocate gives a device the next size numbers after every range already
+// allocated. It is a single statement so concurrent allocations can't
+// overlap.
+func (r *ReceiptRepo) Allocate(id, deviceID string, size int64, now time.Time) error {
+	_, err := r.db.Exec(
+		`INSERT INTO receipt_ranges (id, device_id, start_no, end_no, allocated_at)
+		SELECT ?, ?, COALESCE(MAX(end_no), 0) + 1, COALESCE(MAX(end_no), 0) + ?, ? FROM receipt_ranges`,
+		id, deviceID, size, now,
+	)
+	return err
+}
+
+// GetRanges returns the ranges allocated to a device, or to every device
+// when deviceID is empty, in number order, with how far each has been used
+func (r *ReceiptRepo) GetRanges(deviceID string) ([]*model.ReceiptRange, error) {
+	rows, err := r.db.Query(
+		`SELECT rr.id, rr.device_id, rr.start_no, rr.end_no, rr.allocated_at,
+			(SELECT COUNT(DISTINCT s.receipt_no) FROM sales s
+				WHERE s.device_id = rr.device_id AND s.receipt_no BETWEEN rr.start_no AND rr.end_no),
+			COALESCE((SELECT MAX(s.receipt_no) FROM sales s
+				WHERE s.device_id = rr.device_id AND s.receipt_no BETWEEN rr.start_no AND rr.end_no), rr.start_no - 1)
+		FROM receipt_ranges rr
+		WHERE ? = '' OR rr.device_id = ?
+		ORDER BY rr.start_no ASC`,
+		deviceID, deviceID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ranges := []*model.ReceiptRange{}
+	for rows.Next() {
+		rr := &model.ReceiptRange{}
+		var highest int64
+		if err := rows.Scan(&rr.ID, &rr.DeviceID, &rr.Start, &rr.End, &rr.AllocatedAt, &rr.Used, &highest); err != nil {
+			return nil, err
+		}
+		rr.Next = highest + 1
+		ranges = append(ranges, rr)
+	}
+	return ranges, rows.Err()
+}
+
+// UsedNumbers returns the distinct receipt numbers a device's sales carry
+// within [from, to], in order
+func (r *ReceiptRepo) UsedNumbers(deviceID string, from, to int64) ([]int64, error) {
+	rows, err := r.db.Query(
+		"SELECT DISTINCT receipt_no FROM sales WHERE device_id = ? AND receipt_no BETWEEN ? AND ? ORDER BY receipt_no",
+		deviceID, from, to,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var numbers []int64
+	for rows.Next() {
+		var n int64
+		if err := rows.Scan(&n); err != nil {
+			return nil, err
+		}
+		numbers = append(numbers, n)
+	}
+	return numbers, rows.Err()
+}
+
+// Duplicates returns receipt numbers carried by more than one sale,
+// optionally only those involving one device
+func (r *ReceiptRepo) Duplicates(deviceID string) ([]*model.ReceiptDuplicate, error) {
+	rows, err := r.db.Query(
+		`SELECT receipt_no, GROUP_CONCAT(id)
+		FROM sales
+		WHERE receipt_no > 0
+		GROUP BY receipt_no
+		HAVING COUNT(*) > 1 AND (? = '' OR SUM(device_id = ?) > 0)
+		ORDER BY receipt_no`,
+		deviceID, deviceID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	duplicates := []*model.ReceiptDuplicate{}
+	for rows.Next() {
+		d := &model.ReceiptDuplicate{}
+		var ids string
+		if err := rows.Scan(&d.ReceiptNo, &ids); err != nil {
+			return nil, err
+		}
+		d.SaleIDs = strings.Split(ids, ",")
+		duplicates = append(duplicates, d)
+	}
+	return duplicates, rows.Err()
+}
+
+// Unallocated returns sales whose receipt number is outside every range
+// allocated to their device, optionally for one device
+func (r *ReceiptRepo) Unallocated(deviceID string) ([]*model.ReceiptIssue, error) {
+	rows, err := r.db.Query(
+		`SELECT s.id, s.device_id, s.receipt_no
+		FROM sales s
+		WHERE s.receipt_no > 0 AND (? = '' OR s.device_id = ?)
+			AND NOT EXISTS (SELECT 1 FROM receipt_ranges rr
+				WHERE rr.device_id = s.device_id AND s.receipt_no BETWEEN rr.start_no AND rr.end_no)
+		ORDER BY s.receipt_no`,
+		deviceID, deviceID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	issues := []*model.ReceiptIssue{}
+	for rows.Next() {
+		i := &model.ReceiptIssue{}
+		if err := rows.Scan(&i.SaleID, &i.DeviceID, &i.ReceiptNo); err != nil {
+			return nil, err
+		}
+		issues = append(issues, i)
+	}
+	return issues, rows.Err()
+}
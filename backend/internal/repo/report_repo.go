@@ -0,0 +1,339 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"pesalocal/internal/model"
+)
+
+// ReportRepo runs the aggregate queries behind reports
+type ReportRepo struct {
+	db *sql.DB
+}
+
+func NewReportRepo(db *sql.DB) *ReportRepo {
+	return &ReportRepo{db: db}
+}
+
+// SaleMargins returns revenue and cost per sale made in [from, to), oldest
+// first, less whatever has since been returned
+func (r *ReportRepo) SaleMargins(from, to time.Time) ([]*model.SaleMargin, error) {
+	rows, err := r.db.Query(
+		`SELECT s.id, s.created_at,
+			COALESCE(SUM(si.total), 0) - COALESCE(MAX(rt.revenue), 0),
+			COALESCE(SUM(si.cost), 0) - COALESCE(MAX(rt.cost), 0)
+		FROM sales s LEFT JOIN sale_items si ON si.sale_id = s.id
+		LEFT JOIN (
+			SELECT rt.sale_id, SUM(ri.total) AS revenue, SUM(ri.cost) AS cost
+			FROM returns rt JOIN return_items ri ON ri.return_id = rt.id
+			GROUP BY rt.sale_id
+		) rt ON rt.sale_id = s.id
+		WHERE s.created_at >= ? AND s.created_at < ?
+		GROUP BY s.id
+		ORDER BY s.created_at ASC`,
+		from.UTC(), to.UTC(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	margins := []*model.SaleMargin{}
+	for rows.Next() {
+		m := &model.SaleMargin{}
+		if err := rows.Scan(&m.SaleID, &m.CreatedAt, &m.Revenue, &m.Cost); err != nil {
+			return nil, err
+		}
+		margins = append(margins, m)
+	}
+	return margins, rows.Err()
+}
+
+// ProductMargins returns quantity, revenue and cost per product sold in
+// [from, to), net of returns taken in the same range
+func (r *ReportRepo) ProductMargins(from, to time.Time) ([]*model.ProductMargin, error) {
+	rows, err := r.db.Query(
+		`SELECT m.product_id, COALESCE(p.name, ''), SUM(m.quantity), SUM(m.total), SUM(m.cost)
+		FROM (
+			SELECT si.product_id, si.quantity, si.total, si.cost
+			FROM sale_items si JOIN sales s ON s.id = si.sale_id
+			WHERE s.created_at >= ? AND s.created_at < ?
+			UNION ALL
+			SELECT ri.product_id, -ri.quantity, -ri.total, -ri.cost
+			FROM return_items ri JOIN returns rt ON rt.id = ri.return_id
+			WHERE rt.created_at >= ? AND rt.created_at < ?
+		) m
+		LEFT JOIN products p ON p.id = m.product_id
+		GROUP BY m.product_id`,
+		from.UTC(), to.UTC(), from.UTC(), to.UTC(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	margins := []*model.ProductMargin{}
+	for rows.Next() {
+		m := &model.ProductMargin{}
+		if err := rows.Scan(&m.ProductID, &m.Name, &m.Quantity, &m.Revenue, &m.Cost); err != nil {
+			return nil, err
+		}
+		margins = append(margins, m)
+	}
+	return margins, rows.Err()
+}
+
+// DailyMargins returns sales count, revenue and cost per local day in
+// [from, to), oldest first. Returns count against the day they were taken.
+func (r *ReportRepo) DailyMargins(from, to time.Time) ([]*model.DailyMargin, error) {
+	rows, err := r.db.Query(
+		`SELECT day, SUM(sales), SUM(revenue), SUM(cost)
+		FROM (
+			SELECT date(s.created_at, 'localtime') AS day, COUNT(DISTINCT s.id) AS sales,
+				COALESCE(SUM(si.total), 0) AS revenue, COALESCE(SUM(si.cost), 0) AS cost
+			FROM sales s LEFT JOIN sale_items si ON si.sale_id = s.id
+			WHERE s.created_at >= ? AND s.created_at < ?
+			GROUP BY day
+			UNION ALL
+			SELECT date(rt.created_at, 'localtime'), 0, -SUM(ri.total), -SUM(ri.cost)
+			FROM returns rt JOIN return_items ri ON ri.return_id = rt.id
+			WHERE rt.created_at >= ? AND rt.created_at < ?
+			GROUP BY 1
+		)
+		GROUP BY day
+		ORDER BY day ASC`,
+		from.UTC(), to.UTC(), from.UTC(), to.UTC(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	margins := []*model.DailyMargin{}
+	for rows.Next() {
+		m := &model.DailyMargin{}
+		if err := rows.Scan(&m.Date, &m.Sales, &m.Revenue, &m.Cost); err != nil {
+			return nil, err
+		}
+		margins = append(margins, m)
+	}
+	return margins, rows.Err()
+}
+
+// SalesTotals returns the number of sales in [from, to), their total and
+// the quantity of items sold, optionally for one device
+func (r *ReportRepo) SalesTotals(from, to time.Time, deviceID string) (int, float64, float64, error) {
+	var count int
+	var total, items float64
+	err := r.db.QueryRow(
+		`SELECT COUNT(*), COALESCE(SUM(s.total), 0),
+			COALESCE((SELECT SUM(si.quantity) FROM sale_items si JOIN sales s2 ON s2.id = si.sale_id
+				WHERE s2.created_at >= ? AND s2.created_at < ? AND (? = '' OR s2.device_id = ?)), 0)
+		FROM sales s
+		WHERE s.created_at >= ? AND s.created_at < ? AND (? = '' OR s.device_id = ?)`,
+		from.UTC(), to.UTC(), deviceID, deviceID, from.UTC(), to.UTC(), deviceID, deviceID,
+	).Scan(&count, &total, &items)
+	return count, total, items, err
+}
+
+// Tenders returns sales in [from, to) totalled by payment method and
+// status, optionally for one device
+func (r *ReportRepo) Tenders(from, to time.Time, deviceID string) ([]*model.Tender, error) {
+	rows, err := r.db.Query(
+		`SELECT COALESCE(payment_method, 'cash'), COALESCE(payment_status, 'paid'), COUNT(*), COALESCE(SUM(total), 0)
+		FROM sales
+		WHERE created_at >= ? AND created_at < ? AND (? = '' OR device_id = ?)
+		GROUP BY 1, 2
+		ORDER BY 1, 2`,
+		from.UTC(), to.UTC(), deviceID, deviceID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tenders := []*model.Tender{}
+	for rows.Next() {
+		t := &model.Tender{}
+		if err := rows.Scan(&t.Method, &t.Status, &t.Count, &t.Amount); err != nil {
+			return nil, err
+		}
+		tenders = append(tenders, t)
+	}
+	return tenders, rows.Err()
+}
+
+// TopProducts returns the limit best-selling products by revenue in
+// [from, to), optionally for one device
+func (r *ReportRepo) TopProducts(from, to time.Time, deviceID string, limit int) ([]*model.ProductSales, error) {
+	rows, err := r.db.Query(
+		`SELECT si.product_id, COALESCE(p.name, ''), SUM(si.quantity), SUM(si.total)
+		FROM sale_items si
+		JOIN sales s ON s.id = si.sale_id
+		LEFT JOIN products p ON p.id = si.product_id
+		WHERE s.created_at >= ? AND s.created_at < ? AND (? = '' OR s.device_id = ?)
+		GROUP BY si.product_id
+		ORDER BY SUM(si.total) DESC
+		LIMIT ?`,
+		from.UTC(), to.UTC(), deviceID, deviceID, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	products := []*model.ProductSales{}
+	for rows.Next() {
+		p := &model.ProductSales{}
+		if err := rows.Scan(&p.ProductID, &p.Name, &p.Quantity, &p.Revenue); err != nil {
+			return nil, err
+		}
+		products = append(products, p)
+	}
+	return products, rows.Err()
+}
+
+// CashPaidToSuppliers returns cash paid out to suppliers in [from, to),
+// optionally from one device
+func (r *ReportRepo) CashPaidToSuppliers(from, to time.Time, deviceID string) (float64, error) {
+	var total float64
+	err := r.db.QueryRow(
+		`SELECT COALESCE(SUM(amount), 0) FROM supplier_payments
+		WHERE method = ? AND paid_at >= ? AND paid_at < ? AND (? = '' OR device_id = ?)`,
+		model.PaymentCash, from.UTC(), to.UTC(), deviceID, deviceID,
+	).Scan(&total)
+	return total, err
+}
+
+// RefundTotals returns the number of returns taken in [from, to), the
+// amount refunded and how much of it was paid out in cash, optionally for
+// one device
+func (r *ReportRepo) RefundTotals(from, to time.Time, deviceID string) (int, float64, float64, error) {
+	var count int
+	var total, cash float64
+	err := r.db.QueryRow(
+		`SELECT COUNT(*), COALESCE(SUM(refund_total), 0),
+			COALESCE(SUM(CASE WHEN refund_method = ? THEN refund_total ELSE 0 END), 0)
+		FROM returns
+		WHERE created_at >= ? AND created_at < ? AND (? = '' OR device_id = ?)`,
+		model.PaymentCash, from.UTC(), to.UTC(), deviceID, deviceID,
+	).Scan(&count, &total, &cash)
+	return count, total, cash, err
+}
+
+// PromotionUsage returns how many sales in [from, to) each promotion was
+// applied to and how much it took off, biggest first. Manual discounts
+// are grouped by name.
+func (r *ReportRepo) PromotionUsage(from, to time.Time) ([]*model.PromotionUsage, error) {
+	rows, err := r.db.Query(
+		`SELECT sp.promotion_id, MAX(sp.name), sp.type, COUNT(DISTINCT sp.sale_id), SUM(sp.amount)
+		FROM sale_promotions sp JOIN sales s ON s.id = sp.sale_id
+		WHERE s.created_at >= ? AND s.created_at < ?
+		GROUP BY sp.promotion_id, sp.type, CASE WHEN sp.promotion_id = '' THEN sp.name END
+		ORDER BY SUM(sp.amount) DESC`,
+		from.UTC(), to.UTC(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage := []*model.PromotionUsage{}
+	for rows.Next() {
+		u := &model.PromotionUsage{}
+		if err := rows.Scan(&u.PromotionID, &u.Name, &u.Type, &u.Sales, &u.Amount); err != nil {
+			return nil, err
+		}
+		usage = append(usage, u)
+	}
+	return usage, rows.Err()
+}
+
+// FlaggedDiscounts returns the manual discounts on sales in [from, to)
+// that went beyond the selling user's limit, newest first
+func (r *ReportRepo) FlaggedDiscounts(from, to time.Time) ([]*model.FlaggedDiscount, error) {
+	rows, err := r.db.Query(
+		`SELECT sp.sale_id, sp.sale_item_id, s.user_id, s.device_id, sp.name, sp.amount, s.created_at
+		FROM sale_promotions sp JOIN sales s ON s.id = sp.sale_id
+		WHERE sp.over_limit = 1 AND s.created_at >= ? AND s.created_at < ?
+		ORDER BY s.created_at DESC`,
+		from.UTC(), to.UTC(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	flagged := []*model.FlaggedDiscount{}
+	for rows.Next() {
+		f := &model.FlaggedDiscount{}
+		if err := rows.Scan(&f.SaleID, &f.SaleItemID, &f.UserID, &f.DeviceID, &f.Name, &f.Amount, &f.CreatedAt); err != nil {
+			return nil, err
+		}
+		flagged = append(flagged, f)
+	}
+	return flagged, rows.Err()
+}
+
+// bucketExprs turn a sale's time into the label of its bucket, in shop
+// local time. Weeks are labelled by their Monday.
+var bucketExprs = map[string]string{
+	model.BucketHour:  "strftime('%Y-%m-%d %H:00', s.created_at, 'localtime')",
+	model.BucketDay:   "date(s.created_at, 'localtime')",
+	model.BucketWeek:  "date(s.created_at, 'localtime', '-6 days', 'weekday 1')",
+	model.BucketMonth: "strftime('%Y-%m-01', s.created_at, 'localtime')",
+}
+
+// SalesSeries totals sales in [from, to) per bucket, keyed by bucket
+// label. The range condition on sales.created_at comes first so SQLite
+// can use the created_at indexes.
+func (r *ReportRepo) SalesSeries(bucket string, from, to time.Time, f model.SeriesFilter) (map[string]*model.SeriesPoint, error) {
+	expr, ok := bucketExprs[bucket]
+	if !ok {
+		return nil, errors.New("unknown bucket: " + bucket)
+	}
+
+	query := "SELECT " + expr + ` AS bucket, COUNT(DISTINCT s.id), COALESCE(SUM(si.quantity), 0),
+		COALESCE(SUM(si.total), 0), COALESCE(SUM(si.cost), 0)
+		FROM sales s JOIN sale_items si ON si.sale_id = s.id`
+	if f.Category != "" {
+		query += " JOIN products p ON p.id = si.product_id"
+	}
+	query += " WHERE s.created_at >= ? AND s.created_at < ?"
+	args := []interface{}{from.UTC(), to.UTC()}
+	if f.DeviceID != "" {
+		query += " AND s.device_id = ?"
+		args = append(args, f.DeviceID)
+	}
+	if f.UserID != "" {
+		query += " AND s.user_id = ?"
+		args = append(args, f.UserID)
+	}
+	if f.ProductID != "" {
+		query += " AND si.product_id = ?"
+		args = append(args, f.ProductID)
+	}
+	if f.Category != "" {
+		query += " AND (p.category = ? COLLATE NOCASE OR p.sub_category = ? COLLATE NOCASE)"
+		args = append(args, f.Category, f.Category)
+	}
+	query += " GROUP BY bucket"
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	points := make(map[string]*model.SeriesPoint)
+	for rows.Next() {
+		p := &model.SeriesPoint{}
+		if err := rows.Scan(&p.Bucket, &p.Sales, &p.Units, &p.Revenue, &p.Cost); err != nil {
+			return nil, err
+		}
+		points[p.Bucket] = p
+	}
+	return points, rows.Err()
+}
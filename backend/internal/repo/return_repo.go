@@ -0,0 +1,212 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"pesalocal/internal/model"
+)
+
+const (
+	returnColumns     = "id, sale_id, user_id, device_id, reason, refund_method, refund_total, mpesa_receipt, version, created_at, recorded_at"
+	returnItemColumns = "id, return_id, sale_item_id, product_id, quantity, price, total, disposition, unit_cost, cost"
+)
+
+var (
+	ErrReturnExists      = errors.New("return already recorded")
+	ErrReturnExceedsSale = errors.New("more returned than was sold")
+)
+
+// ReturnRepo stores returns against sales and the items returned
+type ReturnRepo struct {
+	db *sql.DB
+}
+
+func NewReturnRepo(db *sql.DB) *ReturnRepo {
+	return &ReturnRepo{db: db}
+}
+
+// Create inserts a return and its items, and the stock movements putting
+// restocked items back into stock, in one transaction. late, when set,
+// records the return against its already closed day. RecordedAt is set
+// to the server's time, which devices pull by. A return
+// already recorded (replayed by sync) gives ErrReturnExists, and one
+// taking back more of an item than is left of the sale, counting returns
+// recorded since the items were priced, gives ErrReturnExceedsSale. Times
+// are stored in UTC so they compare correctly as text.
+func (r *ReturnRepo) Create(ret *model.Return, movements []*model.StockMovement, late *model.DayAdjustment) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	ret.RecordedAt = time.Now().UTC()
+	res, err := tx.Exec(
+		"INSERT OR IGNORE INTO returns ("+returnColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		ret.ID, ret.SaleID, ret.UserID, ret.DeviceID, ret.Reason, ret.RefundMethod, ret.RefundTotal, ret.MpesaReceipt, ret.Version, ret.CreatedAt.UTC(),
+		ret.RecordedAt,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrReturnExists
+	}
+
+	returned, err := returnedQuantities(tx, ret.SaleID)
+	if err != nil {
+		return err
+	}
+	for _, i := range ret.Items {
+		var sold float64
+		if err := tx.QueryRow("SELECT quantity FROM sale_items WHERE id=? AND sale_id=?", i.SaleItemID, ret.SaleID).Scan(&sold); err != nil {
+			return err
+		}
+		returned[i.SaleItemID] = model.RoundQuantity(returned[i.SaleItemID] + i.Quantity)
+		if returned[i.SaleItemID] > sold {
+			return ErrReturnExceedsSale
+		}
+	}
+
+	for _, i := range ret.Items {
+		if _, err := tx.Exec(
+			"INSERT INTO return_items ("+returnItemColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			i.ID, ret.ID, i.SaleItemID, i.ProductID, i.Quantity, i.Price, i.Total, i.Disposition, i.UnitCost, i.Cost,
+		); err != nil {
+			return err
+		}
+	}
+	for _, m := range movements {
+		if err := recordMovement(tx, m); err != nil {
+			return err
+		}
+	}
+	if late != nil {
+		if err := insertDayAdjustment(tx, late); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetByID returns a return with its items, or nil if it doesn't exist
+func (r *ReturnRepo) GetByID(id string) (*model.Return, error) {
+	row := r.db.QueryRow("SELECT "+returnColumns+" FROM returns WHERE id=?", id)
+	ret, err := scanReturn(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil // not found
+	}
+	if err != nil {
+		return nil, err
+	}
+	if ret.Items, err = r.getItems("return_id=?", ret.ID); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// GetBySaleID returns the returns made against a sale, oldest first
+func (r *ReturnRepo) GetBySaleID(saleID string) ([]*model.Return, error) {
+	return r.query("WHERE sale_id=? ORDER BY created_at ASC", saleID)
+}
+
+// GetBetween returns the returns made in [from, to), oldest first
+func (r *ReturnRepo) GetBetween(from, to time.Time) ([]*model.Return, error) {
+	return r.query("WHERE created_at >= ? AND created_at < ? ORDER BY created_at ASC", from.UTC(), to.UTC())
+}
+
+// GetRecordedSince returns the returns the server recorded at or after t,
+// in the order recorded
+func (r *ReturnRepo) GetRecordedSince(t time.Time) ([]*model.Return, error) {
+	return r.query("WHERE recorded_at >= ? ORDER BY recorded_at ASC", t.UTC())
+}
+
+// ReturnedQuantities returns how much of each item of a sale has already
+// been returned, keyed by sale item ID
+func (r *ReturnRepo) ReturnedQuantities(saleID string) (map[string]float64, error) {
+	return returnedQuantities(r.db, saleID)
+}
+
+func returnedQuantities(q queryer, saleID string) (map[string]float64, error) {
+	rows, err := q.Query(
+		`SELECT ri.sale_item_id, SUM(ri.quantity)
+		FROM return_items ri JOIN returns rt ON rt.id = ri.return_id
+		WHERE rt.sale_id = ?
+		GROUP BY ri.sale_item_id`,
+		saleID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	returned := make(map[string]float64)
+	for rows.Next() {
+		var itemID string
+		var qty float64
+		if err := rows.Scan(&itemID, &qty); err != nil {
+			return nil, err
+		}
+		returned[itemID] = qty
+	}
+	return returned, rows.Err()
+}
+
+func (r *ReturnRepo) query(where string, args ...interface{}) ([]*model.Return, error) {
+	rows, err := r.db.Query("SELECT "+returnColumns+" FROM returns "+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	returns := []*model.Return{}
+	for rows.Next() {
+		ret, err := scanReturn(rows)
+		if err != nil {
+			return nil, err
+		}
+		returns = append(returns, ret)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for _, ret := range returns {
+		if ret.Items, err = r.getItems("return_id=?", ret.ID); err != nil {
+			return nil, err
+		}
+	}
+	return returns, nil
+}
+
+func (r *ReturnRepo) getItems(where string, args ...interface{}) ([]*model.ReturnItem, error) {
+	rows, err := r.db.Query("SELECT "+returnItemColumns+" FROM return_items WHERE "+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []*model.ReturnItem{}
+	for rows.Next() {
+		i := &model.ReturnItem{}
+		if err := rows.Scan(&i.ID, &i.ReturnID, &i.SaleItemID, &i.ProductID, &i.Quantity, &i.Price, &i.Total, &i.Disposition, &i.UnitCost, &i.Cost); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	return items, rows.Err()
+}
+
+func scanReturn(row rowScanner) (*model.Return, error) {
+	ret := &model.Return{}
+	var recordedAt sql.NullTime
+	err := row.Scan(&ret.ID, &ret.SaleID, &ret.UserID, &ret.DeviceID, &ret.Reason, &ret.RefundMethod, &ret.RefundTotal, &ret.MpesaReceipt, &ret.Version, &ret.CreatedAt, &recordedAt)
+	if err != nil {
+		return nil, err
+	}
+	ret.RecordedAt = recordedAt.Time
+	return ret, nil
+}
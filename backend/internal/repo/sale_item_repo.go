@@ -2,6 +2,8 @@ package repo
 
 import (
 	"database/sql"
+	"time"
+
 	"pesalocal/internal/model"
 )
 
@@ -13,19 +15,10 @@ func NewSaleItemRepo(db *sql.DB) *SaleItemRepo {
 	return &SaleItemRepo{db: db}
 }
 
-// Create inserts a sale item into the database
-func (r *SaleItemRepo) Create(item *model.SaleItem) error {
-	_, err := r.db.Exec(
-		"INSERT INTO sale_items (id, sale_id, product_id, quantity, price, total) VALUES (?, ?, ?, ?, ?, ?)",
-		item.ID, item.SaleID, item.ProductID, item.Quantity, item.Price, item.Total,
-	)
-	return err
-}
-
 // GetBySaleID fetches all sale items for a specific sale
 func (r *SaleItemRepo) GetBySaleID(saleID string) ([]*model.SaleItem, error) {
 	rows, err := r.db.Query(
-		"SELECT id, sale_id, product_id, quantity, price, total FROM sale_items WHERE sale_id=?",
+		"SELECT id, sale_id, product_id, quantity, price, total, unit, unit_quantity, unit_cost, cost, discount, discount_type, discount_value FROM sale_items WHERE sale_id=?",
 		saleID,
 	)
 	if err != nil {
@@ -36,9 +29,19 @@ func (r *SaleItemRepo) GetBySaleID(saleID string) ([]*model.SaleItem, error) {
 	var items []*model.SaleItem
 	for rows.Next() {
 		i := &model.SaleItem{}
-		if err := rows.Scan(&i.ID, &i.SaleID, &i.ProductID, &i.Quantity, &i.Price, &i.Total); err != nil {
+		var unit, discountType sql.NullString
+		var unitQty, unitCost, cost, discount, discountValue sql.NullFloat64
+		if err := rows.Scan(&i.ID, &i.SaleID, &i.ProductID, &i.Quantity, &i.Price, &i.Total, &unit, &unitQty, &unitCost, &cost,
+			&discount, &discountType, &discountValue); err != nil {
 			return nil, err
 		}
+		i.Unit = unit.String
+		i.UnitQuantity = unitQty.Float64
+		i.UnitCost = unitCost.Float64
+		i.Cost = cost.Float64
+		i.Discount = discount.Float64
+		i.DiscountType = discountType.String
+		i.DiscountValue = discountValue.Float64
 		items = append(items, i)
 	}
 	return items, nil
@@ -49,3 +52,30 @@ func (r *SaleItemRepo) DeleteBySaleID(saleID string) error {
 	_, err := r.db.Exec("DELETE FROM sale_items WHERE sale_id=?", saleID)
 	return err
 }
+
+// QuantitySoldSince returns the base-unit quantity sold per product in
+// sales made since t
+func (r *SaleItemRepo) QuantitySoldSince(t time.Time) (map[string]float64, error) {
+	rows, err := r.db.Query(
+		`SELECT si.product_id, SUM(si.quantity)
+		FROM sale_items si JOIN sales s ON s.id = si.sale_id
+		WHERE s.created_at >= ?
+		GROUP BY si.product_id`,
+		t.UTC(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sold := make(map[string]float64)
+	for rows.Next() {
+		var productID string
+		var qty float64
+		if err := rows.Scan(&productID, &qty); err != nil {
+			return nil, err
+		}
+		sold[productID] = qty
+	}
+	return sold, rows.Err()
+}
@@ -2,9 +2,17 @@ package repo
 
 import (
 	"database/sql"
+	"errors"
+	"math"
+	"time"
+
 	"pesalocal/internal/model"
 )
 
+var ErrSaleExists = errors.New("sale already recorded")
+
+const saleColumns = "id, user_id, total, device_id, version, created_at, payment_method, payment_status, mpesa_receipt, subtotal, discount, discount_type, discount_value, receipt_no"
+
 type SaleRepo struct {
 	db *sql.DB
 }
@@ -13,26 +21,95 @@ func NewSaleRepo(db *sql.DB) *SaleRepo {
 	return &SaleRepo{db: db}
 }
 
-func (r *SaleRepo) Create(s *model.Sale) error {
-	_, err := r.db.Exec(
-		"INSERT INTO sales (id, user_id, total, device_id, version, created_at) VALUES (?, ?, ?, ?, ?, ?)",
-		s.ID, s.UserID, s.Total, s.DeviceID, s.Version, s.CreatedAt,
+// Create inserts a sale with its items, the promotions and discounts
+// applied to it, and the stock movements taking its items out of stock,
+// in one transaction. movements[i] is the movement for items[i]; each
+// item is costed from its movement. late, when set, records the sale
+// against its already closed day. A sale already recorded (replayed by
+// sync) gives ErrSaleExists and moves no stock. Times are stored in UTC
+// so they compare correctly as text.
+func (r *SaleRepo) Create(s *model.Sale, items []*model.SaleItem, movements []*model.StockMovement, late *model.DayAdjustment) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		"INSERT OR IGNORE INTO sales ("+saleColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		s.ID, s.UserID, s.Total, s.DeviceID, s.Version, s.CreatedAt.UTC(), s.PaymentMethod, s.PaymentStatus, s.MpesaReceipt,
+		s.Subtotal, s.Discount, s.DiscountType, s.DiscountValue, s.ReceiptNo,
 	)
-	return err
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrSaleExists
+	}
+
+	for i, item := range items {
+		m := movements[i]
+		if err := recordMovement(tx, m); err != nil {
+			return err
+		}
+		item.SaleID = s.ID
+		item.UnitCost = m.UnitCost
+		item.Cost = math.Round(item.Quantity*item.UnitCost*100) / 100
+		if _, err := tx.Exec(
+			"INSERT INTO sale_items (id, sale_id, product_id, quantity, price, total, unit, unit_quantity, unit_cost, cost, discount, discount_type, discount_value) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			item.ID, item.SaleID, item.ProductID, item.Quantity, item.Price, item.Total, item.Unit, item.UnitQuantity, item.UnitCost, item.Cost,
+			item.Discount, item.DiscountType, item.DiscountValue,
+		); err != nil {
+			return err
+		}
+	}
+
+	for _, a := range s.Promotions {
+		if _, err := tx.Exec(
+			"INSERT OR IGNORE INTO sale_promotions ("+salePromotionColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+			a.ID, a.SaleID, a.SaleItemID, a.PromotionID, a.Name, a.Type, a.Amount, a.OverLimit,
+		); err != nil {
+			return err
+		}
+	}
+	if late != nil {
+		if err := insertDayAdjustment(tx, late); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
 }
 
 func (r *SaleRepo) GetByID(id string) (*model.Sale, error) {
-	row := r.db.QueryRow("SELECT id, user_id, total, device_id, version, created_at FROM sales WHERE id=?", id)
-	s := &model.Sale{}
-	err := row.Scan(&s.ID, &s.UserID, &s.Total, &s.DeviceID, &s.Version, &s.CreatedAt)
+	row := r.db.QueryRow("SELECT "+saleColumns+" FROM sales WHERE id=?", id)
+	return scanSale(row)
+}
+
+func (r *SaleRepo) GetAll() ([]*model.Sale, error) {
+	rows, err := r.db.Query("SELECT " + saleColumns + " FROM sales")
 	if err != nil {
 		return nil, err
 	}
-	return s, nil
+	defer rows.Close()
+
+	var sales []*model.Sale
+	for rows.Next() {
+		s, err := scanSale(rows)
+		if err != nil {
+			return nil, err
+		}
+		sales = append(sales, s)
+	}
+	return sales, rows.Err()
 }
 
-func (r *SaleRepo) GetAll() ([]*model.Sale, error) {
-	rows, err := r.db.Query("SELECT id, user_id, total, device_id, version, created_at FROM sales")
+// GetPendingMpesa returns M-PESA sales created since the given time that
+// are still awaiting payment confirmation, oldest first
+func (r *SaleRepo) GetPendingMpesa(since time.Time) ([]*model.Sale, error) {
+	rows, err := r.db.Query(
+		"SELECT "+saleColumns+" FROM sales WHERE payment_method=? AND payment_status=? AND created_at >= ? ORDER BY created_at ASC",
+		model.PaymentMpesa, model.PaymentPending, since.UTC(),
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -40,9 +117,51 @@ func (r *SaleRepo) GetAll() ([]*model.Sale, error) {
 
 	var sales []*model.Sale
 	for rows.Next() {
-		s := &model.Sale{}
-		rows.Scan(&s.ID, &s.UserID, &s.Total, &s.DeviceID, &s.Version, &s.CreatedAt)
+		s, err := scanSale(rows)
+		if err != nil {
+			return nil, err
+		}
 		sales = append(sales, s)
 	}
-	return sales, nil
+	return sales, rows.Err()
+}
+
+// MarkPaid records the M-PESA receipt that settled a pending sale
+func (r *SaleRepo) MarkPaid(id, mpesaReceipt string) error {
+	_, err := r.db.Exec(
+		"UPDATE sales SET payment_status=?, mpesa_receipt=?, version=version+1 WHERE id=?",
+		model.PaymentPaid, mpesaReceipt, id,
+	)
+	return err
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// queryer is a database or a transaction
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func scanSale(row rowScanner) (*model.Sale, error) {
+	s := &model.Sale{}
+	var method, status, receipt, discountType sql.NullString
+	var subtotal, discount, discountValue sql.NullFloat64
+	var receiptNo sql.NullInt64
+	err := row.Scan(&s.ID, &s.UserID, &s.Total, &s.DeviceID, &s.Version, &s.CreatedAt, &method, &status, &receipt,
+		&subtotal, &discount, &discountType, &discountValue, &receiptNo)
+	if err != nil {
+		return nil, err
+	}
+	s.PaymentMethod = method.String
+	s.PaymentStatus = status.String
+	s.MpesaReceipt = receipt.String
+	s.Subtotal = subtotal.Float64
+	s.Discount = discount.Float64
+	s.DiscountType = discountType.String
+	s.DiscountValue = discountValue.Float64
+	s.ReceiptNo = receiptNo.Int64
+	return s, nil
 }
@@ -0,0 +1,510 @@
+package repo
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// Migrate creates the schema, brings databases made by older versions up
+// to date and seeds the data a new shop starts with. It is safe to run on
+// every start.
+func Migrate(db *sql.DB) error {
+	statements := []string{
+		// Users
+		`CREATE TABLE IF NOT EXISTS users (
+			id TEXT PRIMARY KEY,
+			name TEXT,
+			email TEXT,
+			email_hash TEXT DEFAULT '',
+			password TEXT,
+			role TEXT,
+			device_id TEXT,
+			version INTEGER,
+			created_at DATETIME,
+			updated_at DATETIME
+		);`,
+		// Products
+		`CREATE TABLE IF NOT EXISTS products (
+			id TEXT PRIMARY KEY,
+			name TEXT,
+			price REAL,
+			stock REAL,
+			version INTEGER,
+			updated_at DATETIME,
+			is_perishable BOOLEAN DEFAULT 0,
+			requires_cooling BOOLEAN DEFAULT 0,
+			shelf_life_days INTEGER DEFAULT 0,
+			reorder_point REAL DEFAULT 0,
+			lead_time_days INTEGER DEFAULT 0,
+			category TEXT DEFAULT '',
+			sub_category TEXT DEFAULT '',
+			price_per_unit TEXT DEFAULT '',
+			barcode TEXT DEFAULT '',
+			supplier TEXT DEFAULT '',
+			emoji TEXT DEFAULT '',
+			description TEXT DEFAULT '',
+			updated_by TEXT DEFAULT '',
+			average_cost REAL DEFAULT 0
+		);`,
+		// Sales
+		`CREATE TABLE IF NOT EXISTS sales (
+			id TEXT PRIMARY KEY,
+			user_id TEXT,
+			total REAL,
+			device_id TEXT,
+			version INTEGER,
+			created_at DATETIME,
+			payment_method TEXT DEFAULT 'cash',
+			payment_status TEXT DEFAULT 'paid',
+			mpesa_receipt TEXT,
+			subtotal REAL,
+			discount REAL DEFAULT 0,
+			discount_type TEXT DEFAULT '',
+			discount_value REAL DEFAULT 0,
+			receipt_no INTEGER DEFAULT 0
+		);`,
+		`CREATE TABLE IF NOT EXISTS sale_items (
+			id TEXT PRIMARY KEY,
+			sale_id TEXT,
+			product_id TEXT,
+			quantity REAL,
+			price REAL,
+			total REAL,
+			unit TEXT DEFAULT '',
+			unit_quantity REAL DEFAULT 0,
+			unit_cost REAL DEFAULT 0,
+			cost REAL DEFAULT 0,
+			discount REAL DEFAULT 0,
+			discount_type TEXT DEFAULT '',
+			discount_value REAL DEFAULT 0
+		);`,
+		// Purchases
+		`CREATE TABLE IF NOT EXISTS purchases (
+			id TEXT PRIMARY KEY,
+			supplier_id TEXT DEFAULT '',
+			supplier TEXT,
+			total_amount REAL,
+			payment_method TEXT DEFAULT 'cash',
+			device_id TEXT,
+			version INTEGER,
+			created_at DATETIME
+		);`,
+		`CREATE TABLE IF NOT EXISTS purchase_items (
+			id TEXT PRIMARY KEY,
+			purchase_id TEXT,
+			product_id TEXT,
+			quantity REAL,
+			price REAL,
+			total REAL,
+			expiry_date DATETIME,
+			unit TEXT DEFAULT '',
+			unit_quantity REAL DEFAULT 0
+		);`,
+		// Sync operations
+		`CREATE TABLE IF NOT EXISTS sync_operations (
+			id TEXT PRIMARY KEY,
+			entity_type TEXT,
+			entity_id TEXT,
+			operation TEXT,
+			payload BLOB,
+			device_id TEXT,
+			created_at DATETIME,
+			retry_count INTEGER
+		);`,
+		// M-PESA transactions (imported statements and SMS)
+		`CREATE TABLE IF NOT EXISTS mpesa_transactions (
+			id TEXT PRIMARY KEY,
+			receipt_no TEXT UNIQUE,
+			completion_time DATETIME,
+			type TEXT,
+			description TEXT,
+			counterparty TEXT,
+			amount REAL,
+			fee REAL,
+			balance REAL,
+			source TEXT,
+			created_at DATETIME,
+			sale_id TEXT
+		);`,
+		// Stock movements: the inventory ledger behind products.stock
+		`CREATE TABLE IF NOT EXISTS stock_movements (
+			id TEXT PRIMARY KEY,
+			product_id TEXT,
+			type TEXT,
+			quantity REAL,
+			stock_after REAL,
+			unit_cost REAL DEFAULT 0,
+			expired_quantity REAL DEFAULT 0,
+			source_type TEXT,
+			source_id TEXT,
+			reason TEXT,
+			device_id TEXT,
+			created_at DATETIME
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_stock_movements_product ON stock_movements (product_id, created_at);`,
+		// Products stocked before the ledger existed get an opening entry
+		`INSERT INTO stock_movements (id, product_id, type, quantity, stock_after, reason, created_at)
+		 SELECT 'opening-' || id, id, 'adjustment', stock, stock, 'opening stock', CURRENT_TIMESTAMP
+		 FROM products
+		 WHERE stock <> 0 AND id NOT IN (SELECT product_id FROM stock_movements);`,
+		// Stock takes: counting sessions and the counts recorded per device
+		`CREATE TABLE IF NOT EXISTS stock_takes (
+			id TEXT PRIMARY KEY,
+			status TEXT,
+			note TEXT,
+			user_id TEXT,
+			device_id TEXT,
+			version INTEGER,
+			created_at DATETIME,
+			committed_at DATETIME
+		);`,
+		`CREATE TABLE IF NOT EXISTS stock_counts (
+			id TEXT,
+			stock_take_id TEXT,
+			product_id TEXT,
+			counted REAL,
+			expected REAL,
+			device_id TEXT,
+			counted_at DATETIME,
+			PRIMARY KEY (stock_take_id, product_id, device_id)
+		);`,
+		// Stock batches: received lots with expiry dates, consumed FEFO
+		`CREATE TABLE IF NOT EXISTS stock_batches (
+			id TEXT PRIMARY KEY,
+			product_id TEXT,
+			purchase_id TEXT,
+			quantity REAL,
+			remaining REAL,
+			unit_cost REAL,
+			expiry_date DATETIME,
+			received_at DATETIME
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_stock_batches_product ON stock_batches (product_id, expiry_date);`,
+		// Shop-wide settings
+		`CREATE TABLE IF NOT EXISTS settings (
+			key TEXT PRIMARY KEY,
+			value TEXT
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_sales_created_at ON sales (created_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_sale_items_sale ON sale_items (sale_id);`,
+		// Sales analytics filter by device, cashier and product
+		`CREATE INDEX IF NOT EXISTS idx_sales_device_created_at ON sales (device_id, created_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_sales_user_created_at ON sales (user_id, created_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_sale_items_product ON sale_items (product_id, sale_id);`,
+		// Categories
+		`CREATE TABLE IF NOT EXISTS categories (
+			id TEXT PRIMARY KEY,
+			name TEXT UNIQUE COLLATE NOCASE,
+			parent_id TEXT,
+			emoji TEXT,
+			version INTEGER,
+			updated_at DATETIME
+		);`,
+		// IDs other devices gave a category already held under another
+		`CREATE TABLE IF NOT EXISTS category_aliases (
+			id TEXT PRIMARY KEY,
+			category_id TEXT
+		);`,
+		// Suppliers, and payments against purchases made on credit
+		`CREATE TABLE IF NOT EXISTS suppliers (
+			id TEXT PRIMARY KEY,
+			name TEXT UNIQUE COLLATE NOCASE,
+			phone TEXT DEFAULT '',
+			paybill TEXT DEFAULT '',
+			account TEXT DEFAULT '',
+			till TEXT DEFAULT '',
+			notes TEXT DEFAULT '',
+			version INTEGER,
+			updated_at DATETIME
+		);`,
+		// IDs other devices gave a supplier already held under another
+		`CREATE TABLE IF NOT EXISTS supplier_aliases (
+			id TEXT PRIMARY KEY,
+			supplier_id TEXT
+		);`,
+		`CREATE TABLE IF NOT EXISTS supplier_payments (
+			id TEXT PRIMARY KEY,
+			supplier_id TEXT,
+			purchase_id TEXT DEFAULT '',
+			amount REAL,
+			method TEXT,
+			reference TEXT DEFAULT '',
+			device_id TEXT,
+			paid_at DATETIME
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_supplier_payments_supplier ON supplier_payments (supplier_id);`,
+		// Product price changes, applied and scheduled
+		`CREATE TABLE IF NOT EXISTS price_changes (
+			id TEXT PRIMARY KEY,
+			product_id TEXT,
+			old_price REAL,
+			price REAL,
+			status TEXT,
+			changed_by TEXT DEFAULT '',
+			device_id TEXT DEFAULT '',
+			effective_at DATETIME,
+			created_at DATETIME
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_price_changes_product ON price_changes (product_id, effective_at);`,
+		// Closed trading days (Z-reports) and corrections made after closing
+		`CREATE TABLE IF NOT EXISTS day_closes (
+			id TEXT PRIMARY KEY,
+			date TEXT,
+			device_id TEXT DEFAULT '',
+			opening_float REAL,
+			counted_cash REAL,
+			closed_by TEXT DEFAULT '',
+			closed_at DATETIME,
+			UNIQUE (date, device_id)
+		);`,
+		`CREATE TABLE IF NOT EXISTS day_adjustments (
+			id TEXT PRIMARY KEY,
+			date TEXT,
+			device_id TEXT DEFAULT '',
+			amount REAL,
+			method TEXT,
+			reason TEXT,
+			source_type TEXT DEFAULT '',
+			source_id TEXT DEFAULT '',
+			created_by TEXT DEFAULT '',
+			created_at DATETIME
+		);`,
+		// Returns against sales: what came back, whether it was restocked,
+		// and how the customer was refunded
+		`CREATE TABLE IF NOT EXISTS returns (
+			id TEXT PRIMARY KEY,
+			sale_id TEXT,
+			user_id TEXT DEFAULT '',
+			device_id TEXT DEFAULT '',
+			reason TEXT DEFAULT '',
+			refund_method TEXT,
+			refund_total REAL,
+			mpesa_receipt TEXT DEFAULT '',
+			version INTEGER,
+			created_at DATETIME,
+			recorded_at DATETIME
+		);`,
+		`CREATE TABLE IF NOT EXISTS return_items (
+			id TEXT PRIMARY KEY,
+			return_id TEXT,
+			sale_item_id TEXT,
+			product_id TEXT,
+			quantity REAL,
+			price REAL,
+			total REAL,
+			disposition TEXT,
+			unit_cost REAL,
+			cost REAL
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_returns_sale ON returns (sale_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_returns_created_at ON returns (created_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_return_items_return ON return_items (return_id);`,
+		// Unit conversions: how many to_unit make one from_unit. An empty
+		// product_id applies to every product.
+		`CREATE TABLE IF NOT EXISTS unit_conversions (
+			id TEXT PRIMARY KEY,
+			product_id TEXT DEFAULT '',
+			from_unit TEXT,
+			to_unit TEXT,
+			factor REAL,
+			version INTEGER,
+			updated_at DATETIME,
+			UNIQUE (product_id, from_unit, to_unit)
+		);`,
+		`INSERT OR IGNORE INTO unit_conversions (id, product_id, from_unit, to_unit, factor, version, updated_at) VALUES
+			('unit-dozen-piece', '', 'dozen', 'piece', 12, 1, CURRENT_TIMESTAMP),
+			('unit-kg-g', '', 'kg', 'g', 1000, 1, CURRENT_TIMESTAMP),
+			('unit-litre-ml', '', 'litre', 'ml', 1000, 1, CURRENT_TIMESTAMP);`,
+		// Promotions, and the promotions and manual discounts applied to
+		// each sale
+		`CREATE TABLE IF NOT EXISTS promotions (
+			id TEXT PRIMARY KEY,
+			name TEXT,
+			type TEXT,
+			product_id TEXT DEFAULT '',
+			category TEXT DEFAULT '',
+			buy_quantity REAL DEFAULT 0,
+			get_quantity REAL DEFAULT 0,
+			bundle_quantity REAL DEFAULT 0,
+			bundle_price REAL DEFAULT 0,
+			price REAL DEFAULT 0,
+			percent REAL DEFAULT 0,
+			start_time TEXT DEFAULT '',
+			end_time TEXT DEFAULT '',
+			starts_at DATETIME,
+			ends_at DATETIME,
+			active BOOLEAN DEFAULT 1,
+			version INTEGER,
+			updated_at DATETIME
+		);`,
+		`CREATE TABLE IF NOT EXISTS sale_promotions (
+			id TEXT PRIMARY KEY,
+			sale_id TEXT,
+			sale_item_id TEXT DEFAULT '',
+			promotion_id TEXT DEFAULT '',
+			name TEXT,
+			type TEXT,
+			amount REAL,
+			over_limit BOOLEAN DEFAULT 0
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_sale_promotions_sale ON sale_promotions (sale_id);`,
+		// Receipt numbers allocated to devices in blocks
+		`CREATE TABLE IF NOT EXISTS receipt_ranges (
+			id TEXT PRIMARY KEY,
+			device_id TEXT,
+			start_no INTEGER UNIQUE,
+			end_no INTEGER,
+			allocated_at DATETIME
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_receipt_ranges_device ON receipt_ranges (device_id, start_no);`,
+		// Erasures of a user's or the whole shop's data, kept through a
+		// shop erasure as proof it happened
+		`CREATE TABLE IF NOT EXISTS erasures (
+			id TEXT PRIMARY KEY,
+			subject_type TEXT,
+			subject_id TEXT DEFAULT '',
+			requested_by TEXT DEFAULT '',
+			reason TEXT DEFAULT '',
+			deleted TEXT DEFAULT '{}',
+			scrubbed TEXT DEFAULT '{}',
+			verified BOOLEAN DEFAULT 0,
+			created_at DATETIME
+		);`,
+		// Sync operations relayed for shops that sync end to end encrypted.
+		// The payload is ciphertext the server can't read.
+		`CREATE TABLE IF NOT EXISTS encrypted_operations (
+			seq INTEGER PRIMARY KEY AUTOINCREMENT,
+			id TEXT UNIQUE,
+			entity_type TEXT,
+			entity_id TEXT,
+			version INTEGER DEFAULT 0,
+			operation TEXT,
+			key_id TEXT DEFAULT '',
+			payload BLOB,
+			device_id TEXT,
+			created_at DATETIME
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_encrypted_operations_entity ON encrypted_operations (entity_type, entity_id);`,
+		// Insert demo user
+		`INSERT OR IGNORE INTO users (id, name, email, password, role, device_id, version, created_at, updated_at)
+		 VALUES ('admin-uuid-1', 'Admin', 'admin@example.com', 'hashedpassword', 'admin', 'device-1', 1, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP);`,
+	}
+
+	for _, stmt := range statements {
+		if _, err := db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+
+	// Columns added to existing tables. Databases created after the column
+	// was added to CREATE TABLE above already have it, so "duplicate column"
+	// errors are expected and ignored.
+	migrations := []string{
+		`ALTER TABLE sales ADD COLUMN payment_method TEXT DEFAULT 'cash';`,
+		`ALTER TABLE sales ADD COLUMN payment_status TEXT DEFAULT 'paid';`,
+		`ALTER TABLE sales ADD COLUMN mpesa_receipt TEXT;`,
+		`ALTER TABLE mpesa_transactions ADD COLUMN sale_id TEXT;`,
+		`ALTER TABLE products ADD COLUMN is_perishable BOOLEAN DEFAULT 0;`,
+		`ALTER TABLE products ADD COLUMN requires_cooling BOOLEAN DEFAULT 0;`,
+		`ALTER TABLE products ADD COLUMN shelf_life_days INTEGER DEFAULT 0;`,
+		`ALTER TABLE purchase_items ADD COLUMN expiry_date DATETIME;`,
+		`ALTER TABLE products ADD COLUMN reorder_point INTEGER DEFAULT 0;`,
+		`ALTER TABLE products ADD COLUMN lead_time_days INTEGER DEFAULT 0;`,
+		`ALTER TABLE products ADD COLUMN category TEXT DEFAULT '';`,
+		`ALTER TABLE products ADD COLUMN sub_category TEXT DEFAULT '';`,
+		`ALTER TABLE products ADD COLUMN price_per_unit TEXT DEFAULT '';`,
+		`ALTER TABLE products ADD COLUMN barcode TEXT DEFAULT '';`,
+		`ALTER TABLE products ADD COLUMN supplier TEXT DEFAULT '';`,
+		`ALTER TABLE products ADD COLUMN emoji TEXT DEFAULT '';`,
+		`ALTER TABLE products ADD COLUMN description TEXT DEFAULT '';`,
+		// early databases created purchases without the columns PurchaseRepo uses
+		`ALTER TABLE purchases ADD COLUMN supplier TEXT;`,
+		`ALTER TABLE purchases ADD COLUMN total_amount REAL;`,
+		// Quantities became fractional. Existing INTEGER columns keep their
+		// whole numbers and store fractions as REAL values without loss, so
+		// only the entered unit needs adding.
+		`ALTER TABLE sale_items ADD COLUMN unit TEXT DEFAULT '';`,
+		`ALTER TABLE sale_items ADD COLUMN unit_quantity REAL DEFAULT 0;`,
+		`ALTER TABLE purchase_items ADD COLUMN unit TEXT DEFAULT '';`,
+		`ALTER TABLE purchase_items ADD COLUMN unit_quantity REAL DEFAULT 0;`,
+		`ALTER TABLE purchases ADD COLUMN supplier_id TEXT DEFAULT '';`,
+		`ALTER TABLE purchases ADD COLUMN payment_method TEXT DEFAULT 'cash';`,
+		`ALTER TABLE products ADD COLUMN updated_by TEXT DEFAULT '';`,
+		`ALTER TABLE products ADD COLUMN average_cost REAL DEFAULT 0;`,
+		`ALTER TABLE stock_movements ADD COLUMN unit_cost REAL DEFAULT 0;`,
+		`ALTER TABLE sale_items ADD COLUMN unit_cost REAL DEFAULT 0;`,
+		`ALTER TABLE sale_items ADD COLUMN cost REAL DEFAULT 0;`,
+		`ALTER TABLE sales ADD COLUMN subtotal REAL;`,
+		`ALTER TABLE sales ADD COLUMN discount REAL DEFAULT 0;`,
+		`ALTER TABLE sales ADD COLUMN discount_type TEXT DEFAULT '';`,
+		`ALTER TABLE sales ADD COLUMN discount_value REAL DEFAULT 0;`,
+		`ALTER TABLE sale_items ADD COLUMN discount REAL DEFAULT 0;`,
+		`ALTER TABLE sale_items ADD COLUMN discount_type TEXT DEFAULT '';`,
+		`ALTER TABLE sale_items ADD COLUMN discount_value REAL DEFAULT 0;`,
+		`ALTER TABLE sales ADD COLUMN receipt_no INTEGER DEFAULT 0;`,
+		`ALTER TABLE users ADD COLUMN email_hash TEXT DEFAULT '';`,
+		`ALTER TABLE sale_promotions ADD COLUMN over_limit BOOLEAN DEFAULT 0;`,
+		`ALTER TABLE day_adjustments ADD COLUMN source_type TEXT DEFAULT '';`,
+		`ALTER TABLE day_adjustments ADD COLUMN source_id TEXT DEFAULT '';`,
+		`ALTER TABLE stock_movements ADD COLUMN expired_quantity REAL DEFAULT 0;`,
+		`ALTER TABLE returns ADD COLUMN recorded_at DATETIME;`,
+		`ALTER TABLE stock_counts ADD COLUMN expected REAL;`,
+	}
+
+	for _, stmt := range migrations {
+		if _, err := db.Exec(stmt); err != nil && !strings.Contains(err.Error(), "duplicate column name") {
+			return err
+		}
+	}
+	// Indexes and backfills on migrated columns
+	indexes := []string{
+		`CREATE INDEX IF NOT EXISTS idx_sales_receipt_no ON sales (receipt_no) WHERE receipt_no > 0;`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_products_barcode ON products (barcode) WHERE barcode <> '';`,
+		`CREATE INDEX IF NOT EXISTS idx_products_category ON products (category);`,
+		`CREATE INDEX IF NOT EXISTS idx_purchases_supplier ON purchases (supplier_id, created_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_users_email_hash ON users (email_hash) WHERE email_hash <> '';`,
+		`CREATE INDEX IF NOT EXISTS idx_returns_recorded_at ON returns (recorded_at);`,
+		// Purchases from before the supplier directory only have a name;
+		// give each name a supplier and link the purchases to it
+		`INSERT OR IGNORE INTO suppliers (id, name, version, updated_at)
+		 SELECT 'supplier-' || lower(trim(supplier)), trim(supplier), 1, CURRENT_TIMESTAMP
+		 FROM purchases
+		 WHERE COALESCE(supplier_id, '') = '' AND trim(COALESCE(supplier, '')) <> ''
+		 GROUP BY lower(trim(supplier));`,
+		`UPDATE purchases
+		 SET supplier_id = (SELECT id FROM suppliers WHERE name = trim(purchases.supplier) COLLATE NOCASE)
+		 WHERE COALESCE(supplier_id, '') = '' AND trim(COALESCE(supplier, '')) <> '';`,
+		// Products stocked before costing start at the cost of the batches
+		// they hold
+		`UPDATE products
+		 SET average_cost = (SELECT SUM(remaining * unit_cost) / SUM(remaining) FROM stock_batches b WHERE b.product_id = products.id AND b.remaining > 0)
+		 WHERE COALESCE(average_cost, 0) = 0 AND EXISTS (SELECT 1 FROM stock_batches b WHERE b.product_id = products.id AND b.remaining > 0 AND b.unit_cost > 0);`,
+		// Sales from before discounts were charged what they were listed at
+		`UPDATE sales SET subtotal = total WHERE subtotal IS NULL;`,
+		// Times were stored with the offset of the zone that sent them,
+		// which doesn't compare correctly as text; bring them to UTC
+		`UPDATE sales SET created_at = strftime('%Y-%m-%d %H:%M:%f+00:00', created_at)
+		 WHERE substr(created_at, -6, 1) IN ('+', '-') AND substr(created_at, -6) <> '+00:00';`,
+		`UPDATE returns SET created_at = strftime('%Y-%m-%d %H:%M:%f+00:00', created_at)
+		 WHERE substr(created_at, -6, 1) IN ('+', '-') AND substr(created_at, -6) <> '+00:00';`,
+		// Returns from before the server stamped them were recorded when taken
+		`UPDATE returns SET recorded_at = created_at WHERE recorded_at IS NULL;`,
+		`UPDATE purchases SET created_at = strftime('%Y-%m-%d %H:%M:%f+00:00', created_at)
+		 WHERE substr(created_at, -6, 1) IN ('+', '-') AND substr(created_at, -6) <> '+00:00';`,
+		`UPDATE stock_batches SET received_at = strftime('%Y-%m-%d %H:%M:%f+00:00', received_at)
+		 WHERE substr(received_at, -6, 1) IN ('+', '-') AND substr(received_at, -6) <> '+00:00';`,
+		`UPDATE supplier_payments SET paid_at = strftime('%Y-%m-%d %H:%M:%f+00:00', paid_at)
+		 WHERE substr(paid_at, -6, 1) IN ('+', '-') AND substr(paid_at, -6) <> '+00:00';`,
+		`UPDATE mpesa_transactions SET completion_time = strftime('%Y-%m-%d %H:%M:%f+00:00', completion_time)
+		 WHERE substr(completion_time, -6, 1) IN ('+', '-') AND substr(completion_time, -6) <> '+00:00';`,
+		`UPDATE day_adjustments SET created_at = strftime('%Y-%m-%d %H:%M:%f+00:00', created_at)
+		 WHERE substr(created_at, -6, 1) IN ('+', '-') AND substr(created_at, -6) <> '+00:00';`,
+	}
+
+	for _, stmt := range indexes {
+		if _, err := db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+)
+
+// SettingsRepo stores shop-wide settings as key/value pairs
+type SettingsRepo struct {
+	db *sql.DB
+}
+
+func NewSettingsRepo(db *sql.DB) *SettingsRepo {
+	return &SettingsRepo{db: db}
+}
+
+// Get returns a setting, or def if it isn't set
+func (r *SettingsRepo) Get(key, def string) (string, error) {
+	var value string
+	err := r.db.QueryRow("SELECT value FROM settings WHERE key=?", key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return def, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return value, nil
+}
+
+// GetInt returns a numeric setting, or def if it isn't set or isn't a number
+func (r *SettingsRepo) GetInt(key string, def int) (int, error) {
+	value, err := r.Get(key, "")
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return def, nil
+	}
+	return n, nil
+}
+
+// GetFloat returns a numeric setting that may have decimals, or def if it
+// isn't set or isn't a number
+func (r *SettingsRepo) GetFloat(key string, def float64) (float64, error) {
+	value, err := r.Get(key, "")
+	if err != nil {
+		return 0, err
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return def, nil
+	}
+	return f, nil
+}
+
+// Set stores a setting
+func (r *SettingsRepo) Set(key, value string) error {
+	_, err := r.db.Exec(
+		"INSERT INTO settings (key, value) VALUES (?, ?) ON CONFLICT (key) DO UPDATE SET value=excluded.value",
+		key, value,
+	)
+	return err
+}
+
+// GetAll returns every setting
+func (r *SettingsRepo) GetAll() (map[string]string, error) {
+	rows, err := r.db.Query("SELECT key, value FROM settings")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	settings := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		settings[key] = value
+	}
+	return settings, rows.Err()
+}
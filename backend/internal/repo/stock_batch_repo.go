@@ -0,0 +1,157 @@
+package repo
+
+import (
+	"database/sql"
+	"time"
+
+	"pesalocal/internal/model"
+)
+
+const batchColumns = "id, product_id, purchase_id, quantity, remaining, unit_cost, expiry_date, received_at"
+
+type StockBatchRepo struct {
+	db *sql.DB
+}
+
+func NewStockBatchRepo(db *sql.DB) *StockBatchRepo {
+	return &StockBatchRepo{db: db}
+}
+
+// insertBatch records a batch brought into stock by a movement recorded
+// in the same transaction. Batches already received are skipped. Times
+// are stored in UTC so they compare correctly as text.
+func insertBatch(tx *sql.Tx, b *model.StockBatch) error {
+	_, err := tx.Exec(
+		"INSERT OR IGNORE INTO stock_batches ("+batchColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		b.ID, b.ProductID, b.PurchaseID, b.Quantity, b.Remaining, b.UnitCost, b.ExpiryDate, b.ReceivedAt.UTC(),
+	)
+	return err
+}
+
+// GetByID returns a batch, or nil if it doesn't exist
+func (r *StockBatchRepo) GetByID(id string) (*model.StockBatch, error) {
+	rows, err := r.db.Query("SELECT "+batchColumns+" FROM stock_batches WHERE id=?", id)
+	if err != nil {
+		return nil, err
+	}
+	batches, err := scanBatches(rows)
+	if err != nil || len(batches) == 0 {
+		return nil, err
+	}
+	return batches[0], nil
+}
+
+// GetByProductID returns a product's batches that still hold stock, in the
+// order they will be sold
+func (r *StockBatchRepo) GetByProductID(productID string) ([]*model.StockBatch, error) {
+	rows, err := r.db.Query(
+		"SELECT "+batchColumns+" FROM stock_batches WHERE product_id=? AND remaining > 0 ORDER BY "+fefoOrder,
+		productID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanBatches(rows)
+}
+
+// GetExpiringBefore returns batches holding stock that expire before t,
+// soonest first
+func (r *StockBatchRepo) GetExpiringBefore(t time.Time) ([]*model.StockBatch, error) {
+	rows, err := r.db.Query(
+		"SELECT "+batchColumns+" FROM stock_batches WHERE remaining > 0 AND expiry_date IS NOT NULL AND expiry_date < ? ORDER BY expiry_date ASC",
+		t.UTC(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanBatches(rows)
+}
+
+// First-expiry-first-out; batches without an expiry go last, oldest first
+const fefoOrder = "expiry_date IS NULL, expiry_date ASC, received_at ASC"
+
+// consumeBatches takes quantity out of a product's batches FEFO, starting
+// with preferBatchID if given. Batches already expired at the time of the
+// movement go last, so they are only sold once nothing fresher is left;
+// how much came from them is returned so the movement can be flagged.
+// Stock held outside any batch (received before batches were tracked)
+// absorbs whatever the batches can't cover. It returns the cost of the
+// stock taken from batches, how much of quantity they covered and how
+// much of that was expired.
+func consumeBatches(tx *sql.Tx, productID string, quantity float64, preferBatchID string, at time.Time) (float64, float64, float64, error) {
+	rows, err := tx.Query(
+		`SELECT id, remaining, unit_cost, COALESCE(expiry_date < ?, 0) FROM stock_batches
+		 WHERE product_id=? AND remaining > 0
+		 ORDER BY id = ? DESC, COALESCE(expiry_date < ?, 0), `+fefoOrder,
+		at.UTC(), productID, preferBatchID, at.UTC(),
+	)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	type batchLevel struct {
+		id        string
+		remaining float64
+		unitCost  float64
+		expired   bool
+	}
+	var levels []batchLevel
+	for rows.Next() {
+		var b batchLevel
+		var unitCost sql.NullFloat64
+		if err := rows.Scan(&b.id, &b.remaining, &unitCost, &b.expired); err != nil {
+			rows.Close()
+			return 0, 0, 0, err
+		}
+		b.unitCost = unitCost.Float64
+		levels = append(levels, b)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, 0, err
+	}
+
+	var cost, covered, expired float64
+	for _, b := range levels {
+		if quantity <= 0 {
+			break
+		}
+		take := b.remaining
+		if take > quantity {
+			take = quantity
+		}
+		if _, err := tx.Exec("UPDATE stock_batches SET remaining = ? WHERE id=?", model.RoundQuantity(b.remaining-take), b.id); err != nil {
+			return 0, 0, 0, err
+		}
+		quantity = model.RoundQuantity(quantity - take)
+		covered += take
+		cost += take * b.unitCost
+		// writing off the named batch is meant to take expired stock
+		if b.expired && b.id != preferBatchID {
+			expired += take
+		}
+	}
+	return cost, covered, model.RoundQuantity(expired), nil
+}
+
+func scanBatches(rows *sql.Rows) ([]*model.StockBatch, error) {
+	defer rows.Close()
+
+	var batches []*model.StockBatch
+	for rows.Next() {
+		b := &model.StockBatch{}
+		var purchaseID sql.NullString
+		var expiry sql.NullTime
+		if err := rows.Scan(
+			&b.ID, &b.ProductID, &purchaseID, &b.Quantity, &b.Remaining, &b.UnitCost, &expiry, &b.ReceivedAt,
+		); err != nil {
+			return nil, err
+		}
+		b.PurchaseID = purchaseID.String
+		if expiry.Valid {
+			b.ExpiryDate = &expiry.Time
+		}
+		batches = append(batches, b)
+	}
+	return batches, rows.Err()
+}
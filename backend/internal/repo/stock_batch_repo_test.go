@@ -0,0 +1,117 @@
+package repo
+
+import (
+	"database/sql"
+	"math"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"pesalocal/internal/model"
+)
+
+// testDB returns an empty database with the shop's schema
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1) // every connection gets its own in-memory database
+	t.Cleanup(func() { db.Close() })
+	if err := Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestConsumeBatches(t *testing.T) {
+	day := func(d int) *time.Time {
+		t := time.Date(2026, 10, d, 0, 0, 0, 0, time.UTC)
+		return &t
+	}
+	received := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	// expiring soonest first: b-early, b-late, then the two without an
+	// expiry in the order received, and b-expired only when all are gone
+	batches := []*model.StockBatch{
+		{ID: "b-late", Remaining: 5, UnitCost: 12, ExpiryDate: day(30), ReceivedAt: received},
+		{ID: "b-none-new", Remaining: 4, UnitCost: 20, ReceivedAt: received.AddDate(0, 0, 2)},
+		{ID: "b-early", Remaining: 3, UnitCost: 10, ExpiryDate: day(20), ReceivedAt: received.AddDate(0, 0, 1)},
+		{ID: "b-none-old", Remaining: 2, UnitCost: 15, ReceivedAt: received},
+		{ID: "b-empty", Remaining: 0, UnitCost: 1, ExpiryDate: day(1), ReceivedAt: received},
+		{ID: "b-expired", Remaining: 2, UnitCost: 8, ExpiryDate: day(10), ReceivedAt: received},
+	}
+
+	tests := []struct {
+		name          string
+		quantity      float64
+		prefer        string
+		cost, covered float64
+		expired       float64
+		remaining     map[string]float64 // batches changed
+	}{
+		{"within the first batch", 2, "", 20, 2, 0,
+			map[string]float64{"b-early": 1}},
+		{"spills into the next expiry", 5, "", 3*10 + 2*12, 5, 0,
+			map[string]float64{"b-early": 0, "b-late": 3}},
+		{"undated batches last, oldest first", 9, "", 3*10 + 5*12 + 1*15, 9, 0,
+			map[string]float64{"b-early": 0, "b-late": 0, "b-none-old": 1}},
+		{"expired stock only once the rest is gone", 15, "", 3*10 + 5*12 + 2*15 + 4*20 + 1*8, 15, 1,
+			map[string]float64{"b-early": 0, "b-late": 0, "b-none-old": 0, "b-none-new": 0, "b-expired": 1}},
+		{"more than the batches hold", 20, "", 3*10 + 5*12 + 2*15 + 4*20 + 2*8, 16, 2,
+			map[string]float64{"b-early": 0, "b-late": 0, "b-none-old": 0, "b-none-new": 0, "b-expired": 0}},
+		{"named batch first", 6, "b-none-new", 4*20 + 2*10, 6, 0,
+			map[string]float64{"b-none-new": 0, "b-early": 1}},
+		{"writing off the expired batch", 2, "b-expired", 2 * 8, 2, 0,
+			map[string]float64{"b-expired": 0}},
+		{"fractional quantities", 0.75, "", 7.5, 0.75, 0,
+			map[string]float64{"b-early": 2.25}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testDB(t)
+			tx, err := db.Begin()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer tx.Rollback()
+			for _, b := range batches {
+				b.ProductID, b.Quantity = "p1", b.Remaining
+				if err := insertBatch(tx, b); err != nil {
+					t.Fatal(err)
+				}
+			}
+			other := &model.StockBatch{ID: "other", ProductID: "p2", Quantity: 50, Remaining: 50, UnitCost: 1, ExpiryDate: day(2)}
+			if err := insertBatch(tx, other); err != nil {
+				t.Fatal(err)
+			}
+
+			cost, covered, expired, err := consumeBatches(tx, "p1", tt.quantity, tt.prefer, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(cost-tt.cost) > 1e-9 || covered != tt.covered || expired != tt.expired {
+				t.Errorf("cost %v covered %v expired %v, want %v, %v and %v", cost, covered, expired, tt.cost, tt.covered, tt.expired)
+			}
+
+			want := map[string]float64{"other": 50}
+			for _, b := range batches {
+				want[b.ID] = b.Remaining
+			}
+			for id, r := range tt.remaining {
+				want[id] = r
+			}
+			for id, w := range want {
+				var got float64
+				if err := tx.QueryRow("SELECT remaining FROM stock_batches WHERE id=?", id).Scan(&got); err != nil {
+					t.Fatal(err)
+				}
+				if got != w {
+					t.Errorf("%s has %v left, want %v", id, got, w)
+				}
+			}
+		})
+	}
+}
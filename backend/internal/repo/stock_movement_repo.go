@@ -0,0 +1,187 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"time"
+
+	"pesalocal/internal/model"
+)
+
+var (
+	ErrProductNotFound   = errors.New("product not found")
+	ErrInsufficientStock = errors.New("insufficient stock")
+)
+
+const movementColumns = "id, product_id, type, quantity, stock_after, unit_cost, expired_quantity, source_type, source_id, reason, device_id, created_at"
+
+type StockMovementRepo struct {
+	db *sql.DB
+}
+
+func NewStockMovementRepo(db *sql.DB) *StockMovementRepo {
+	return &StockMovementRepo{db: db}
+}
+
+// Record appends a movement to the ledger and applies it to the product's
+// cached stock in one transaction. Movements that would take stock below
+// zero are rejected.
+func (r *StockMovementRepo) Record(m *model.StockMovement) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := recordMovement(tx, m); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// recordMovement applies a movement within an open transaction. Movements
+// already in the ledger (replayed by sync) are skipped.
+//
+// It also values the movement: stock coming in at a cost moves the
+// product's weighted-average cost, and stock going out is costed by the
+// shop's costing method. UnitCost is set on m either way.
+func recordMovement(tx *sql.Tx, m *model.StockMovement) error {
+	var exists int
+	err := tx.QueryRow("SELECT COUNT(*) FROM stock_movements WHERE id=?", m.ID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists > 0 {
+		return nil
+	}
+
+	var stock, avgCost float64
+	err = tx.QueryRow("SELECT stock, COALESCE(average_cost, 0) FROM products WHERE id=?", m.ProductID).Scan(&stock, &avgCost)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrProductNotFound
+		}
+		return err
+	}
+
+	m.Quantity = model.RoundQuantity(m.Quantity)
+	m.StockAfter = model.RoundQuantity(stock + m.Quantity)
+	if m.StockAfter < 0 {
+		return ErrInsufficientStock
+	}
+
+	switch {
+	case m.Quantity < 0:
+		// Stock leaving the shop comes out of batches, closest expiry
+		// first, unless the movement names the batch (e.g. writing off
+		// expired stock). Expired stock sold is flagged on the movement.
+		preferBatchID := ""
+		if m.SourceType == "batch" {
+			preferBatchID = m.SourceID
+		}
+		at := m.CreatedAt
+		if at.IsZero() {
+			at = time.Now()
+		}
+		batchCost, covered, expired, err := consumeBatches(tx, m.ProductID, -m.Quantity, preferBatchID, at)
+		if err != nil {
+			return err
+		}
+		m.ExpiredQuantity = expired
+		m.UnitCost = avgCost
+		method, err := costingMethod(tx)
+		if err != nil {
+			return err
+		}
+		if method == model.CostingFIFO {
+			// stock outside any batch is valued at the average
+			m.UnitCost = (batchCost + (-m.Quantity-covered)*avgCost) / -m.Quantity
+		}
+	case m.Quantity > 0 && m.UnitCost > 0:
+		held := math.Max(stock, 0)
+		avgCost = (held*avgCost + m.Quantity*m.UnitCost) / (held + m.Quantity)
+	case m.Quantity > 0:
+		// found stock and returns come back at what stock is worth
+		m.UnitCost = avgCost
+	}
+
+	if _, err := tx.Exec(
+		"INSERT INTO stock_movements ("+movementColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		m.ID, m.ProductID, m.Type, m.Quantity, m.StockAfter, m.UnitCost, m.ExpiredQuantity, m.SourceType, m.SourceID, m.Reason, m.DeviceID, m.CreatedAt,
+	); err != nil {
+		return err
+	}
+
+	// updated_at is the server's time, not the movement's, which may be
+	// back-dated to when a sale was made offline
+	_, err = tx.Exec(
+		"UPDATE products SET stock=?, average_cost=?, version=version+1, updated_at=? WHERE id=?",
+		m.StockAfter, avgCost, time.Now(), m.ProductID,
+	)
+	return err
+}
+
+// costingMethod reads the shop's costing method, defaulting to average
+func costingMethod(tx *sql.Tx) (string, error) {
+	var method string
+	err := tx.QueryRow("SELECT value FROM settings WHERE key=?", model.SettingCostingMethod).Scan(&method)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !model.ValidCostingMethod(method)) {
+		return model.CostingAverage, nil
+	}
+	return method, err
+}
+
+// GetByProductID returns a product's movement history, oldest first
+func (r *StockMovementRepo) GetByProductID(productID string) ([]*model.StockMovement, error) {
+	rows, err := r.db.Query(
+		"SELECT "+movementColumns+" FROM stock_movements WHERE product_id=? ORDER BY created_at ASC, rowid ASC",
+		productID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanMovements(rows)
+}
+
+func scanMovements(rows *sql.Rows) ([]*model.StockMovement, error) {
+	var movements []*model.StockMovement
+	for rows.Next() {
+		m := &model.StockMovement{}
+		var sourceType, sourceID, reason, deviceID sql.NullString
+		var unitCost, expired sql.NullFloat64
+		if err := rows.Scan(
+			&m.ID, &m.ProductID, &m.Type, &m.Quantity, &m.StockAfter, &unitCost, &expired,
+			&sourceType, &sourceID, &reason, &deviceID, &m.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		m.UnitCost = unitCost.Float64
+		m.ExpiredQuantity = expired.Float64
+		m.SourceType = sourceType.String
+		m.SourceID = sourceID.String
+		m.Reason = reason.String
+		m.DeviceID = deviceID.String
+		movements = append(movements, m)
+	}
+	return movements, rows.Err()
+}
+
+// Rebuild recomputes a product's cached stock from its ledger
+func (r *StockMovementRepo) Rebuild(productID string) (float64, error) {
+	var stock float64
+	err := r.db.QueryRow(
+		"SELECT COALESCE(SUM(quantity), 0) FROM stock_movements WHERE product_id=?", productID,
+	).Scan(&stock)
+	if err != nil {
+		return 0, err
+	}
+	stock = model.RoundQuantity(stock)
+
+	_, err = r.db.Exec(
+		"UPDATE products SET stock=?, version=version+1, updated_at=? WHERE id=? AND stock<>?",
+		stock, time.Now(), productID, stock,
+	)
+	return stock, err
+}
@@ -0,0 +1,186 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"pesalocal/internal/model"
+)
+
+var ErrStockTakeClosed = errors.New("stock take is not open")
+
+const stockTakeColumns = "id, status, note, user_id, device_id, version, created_at, committed_at"
+
+type StockTakeRepo struct {
+	db *sql.DB
+}
+
+func NewStockTakeRepo(db *sql.DB) *StockTakeRepo {
+	return &StockTakeRepo{db: db}
+}
+
+// Create inserts a stock take session, ignoring sessions already present
+func (r *StockTakeRepo) Create(t *model.StockTake) error {
+	_, err := r.db.Exec(
+		"INSERT OR IGNORE INTO stock_takes ("+stockTakeColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		t.ID, t.Status, t.Note, t.UserID, t.DeviceID, t.Version, t.CreatedAt, t.CommittedAt,
+	)
+	return err
+}
+
+// GetByID returns a stock take session, or nil if it doesn't exist
+func (r *StockTakeRepo) GetByID(id string) (*model.StockTake, error) {
+	row := r.db.QueryRow("SELECT "+stockTakeColumns+" FROM stock_takes WHERE id=?", id)
+	t, err := scanStockTake(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil // not found
+	}
+	return t, err
+}
+
+// GetAll returns all stock take sessions, newest first
+func (r *StockTakeRepo) GetAll() ([]*model.StockTake, error) {
+	rows, err := r.db.Query("SELECT " + stockTakeColumns + " FROM stock_takes ORDER BY created_at DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var takes []*model.StockTake
+	for rows.Next() {
+		t, err := scanStockTake(rows)
+		if err != nil {
+			return nil, err
+		}
+		takes = append(takes, t)
+	}
+	return takes, rows.Err()
+}
+
+// Cancel closes an open session without adjusting stock
+func (r *StockTakeRepo) Cancel(id string) error {
+	res, err := r.db.Exec(
+		"UPDATE stock_takes SET status=?, version=version+1 WHERE id=? AND status=?",
+		model.StockTakeCancelled, id, model.StockTakeOpen,
+	)
+	if err != nil {
+		return err
+	}
+	affected, _ := res.RowsAffected()
+	if affected == 0 {
+		return ErrStockTakeClosed
+	}
+	return nil
+}
+
+// UpsertCount records a device's count of a product, with the product's
+// stock as it stands so that sales made before the session is committed
+// aren't counted as missing. A later count from the same device replaces
+// its earlier one; older counts are ignored.
+func (r *StockTakeRepo) UpsertCount(c *model.StockCount) error {
+	_, err := r.db.Exec(
+		`INSERT INTO stock_counts (id, stock_take_id, product_id, counted, expected, device_id, counted_at)
+		VALUES (?, ?, ?, ?, (SELECT stock FROM products WHERE id=?), ?, ?)
+		ON CONFLICT (stock_take_id, product_id, device_id) DO UPDATE SET
+			id=excluded.id, counted=excluded.counted, expected=excluded.expected, counted_at=excluded.counted_at
+		WHERE excluded.counted_at >= stock_counts.counted_at`,
+		c.ID, c.StockTakeID, c.ProductID, c.Counted, c.ProductID, c.DeviceID, c.CountedAt,
+	)
+	return err
+}
+
+// GetCounts returns all counts recorded for a session, oldest first.
+// Counts recorded before the expected stock was kept expect the product's
+// current stock.
+func (r *StockTakeRepo) GetCounts(stockTakeID string) ([]*model.StockCount, error) {
+	rows, err := r.db.Query(
+		`SELECT c.id, c.stock_take_id, c.product_id, c.counted, COALESCE(c.expected, p.stock, 0), c.device_id, c.counted_at
+		FROM stock_counts c LEFT JOIN products p ON p.id = c.product_id
+		WHERE c.stock_take_id=? ORDER BY c.counted_at ASC, c.rowid ASC`,
+		stockTakeID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []*model.StockCount
+	for rows.Next() {
+		c := &model.StockCount{}
+		if err := rows.Scan(&c.ID, &c.StockTakeID, &c.ProductID, &c.Counted, &c.Expected, &c.DeviceID, &c.CountedAt); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+// Commit books each product's variance and closes the session in one
+// transaction, so either every variance is booked or none is
+func (r *StockTakeRepo) Commit(id string, adjustments []*model.StockMovement, committedAt time.Time) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		"UPDATE stock_takes SET status=?, committed_at=?, version=version+1 WHERE id=? AND status=?",
+		model.StockTakeCommitted, committedAt, id, model.StockTakeOpen,
+	)
+	if err != nil {
+		return err
+	}
+	affected, _ := res.RowsAffected()
+	if affected == 0 {
+		return ErrStockTakeClosed
+	}
+
+	// Variances are against the stock when counted, so sales made since
+	// stay booked. Stock can't be taken below nothing, which a loss found
+	// by the count and sales made after it could otherwise ask for.
+	for _, m := range adjustments {
+		var stock float64
+		if err := tx.QueryRow("SELECT stock FROM products WHERE id=?", m.ProductID).Scan(&stock); err != nil {
+			return err
+		}
+		if stock+m.Quantity < 0 {
+			m.Quantity = -stock
+		}
+		if err := recordMovement(tx, m); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Adjustments returns the movements a committed stock take booked
+func (r *StockTakeRepo) Adjustments(id string) ([]*model.StockMovement, error) {
+	rows, err := r.db.Query(
+		"SELECT "+movementColumns+" FROM stock_movements WHERE source_type='stock_take' AND source_id=? ORDER BY rowid ASC",
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanMovements(rows)
+}
+
+func scanStockTake(row rowScanner) (*model.StockTake, error) {
+	t := &model.StockTake{}
+	var note, userID, deviceID sql.NullString
+	var committedAt sql.NullTime
+	err := row.Scan(&t.ID, &t.Status, &note, &userID, &deviceID, &t.Version, &t.CreatedAt, &committedAt)
+	if err != nil {
+		return nil, err
+	}
+	t.Note = note.String
+	t.UserID = userID.String
+	t.DeviceID = deviceID.String
+	if committedAt.Valid {
+		t.CommittedAt = &committedAt.Time
+	}
+	return t, nil
+}
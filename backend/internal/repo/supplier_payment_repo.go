@@ -0,0 +1,80 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+
+	"pesalocal/internal/model"
+)
+
+const supplierPaymentColumns = "id, supplier_id, purchase_id, amount, method, reference, device_id, paid_at"
+
+type SupplierPaymentRepo struct {
+	db *sql.DB
+}
+
+func NewSupplierPaymentRepo(db *sql.DB) *SupplierPaymentRepo {
+	return &SupplierPaymentRepo{db: db}
+}
+
+// Create inserts a payment. Payments are never edited, so a payment
+// already recorded (a sync replay) is left as it is. Payment times are
+// stored in UTC so they compare correctly as text.
+func (r *SupplierPaymentRepo) Create(p *model.SupplierPayment) error {
+	_, err := r.db.Exec(
+		"INSERT OR IGNORE INTO supplier_payments ("+supplierPaymentColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		p.ID, p.SupplierID, p.PurchaseID, p.Amount, p.Method, p.Reference, p.DeviceID, p.PaidAt.UTC(),
+	)
+	return err
+}
+
+// GetByID returns a payment, or nil if it doesn't exist
+func (r *SupplierPaymentRepo) GetByID(id string) (*model.SupplierPayment, error) {
+	row := r.db.QueryRow("SELECT "+supplierPaymentColumns+" FROM supplier_payments WHERE id=?", id)
+	p, err := scanSupplierPayment(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil // not found
+	}
+	return p, err
+}
+
+// GetBySupplierID returns a supplier's payments, newest first
+func (r *SupplierPaymentRepo) GetBySupplierID(supplierID string) ([]*model.SupplierPayment, error) {
+	rows, err := r.db.Query(
+		"SELECT "+supplierPaymentColumns+" FROM supplier_payments WHERE supplier_id=? ORDER BY paid_at DESC",
+		supplierID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	payments := []*model.SupplierPayment{}
+	for rows.Next() {
+		p, err := scanSupplierPayment(rows)
+		if err != nil {
+			return nil, err
+		}
+		payments = append(payments, p)
+	}
+	return payments, rows.Err()
+}
+
+// TotalForPurchase returns how much has been paid against a purchase
+func (r *SupplierPaymentRepo) TotalForPurchase(purchaseID string) (float64, error) {
+	var total float64
+	err := r.db.QueryRow(
+		"SELECT COALESCE(SUM(amount), 0) FROM supplier_payments WHERE purchase_id=?",
+		purchaseID,
+	).Scan(&total)
+	return total, err
+}
+
+func scanSupplierPayment(row rowScanner) (*model.SupplierPayment, error) {
+	p := &model.SupplierPayment{}
+	err := row.Scan(&p.ID, &p.SupplierID, &p.PurchaseID, &p.Amount, &p.Method, &p.Reference, &p.DeviceID, &p.PaidAt)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
@@ -0,0 +1,261 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"pesalocal/internal/fieldcrypt"
+	"pesalocal/internal/model"
+)
+
+const supplierColumns = "id, name, phone, paybill, account, till, notes, version, updated_at"
+
+// supplierIDMatch matches a supplier by ID, or by an ID merged into it;
+// the ID is bound twice
+const supplierIDMatch = "id = COALESCE((SELECT supplier_id FROM supplier_aliases WHERE id=?), ?)"
+
+type SupplierRepo struct {
+	db   *sql.DB
+	keys *fieldcrypt.Keyring // encrypts phone and account numbers
+}
+
+func NewSupplierRepo(db *sql.DB, keys *fieldcrypt.Keyring) *SupplierRepo {
+	return &SupplierRepo{db: db, keys: keys}
+}
+
+// CreateOrUpdate ensures idempotent behavior for sync. Names are unique,
+// so a supplier arriving under a new ID with the name of one already held
+// (added by another device, or from a purchase naming them) is the same
+// supplier: its ID is kept as an alias of the one held, and s.ID is set
+// to that.
+func (r *SupplierRepo) CreateOrUpdate(s *model.Supplier) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	existing, err := scanSupplier(tx.QueryRow("SELECT "+supplierColumns+" FROM suppliers WHERE "+supplierIDMatch, s.ID, s.ID), r.keys)
+	if errors.Is(err, sql.ErrNoRows) {
+		existing, err = scanSupplier(tx.QueryRow("SELECT "+supplierColumns+" FROM suppliers WHERE name=? COLLATE NOCASE", s.Name), r.keys)
+		if err == nil {
+			if _, err := tx.Exec("INSERT INTO supplier_aliases (id, supplier_id) VALUES (?, ?)", s.ID, existing.ID); err != nil {
+				return err
+			}
+		}
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		existing, err = nil, nil
+	}
+	if err != nil {
+		return err
+	}
+
+	phone, err := r.keys.Encrypt(colSupplierPhone, s.Phone)
+	if err != nil {
+		return err
+	}
+	account, err := r.keys.Encrypt(colSupplierAccount, s.Account)
+	if err != nil {
+		return err
+	}
+
+	if existing == nil {
+		if _, err := tx.Exec(
+			"INSERT INTO suppliers ("+supplierColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			s.ID, s.Name, phone, s.Paybill, account, s.Till, s.Notes, s.Version, s.UpdatedAt,
+		); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	merged := existing.ID != s.ID
+	s.ID = existing.ID
+	// Update only if version is newer; a merged supplier's details count
+	// when they are at least as new
+	if s.Version < existing.Version || (s.Version == existing.Version && !merged) {
+		return tx.Commit()
+	}
+
+	if _, err := tx.Exec(
+		"UPDATE suppliers SET name=?, phone=?, paybill=?, account=?, till=?, notes=?, version=?, updated_at=? WHERE id=?",
+		s.Name, phone, s.Paybill, account, s.Till, s.Notes, s.Version, s.UpdatedAt, s.ID,
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetByID returns a supplier by their ID or one merged into it, or nil if
+// they don't exist
+func (r *SupplierRepo) GetByID(id string) (*model.Supplier, error) {
+	row := r.db.QueryRow("SELECT "+supplierColumns+" FROM suppliers WHERE "+supplierIDMatch, id, id)
+	s, err := scanSupplier(row, r.keys)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil // not found
+	}
+	return s, err
+}
+
+// GetByName returns a supplier by name (case-insensitive), or nil
+func (r *SupplierRepo) GetByName(name string) (*model.Supplier, error) {
+	row := r.db.QueryRow("SELECT "+supplierColumns+" FROM suppliers WHERE name=? COLLATE NOCASE", name)
+	s, err := scanSupplier(row, r.keys)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil // not found
+	}
+	return s, err
+}
+
+// GetUpdatedSince returns suppliers changed after t
+func (r *SupplierRepo) GetUpdatedSince(t time.Time) ([]*model.Supplier, error) {
+	rows, err := r.db.Query("SELECT "+supplierColumns+" FROM suppliers WHERE updated_at > ? ORDER BY name", t)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var suppliers []*model.Supplier
+	for rows.Next() {
+		s, err := scanSupplier(rows, r.keys)
+		if err != nil {
+			return nil, err
+		}
+		suppliers = append(suppliers, s)
+	}
+	return suppliers, rows.Err()
+}
+
+// supplierSummarySelect totals each supplier's purchases and payments.
+// Cash and M-PESA purchases are paid on delivery; only credit purchases
+// add to the balance owed.
+const supplierSummarySelect = `SELECT ` + supplierColumns + `,
+	(SELECT COUNT(*) FROM purchases p WHERE p.supplier_id = s.id),
+	(SELECT COALESCE(SUM(p.total_amount), 0) FROM purchases p WHERE p.supplier_id = s.id),
+	(SELECT COALESCE(SUM(p.total_amount), 0) FROM purchases p WHERE p.supplier_id = s.id AND p.payment_method = 'credit'),
+	(SELECT COALESCE(SUM(sp.amount), 0) FROM supplier_payments sp WHERE sp.supplier_id = s.id),
+	(SELECT MAX(p.created_at) FROM purchases p WHERE p.supplier_id = s.id)
+	FROM suppliers s`
+
+// GetSummary returns a supplier, found by their ID or one merged into it,
+// with their purchase and payment totals, or nil if they don't exist
+func (r *SupplierRepo) GetSummary(id string) (*model.SupplierSummary, error) {
+	row := r.db.QueryRow(supplierSummarySelect+" WHERE s."+supplierIDMatch, id, id)
+	s, err := scanSupplierSummary(row, r.keys)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil // not found
+	}
+	return s, err
+}
+
+// GetSummaries returns every supplier with their totals, by name
+func (r *SupplierRepo) GetSummaries() ([]*model.SupplierSummary, error) {
+	rows, err := r.db.Query(supplierSummarySelect + " ORDER BY s.name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summaries := []*model.SupplierSummary{}
+	for rows.Next() {
+		s, err := scanSupplierSummary(rows, r.keys)
+		if err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, s)
+	}
+	return summaries, rows.Err()
+}
+
+// GetLastPrices returns, for each product bought from a supplier, the
+// price paid on the most recent purchase
+func (r *SupplierRepo) GetLastPrices(supplierID string) ([]*model.SupplierPrice, error) {
+	rows, err := r.db.Query(
+		`SELECT pi.product_id, COALESCE(pr.name, ''), COALESCE(pr.price_per_unit, ''),
+			pi.price, pi.quantity, p.id, p.created_at
+		FROM purchase_items pi
+		JOIN purchases p ON p.id = pi.purchase_id
+		LEFT JOIN products pr ON pr.id = pi.product_id
+		WHERE p.supplier_id = ? AND p.id = (
+			SELECT p2.id FROM purchase_items pi2 JOIN purchases p2 ON p2.id = pi2.purchase_id
+			WHERE p2.supplier_id = p.supplier_id AND pi2.product_id = pi.product_id
+			ORDER BY p2.created_at DESC LIMIT 1
+		)
+		ORDER BY pr.name`,
+		supplierID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	prices := []*model.SupplierPrice{}
+	for rows.Next() {
+		p := &model.SupplierPrice{}
+		if err := rows.Scan(&p.ProductID, &p.Name, &p.Unit, &p.Price, &p.Quantity, &p.PurchaseID, &p.PurchasedAt); err != nil {
+			return nil, err
+		}
+		prices = append(prices, p)
+	}
+	return prices, rows.Err()
+}
+
+func scanSupplier(row rowScanner, keys *fieldcrypt.Keyring) (*model.Supplier, error) {
+	s := &model.Supplier{}
+	err := row.Scan(&s.ID, &s.Name, &s.Phone, &s.Paybill, &s.Account, &s.Till, &s.Notes, &s.Version, &s.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return s, decryptSupplier(s, keys)
+}
+
+// decryptSupplier reads a supplier's phone and account numbers as stored
+func decryptSupplier(s *model.Supplier, keys *fieldcrypt.Keyring) error {
+	var err error
+	if s.Phone, err = keys.Decrypt(colSupplierPhone, s.Phone); err != nil {
+		return err
+	}
+	s.Account, err = keys.Decrypt(colSupplierAccount, s.Account)
+	return err
+}
+
+func scanSupplierSummary(row rowScanner, keys *fieldcrypt.Keyring) (*model.SupplierSummary, error) {
+	s := &model.SupplierSummary{Supplier: &model.Supplier{}}
+	var last sql.NullString
+	err := row.Scan(
+		&s.ID, &s.Name, &s.Phone, &s.Paybill, &s.Account, &s.Till, &s.Notes, &s.Version, &s.UpdatedAt,
+		&s.PurchaseCount, &s.TotalSpend, &s.CreditTotal, &s.Paid, &last,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := decryptSupplier(s.Supplier, keys); err != nil {
+		return nil, err
+	}
+	s.Balance = s.CreditTotal - s.Paid
+	if last.Valid {
+		// aggregates lose the column's DATETIME type, so parse it here
+		if t, err := parseSQLiteTime(last.String); err == nil {
+			s.LastPurchaseAt = &t
+		}
+	}
+	return s, nil
+}
+
+// parseSQLiteTime parses a timestamp as the driver writes it
+func parseSQLiteTime(s string) (time.Time, error) {
+	for _, layout := range []string{
+		"2006-01-02 15:04:05.999999999-07:00",
+		"2006-01-02T15:04:05.999999999-07:00",
+		"2006-01-02 15:04:05.999999999",
+		"2006-01-02T15:04:05.999999999Z07:00",
+		"2006-01-02 15:04:05",
+	} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New("unrecognised timestamp: " + s)
+}
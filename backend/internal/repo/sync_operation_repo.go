@@ -3,26 +3,42 @@ package repo
 import (
 	"database/sql"
 
+	"pesalocal/internal/fieldcrypt"
 	"pesalocal/internal/model"
 )
 
 type SyncOperationRepo struct {
-	db *sql.DB
+	db   *sql.DB
+	keys *fieldcrypt.Keyring // encrypts payloads, which can hold personal data
 }
 
-func NewSyncOperationRepo(db *sql.DB) *SyncOperationRepo {
-	return &SyncOperationRepo{db: db}
+func NewSyncOperationRepo(db *sql.DB, keys *fieldcrypt.Keyring) *SyncOperationRepo {
+	return &SyncOperationRepo{db: db, keys: keys}
 }
 
 // Create adds a new sync operation (from device)
 func (r *SyncOperationRepo) Create(op *model.SyncOperation) error {
-	_, err := r.db.Exec(
+	payload, err := r.keys.Encrypt(colSyncPayload, string(op.Payload))
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(
 		"INSERT INTO sync_operations (id, entity_type, entity_id, operation, payload, device_id, created_at, retry_count) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
-		op.ID, op.EntityType, op.EntityID, op.Operation, op.Payload, op.DeviceID, op.CreatedAt, op.RetryCount,
+		op.ID, op.EntityType, op.EntityID, op.Operation, payload, op.DeviceID, op.CreatedAt, op.RetryCount,
 	)
 	return err
 }
 
+// decryptPayload replaces an operation's stored payload with its plaintext
+func (r *SyncOperationRepo) decryptPayload(op *model.SyncOperation) error {
+	payload, err := r.keys.Decrypt(colSyncPayload, string(op.Payload))
+	if err != nil {
+		return err
+	}
+	op.Payload = []byte(payload)
+	return nil
+}
+
 // GetAllPending returns all operations that have not been processed (retry_count < max)
 func (r *SyncOperationRepo) GetAllPending(maxRetries int) ([]*model.SyncOperation, error) {
 	rows, err := r.db.Query(
@@ -38,6 +54,9 @@ func (r *SyncOperationRepo) GetAllPending(maxRetries int) ([]*model.SyncOperatio
 	for rows.Next() {
 		op := &model.SyncOperation{}
 		rows.Scan(&op.ID, &op.EntityType, &op.EntityID, &op.Operation, &op.Payload, &op.DeviceID, &op.CreatedAt, &op.RetryCount)
+		if err := r.decryptPayload(op); err != nil {
+			return nil, err
+		}
 		ops = append(ops, op)
 	}
 	return ops, nil
@@ -95,6 +114,9 @@ func (r *SyncOperationRepo) GetAll() ([]*model.SyncOperation, error) {
 		if err != nil {
 			return nil, err
 		}
+		if err := r.decryptPayload(op); err != nil {
+			return nil, err
+		}
 
 		ops = append(ops, op)
 	}
@@ -107,7 +129,11 @@ func (r *SyncOperationRepo) GetAll() ([]*model.SyncOperation, error) {
 }
 
 func (r *SyncOperationRepo) Update(op *model.SyncOperation) error {
-	_, err := r.db.Exec(`
+	payload, err := r.keys.Encrypt(colSyncPayload, string(op.Payload))
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(`
 		UPDATE sync_operations
 		SET
 			entity_type = ?,
@@ -122,7 +148,7 @@ func (r *SyncOperationRepo) Update(op *model.SyncOperation) error {
 		op.EntityType,
 		op.EntityID,
 		op.Operation,
-		op.Payload,
+		payload,
 		op.DeviceID,
 		op.CreatedAt,
 		op.RetryCount,
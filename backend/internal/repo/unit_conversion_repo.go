@@ -0,0 +1,96 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+
+	"pesalocal/internal/model"
+)
+
+const unitConversionColumns = "id, product_id, from_unit, to_unit, factor, version, updated_at"
+
+type UnitConversionRepo struct {
+	db *sql.DB
+}
+
+func NewUnitConversionRepo(db *sql.DB) *UnitConversionRepo {
+	return &UnitConversionRepo{db: db}
+}
+
+// CreateOrUpdate ensures idempotent behavior for sync
+func (r *UnitConversionRepo) CreateOrUpdate(c *model.UnitConversion) error {
+	existing, err := r.GetByID(c.ID)
+	if err != nil {
+		return err
+	}
+
+	if existing == nil {
+		_, err := r.db.Exec(
+			"INSERT INTO unit_conversions ("+unitConversionColumns+") VALUES (?, ?, ?, ?, ?, ?, ?)",
+			c.ID, c.ProductID, c.FromUnit, c.ToUnit, c.Factor, c.Version, c.UpdatedAt,
+		)
+		return err
+	}
+
+	// Update only if version is newer
+	if c.Version <= existing.Version {
+		return nil
+	}
+
+	_, err = r.db.Exec(
+		"UPDATE unit_conversions SET product_id=?, from_unit=?, to_unit=?, factor=?, version=?, updated_at=? WHERE id=?",
+		c.ProductID, c.FromUnit, c.ToUnit, c.Factor, c.Version, c.UpdatedAt, c.ID,
+	)
+	return err
+}
+
+// GetByID returns a conversion, or nil if it doesn't exist
+func (r *UnitConversionRepo) GetByID(id string) (*model.UnitConversion, error) {
+	row := r.db.QueryRow("SELECT "+unitConversionColumns+" FROM unit_conversions WHERE id=?", id)
+	c, err := scanUnitConversion(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil // not found
+	}
+	return c, err
+}
+
+// Find returns the conversion between two units for a product, or the
+// shop-wide one when productID is empty. Returns nil if none is defined.
+func (r *UnitConversionRepo) Find(productID, fromUnit, toUnit string) (*model.UnitConversion, error) {
+	row := r.db.QueryRow(
+		"SELECT "+unitConversionColumns+" FROM unit_conversions WHERE product_id=? AND from_unit=? COLLATE NOCASE AND to_unit=? COLLATE NOCASE",
+		productID, fromUnit, toUnit,
+	)
+	c, err := scanUnitConversion(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil // not found
+	}
+	return c, err
+}
+
+// GetAll returns all conversions, shop-wide ones first
+func (r *UnitConversionRepo) GetAll() ([]*model.UnitConversion, error) {
+	rows, err := r.db.Query("SELECT " + unitConversionColumns + " FROM unit_conversions ORDER BY product_id, from_unit, to_unit")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var conversions []*model.UnitConversion
+	for rows.Next() {
+		c, err := scanUnitConversion(rows)
+		if err != nil {
+			return nil, err
+		}
+		conversions = append(conversions, c)
+	}
+	return conversions, rows.Err()
+}
+
+func scanUnitConversion(row rowScanner) (*model.UnitConversion, error) {
+	c := &model.UnitConversion{}
+	if err := row.Scan(&c.ID, &c.ProductID, &c.FromUnit, &c.ToUnit, &c.Factor, &c.Version, &c.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
@@ -3,17 +3,21 @@ package repo
 import (
 	"database/sql"
 	"errors"
+	"strings"
+
+	"pesalocal/internal/fieldcrypt"
 	"pesalocal/internal/model"
 )
 
 var ErrUserConflict = errors.New("user conflict")
 
 type UserRepo struct {
-	db *sql.DB
+	db   *sql.DB
+	keys *fieldcrypt.Keyring // encrypts emails
 }
 
-func NewUserRepo(db *sql.DB) *UserRepo {
-	return &UserRepo{db: db}
+func NewUserRepo(db *sql.DB, keys *fieldcrypt.Keyring) *UserRepo {
+	return &UserRepo{db: db, keys: keys}
 }
 
 // CreateOrUpdate ensures idempotent sync behavior
@@ -23,12 +27,18 @@ func (r *UserRepo) CreateOrUpdate(u *model.User) error {
 		return err
 	}
 
+	email, err := r.keys.Encrypt(colUserEmail, u.Email)
+	if err != nil {
+		return err
+	}
+	emailHash := r.keys.Blind(colUserEmail, u.Email)
+
 	if existing == nil {
 		_, err := r.db.Exec(
 			`INSERT INTO users 
-			(id, name, email, password, role, device_id, version, created_at, updated_at) 
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-			u.ID, u.Name, u.Email, u.Password, u.Role, u.DeviceID, u.Version, u.CreatedAt, u.UpdatedAt,
+			(id, name, email, email_hash, password, role, device_id, version, created_at, updated_at) 
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			u.ID, u.Name, email, emailHash, u.Password, u.Role, u.DeviceID, u.Version, u.CreatedAt, u.UpdatedAt,
 		)
 		return err
 	}
@@ -40,9 +50,9 @@ func (r *UserRepo) CreateOrUpdate(u *model.User) error {
 
 	_, err = r.db.Exec(
 		`UPDATE users SET 
-		name=?, email=?, password=?, role=?, device_id=?, version=?, updated_at=? 
+		name=?, email=?, email_hash=?, password=?, role=?, device_id=?, version=?, updated_at=? 
 		WHERE id=?`,
-		u.Name, u.Email, u.Password, u.Role, u.DeviceID, u.Version, u.UpdatedAt, u.ID,
+		u.Name, email, emailHash, u.Password, u.Role, u.DeviceID, u.Version, u.UpdatedAt, u.ID,
 	)
 	return err
 }
@@ -61,13 +71,24 @@ func (r *UserRepo) GetByID(id string) (*model.User, error) {
 	if err != nil {
 		return nil, err
 	}
-	return u, nil
+	return u, r.decrypt(u)
 }
 
+// GetByEmail finds a user by email. Encrypted emails are found by their
+// blind index.
 func (r *UserRepo) GetByEmail(email string) (*model.User, error) {
+	where, args := "email=?", []interface{}{email}
+	if r.keys.Enabled() {
+		blinds := r.keys.Blinds(colUserEmail, email)
+		where = "email_hash IN (" + strings.TrimSuffix(strings.Repeat("?, ", len(blinds)), ", ") + ")"
+		args = args[:0]
+		for _, b := range blinds {
+			args = append(args, b)
+		}
+	}
 	row := r.db.QueryRow(
 		`SELECT id, name, email, password, role, device_id, version, created_at, updated_at 
-		FROM users WHERE email=?`, email,
+		FROM users WHERE `+where, args...,
 	)
 	u := &model.User{}
 	err := row.Scan(
@@ -77,7 +98,7 @@ func (r *UserRepo) GetByEmail(email string) (*model.User, error) {
 	if err != nil {
 		return nil, err
 	}
-	return u, nil
+	return u, r.decrypt(u)
 }
 
 func (r *UserRepo) GetAll() ([]*model.User, error) {
@@ -99,6 +120,9 @@ func (r *UserRepo) GetAll() ([]*model.User, error) {
 		); err != nil {
 			return nil, err
 		}
+		if err := r.decrypt(u); err != nil {
+			return nil, err
+		}
 		users = append(users, u)
 	}
 
@@ -107,3 +131,10 @@ func (r *UserRepo) GetAll() ([]*model.User, error) {
 	}
 	return users, nil
 }
+
+// decrypt reads a user's email as stored
+func (r *UserRepo) decrypt(u *model.User) error {
+	email, err := r.keys.Decrypt(colUserEmail, u.Email)
+	u.Email = email
+	return err
+}
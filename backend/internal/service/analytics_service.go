@@ -0,0 +1,169 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"pesalocal/internal/model"
+	"pesalocal/internal/repo"
+)
+
+var ErrInvalidBucket = errors.New("bucket must be hour, day, week or month")
+var ErrInvalidCompare = errors.New("compare must be previous or year")
+var ErrInvalidRange = errors.New("from must be before to")
+var ErrSeriesTooLong = errors.New("too many buckets; use a larger bucket or a shorter range")
+
+// Comparison periods
+const (
+	ComparePrevious = "previous" // the same length of time just before
+	CompareYear     = "year"     // the same dates a year earlier
+)
+
+// maxSeriesPoints keeps a series chartable: a year of days or a quarter
+// of hours fits
+const maxSeriesPoints = 2500
+
+type AnalyticsService struct {
+	reportRepo *repo.ReportRepo
+}
+
+func NewAnalyticsService(rr *repo.ReportRepo) *AnalyticsService {
+	return &AnalyticsService{reportRepo: rr}
+}
+
+// DefaultSeriesRange returns the range a series covers when none is
+// given: the last day of hours, month of days, quarter of weeks or year
+// of months, up to now
+func DefaultSeriesRange(bucket string, now time.Time) (time.Time, time.Time) {
+	to := nextBucket(bucketStart(now, bucket), bucket)
+	switch bucket {
+	case model.BucketHour:
+		return to.Add(-24 * time.Hour), to
+	case model.BucketWeek:
+		return to.AddDate(0, 0, -7*13), to
+	case model.BucketMonth:
+		return to.AddDate(-1, 0, 0), to
+	}
+	return to.AddDate(0, 0, -30), to
+}
+
+// GetSalesSeries returns sales, units and margin per bucket in [from, to),
+// every bucket present even when nothing sold. With compare, the same
+// series for the earlier period is attached along with the change in
+// totals.
+func (s *AnalyticsService) GetSalesSeries(bucket string, from, to time.Time, f model.SeriesFilter, compare string) (*model.SalesSeries, error) {
+	if !model.ValidBucket(bucket) {
+		return nil, ErrInvalidBucket
+	}
+	if compare != "" && compare != ComparePrevious && compare != CompareYear {
+		return nil, ErrInvalidCompare
+	}
+
+	series, err := s.series(bucket, from, to, f)
+	if err != nil || compare == "" {
+		return series, err
+	}
+
+	cFrom, cTo := from.Add(-to.Sub(from)), from
+	if compare == CompareYear {
+		cFrom, cTo = from.AddDate(-1, 0, 0), to.AddDate(-1, 0, 0)
+	}
+	series.Compare, err = s.series(bucket, cFrom, cTo, f)
+	if err != nil {
+		return nil, err
+	}
+	series.Change = &model.SeriesChange{
+		Sales:       percentChange(float64(series.Compare.Total.Sales), float64(series.Total.Sales)),
+		Units:       percentChange(series.Compare.Total.Units, series.Total.Units),
+		Revenue:     percentChange(series.Compare.Total.Revenue, series.Total.Revenue),
+		GrossMargin: percentChange(series.Compare.Total.GrossMargin, series.Total.GrossMargin),
+	}
+	return series, nil
+}
+
+func (s *AnalyticsService) series(bucket string, from, to time.Time, f model.SeriesFilter) (*model.SalesSeries, error) {
+	if !from.Before(to) {
+		return nil, ErrInvalidRange
+	}
+
+	// lay out every bucket first so gaps show as zeros
+	points := []*model.SeriesPoint{}
+	for start := bucketStart(from, bucket); start.Before(to); start = nextBucket(start, bucket) {
+		if len(points) == maxSeriesPoints {
+			return nil, ErrSeriesTooLong
+		}
+		points = append(points, &model.SeriesPoint{Bucket: bucketLabel(start, bucket), Start: start})
+	}
+
+	found, err := s.reportRepo.SalesSeries(bucket, from, to, f)
+	if err != nil {
+		return nil, err
+	}
+
+	series := &model.SalesSeries{Bucket: bucket, From: from, To: to, Filter: f, Points: points}
+	total := &series.Total
+	for _, p := range points {
+		if got, ok := found[p.Bucket]; ok {
+			p.Sales, p.Units, p.Revenue, p.Cost = got.Sales, got.Units, got.Revenue, got.Cost
+		}
+		p.Units = model.RoundQuantity(p.Units)
+		p.Revenue = roundMoney(p.Revenue)
+		p.Cost = roundMoney(p.Cost)
+		p.GrossMargin = roundMoney(p.Revenue - p.Cost)
+
+		total.Sales += p.Sales
+		total.Units += p.Units
+		total.Revenue += p.Revenue
+		total.Cost += p.Cost
+	}
+	total.Start = from
+	total.Units = model.RoundQuantity(total.Units)
+	total.Revenue = roundMoney(total.Revenue)
+	total.Cost = roundMoney(total.Cost)
+	total.GrossMargin = roundMoney(total.Revenue - total.Cost)
+	return series, nil
+}
+
+// bucketStart returns the start of the bucket holding t, in local time
+func bucketStart(t time.Time, bucket string) time.Time {
+	t = t.Local()
+	y, m, d := t.Date()
+	switch bucket {
+	case model.BucketHour:
+		return time.Date(y, m, d, t.Hour(), 0, 0, 0, time.Local)
+	case model.BucketWeek:
+		monday := d - (int(t.Weekday())+6)%7
+		return time.Date(y, m, monday, 0, 0, 0, 0, time.Local)
+	case model.BucketMonth:
+		return time.Date(y, m, 1, 0, 0, 0, 0, time.Local)
+	}
+	return time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+}
+
+func nextBucket(start time.Time, bucket string) time.Time {
+	switch bucket {
+	case model.BucketHour:
+		return start.Add(time.Hour)
+	case model.BucketWeek:
+		return start.AddDate(0, 0, 7)
+	case model.BucketMonth:
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// bucketLabel matches the labels ReportRepo.SalesSeries groups by
+func bucketLabel(start time.Time, bucket string) string {
+	if bucket == model.BucketHour {
+		return start.Format("2006-01-02 15:00")
+	}
+	return start.Format(dayLayout)
+}
+
+func percentChange(before, after float64) *float64 {
+	if before == 0 {
+		return nil
+	}
+	change := roundMoney((after - before) / before * 100)
+	return &change
+}
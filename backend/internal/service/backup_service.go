@@ -0,0 +1,163 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"pesalocal/internal/backup"
+	"pesalocal/internal/model"
+	"pesalocal/internal/repo"
+)
+
+// DefaultBackupKeep is how many scheduled backups are kept: two weeks of
+// daily backups
+const DefaultBackupKeep = 14
+
+const backupPrefix = "pesalocal-"
+
+var (
+	ErrBackupsDisabled = errors.New("backups need a passphrase: set PESALOCAL_BACKUP_KEY or PESALOCAL_BACKUP_KEY_FILE")
+	ErrBackupNotFound  = errors.New("backup not found")
+)
+
+type BackupService struct {
+	backupRepo *repo.BackupRepo
+	dir        string
+	passphrase []byte
+	keep       int
+}
+
+// NewBackupService keeps backups in dir, the newest keep of them.
+// Without a passphrase no backups are made: they would hold the shop's
+// data in the clear.
+func NewBackupService(br *repo.BackupRepo, dir string, passphrase []byte, keep int) *BackupService {
+	if keep <= 0 {
+		keep = DefaultBackupKeep
+	}
+	return &BackupService{
+		backupRepo: br,
+		dir:        dir,
+		passphrase: passphrase,
+		keep:       keep,
+	}
+}
+
+// Enabled reports whether backups can be made
+func (s *BackupService) Enabled() bool {
+	return len(s.passphrase) > 0
+}
+
+// CreateBackup snapshots the database into a new encrypted archive, then
+// removes the oldest archives beyond the number kept
+func (s *BackupService) CreateBackup() (*model.Backup, error) {
+	if !s.Enabled() {
+		return nil, ErrBackupsDisabled
+	}
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return nil, err
+	}
+	tmp, err := os.MkdirTemp(s.dir, ".backup-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	snapshot := filepath.Join(tmp, "snapshot.db")
+	if err := s.backupRepo.Snapshot(snapshot); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	name := backupPrefix + now.Format("20060102-150405") + backup.Extension
+	partial := filepath.Join(tmp, name)
+	f, err := os.OpenFile(partial, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := backup.Write(f, snapshot, s.passphrase)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(partial)
+	if err != nil {
+		return nil, err
+	}
+	// only complete archives appear under their name
+	if err := os.Rename(partial, filepath.Join(s.dir, name)); err != nil {
+		return nil, err
+	}
+
+	if err := s.prune(); err != nil {
+		return nil, err
+	}
+	return &model.Backup{Name: name, Size: info.Size(), CreatedAt: now, Tables: manifest.Tables}, nil
+}
+
+// GetBackups lists the archives kept, newest first
+func (s *BackupService) GetBackups() ([]*model.Backup, error) {
+	entries, err := os.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return []*model.Backup{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	backups := []*model.Backup{}
+	for _, e := range entries {
+		if e.IsDir() || !isBackupName(e.Name()) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		backups = append(backups, &model.Backup{Name: e.Name(), Size: info.Size(), CreatedAt: info.ModTime()})
+	}
+	// names carry the time they were made
+	sort.Slice(backups, func(i, j int) bool { return backups[i].Name > backups[j].Name })
+	return backups, nil
+}
+
+// BackupPath returns where a kept archive is, for downloading it
+func (s *BackupService) BackupPath(name string) (string, error) {
+	if !isBackupName(name) || filepath.Base(name) != name {
+		return "", ErrBackupNotFound
+	}
+	path := filepath.Join(s.dir, name)
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			return "", ErrBackupNotFound
+		}
+		return "", err
+	}
+	return path, nil
+}
+
+// prune removes the oldest archives beyond the number kept
+func (s *BackupService) prune() error {
+	backups, err := s.GetBackups()
+	if err != nil {
+		return err
+	}
+	for i := s.keep; i < len(backups); i++ {
+		if err := os.Remove(filepath.Join(s.dir, backups[i].Name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func isBackupName(name string) bool {
+	return strings.HasPrefix(name, backupPrefix) && strings.HasSuffix(name, backup.Extension)
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"log"
+
+	"pesalocal/internal/daraja"
+	"pesalocal/internal/model"
+)
+
+type DarajaService struct {
+	mpesaSvc *MpesaService
+	saleSvc  *SaleService
+}
+
+func NewDarajaService(ms *MpesaService, ss *SaleService) *DarajaService {
+	return &DarajaService{
+		mpesaSvc: ms,
+		saleSvc:  ss,
+	}
+}
+
+// PaymentResult reports what happened to a callback payment
+type PaymentResult struct {
+	Transaction *model.MpesaTransaction `json:"transaction"`
+	Duplicate   bool                    `json:"duplicate"`
+	Sale        *model.Sale             `json:"sale,omitempty"` // matched sale, if any
+}
+
+// ValidateC2B decides whether Safaricom should accept a C2B payment
+func (s *DarajaService) ValidateC2B(req *daraja.C2BRequest) *daraja.C2BResponse {
+	amount, err := req.Amount()
+	if err != nil || amount <= 0 {
+		return &daraja.C2BResponse{ResultCode: daraja.ResultInvalidAmount, ResultDesc: "Rejected"}
+	}
+	return &daraja.C2BResponse{ResultCode: daraja.ResultAccepted, ResultDesc: "Accepted"}
+}
+
+// ConfirmC2B stores a confirmed C2B payment and matches it to a sale using
+// the account reference the customer entered
+func (s *DarajaService) ConfirmC2B(req *daraja.C2BRequest) (*PaymentResult, error) {
+	tx, err := req.Transaction()
+	if err != nil {
+		return nil, err
+	}
+	return s.record(tx, req.BillRefNumber)
+}
+
+// ConfirmSTK stores a completed STK Push payment and matches it to a sale
+func (s *DarajaService) ConfirmSTK(cb *daraja.STKCallback) (*PaymentResult, error) {
+	tx, err := cb.Transaction()
+	if err != nil {
+		return nil, err
+	}
+	return s.record(tx, "")
+}
+
+// record stores the payment once; Daraja retries callbacks it thinks
+// failed, so repeats are acknowledged without matching again
+func (s *DarajaService) record(tx *model.MpesaTransaction, reference string) (*PaymentResult, error) {
+	isNew, err := s.mpesaSvc.AddTransaction(tx)
+	if err != nil {
+		return nil, err
+	}
+	result := &PaymentResult{Transaction: tx, Duplicate: !isNew}
+	if !isNew {
+		return result, nil
+	}
+
+	sale, err := s.saleSvc.MatchMpesaPayment(tx, reference)
+	if err != nil {
+		// the payment is stored; matching can be retried later
+		log.Printf("daraja: matching %s failed: %v", tx.ReceiptNo, err)
+		return result, nil
+	}
+	if sale != nil {
+		if err := s.mpesaSvc.LinkSale(tx, sale.ID); err != nil {
+			return nil, err
+		}
+		result.Sale = sale
+	}
+	return result, nil
+}
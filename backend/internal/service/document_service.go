@@ -0,0 +1,196 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"pesalocal/internal/document"
+	"pesalocal/internal/model"
+	"pesalocal/internal/repo"
+)
+
+var ErrInvalidDocumentKind = errors.New("kind must be receipt, invoice or iou")
+
+// Setting keys for shop branding on printed documents
+const (
+	SettingShopName       = "shop_name"
+	SettingShopAddress    = "shop_address"
+	SettingShopPhone      = "shop_phone"
+	SettingShopEmail      = "shop_email"
+	SettingShopKRAPin     = "shop_kra_pin"
+	SettingMpesaTill      = "mpesa_till"
+	SettingMpesaPaybill   = "mpesa_paybill"
+	SettingMpesaAccount   = "mpesa_account"    // paybill account; the document number when empty
+	SettingReceiptFooter  = "receipt_footer"   // printed at the bottom of every document
+	SettingQuoteValidDays = "quote_valid_days" // how long quoted prices stand
+)
+
+const defaultQuoteValidDays = 7
+
+type DocumentService struct {
+	saleSvc      *SaleService
+	productSvc   *ProductService
+	settingsRepo *repo.SettingsRepo
+	userRepo     *repo.UserRepo
+	mpesaRepo    *repo.MpesaTransactionRepo
+}
+
+func NewDocumentService(ss *SaleService, ps *ProductService, sr *repo.SettingsRepo, ur *repo.UserRepo, mr *repo.MpesaTransactionRepo) *DocumentService {
+	return &DocumentService{
+		saleSvc:      ss,
+		productSvc:   ps,
+		settingsRepo: sr,
+		userRepo:     ur,
+		mpesaRepo:    mr,
+	}
+}
+
+// SaleDocument builds the document for a stored sale. Without a kind,
+// credit sales print as an IOU and everything else as a receipt.
+func (s *DocumentService) SaleDocument(saleID, kind string) (*document.Document, error) {
+	sale, items, err := s.saleSvc.GetSale(saleID)
+	if err != nil {
+		return nil, err
+	}
+	if kind == "" {
+		kind = document.KindReceipt
+		if sale.PaymentMethod == model.PaymentCredit {
+			kind = document.KindIOU
+		}
+	}
+	if kind != document.KindReceipt && kind != document.KindInvoice && kind != document.KindIOU {
+		return nil, ErrInvalidDocumentKind
+	}
+
+	d, err := s.build(kind, sale, items)
+	if err != nil {
+		return nil, err
+	}
+	if sale.ReceiptNo > 0 {
+		d.Number = fmt.Sprintf("%06d", sale.ReceiptNo)
+	}
+
+	if user, err := s.userRepo.GetByID(sale.UserID); err == nil {
+		d.Cashier = user.Name
+	}
+	if sale.MpesaReceipt != "" {
+		d.Payment.MpesaReceipt = sale.MpesaReceipt
+		tx, err := s.mpesaRepo.GetByReceiptNo(sale.MpesaReceipt)
+		if err != nil {
+			return nil, err
+		}
+		if tx != nil {
+			d.Payment.MpesaPayer = tx.Counterparty
+		}
+	}
+	if sale.PaymentMethod == model.PaymentCredit || sale.PaymentStatus == model.PaymentPending {
+		d.Payment.Owing = sale.Total
+	}
+	return d, nil
+}
+
+// QuoteDocument prices a basket as a sale would be and builds a quote for
+// it. Nothing is sold or stored.
+func (s *DocumentService) QuoteDocument(sale *model.Sale, items []*model.SaleItem) (*document.Document, error) {
+	if err := s.saleSvc.QuoteSale(sale, items); err != nil {
+		return nil, err
+	}
+	d, err := s.build(document.KindQuote, sale, items)
+	if err != nil {
+		return nil, err
+	}
+	days, err := s.settingsRepo.GetInt(SettingQuoteValidDays, defaultQuoteValidDays)
+	if err != nil {
+		return nil, err
+	}
+	validUntil := sale.CreatedAt.AddDate(0, 0, days)
+	d.ValidUntil = &validUntil
+	return d, nil
+}
+
+// build fills in what every kind of document shows: branding, lines,
+// discounts, totals and VAT
+func (s *DocumentService) build(kind string, sale *model.Sale, items []*model.SaleItem) (*document.Document, error) {
+	settings, err := s.settingsRepo.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	taxRate, err := s.settingsRepo.GetFloat(SettingTaxRate, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	number := sale.ID
+	if len(number) > 8 {
+		number = number[:8]
+	}
+	d := &document.Document{
+		Kind:   kind,
+		Number: number,
+		Date:   sale.CreatedAt.Local(),
+		Shop: document.Shop{
+			Name:    settings[SettingShopName],
+			Address: settings[SettingShopAddress],
+			Phone:   settings[SettingShopPhone],
+			Email:   settings[SettingShopEmail],
+			KRAPin:  settings[SettingShopKRAPin],
+		},
+		Subtotal: sale.Subtotal,
+		Discount: sale.Discount,
+		Total:    sale.Total,
+		Payment: document.Payment{
+			Method:  sale.PaymentMethod,
+			Status:  sale.PaymentStatus,
+			Till:    settings[SettingMpesaTill],
+			Paybill: settings[SettingMpesaPaybill],
+			Account: settings[SettingMpesaAccount],
+		},
+		Footer: settings[SettingReceiptFooter],
+	}
+	if d.Shop.Name == "" {
+		d.Shop.Name = "PesaLocal"
+	}
+	if taxRate > 0 {
+		d.VAT.Rate = taxRate
+		d.VAT.Amount = roundMoney(sale.Total * taxRate / (100 + taxRate))
+		d.VAT.Net = roundMoney(sale.Total - d.VAT.Amount)
+	}
+
+	// promotions and manual discounts go under the line they apply to;
+	// basket discounts under the subtotal
+	lineDiscounts := make(map[string][]*document.Adjustment)
+	for _, a := range sale.Promotions {
+		adj := &document.Adjustment{Name: a.Name, Amount: a.Amount}
+		if a.SaleItemID == "" {
+			d.Discounts = append(d.Discounts, adj)
+		} else {
+			lineDiscounts[a.SaleItemID] = append(lineDiscounts[a.SaleItemID], adj)
+		}
+	}
+
+	for _, item := range items {
+		line := &document.Line{
+			Name:      item.ProductID,
+			Quantity:  item.Quantity,
+			Price:     item.Price,
+			Total:     roundMoney(item.Quantity * item.Price),
+			Discounts: lineDiscounts[item.ID],
+		}
+		product, err := s.productSvc.GetProduct(item.ProductID)
+		if err != nil {
+			return nil, err
+		}
+		if product != nil {
+			line.Name = product.Name
+			line.Unit = product.PricePerUnit
+		}
+		for _, adj := range line.Discounts {
+			line.Total = roundMoney(line.Total - adj.Amount)
+		}
+		d.Lines = append(d.Lines, line)
+	}
+	if d.Subtotal == 0 && d.Discount == 0 {
+		d.Subtotal = sale.Total // sold before subtotals were kept
+	}
+	return d, nil
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"pesalocal/internal/model"
+	"pesalocal/internal/repo"
+)
+
+// Operations returned by one encrypted pull
+const (
+	DefaultEncryptedPullLimit = 500
+	MaxEncryptedPullLimit     = 5000
+)
+
+var (
+	ErrSyncEncrypted       = errors.New("this shop syncs end-to-end encrypted: the server holds none of its data, so this is turned off")
+	ErrSyncNotEncrypted    = errors.New("this shop doesn't sync encrypted: send payloads as plain JSON")
+	ErrPayloadNotEncrypted = errors.New("payload must be ciphertext, base64-encoded as a JSON string")
+	ErrInvalidOperation    = errors.New("operation needs an id, entity_type, entity_id and operation")
+)
+
+// EncryptedSyncService relays sync operations between the devices of a
+// shop that syncs end to end encrypted. Devices encrypt each payload with
+// a shop key the server never sees. The server stores the ciphertext with
+// the routing metadata beside it and hands it to the other devices, which
+// decrypt and apply it themselves; nothing is applied on the server.
+type EncryptedSyncService struct {
+	opRepo  *repo.EncryptedOperationRepo
+	enabled bool
+}
+
+// EncryptedPullResult is what a device of an encrypted shop pulls
+type EncryptedPullResult struct {
+	ServerTime time.Time                   `json:"server_time"`
+	Encrypted  bool                        `json:"encrypted"` // always true: payloads are to be decrypted
+	Operations []*model.EncryptedOperation `json:"operations"`
+	Cursor     int64                       `json:"cursor"` // pass as "after" on the next pull
+	More       bool                        `json:"more"`   // more are waiting; pull again now
+}
+
+func NewEncryptedSyncService(er *repo.EncryptedOperationRepo, enabled bool) *EncryptedSyncService {
+	return &EncryptedSyncService{opRepo: er, enabled: enabled}
+}
+
+// Enabled reports whether the shop syncs end to end encrypted
+func (s *EncryptedSyncService) Enabled() bool {
+	return s.enabled
+}
+
+// Push stores operations for the shop's other devices, and returns how
+// many were new; ones already stored are pushes being retried. The batch
+// is checked before anything is stored, so a payload sent in plaintext by
+// mistake is never kept.
+func (s *EncryptedSyncService) Push(ops []*model.EncryptedOperation) (int, error) {
+	if !s.enabled {
+		return 0, ErrSyncNotEncrypted
+	}
+	for _, op := range ops {
+		if op.ID == "" || op.EntityType == "" || op.EntityID == "" || op.Operation == "" {
+			return 0, fmt.Errorf("%w (operation %q)", ErrInvalidOperation, op.ID)
+		}
+		// ciphertext is never valid JSON; an encoded entity is
+		if len(op.Payload) == 0 || json.Valid(op.Payload) {
+			return 0, fmt.Errorf("%w (operation %s)", ErrPayloadNotEncrypted, op.ID)
+		}
+	}
+
+	now := time.Now()
+	stored := 0
+	for _, op := range ops {
+		op.CreatedAt = now
+		created, err := s.opRepo.Create(op)
+		if err != nil {
+			return stored, err
+		}
+		if created {
+			stored++
+		}
+	}
+	return stored, nil
+}
+
+// Pull returns operations received after the cursor, in order. A device
+// that names itself isn't sent its own operations back, but the cursor
+// still moves past them.
+func (s *EncryptedSyncService) Pull(after int64, deviceID string, limit int) (*EncryptedPullResult, error) {
+	if !s.enabled {
+		return nil, ErrSyncNotEncrypted
+	}
+	if limit <= 0 {
+		limit = DefaultEncryptedPullLimit
+	}
+	if limit > MaxEncryptedPullLimit {
+		limit = MaxEncryptedPullLimit
+	}
+
+	now := time.Now()
+	ops, err := s.opRepo.GetAfter(after, limit)
+	if err != nil {
+		return nil, err
+	}
+	result := &EncryptedPullResult{
+		ServerTime: now,
+		Encrypted:  true,
+		Operations: []*model.EncryptedOperation{},
+		Cursor:     after,
+		More:       len(ops) == limit,
+	}
+	for _, op := range ops {
+		result.Cursor = op.Seq
+		if deviceID != "" && op.DeviceID == deviceID {
+			continue
+		}
+		result.Operations = append(result.Operations, op)
+	}
+	return result, nil
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	"pesalocal/internal/export"
+	"pesalocal/internal/model"
+	"pesalocal/internal/repo"
+)
+
+// Exports
+const (
+	ExportSales     = "sales"     // one row per item sold
+	ExportPurchases = "purchases" // one row per item bought
+	ExportProducts  = "products"  // current stock and its value; the date range doesn't apply
+)
+
+var ErrInvalidExport = errors.New("export must be sales, purchases or products")
+
+// ValidExport reports whether name is a known export
+func ValidExport(name string) bool {
+	switch name {
+	case ExportSales, ExportPurchases, ExportProducts:
+		return true
+	}
+	return false
+}
+
+type ExportService struct {
+	exportRepo *repo.ExportRepo
+}
+
+func NewExportService(er *repo.ExportRepo) *ExportService {
+	return &ExportService{exportRepo: er}
+}
+
+// Export writes an export of the records made in [from, to) to w as CSV
+// or XLSX, row by row as they are read
+func (s *ExportService) Export(w io.Writer, name, format string, from, to time.Time) error {
+	if !ValidExport(name) {
+		return ErrInvalidExport
+	}
+	out, err := export.NewWriter(w, format, name)
+	if err != nil {
+		return err
+	}
+
+	switch name {
+	case ExportSales:
+		err = s.exportSales(out, from, to)
+	case ExportPurchases:
+		err = s.exportPurchases(out, from, to)
+	case ExportProducts:
+		err = s.exportProducts(out)
+	}
+	if err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+func (s *ExportService) exportSales(out export.Writer, from, to time.Time) error {
+	if err := out.Write(
+		"Sale ID", "Receipt No", "Date", "User", "Device", "Payment Method", "Payment Status", "M-PESA Receipt", "Sale Total",
+		"Item ID", "Product ID", "Product", "Quantity", "Price", "Discount", "Total", "Cost",
+	); err != nil {
+		return err
+	}
+	return s.exportRepo.SaleLines(from, to, func(l *model.SaleLine) error {
+		return out.Write(
+			l.SaleID, l.ReceiptNo, l.CreatedAt, l.UserID, l.DeviceID, l.PaymentMethod, l.PaymentStatus, l.MpesaReceipt, l.SaleTotal,
+			l.ItemID, l.ProductID, l.ProductName, l.Quantity, l.Price, l.Discount, l.Total, l.Cost,
+		)
+	})
+}
+
+func (s *ExportService) exportPurchases(out export.Writer, from, to time.Time) error {
+	if err := out.Write(
+		"Purchase ID", "Date", "Supplier ID", "Supplier", "Payment Method", "Purchase Total",
+		"Item ID", "Product ID", "Product", "Quantity", "Price", "Total", "Expiry Date",
+	); err != nil {
+		return err
+	}
+	return s.exportRepo.PurchaseLines(from, to, func(l *model.PurchaseLine) error {
+		return out.Write(
+			l.PurchaseID, l.CreatedAt, l.SupplierID, l.Supplier, l.PaymentMethod, l.PurchaseTotal,
+			l.ItemID, l.ProductID, l.ProductName, l.Quantity, l.Price, l.Total, l.ExpiryDate,
+		)
+	})
+}
+
+func (s *ExportService) exportProducts(out export.Writer) error {
+	if err := out.Write(
+		"Product ID", "Product", "Category", "Barcode", "Price", "Stock", "Average Cost", "Stock Value", "Retail Value",
+	); err != nil {
+		return err
+	}
+	return s.exportRepo.ProductStock(func(p *model.ProductStock) error {
+		return out.Write(p.ID, p.Name, p.Category, p.Barcode, p.Price, p.Stock, p.AverageCost, p.StockValue, p.RetailValue)
+	})
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"pesalocal/internal/model"
+	"pesalocal/internal/repo"
+	"pesalocal/internal/tariff"
+)
+
+// Charged fees within this many shillings of the tariff are not flagged
+const feeTolerance = 0.5
+
+type FeeService struct {
+	tariffs   *tariff.Engine
+	mpesaRepo *repo.MpesaTransactionRepo
+}
+
+func NewFeeService(te *tariff.Engine, mr *repo.MpesaTransactionRepo) *FeeService {
+	return &FeeService{
+		tariffs:   te,
+		mpesaRepo: mr,
+	}
+}
+
+// FeeDiscrepancy is an imported transaction charged a fee other than the
+// tariff in force when it completed
+type FeeDiscrepancy struct {
+	Transaction   *model.MpesaTransaction `json:"transaction"`
+	TariffVersion string                  `json:"tariff_version"`
+	ExpectedFee   float64                 `json:"expected_fee"`
+	ChargedFee    float64                 `json:"charged_fee"`
+	Difference    float64                 `json:"difference"` // charged - expected
+}
+
+// FeeAuditReport summarises fees paid against the tariff
+type FeeAuditReport struct {
+	From          time.Time         `json:"from"`
+	To            time.Time         `json:"to"`
+	Checked       int               `json:"checked"`
+	TotalCharged  float64           `json:"total_charged"`
+	TotalExpected float64           `json:"total_expected"`
+	Flagged       []*FeeDiscrepancy `json:"flagged"`
+}
+
+// ComputeFee returns the tariff fee for a transaction at the given time
+func (s *FeeService) ComputeFee(txType string, amount float64, at time.Time) (*tariff.Quote, error) {
+	return s.tariffs.Fee(txType, amount, at)
+}
+
+// GetTariffs returns every loaded tariff version
+func (s *FeeService) GetTariffs() []*tariff.Table {
+	return s.tariffs.Tables()
+}
+
+// AuditFees compares the fee charged on each imported transaction in
+// [from, to) with the tariff in force when it completed
+func (s *FeeService) AuditFees(from, to time.Time) (*FeeAuditReport, error) {
+	txs, err := s.mpesaRepo.GetBetween(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &FeeAuditReport{
+		From:    from,
+		To:      to,
+		Flagged: []*FeeDiscrepancy{},
+	}
+
+	for _, tx := range txs {
+		if !s.tariffs.Charges(tx.Type) {
+			continue
+		}
+		quote, err := s.tariffs.Fee(tx.Type, tx.Amount, tx.CompletionTime)
+		if errors.Is(err, tariff.ErrNoTariff) || errors.Is(err, tariff.ErrUnknownType) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		report.Checked++
+		report.TotalCharged += tx.Fee
+		report.TotalExpected += quote.Fee
+
+		if math.Abs(tx.Fee-quote.Fee) > feeTolerance {
+			report.Flagged = append(report.Flagged, &FeeDiscrepancy{
+				Transaction:   tx,
+				TariffVersion: quote.TariffVersion,
+				ExpectedFee:   quote.Fee,
+				ChargedFee:    tx.Fee,
+				Difference:    tx.Fee - quote.Fee,
+			})
+		}
+	}
+
+	return report, nil
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"io"
+	"time"
+
+	"pesalocal/internal/model"
+	"pesalocal/internal/mpesa"
+	"pesalocal/internal/repo"
+)
+
+type MpesaService struct {
+	mpesaRepo *repo.MpesaTransactionRepo
+}
+
+func NewMpesaService(mr *repo.MpesaTransactionRepo) *MpesaService {
+	return &MpesaService{
+		mpesaRepo: mr,
+	}
+}
+
+// ImportSummary reports the outcome of an import
+type ImportSummary struct {
+	New              int      `json:"new"`
+	Duplicate        int      `json:"duplicate"`
+	Unparseable      int      `json:"unparseable"`
+	UnparseableLines []string `json:"unparseable_lines,omitempty"`
+}
+
+// Import parses a statement CSV, statement text or pasted SMS and stores
+// every transaction whose receipt code hasn't been seen before
+func (s *MpesaService) Import(format string, r io.Reader) (*ImportSummary, error) {
+	result, err := mpesa.Parse(format, r)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &ImportSummary{
+		Unparseable:      len(result.Unparseable),
+		UnparseableLines: result.Unparseable,
+	}
+
+	for _, tx := range result.Transactions {
+		isNew, err := s.AddTransaction(tx)
+		if err != nil {
+			return nil, err
+		}
+		if isNew {
+			summary.New++
+		} else {
+			summary.Duplicate++
+		}
+	}
+
+	return summary, nil
+}
+
+// AddTransaction stores a transaction unless its receipt code already
+// exists, reporting whether it was new
+func (s *MpesaService) AddTransaction(tx *model.MpesaTransaction) (bool, error) {
+	existing, err := s.mpesaRepo.GetByReceiptNo(tx.ReceiptNo)
+	if err != nil {
+		return false, err
+	}
+	if existing != nil {
+		return false, nil
+	}
+
+	if tx.ID == "" {
+		tx.ID = newID()
+	}
+	tx.CreatedAt = time.Now()
+	if err := s.mpesaRepo.Create(tx); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// GetAllTransactions returns all imported M-PESA transactions
+func (s *MpesaService) GetAllTransactions() ([]*model.MpesaTransaction, error) {
+	return s.mpesaRepo.GetAll()
+}
+
+// LinkSale records the sale an M-PESA payment settled
+func (s *MpesaService) LinkSale(tx *model.MpesaTransaction, saleID string) error {
+	tx.SaleID = saleID
+	return s.mpesaRepo.SetSaleID(tx.ID, saleID)
+}
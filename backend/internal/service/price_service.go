@@ -0,0 +1,137 @@
+package service
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"pesalocal/internal/model"
+	"pesalocal/internal/repo"
+)
+
+var ErrInvalidPrice = errors.New("price must be positive")
+var ErrPriceChangeNotFound = errors.New("price change not found")
+var ErrPriceChangeClosed = errors.New("price change is no longer scheduled")
+
+type PriceService struct {
+	productSvc       *ProductService
+	priceRepo        *repo.PriceChangeRepo
+	purchaseItemRepo *repo.PurchaseItemRepo
+}
+
+func NewPriceService(ps *ProductService, pcr *repo.PriceChangeRepo, pir *repo.PurchaseItemRepo) *PriceService {
+	return &PriceService{
+		productSvc:       ps,
+		priceRepo:        pcr,
+		purchaseItemRepo: pir,
+	}
+}
+
+// SetPrice changes a product's price now, or schedules the change when
+// EffectiveAt is in the future. Changes replayed by sync are ignored.
+func (s *PriceService) SetPrice(c *model.PriceChange) error {
+	if c.Price <= 0 {
+		return ErrInvalidPrice
+	}
+	if c.ID == "" {
+		c.ID = newID()
+	}
+	existing, err := s.priceRepo.GetByID(c.ID)
+	if err != nil || existing != nil {
+		return err
+	}
+
+	product, err := s.productSvc.GetProduct(c.ProductID)
+	if err != nil {
+		return err
+	}
+	if product == nil {
+		return repo.ErrProductNotFound
+	}
+
+	now := time.Now()
+	c.CreatedAt = now
+	if c.EffectiveAt.After(now) {
+		c.Status = model.PriceChangeScheduled
+		return s.priceRepo.Save(c)
+	}
+	c.EffectiveAt = now
+	return s.productSvc.applyPriceChange(c)
+}
+
+// CancelPriceChange withdraws a scheduled price change
+func (s *PriceService) CancelPriceChange(id string) (*model.PriceChange, error) {
+	c, err := s.priceRepo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return nil, ErrPriceChangeNotFound
+	}
+	if c.Status != model.PriceChangeScheduled {
+		return nil, ErrPriceChangeClosed
+	}
+	c.Status = model.PriceChangeCancelled
+	return c, s.priceRepo.Save(c)
+}
+
+// ApplyDuePriceChanges applies scheduled changes whose time has come and
+// returns how many were applied
+func (s *PriceService) ApplyDuePriceChanges(now time.Time) (int, error) {
+	due, err := s.priceRepo.GetDue(now)
+	if err != nil {
+		return 0, err
+	}
+	for i, c := range due {
+		if err := s.productSvc.applyPriceChange(c); err != nil {
+			return i, err
+		}
+	}
+	return len(due), nil
+}
+
+// GetPriceHistory returns a product's price changes in [from, to), its
+// upcoming changes and the average cost paid per day of purchases
+func (s *PriceService) GetPriceHistory(productID string, from, to time.Time) (*model.PriceHistory, error) {
+	product, err := s.productSvc.GetProduct(productID)
+	if err != nil {
+		return nil, err
+	}
+	if product == nil {
+		return nil, repo.ErrProductNotFound
+	}
+
+	changes, err := s.priceRepo.GetApplied(productID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	scheduled, err := s.priceRepo.GetScheduled(productID)
+	if err != nil {
+		return nil, err
+	}
+	costs, err := s.purchaseItemRepo.GetDailyCosts(productID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	history := &model.PriceHistory{
+		Product:       product,
+		Changes:       changes,
+		Scheduled:     scheduled,
+		PurchaseCosts: costs,
+	}
+	var quantity, spent float64
+	for _, c := range costs {
+		quantity += c.Quantity
+		spent += c.Quantity * c.AverageCost
+		c.AverageCost = roundMoney(c.AverageCost)
+	}
+	if quantity > 0 {
+		history.AverageCost = roundMoney(spent / quantity)
+	}
+	return history, nil
+}
+
+func roundMoney(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,203 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+	"unicode/utf8"
+
+	"pesalocal/internal/model"
+	"pesalocal/internal/repo"
+)
+
+// ShopErasureConfirmation must be sent to erase the whole shop
+const ShopErasureConfirmation = "erase all shop data"
+
+var (
+	ErrSubjectNotFound     = errors.New("no data held for this user")
+	ErrErasureNotConfirmed = errors.New("shop erasure was not confirmed")
+	ErrErasureRequestedBy  = errors.New("requested_by is required")
+	ErrErasureNotCompleted = errors.New("erasure left data behind")
+)
+
+type PrivacyService struct {
+	privacyRepo *repo.PrivacyRepo
+}
+
+func NewPrivacyService(pr *repo.PrivacyRepo) *PrivacyService {
+	return &PrivacyService{privacyRepo: pr}
+}
+
+// ExportUser writes everything held about a user as one JSON document, as
+// for a subject access request: their account (without the password
+// hash), the records they made and queued sync operations naming them
+func (s *PrivacyService) ExportUser(w io.Writer, userID string) error {
+	n, err := s.privacyRepo.UserRemnants(userID)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrSubjectNotFound
+	}
+	filters, err := s.privacyRepo.UserRows(userID)
+	if err != nil {
+		return err
+	}
+	return s.export(w, model.SubjectUser, userID, filters)
+}
+
+// ExportShop writes every table as one JSON document
+func (s *PrivacyService) ExportShop(w io.Writer) error {
+	filters, err := s.privacyRepo.ShopRows()
+	if err != nil {
+		return err
+	}
+	return s.export(w, model.SubjectShop, "", filters)
+}
+
+// export streams the selected rows as
+//
+//	{"subject": {...}, "exported_at": "...", "tables": {"sales": [{...}, ...], ...}}
+func (s *PrivacyService) export(w io.Writer, subjectType, subjectID string, filters []repo.RowFilter) error {
+	head, err := json.Marshal(map[string]interface{}{
+		"type": subjectType,
+		"id":   subjectID,
+	})
+	if err != nil {
+		return err
+	}
+	exportedAt, _ := json.Marshal(time.Now())
+	if _, err := io.WriteString(w, `{"subject":`+string(head)+`,"exported_at":`+string(exportedAt)+`,"tables":{`); err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	for i, f := range filters {
+		name, _ := json.Marshal(f.Table)
+		sep := ","
+		if i == 0 {
+			sep = ""
+		}
+		if _, err := io.WriteString(w, sep+string(name)+":["); err != nil {
+			return err
+		}
+		first := true
+		err := s.privacyRepo.Dump(f, func(row map[string]interface{}) error {
+			for k, v := range row {
+				row[k] = exportValue(v)
+			}
+			if !first {
+				if _, err := io.WriteString(w, ","); err != nil {
+					return err
+				}
+			}
+			first = false
+			return enc.Encode(row)
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, "]"); err != nil {
+			return err
+		}
+	}
+	_, err = io.WriteString(w, "}}\n")
+	return err
+}
+
+// exportValue makes a column value readable in JSON: stored JSON (sync
+// payloads) is embedded as is and text as a string
+func exportValue(v interface{}) interface{} {
+	b, ok := v.([]byte)
+	if !ok {
+		return v
+	}
+	if json.Valid(b) {
+		return json.RawMessage(b)
+	}
+	if utf8.Valid(b) {
+		return string(b)
+	}
+	return b
+}
+
+// EraseUser hard-deletes a user's account and every queued sync
+// operation that names them. Sales, returns and other records they made
+// belong to the shop, which must keep them, so the user is removed from
+// those instead. The erasure is checked and logged.
+func (s *PrivacyService) EraseUser(userID, requestedBy, reason string) (*model.Erasure, error) {
+	if requestedBy == "" {
+		return nil, ErrErasureRequestedBy
+	}
+	n, err := s.privacyRepo.UserRemnants(userID)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, ErrSubjectNotFound
+	}
+
+	deleted, scrubbed, err := s.privacyRepo.EraseUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if n, err = s.privacyRepo.UserRemnants(userID); err != nil {
+		return nil, err
+	}
+	return s.logErasure(&model.Erasure{
+		SubjectType: model.SubjectUser,
+		SubjectID:   userID,
+		RequestedBy: requestedBy,
+		Reason:      reason,
+		Deleted:     deleted,
+		Scrubbed:    scrubbed,
+		Verified:    n == 0,
+	})
+}
+
+// EraseShop hard-deletes every row of every table, keeping only the
+// erasure log. Backups made before it still hold the data until they are
+// removed.
+func (s *PrivacyService) EraseShop(requestedBy, reason, confirm string) (*model.Erasure, error) {
+	if confirm != ShopErasureConfirmation {
+		return nil, ErrErasureNotConfirmed
+	}
+	if requestedBy == "" {
+		return nil, ErrErasureRequestedBy
+	}
+
+	deleted, err := s.privacyRepo.EraseShop()
+	if err != nil {
+		return nil, err
+	}
+	n, err := s.privacyRepo.ShopRemnants()
+	if err != nil {
+		return nil, err
+	}
+	return s.logErasure(&model.Erasure{
+		SubjectType: model.SubjectShop,
+		RequestedBy: requestedBy,
+		Reason:      reason,
+		Deleted:     deleted,
+		Verified:    n == 0,
+	})
+}
+
+// logErasure records an erasure, and fails if it wasn't complete
+func (s *PrivacyService) logErasure(e *model.Erasure) (*model.Erasure, error) {
+	e.ID = newID()
+	e.CreatedAt = time.Now()
+	if err := s.privacyRepo.AddErasure(e); err != nil {
+		return nil, err
+	}
+	if !e.Verified {
+		return e, ErrErasureNotCompleted
+	}
+	return e, nil
+}
+
+// GetErasures returns the erasure log, newest first
+func (s *PrivacyService) GetErasures() ([]*model.Erasure, error) {
+	return s.privacyRepo.GetErasures()
+}
@@ -0,0 +1,412 @@
+package service
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"pesalocal/internal/model"
+	"pesalocal/internal/repo"
+)
+
+// Columns of a product import. Only name is required; price is required
+// for new products.
+var importColumns = []string{"name", "category", "unit", "price", "cost", "stock", "barcode", "supplier"}
+
+// Product import actions
+const (
+	ImportCreate    = "create"
+	ImportUpdate    = "update"
+	ImportUnchanged = "unchanged"
+)
+
+var ErrInvalidImport = errors.New("import file must be CSV with a header row naming its columns")
+
+// ProductImport reports what an import did, or would do on a dry run.
+// When any row has errors nothing is imported.
+type ProductImport struct {
+	DryRun    bool                `json:"dry_run"`
+	Imported  bool                `json:"imported"`
+	Created   int                 `json:"created"`
+	Updated   int                 `json:"updated"`
+	Unchanged int                 `json:"unchanged"`
+	Rows      []*ProductImportRow `json:"rows"`
+	Errors    []*ImportError      `json:"errors"`
+}
+
+// ProductImportRow is the outcome for one row of the file
+type ProductImportRow struct {
+	Row         int     `json:"row"` // line in the file; the header is row 1
+	Action      string  `json:"action"`
+	ProductID   string  `json:"product_id,omitempty"` // empty for products a dry run would create
+	Name        string  `json:"name"`
+	StockChange float64 `json:"stock_change,omitempty"`
+
+	product  *model.Product // as it will be saved
+	existing *model.Product // as it was, for updates
+	cost     float64        // per unit of stock added
+}
+
+// ImportError is a problem with one row of an import
+type ImportError struct {
+	Row     int    `json:"row"`
+	Column  string `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+// ImportProducts creates or updates products from a CSV price list.
+// Rows are matched to products by barcode, then by name. Stock in the file
+// is the opening stock level: the difference is recorded in the ledger,
+// with stock added valued at the row's cost. The whole file is checked
+// before anything is saved; a dry run stops there.
+func (s *ProductService) ImportProducts(r io.Reader, dryRun bool, userID string) (*ProductImport, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, ErrInvalidImport
+	}
+	columns, err := importHeader(header)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ProductImport{DryRun: dryRun, Rows: []*ProductImportRow{}, Errors: []*ImportError{}}
+	seen := map[string]int{} // barcode or name -> first row
+	for line := 2; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				result.Errors = append(result.Errors, &ImportError{Row: line, Message: parseErr.Err.Error()})
+				continue
+			}
+			return nil, err
+		}
+		if blankRecord(record) {
+			continue
+		}
+
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		row, errs, err := s.planImportRow(line, field, seen)
+		if err != nil {
+			return nil, err
+		}
+		if len(errs) > 0 {
+			result.Errors = append(result.Errors, errs...)
+			continue
+		}
+		result.Rows = append(result.Rows, row)
+		switch row.Action {
+		case ImportCreate:
+			result.Created++
+		case ImportUpdate:
+			result.Updated++
+		default:
+			result.Unchanged++
+		}
+	}
+
+	if dryRun || len(result.Errors) > 0 {
+		return result, nil
+	}
+	if err := s.applyImport(result.Rows, userID); err != nil {
+		return nil, err
+	}
+	result.Imported = true
+	return result, nil
+}
+
+// importHeader maps column names to their positions. Names are matched
+// without regard to case; unknown columns are rejected so a misspelt
+// column isn't silently ignored.
+func importHeader(header []string) (map[string]int, error) {
+	known := map[string]bool{}
+	for _, c := range importColumns {
+		known[c] = true
+	}
+
+	columns := map[string]int{}
+	for i, h := range header {
+		name := strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff"))) // Excel writes a BOM
+		name = strings.ReplaceAll(name, " ", "_")
+		if name == "" {
+			continue
+		}
+		if !known[name] {
+			return nil, fmt.Errorf("%w: unknown column %q (columns are %s)", ErrInvalidImport, h, strings.Join(importColumns, ", "))
+		}
+		columns[name] = i
+	}
+	if _, ok := columns["name"]; !ok {
+		return nil, fmt.Errorf("%w: name column is required", ErrInvalidImport)
+	}
+	return columns, nil
+}
+
+// planImportRow validates a row and works out what importing it does
+func (s *ProductService) planImportRow(line int, field func(string) string, seen map[string]int) (*ProductImportRow, []*ImportError, error) {
+	var errs []*ImportError
+	fail := func(column, format string, args ...interface{}) {
+		errs = append(errs, &ImportError{Row: line, Column: column, Message: fmt.Sprintf(format, args...)})
+	}
+	number := func(column string) *float64 {
+		v := field(column)
+		if v == "" {
+			return nil
+		}
+		n, err := parseImportNumber(v)
+		if err != nil || n < 0 {
+			fail(column, "%q is not a number of zero or more", v)
+			return nil
+		}
+		return &n
+	}
+
+	name := field("name")
+	barcode := field("barcode")
+	price, cost, stock := number("price"), number("cost"), number("stock")
+	if name == "" {
+		fail("name", "name is required")
+	}
+
+	key := "name:" + strings.ToLower(name)
+	if barcode != "" {
+		key = "barcode:" + barcode
+	}
+	if first, ok := seen[key]; ok {
+		fail("", "same product as row %d", first)
+	} else {
+		seen[key] = line
+	}
+
+	existing, problem, err := s.findImportMatch(barcode, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if problem != "" {
+		fail("name", "%s", problem)
+	}
+	if existing == nil && field("price") == "" {
+		fail("price", "price is required for new products")
+	}
+	if len(errs) > 0 {
+		return nil, errs, nil
+	}
+
+	row := &ProductImportRow{Row: line, Name: name, existing: existing}
+	p := &model.Product{}
+	if existing != nil {
+		*p = *existing
+		row.ProductID = existing.ID
+	}
+	p.Name = name
+	for column, dst := range map[string]*string{
+		"category": &p.Category, "unit": &p.PricePerUnit, "barcode": &p.Barcode, "supplier": &p.Supplier,
+	} {
+		if v := field(column); v != "" {
+			*dst = v
+		}
+	}
+	if price != nil {
+		p.Price = roundMoney(*price)
+	}
+	if cost != nil {
+		row.cost = roundMoney(*cost)
+	}
+	row.product = p
+
+	if stock != nil {
+		held := 0.0
+		if existing != nil {
+			held = existing.Stock
+		}
+		row.StockChange = model.RoundQuantity(*stock - held)
+	}
+
+	switch {
+	case existing == nil:
+		row.Action = ImportCreate
+	case !sameImportDetails(existing, p) || row.StockChange != 0:
+		row.Action = ImportUpdate
+	default:
+		row.Action = ImportUnchanged
+	}
+	return row, nil, nil
+}
+
+// findImportMatch finds the product a row updates: the one with its
+// barcode, or else the only one with its name. A row that can't be matched
+// safely gets a problem to report instead.
+func (s *ProductService) findImportMatch(barcode, name string) (*model.Product, string, error) {
+	if barcode != "" {
+		p, err := s.productRepo.GetByBarcode(barcode)
+		if err != nil || p != nil {
+			return p, "", err
+		}
+	}
+	if name == "" {
+		return nil, "", nil
+	}
+	matches, err := s.productRepo.FindByName(name)
+	if err != nil {
+		return nil, "", err
+	}
+	switch {
+	case len(matches) > 1:
+		return nil, fmt.Sprintf("%d products are named %q; add a barcode to say which", len(matches), name), nil
+	case len(matches) == 1 && barcode != "" && matches[0].Barcode != "" && matches[0].Barcode != barcode:
+		return nil, fmt.Sprintf("%q already has barcode %s", name, matches[0].Barcode), nil
+	case len(matches) == 1:
+		return matches[0], "", nil
+	}
+	return nil, "", nil
+}
+
+// applyImport saves the planned rows, the categories they add, their
+// price history and their opening stock, all or nothing
+func (s *ProductService) applyImport(rows []*ProductImportRow, userID string) error {
+	now := time.Now()
+	var products []*model.Product
+	var changes []*model.PriceChange
+	var movements []*model.StockMovement
+	var categories []*model.Category // added, parents first
+	known := map[string]string{}     // category ID by lower-case name
+
+	for _, row := range rows {
+		if row.Action == ImportUnchanged {
+			continue
+		}
+		p := row.product
+		p.UpdatedBy = userID
+		p.UpdatedAt = now
+		if row.existing == nil {
+			p.ID = newID()
+			p.Version = 1
+			p.Stock = 0
+			row.ProductID = p.ID
+		} else {
+			p.Version = row.existing.Version + 1
+		}
+		added, err := s.planCategories(p, known, now)
+		if err != nil {
+			return err
+		}
+		categories = append(categories, added...)
+		products = append(products, p)
+
+		// keep the price history
+		if row.existing == nil || row.existing.Price != p.Price {
+			change := &model.PriceChange{
+				ID:          newID(),
+				ProductID:   p.ID,
+				Price:       p.Price,
+				Status:      model.PriceChangeApplied,
+				ChangedBy:   userID,
+				EffectiveAt: now,
+				CreatedAt:   now,
+			}
+			if row.existing != nil {
+				change.OldPrice = row.existing.Price
+			}
+			changes = append(changes, change)
+		}
+
+		if row.StockChange != 0 {
+			m := &model.StockMovement{
+				ID:         newID(),
+				ProductID:  p.ID,
+				Type:       model.MovementAdjustment,
+				Quantity:   row.StockChange,
+				SourceType: "import",
+				Reason:     "opening stock",
+				CreatedAt:  now,
+			}
+			if row.StockChange > 0 {
+				m.UnitCost = row.cost
+			}
+			movements = append(movements, m)
+		}
+	}
+
+	err := s.productRepo.Import(categories, products, changes, movements)
+	switch {
+	case errors.Is(err, repo.ErrDuplicateBarcode):
+		return ErrDuplicateBarcode
+	case errors.Is(err, repo.ErrProductConflict):
+		return ErrProductConflict
+	}
+	return err
+}
+
+// planCategories returns the product's category and sub-category when
+// they are neither held nor already planned, as ensureCategories would
+// add them. known maps the names seen so far to their IDs.
+func (s *ProductService) planCategories(p *model.Product, known map[string]string, now time.Time) ([]*model.Category, error) {
+	var added []*model.Category
+	parentID := ""
+	for _, name := range []string{p.Category, p.SubCategory} {
+		if name == "" {
+			break
+		}
+		key := strings.ToLower(name)
+		id, ok := known[key]
+		if !ok {
+			held, err := s.categoryRepo.GetByName(name)
+			if err != nil {
+				return nil, err
+			}
+			if held != nil {
+				id = held.ID
+			} else {
+				c := &model.Category{ID: newID(), Name: name, ParentID: parentID, Version: 1, UpdatedAt: now}
+				added = append(added, c)
+				id = c.ID
+			}
+			known[key] = id
+		}
+		parentID = id
+	}
+	return added, nil
+}
+
+// sameImportDetails reports whether an import leaves a product's details
+// as they are
+func sameImportDetails(a, b *model.Product) bool {
+	return a.Name == b.Name && a.Category == b.Category && a.PricePerUnit == b.PricePerUnit &&
+		a.Price == b.Price && a.Barcode == b.Barcode && a.Supplier == b.Supplier
+}
+
+// parseImportNumber reads a number as wholesalers' price lists write them,
+// e.g. "1,250.00" or "KSh 1,250"
+func parseImportNumber(v string) (float64, error) {
+	v = strings.TrimSpace(v)
+	for _, prefix := range []string{"KShs", "KSh", "Kshs", "Ksh", "KES"} {
+		v = strings.TrimPrefix(v, prefix)
+	}
+	v = strings.NewReplacer(",", "", " ", "").Replace(v)
+	return strconv.ParseFloat(v, 64)
+}
+
+func blankRecord(record []string) bool {
+	for _, f := range record {
+		if strings.TrimSpace(f) != "" {
+			return false
+		}
+	}
+	return true
+}
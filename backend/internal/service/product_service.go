@@ -2,6 +2,7 @@ package service
 
 import (
 	"errors"
+	"strings"
 	"time"
 
 	"pesalocal/internal/model"
@@ -11,71 +12,454 @@ import (
 var ErrProductConflict = errors.New("product version conflict")
 var ErrInsufficientStock = errors.New("insufficient stock")
 
+var ErrBatchNotFound = errors.New("stock batch not found")
+var ErrDuplicateBarcode = errors.New("barcode already used by another product")
+var ErrUnknownConversion = errors.New("no conversion defined for unit")
+var ErrInvalidConversion = errors.New("conversion needs two different units and a positive factor")
+
 type ProductService struct {
-	productRepo *repo.ProductRepo
+	productRepo  *repo.ProductRepo
+	movementRepo *repo.StockMovementRepo
+	batchRepo    *repo.StockBatchRepo
+	categoryRepo *repo.CategoryRepo
+	unitRepo     *repo.UnitConversionRepo
+	priceRepo    *repo.PriceChangeRepo
 }
 
-func NewProductService(pr *repo.ProductRepo) *ProductService {
+func NewProductService(pr *repo.ProductRepo, mr *repo.StockMovementRepo, br *repo.StockBatchRepo, cr *repo.CategoryRepo, ur *repo.UnitConversionRepo, pcr *repo.PriceChangeRepo) *ProductService {
 	return &ProductService{
-		productRepo: pr,
+		productRepo:  pr,
+		movementRepo: mr,
+		batchRepo:    br,
+		categoryRepo: cr,
+		unitRepo:     ur,
+		priceRepo:    pcr,
 	}
 }
 
-// CreateOrUpdateProduct ensures idempotent behavior for sync
+// CreateOrUpdateProduct ensures idempotent behavior for sync. A new
+// product's stock is booked in the ledger as its opening stock; the stock
+// a device sends for a product already held is ignored, since stock only
+// changes through movements (stock_adjustment operations for counts and
+// corrections). A price change takes effect from when the device made it.
 func (s *ProductService) CreateOrUpdateProduct(p *model.Product) error {
 	if p.Version == 0 {
 		p.Version = 1
 	}
-	if p.UpdatedAt.IsZero() {
-		p.UpdatedAt = time.Now()
+	changedAt := p.UpdatedAt
+	if now := time.Now(); changedAt.IsZero() || changedAt.After(now) {
+		changedAt = now
+	}
+	existing, err := s.productRepo.GetByID(p.ID)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		p.Stock = existing.Stock
 	}
-	return s.productRepo.CreateOrUpdate(p)
+	return s.saveProduct(p, changedAt, "opening stock from device")
 }
 
 // CreateProduct inserts a new product (non-sync usage)
 func (s *ProductService) CreateProduct(p *model.Product) error {
 	p.Version = 1
-	p.UpdatedAt = time.Now()
-	return s.productRepo.CreateOrUpdate(p) // use CreateOrUpdate to prevent conflict
+	return s.saveProduct(p, time.Now(), "opening stock")
 }
 
 // UpdateProduct updates product details (non-sync usage)
 func (s *ProductService) UpdateProduct(p *model.Product) error {
 	// increment version for optimistic concurrency
 	p.Version += 1
-	p.UpdatedAt = time.Now()
 
-	err := s.productRepo.CreateOrUpdate(p) // use CreateOrUpdate instead of old Update
+	err := s.saveProduct(p, time.Now(), "stock level edited")
+	if errors.Is(err, ErrDuplicateBarcode) {
+		return err
+	}
 	if err != nil {
 		return ErrProductConflict
 	}
 	return nil
 }
 
-// AdjustStock adjusts stock quantity (positive or negative)
-func (s *ProductService) AdjustStock(productID string, delta int) error {
-	product, err := s.productRepo.GetByID(productID)
+// saveProduct stores product details with the current stock, then moves
+// stock to the requested level through the ledger. changedAt is when the
+// change was made; UpdatedAt is always the server's time, so a device
+// pulling changes since a server time misses none.
+func (s *ProductService) saveProduct(p *model.Product, changedAt time.Time, reason string) error {
+	existing, err := s.productRepo.GetByID(p.ID)
 	if err != nil {
 		return err
 	}
+	// stale sync updates are ignored by the repo; don't move stock for them
+	if existing != nil && p.Version <= existing.Version {
+		return nil
+	}
+
+	p.Barcode = strings.TrimSpace(p.Barcode)
+	if p.Barcode != "" {
+		other, err := s.productRepo.GetByBarcode(p.Barcode)
+		if err != nil {
+			return err
+		}
+		if other != nil && other.ID != p.ID {
+			return ErrDuplicateBarcode
+		}
+	}
+	if err := s.ensureCategories(p); err != nil {
+		return err
+	}
 
-	newStock := product.Stock + delta
-	if newStock < 0 {
+	target := p.Stock
+	p.Stock = 0
+	if existing != nil {
+		p.Stock = existing.Stock
+	}
+	p.UpdatedAt = time.Now()
+	err = s.productRepo.CreateOrUpdate(p)
+	if errors.Is(err, repo.ErrDuplicateBarcode) {
+		return ErrDuplicateBarcode
+	}
+	if err != nil {
+		return err
+	}
+
+	// keep the price history
+	if existing == nil || existing.Price != p.Price {
+		change := &model.PriceChange{
+			ID:          newID(),
+			ProductID:   p.ID,
+			Price:       p.Price,
+			Status:      model.PriceChangeApplied,
+			ChangedBy:   p.UpdatedBy,
+			EffectiveAt: changedAt,
+			CreatedAt:   time.Now(),
+		}
+		if existing != nil {
+			change.OldPrice = existing.Price
+		}
+		if err := s.priceRepo.Save(change); err != nil {
+			return err
+		}
+	}
+
+	if delta := target - p.Stock; delta != 0 {
+		return s.RecordMovement(&model.StockMovement{
+			ProductID: p.ID,
+			Type:      model.MovementAdjustment,
+			Quantity:  delta,
+			Reason:    reason,
+		})
+	}
+	return nil
+}
+
+// applyPriceChange sets a product's price from a price change and records
+// the change as applied
+func (s *ProductService) applyPriceChange(c *model.PriceChange) error {
+	p, err := s.productRepo.GetByID(c.ProductID)
+	if err != nil {
+		return err
+	}
+	if p == nil {
+		return repo.ErrProductNotFound
+	}
+
+	c.OldPrice = p.Price
+	c.Status = model.PriceChangeApplied
+	if p.Price != c.Price {
+		p.Price = c.Price
+		p.Version++
+		p.UpdatedAt = time.Now()
+		p.UpdatedBy = c.ChangedBy
+		if err := s.productRepo.CreateOrUpdate(p); err != nil {
+			return err
+		}
+	}
+	return s.priceRepo.Save(c)
+}
+
+// ensureCategories adds the product's category and sub-category to the
+// categories table if they aren't there yet
+func (s *ProductService) ensureCategories(p *model.Product) error {
+	if p.Category == "" {
+		return nil
+	}
+	parent, err := s.ensureCategory(p.Category, "")
+	if err != nil || p.SubCategory == "" {
+		return err
+	}
+	_, err = s.ensureCategory(p.SubCategory, parent.ID)
+	return err
+}
+
+func (s *ProductService) ensureCategory(name, parentID string) (*model.Category, error) {
+	c, err := s.categoryRepo.GetByName(name)
+	if err != nil || c != nil {
+		return c, err
+	}
+	c = &model.Category{
+		ID:        newID(),
+		Name:      name,
+		ParentID:  parentID,
+		Version:   1,
+		UpdatedAt: time.Now(),
+	}
+	return c, s.categoryRepo.CreateOrUpdate(c)
+}
+
+// CreateOrUpdateCategory ensures idempotent behavior for sync. UpdatedAt
+// is always the server's time, so a device pulling changes since a
+// server time misses none.
+func (s *ProductService) CreateOrUpdateCategory(c *model.Category) error {
+	if c.ID == "" {
+		c.ID = newID()
+	}
+	if c.Version == 0 {
+		c.Version = 1
+	}
+	c.UpdatedAt = time.Now()
+	return s.categoryRepo.CreateOrUpdate(c)
+}
+
+// GetCategoriesUpdatedSince returns categories changed at or after t
+func (s *ProductService) GetCategoriesUpdatedSince(t time.Time) ([]*model.Category, error) {
+	return s.categoryRepo.GetUpdatedSince(t)
+}
+
+// GetAllCategories returns all categories by name
+func (s *ProductService) GetAllCategories() ([]*model.Category, error) {
+	return s.categoryRepo.GetAll()
+}
+
+// CreateOrUpdateUnitConversion ensures idempotent behavior for sync
+func (s *ProductService) CreateOrUpdateUnitConversion(c *model.UnitConversion) error {
+	c.FromUnit = strings.TrimSpace(c.FromUnit)
+	c.ToUnit = strings.TrimSpace(c.ToUnit)
+	if c.FromUnit == "" || c.ToUnit == "" || strings.EqualFold(c.FromUnit, c.ToUnit) || c.Factor <= 0 {
+		return ErrInvalidConversion
+	}
+	if c.ID == "" {
+		c.ID = newID()
+	}
+	if c.Version == 0 {
+		c.Version = 1
+	}
+	if c.UpdatedAt.IsZero() {
+		c.UpdatedAt = time.Now()
+	}
+	return s.unitRepo.CreateOrUpdate(c)
+}
+
+// GetAllUnitConversions returns all unit conversions
+func (s *ProductService) GetAllUnitConversions() ([]*model.UnitConversion, error) {
+	return s.unitRepo.GetAll()
+}
+
+// UnitFactor returns how many of the product's own unit (PricePerUnit)
+// make one of unit. Product-specific conversions win over shop-wide ones,
+// and a conversion defined the other way round is inverted.
+func (s *ProductService) UnitFactor(p *model.Product, unit string) (float64, error) {
+	unit = strings.TrimSpace(unit)
+	if unit == "" || strings.EqualFold(unit, p.PricePerUnit) {
+		return 1, nil
+	}
+	if p.PricePerUnit == "" {
+		return 0, ErrUnknownConversion
+	}
+
+	for _, productID := range []string{p.ID, ""} {
+		c, err := s.unitRepo.Find(productID, unit, p.PricePerUnit)
+		if err != nil {
+			return 0, err
+		}
+		if c != nil {
+			return c.Factor, nil
+		}
+		c, err = s.unitRepo.Find(productID, p.PricePerUnit, unit)
+		if err != nil {
+			return 0, err
+		}
+		if c != nil {
+			return 1 / c.Factor, nil
+		}
+	}
+	return 0, ErrUnknownConversion
+}
+
+// toBaseUnit converts a quantity and unit price entered in unit into the
+// product's own unit. It returns the converted quantity and price.
+func (s *ProductService) toBaseUnit(productID, unit string, quantity, price float64) (float64, float64, error) {
+	if strings.TrimSpace(unit) == "" {
+		return quantity, price, nil
+	}
+	p, err := s.productRepo.GetByID(productID)
+	if err != nil {
+		return 0, 0, err
+	}
+	if p == nil {
+		return 0, 0, repo.ErrProductNotFound
+	}
+	factor, err := s.UnitFactor(p, unit)
+	if err != nil {
+		return 0, 0, err
+	}
+	return model.RoundQuantity(quantity * factor), price / factor, nil
+}
+
+// SearchProducts finds products by name, category or barcode
+func (s *ProductService) SearchProducts(query, category string) ([]*model.Product, error) {
+	return s.productRepo.Search(strings.TrimSpace(query), strings.TrimSpace(category))
+}
+
+// GetProductByBarcode returns the product with the given barcode, or nil
+func (s *ProductService) GetProductByBarcode(barcode string) (*model.Product, error) {
+	return s.productRepo.GetByBarcode(strings.TrimSpace(barcode))
+}
+
+// RecordMovement adds a movement to the stock ledger and updates the
+// product's cached stock
+func (s *ProductService) RecordMovement(m *model.StockMovement) error {
+	if m.ID == "" {
+		m.ID = newID()
+	}
+	if m.CreatedAt.IsZero() {
+		m.CreatedAt = time.Now()
+	}
+
+	err := s.movementRepo.Record(m)
+	if errors.Is(err, repo.ErrInsufficientStock) {
 		return ErrInsufficientStock
 	}
+	return err
+}
 
-	product.Stock = newStock
-	product.Version += 1
-	product.UpdatedAt = time.Now()
+// priceAt returns what a product sold for at t: the price its first
+// change since then replaced, or its current price
+func (s *ProductService) priceAt(product *model.Product, t time.Time) (float64, error) {
+	changes, err := s.priceRepo.GetApplied(product.ID, t, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	if len(changes) > 0 && changes[0].OldPrice > 0 {
+		return changes[0].OldPrice, nil
+	}
+	return product.Price, nil
+}
 
-	err = s.productRepo.CreateOrUpdate(product) // updated for sync safety
+// prepareBatch fills in the batch a movement brings into stock.
+// Perishable products without an expiry date get one from their shelf life.
+func (s *ProductService) prepareBatch(m *model.StockMovement, b *model.StockBatch) error {
+	product, err := s.productRepo.GetByID(m.ProductID)
 	if err != nil {
-		return ErrProductConflict
+		return err
+	}
+	if product == nil {
+		return repo.ErrProductNotFound
 	}
 
+	if b.ID == "" {
+		b.ID = newID()
+	}
+	b.ProductID = m.ProductID
+	b.Quantity = m.Quantity
+	b.Remaining = m.Quantity
+	b.ReceivedAt = m.CreatedAt
+	if b.ExpiryDate == nil && product.IsPerishable && product.ShelfLifeDays > 0 {
+		expiry := m.CreatedAt.AddDate(0, 0, product.ShelfLifeDays)
+		b.ExpiryDate = &expiry
+	}
+	if b.ExpiryDate != nil {
+		expiry := b.ExpiryDate.UTC()
+		b.ExpiryDate = &expiry
+	}
 	return nil
 }
 
+// GetBatches returns a product's batches still in stock, in the order they
+// will be sold
+func (s *ProductService) GetBatches(productID string) ([]*model.StockBatch, error) {
+	return s.batchRepo.GetByProductID(productID)
+}
+
+// WriteOffBatch removes what is left of a batch as spoilage
+func (s *ProductService) WriteOffBatch(batchID, reason, deviceID string) (*model.StockMovement, error) {
+	b, err := s.batchRepo.GetByID(batchID)
+	if err != nil {
+		return nil, err
+	}
+	if b == nil {
+		return nil, ErrBatchNotFound
+	}
+	if b.Remaining == 0 {
+		return nil, ErrInsufficientStock
+	}
+	if reason == "" {
+		reason = model.ReasonSpoiled
+	}
+
+	m := &model.StockMovement{
+		ProductID:  b.ProductID,
+		Type:       model.MovementSpoilage,
+		Quantity:   -b.Remaining,
+		SourceType: "batch",
+		SourceID:   b.ID,
+		Reason:     reason,
+		DeviceID:   deviceID,
+	}
+	if err := s.RecordMovement(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// GetExpiryReport lists stock expiring within the given number of days and
+// the cost value of stock that has already expired
+func (s *ProductService) GetExpiryReport(days int) (*model.ExpiryReport, error) {
+	now := time.Now()
+	batches, err := s.batchRepo.GetExpiringBefore(now.AddDate(0, 0, days))
+	if err != nil {
+		return nil, err
+	}
+
+	report := &model.ExpiryReport{
+		AsOf:     now,
+		Days:     days,
+		Expiring: []*model.StockBatch{},
+		Expired:  []*model.StockBatch{},
+	}
+	for _, b := range batches {
+		value := float64(b.Remaining) * b.UnitCost
+		if b.ExpiryDate.After(now) {
+			report.Expiring = append(report.Expiring, b)
+			report.ExpiringValue += value
+		} else {
+			report.Expired = append(report.Expired, b)
+			report.ExpiredCostValue += value
+		}
+	}
+	return report, nil
+}
+
+// AdjustStock records a manual stock correction (positive or negative)
+func (s *ProductService) AdjustStock(productID string, delta float64, reason string) error {
+	return s.RecordMovement(&model.StockMovement{
+		ProductID: productID,
+		Type:      model.MovementAdjustment,
+		Quantity:  delta,
+		Reason:    reason,
+	})
+}
+
+// GetStockMovements returns a product's stock history, oldest first
+func (s *ProductService) GetStockMovements(productID string) ([]*model.StockMovement, error) {
+	return s.movementRepo.GetByProductID(productID)
+}
+
+// RebuildStock recomputes a product's cached stock from its ledger
+func (s *ProductService) RebuildStock(productID string) (float64, error) {
+	return s.movementRepo.Rebuild(productID)
+}
+
 // GetProduct returns a product by ID
 func (s *ProductService) GetProduct(id string) (*model.Product, error) {
 	return s.productRepo.GetByID(id)
@@ -85,3 +469,8 @@ func (s *ProductService) GetProduct(id string) (*model.Product, error) {
 func (s *ProductService) GetAllProducts() ([]*model.Product, error) {
 	return s.productRepo.GetAll()
 }
+
+// GetProductsUpdatedSince returns products changed after t
+func (s *ProductService) GetProductsUpdatedSince(t time.Time) ([]*model.Product, error) {
+	return s.productRepo.GetUpdatedSince(t)
+}
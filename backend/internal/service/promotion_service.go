@@ -0,0 +1,272 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"strings"
+	"time"
+
+	"pesalocal/internal/model"
+	"pesalocal/internal/repo"
+)
+
+var ErrInvalidPromotion = errors.New("promotion needs a name, a product or category, and valid terms for its type")
+var ErrInvalidDiscount = errors.New("discount must be a percentage up to 100 or an amount up to what is being discounted")
+var ErrDiscountNotAllowed = errors.New("discount is more than this user may give")
+
+// timeOfDayLayout is how promotion windows are written
+const timeOfDayLayout = "15:04"
+
+type PromotionService struct {
+	promotionRepo *repo.PromotionRepo
+	productSvc    *ProductService
+	userRepo      *repo.UserRepo
+	settingsRepo  *repo.SettingsRepo
+}
+
+func NewPromotionService(pr *repo.PromotionRepo, ps *ProductService, ur *repo.UserRepo, sr *repo.SettingsRepo) *PromotionService {
+	return &PromotionService{
+		promotionRepo: pr,
+		productSvc:    ps,
+		userRepo:      ur,
+		settingsRepo:  sr,
+	}
+}
+
+// CreateOrUpdatePromotion validates and saves a promotion. Edits replayed
+// by sync only apply when newer.
+func (s *PromotionService) CreateOrUpdatePromotion(p *model.Promotion) error {
+	p.Name = strings.TrimSpace(p.Name)
+	if p.Name == "" || (p.ProductID == "" && p.Category == "") || !validPromotionTerms(p) {
+		return ErrInvalidPromotion
+	}
+	if p.ID == "" {
+		p.ID = newID()
+	}
+	if p.Version == 0 {
+		p.Version = 1
+	}
+	if p.UpdatedAt.IsZero() {
+		p.UpdatedAt = time.Now()
+	}
+	return s.promotionRepo.CreateOrUpdate(p)
+}
+
+func validPromotionTerms(p *model.Promotion) bool {
+	if (p.StartTime == "") != (p.EndTime == "") {
+		return false
+	}
+	if p.StartTime != "" {
+		if _, err := time.Parse(timeOfDayLayout, p.StartTime); err != nil {
+			return false
+		}
+		if _, err := time.Parse(timeOfDayLayout, p.EndTime); err != nil {
+			return false
+		}
+	}
+	switch p.Type {
+	case model.PromotionBuyXGetY:
+		return p.BuyQuantity > 0 && p.GetQuantity > 0
+	case model.PromotionBundle:
+		return p.BundleQuantity > 0 && p.BundlePrice > 0
+	case model.PromotionTimePrice:
+		return p.StartTime != "" && (p.Price > 0 || (p.Percent > 0 && p.Percent <= 100))
+	}
+	return false
+}
+
+// GetAllPromotions returns every promotion, by name
+func (s *PromotionService) GetAllPromotions() ([]*model.Promotion, error) {
+	return s.promotionRepo.GetAll()
+}
+
+// GetApplied returns the promotions and manual discounts applied to a sale
+func (s *PromotionService) GetApplied(saleID string) ([]*model.SalePromotion, error) {
+	return s.promotionRepo.GetApplied(saleID)
+}
+
+// PriceSale works out what a sale is charged. Each line's Price must be
+// set; lines get the best promotion running at now, then any manual line
+// discount, then the basket discount is shared across them by value.
+// Manual discounts beyond what the selling user may give are applied and
+// marked OverLimit, since the customer has already paid. Totals and
+// discounts are set on the sale and items, and what was applied is listed
+// in sale.Promotions.
+func (s *PromotionService) PriceSale(sale *model.Sale, items []*model.SaleItem, now time.Time) error {
+	promotions, err := s.promotionRepo.GetActive(now)
+	if err != nil {
+		return err
+	}
+	limit, err := s.discountLimit(sale.UserID)
+	if err != nil {
+		return err
+	}
+
+	sale.Promotions = nil
+	sale.Subtotal, sale.Discount, sale.Total = 0, 0, 0
+	net := 0.0
+	for _, item := range items {
+		if item.ID == "" {
+			item.ID = newID()
+		}
+		if item.DiscountType == "" && item.Discount > 0 {
+			// older clients send the amount off as discount
+			item.DiscountType, item.DiscountValue = model.DiscountFixed, item.Discount
+		}
+		gross := roundMoney(item.Quantity * item.Price)
+		item.Discount = 0
+
+		// best promotion for the line
+		product, err := s.productSvc.GetProduct(item.ProductID)
+		if err != nil {
+			return err
+		}
+		var best *model.Promotion
+		for _, p := range promotions {
+			if !promotionCovers(p, product, now) {
+				continue
+			}
+			if off := promotionDiscount(p, item); off > item.Discount {
+				best, item.Discount = p, off
+			}
+		}
+		if best != nil {
+			sale.Promotions = append(sale.Promotions, &model.SalePromotion{
+				SaleItemID: item.ID, PromotionID: best.ID, Name: best.Name, Type: best.Type, Amount: item.Discount,
+			})
+		}
+
+		// manual line discount on what is left
+		off, err := manualDiscount(item.DiscountType, item.DiscountValue, gross-item.Discount)
+		if err != nil {
+			return err
+		}
+		if off > 0 {
+			item.Discount = roundMoney(item.Discount + off)
+			sale.Promotions = append(sale.Promotions, &model.SalePromotion{
+				SaleItemID: item.ID, Name: "Manual discount", Type: model.AppliedManual, Amount: off,
+				OverLimit: limit >= 0 && off > roundMoney(gross*limit/100),
+			})
+		}
+
+		item.Total = roundMoney(gross - item.Discount)
+		sale.Subtotal += gross
+		net += item.Total
+	}
+
+	// basket discount, shared across lines in proportion to their value
+	off, err := manualDiscount(sale.DiscountType, sale.DiscountValue, net)
+	if err != nil {
+		return err
+	}
+	if off > 0 {
+		left := off
+		for i, item := range items {
+			share := roundMoney(off * item.Total / net)
+			if i == len(items)-1 || share > left {
+				share = left
+			}
+			item.Discount = roundMoney(item.Discount + share)
+			item.Total = roundMoney(item.Total - share)
+			left = roundMoney(left - share)
+		}
+		sale.Promotions = append(sale.Promotions, &model.SalePromotion{
+			Name: "Basket discount", Type: model.AppliedManual, Amount: off,
+			OverLimit: limit >= 0 && off > roundMoney(net*limit/100),
+		})
+	}
+
+	for _, item := range items {
+		sale.Discount += item.Discount
+		sale.Total += item.Total
+	}
+	sale.Subtotal = roundMoney(sale.Subtotal)
+	sale.Discount = roundMoney(sale.Discount)
+	sale.Total = roundMoney(sale.Total)
+	for _, a := range sale.Promotions {
+		a.ID = newID()
+		a.SaleID = sale.ID
+	}
+	return nil
+}
+
+// discountLimit returns the percentage a user may take off by hand, or -1
+// for no limit
+func (s *PromotionService) discountLimit(userID string) (float64, error) {
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+	if user != nil && user.Role == "admin" {
+		return -1, nil
+	}
+	return s.settingsRepo.GetFloat(model.SettingCashierDiscountLimit, 0)
+}
+
+// promotionCovers reports whether a promotion applies to a product at now
+func promotionCovers(p *model.Promotion, product *model.Product, now time.Time) bool {
+	if product == nil {
+		return false
+	}
+	if p.ProductID != "" && p.ProductID != product.ID {
+		return false
+	}
+	if p.ProductID == "" && !strings.EqualFold(p.Category, product.Category) && !strings.EqualFold(p.Category, product.SubCategory) {
+		return false
+	}
+	if p.StartTime == "" {
+		return true
+	}
+	// the window may run past midnight, e.g. 22:00-02:00
+	clock := now.Local().Format(timeOfDayLayout)
+	if p.StartTime <= p.EndTime {
+		return clock >= p.StartTime && clock < p.EndTime
+	}
+	return clock >= p.StartTime || clock < p.EndTime
+}
+
+// promotionDiscount returns how much a promotion takes off a line
+func promotionDiscount(p *model.Promotion, item *model.SaleItem) float64 {
+	off := 0.0
+	switch p.Type {
+	case model.PromotionBuyXGetY:
+		sets := math.Floor(item.Quantity / (p.BuyQuantity + p.GetQuantity))
+		off = sets * p.GetQuantity * item.Price
+	case model.PromotionBundle:
+		sets := math.Floor(item.Quantity / p.BundleQuantity)
+		off = sets * (p.BundleQuantity*item.Price - p.BundlePrice)
+	case model.PromotionTimePrice:
+		if p.Price > 0 {
+			off = item.Quantity * (item.Price - p.Price)
+		} else {
+			off = item.Quantity * item.Price * p.Percent / 100
+		}
+	}
+	return math.Max(roundMoney(off), 0)
+}
+
+// manualDiscount returns the amount a manual discount takes off base
+func manualDiscount(discountType string, value, base float64) (float64, error) {
+	var off float64
+	switch discountType {
+	case "":
+		if value != 0 {
+			return 0, ErrInvalidDiscount
+		}
+		return 0, nil
+	case model.DiscountPercent:
+		if value < 0 || value > 100 {
+			return 0, ErrInvalidDiscount
+		}
+		off = roundMoney(base * value / 100)
+	case model.DiscountFixed:
+		off = roundMoney(value)
+	default:
+		return 0, ErrInvalidDiscount
+	}
+	if off < 0 || off > roundMoney(base) {
+		return 0, ErrInvalidDiscount
+	}
+	return off, nil
+}
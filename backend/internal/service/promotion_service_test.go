@@ -0,0 +1,280 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"pesalocal/internal/model"
+	"pesalocal/internal/repo"
+)
+
+// promotionTestService returns a PromotionService over an in-memory
+// database holding a few products, promotions and users. Cashiers may
+// take 10% off by hand.
+func promotionTestService(t *testing.T) *PromotionService {
+	t.Helper()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1) // every connection gets its own in-memory database
+	t.Cleanup(func() { db.Close() })
+
+	if err := repo.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	productRepo := repo.NewProductRepo(db)
+	for _, p := range []*model.Product{
+		{ID: "sugar", Name: "Sukari 1kg", Price: 200, Category: "Groceries"},
+		{ID: "soda", Name: "Soda 500ml", Price: 60, Category: "Drinks"},
+		{ID: "bread", Name: "Mkate", Price: 65, Category: "Bakery"},
+	} {
+		p.Version = 1
+		if err := productRepo.CreateOrUpdate(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ended := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	promotionRepo := repo.NewPromotionRepo(db)
+	for _, p := range []*model.Promotion{
+		{ID: "soda-3for2", Name: "Soda 3 for 2", Type: model.PromotionBuyXGetY, ProductID: "soda", BuyQuantity: 2, GetQuantity: 1, Active: true},
+		{ID: "happy-hour", Name: "Happy hour", Type: model.PromotionTimePrice, Category: "drinks", Percent: 10, StartTime: "16:00", EndTime: "18:00", Active: true},
+		{ID: "bread-pair", Name: "2 loaves for 120", Type: model.PromotionBundle, ProductID: "bread", BundleQuantity: 2, BundlePrice: 120, Active: true},
+		{ID: "sugar-off", Name: "Switched off", Type: model.PromotionTimePrice, ProductID: "sugar", Percent: 50},
+		{ID: "sugar-ended", Name: "Ended", Type: model.PromotionTimePrice, ProductID: "sugar", Price: 100, EndsAt: &ended, Active: true},
+	} {
+		p.Version = 1
+		if err := promotionRepo.CreateOrUpdate(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	userRepo := repo.NewUserRepo(db, nil)
+	for _, u := range []*model.User{
+		{ID: "cashier", Name: "Wanjiru", Role: "cashier", Version: 1},
+		{ID: "owner", Name: "Njeri", Role: "admin", Version: 1},
+	} {
+		if err := userRepo.CreateOrUpdate(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	settingsRepo := repo.NewSettingsRepo(db)
+	if err := settingsRepo.Set(model.SettingCashierDiscountLimit, "10"); err != nil {
+		t.Fatal(err)
+	}
+
+	productSvc := NewProductService(productRepo, nil, nil, nil, nil, nil)
+	return NewPromotionService(promotionRepo, productSvc, userRepo, settingsRepo)
+}
+
+func TestPriceSale(t *testing.T) {
+	s := promotionTestService(t)
+	morning := time.Date(2026, 10, 18, 10, 0, 0, 0, time.Local)
+	evening := time.Date(2026, 10, 18, 17, 0, 0, 0, time.Local)
+
+	line := func(productID string, quantity, price float64) *model.SaleItem {
+		return &model.SaleItem{ProductID: productID, Quantity: quantity, Price: price}
+	}
+	type applied struct {
+		name      string
+		amount    float64
+		overLimit bool
+	}
+	tests := []struct {
+		name       string
+		user       string
+		at         time.Time
+		items      []*model.SaleItem
+		edit       func(s *model.Sale, items []*model.SaleItem)
+		wantErr    error
+		totals     []float64 // per line
+		discount   float64
+		total      float64
+		promotions []applied
+	}{
+		{
+			name:   "no promotion",
+			at:     morning,
+			items:  []*model.SaleItem{line("sugar", 2, 200)},
+			totals: []float64{400},
+			total:  400,
+		},
+		{
+			name:       "buy two get one",
+			at:         morning,
+			items:      []*model.SaleItem{line("soda", 3, 60)},
+			totals:     []float64{120},
+			discount:   60,
+			total:      120,
+			promotions: []applied{{"Soda 3 for 2", 60, false}},
+		},
+		{
+			name:   "buy two get one needs a full set",
+			at:     morning,
+			items:  []*model.SaleItem{line("soda", 2, 60)},
+			totals: []float64{120},
+			total:  120,
+		},
+		{
+			name:       "category promotion in its window",
+			at:         evening,
+			items:      []*model.SaleItem{line("soda", 1, 60)},
+			totals:     []float64{54},
+			discount:   6,
+			total:      54,
+			promotions: []applied{{"Happy hour", 6, false}},
+		},
+		{
+			name:       "the promotion saving most wins",
+			at:         evening,
+			items:      []*model.SaleItem{line("soda", 3, 60)},
+			totals:     []float64{120},
+			discount:   60,
+			total:      120,
+			promotions: []applied{{"Soda 3 for 2", 60, false}},
+		},
+		{
+			name:       "bundle",
+			at:         morning,
+			items:      []*model.SaleItem{line("bread", 5, 65)},
+			totals:     []float64{305},
+			discount:   20,
+			total:      305,
+			promotions: []applied{{"2 loaves for 120", 20, false}},
+		},
+		{
+			name:  "manual discount on what the promotion leaves",
+			at:    morning,
+			items: []*model.SaleItem{line("soda", 3, 60)},
+			edit: func(s *model.Sale, items []*model.SaleItem) {
+				items[0].DiscountType, items[0].DiscountValue = model.DiscountPercent, 10
+			},
+			totals:     []float64{108},
+			discount:   72,
+			total:      108,
+			promotions: []applied{{"Soda 3 for 2", 60, false}, {"Manual discount", 12, false}},
+		},
+		{
+			name:  "over the cashier's limit is applied and flagged",
+			at:    morning,
+			items: []*model.SaleItem{line("sugar", 1, 200)},
+			edit: func(s *model.Sale, items []*model.SaleItem) {
+				items[0].DiscountType, items[0].DiscountValue = model.DiscountFixed, 50
+			},
+			totals:     []float64{150},
+			discount:   50,
+			total:      150,
+			promotions: []applied{{"Manual discount", 50, true}},
+		},
+		{
+			name:  "admins have no limit",
+			user:  "owner",
+			at:    morning,
+			items: []*model.SaleItem{line("sugar", 1, 200)},
+			edit: func(s *model.Sale, items []*model.SaleItem) {
+				items[0].DiscountType, items[0].DiscountValue = model.DiscountFixed, 50
+			},
+			totals:     []float64{150},
+			discount:   50,
+			total:      150,
+			promotions: []applied{{"Manual discount", 50, false}},
+		},
+		{
+			name:  "older clients send the amount off as discount",
+			at:    morning,
+			items: []*model.SaleItem{line("sugar", 1, 200)},
+			edit: func(s *model.Sale, items []*model.SaleItem) {
+				items[0].Discount = 20
+			},
+			totals:     []float64{180},
+			discount:   20,
+			total:      180,
+			promotions: []applied{{"Manual discount", 20, false}},
+		},
+		{
+			name:  "basket discount shared by value",
+			at:    morning,
+			items: []*model.SaleItem{line("sugar", 1, 200), line("bread", 1, 65)},
+			edit: func(s *model.Sale, items []*model.SaleItem) {
+				s.DiscountType, s.DiscountValue = model.DiscountFixed, 53
+			},
+			totals:     []float64{160, 52},
+			discount:   53,
+			total:      212,
+			promotions: []applied{{"Basket discount", 53, true}},
+		},
+		{
+			name:  "percentage over 100",
+			at:    morning,
+			items: []*model.SaleItem{line("sugar", 1, 200)},
+			edit: func(s *model.Sale, items []*model.SaleItem) {
+				items[0].DiscountType, items[0].DiscountValue = model.DiscountPercent, 150
+			},
+			wantErr: ErrInvalidDiscount,
+		},
+		{
+			name:  "more off than the line is worth",
+			at:    morning,
+			items: []*model.SaleItem{line("bread", 1, 65)},
+			edit: func(s *model.Sale, items []*model.SaleItem) {
+				items[0].DiscountType, items[0].DiscountValue = model.DiscountFixed, 70
+			},
+			wantErr: ErrInvalidDiscount,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sale := &model.Sale{ID: "sale-1", UserID: "cashier"}
+			if tt.user != "" {
+				sale.UserID = tt.user
+			}
+			if tt.edit != nil {
+				tt.edit(sale, tt.items)
+			}
+
+			err := s.PriceSale(sale, tt.items, tt.at)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			subtotal := 0.0
+			for i, item := range tt.items {
+				subtotal += item.Quantity * item.Price
+				if item.Total != tt.totals[i] {
+					t.Errorf("line %d total %v, want %v", i, item.Total, tt.totals[i])
+				}
+			}
+			if math.Abs(sale.Subtotal-subtotal) > 0.001 || sale.Discount != tt.discount || sale.Total != tt.total {
+				t.Errorf("subtotal %v discount %v total %v, want %v, %v, %v",
+					sale.Subtotal, sale.Discount, sale.Total, subtotal, tt.discount, tt.total)
+			}
+
+			if len(sale.Promotions) != len(tt.promotions) {
+				t.Fatalf("applied %d promotions, want %d", len(sale.Promotions), len(tt.promotions))
+			}
+			for i, want := range tt.promotions {
+				got := sale.Promotions[i]
+				if got.Name != want.name || got.Amount != want.amount || got.OverLimit != want.overLimit {
+					t.Errorf("promotion %d: %s %v (over limit %v), want %s %v (over limit %v)",
+						i, got.Name, got.Amount, got.OverLimit, want.name, want.amount, want.overLimit)
+				}
+				if got.SaleID != sale.ID || got.ID == "" {
+					t.Errorf("promotion %d not tied to the sale: %+v", i, got)
+				}
+			}
+		})
+	}
+}
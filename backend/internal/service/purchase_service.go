@@ -2,6 +2,7 @@ package service
 
 import (
 	"errors"
+	"math"
 	"time"
 
 	"pesalocal/internal/model"
@@ -14,13 +15,15 @@ type PurchaseService struct {
 	purchaseRepo     *repo.PurchaseRepo
 	purchaseItemRepo *repo.PurchaseItemRepo
 	productSvc       *ProductService
+	supplierSvc      *SupplierService
 }
 
-func NewPurchaseService(pr *repo.PurchaseRepo, pir *repo.PurchaseItemRepo, ps *ProductService) *PurchaseService {
+func NewPurchaseService(pr *repo.PurchaseRepo, pir *repo.PurchaseItemRepo, ps *ProductService, ss *SupplierService) *PurchaseService {
 	return &PurchaseService{
 		purchaseRepo:     pr,
 		purchaseItemRepo: pir,
 		productSvc:       ps,
+		supplierSvc:      ss,
 	}
 }
 
@@ -28,14 +31,60 @@ func NewPurchaseService(pr *repo.PurchaseRepo, pir *repo.PurchaseItemRepo, ps *P
 func (s *PurchaseService) CreatePurchase(purchase *model.Purchase, items []*model.PurchaseItem) error {
 	total := 0.0
 
-	// 1. Calculate totals and update stock
-	for _, item := range items {
-		item.Total = float64(item.Quantity) * item.Price
+	// 0. Link the purchase to its supplier before any stock moves
+	if err := s.supplierSvc.resolveSupplier(purchase); err != nil {
+		return err
+	}
+
+	// Purchases recorded offline keep the time they were made; only a
+	// missing time or one in the future is replaced
+	now := time.Now()
+	if purchase.CreatedAt.IsZero() || purchase.CreatedAt.After(now) {
+		purchase.CreatedAt = now
+	}
+
+	// 1. Calculate totals and the stock each item brings in
+	movements := make([]*model.StockMovement, len(items))
+	batches := make([]*model.StockBatch, len(items))
+	for i, item := range items {
+		// Stock bought in another unit (crates of tomatoes stocked by the
+		// kg) is received in the product's own unit. UnitQuantity is only
+		// set once converted, so replays don't convert twice.
+		if item.Unit != "" && item.UnitQuantity == 0 {
+			qty, price, err := s.productSvc.toBaseUnit(item.ProductID, item.Unit, item.Quantity, item.Price)
+			if err != nil {
+				return err
+			}
+			item.UnitQuantity = item.Quantity
+			item.Quantity, item.Price = qty, price
+		}
+		item.Total = math.Round(item.Quantity*item.Price*100) / 100
 		total += item.Total
 
-		// Increase product stock
-		err := s.productSvc.AdjustStock(item.ProductID, item.Quantity)
-		if err != nil {
+		if item.ID == "" {
+			item.ID = newID()
+		}
+		// Stock is received as a batch, so sales can use it up closest-expiry
+		// first. Movement IDs follow the item IDs, so a replayed purchase
+		// can't receive stock twice.
+		movements[i] = &model.StockMovement{
+			ID:         "purchase:" + item.ID,
+			ProductID:  item.ProductID,
+			Type:       model.MovementPurchase,
+			Quantity:   item.Quantity,
+			UnitCost:   item.Price,
+			SourceType: "purchase",
+			SourceID:   purchase.ID,
+			DeviceID:   purchase.DeviceID,
+			CreatedAt:  purchase.CreatedAt,
+		}
+		batches[i] = &model.StockBatch{
+			ID:         item.ID,
+			PurchaseID: purchase.ID,
+			UnitCost:   item.Price,
+			ExpiryDate: item.ExpiryDate,
+		}
+		if err := s.productSvc.prepareBatch(movements[i], batches[i]); err != nil {
 			return err
 		}
 	}
@@ -43,24 +92,14 @@ func (s *PurchaseService) CreatePurchase(purchase *model.Purchase, items []*mode
 	// 2. Set purchase fields
 	purchase.TotalAmount = total
 	purchase.Version = 1
-	purchase.CreatedAt = time.Now()
-
-	// 3. Insert purchase into DB
-	err := s.purchaseRepo.Create(purchase)
-	if err != nil {
-		return err
-	}
 
-	// 4. Insert purchase items into DB
-	for _, item := range items {
-		item.PurchaseID = purchase.ID
-		err := s.purchaseItemRepo.Create(item)
-		if err != nil {
-			return err
-		}
+	// 3. Insert the purchase, its items, movements and batches together
+	err := s.purchaseRepo.Create(purchase, items, movements, batches)
+	if errors.Is(err, repo.ErrPurchaseExists) {
+		// already recorded: a replay from sync
+		return nil
 	}
-
-	return nil
+	return err
 }
 
 // GetPurchase returns a purchase and its items by ID
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"pesalocal/internal/model"
+	"pesalocal/internal/repo"
+)
+
+var ErrDeviceRequired = errors.New("device_id is required")
+var ErrInvalidRangeSize = errors.New("range size must be between 1 and 100000")
+
+// DefaultReceiptRangeSize is how many numbers a device gets at a time
+// unless the receipt_range_size setting says otherwise
+const DefaultReceiptRangeSize = 500
+
+const maxReceiptRangeSize = 100000
+
+type ReceiptService struct {
+	receiptRepo  *repo.ReceiptRepo
+	settingsRepo *repo.SettingsRepo
+}
+
+func NewReceiptService(rr *repo.ReceiptRepo, sr *repo.SettingsRepo) *ReceiptService {
+	return &ReceiptService{
+		receiptRepo:  rr,
+		settingsRepo: sr,
+	}
+}
+
+// AllocateRange gives a device a new block of receipt numbers following
+// every block already given out. A size of 0 uses the shop's range size.
+func (s *ReceiptService) AllocateRange(deviceID string, size int64) (*model.ReceiptRange, error) {
+	if deviceID == "" {
+		return nil, ErrDeviceRequired
+	}
+	if size == 0 {
+		n, err := s.settingsRepo.GetInt(model.SettingReceiptRangeSize, DefaultReceiptRangeSize)
+		if err != nil {
+			return nil, err
+		}
+		size = int64(n)
+	}
+	if size < 1 || size > maxReceiptRangeSize {
+		return nil, ErrInvalidRangeSize
+	}
+
+	id := newID()
+	if err := s.receiptRepo.Allocate(id, deviceID, size, time.Now()); err != nil {
+		return nil, err
+	}
+	ranges, err := s.receiptRepo.GetRanges(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	for _, rr := range ranges {
+		if rr.ID == id {
+			return rr, nil
+		}
+	}
+	return nil, errors.New("allocated receipt range not found")
+}
+
+// EnsureRanges returns the device's ranges with numbers left, allocating
+// another first when fewer than a fifth of a range remain. Devices call
+// this on every sync so they always hold numbers to use offline.
+func (s *ReceiptService) EnsureRanges(deviceID string) ([]*model.ReceiptRange, error) {
+	size, err := s.settingsRepo.GetInt(model.SettingReceiptRangeSize, DefaultReceiptRangeSize)
+	if err != nil {
+		return nil, err
+	}
+	open, err := s.openRanges(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	var remaining int64
+	for _, rr := range open {
+		remaining += rr.Remaining()
+	}
+	if remaining >= int64(size)/5 && len(open) > 0 {
+		return open, nil
+	}
+	if _, err := s.AllocateRange(deviceID, int64(size)); err != nil {
+		return nil, err
+	}
+	return s.openRanges(deviceID)
+}
+
+func (s *ReceiptService) openRanges(deviceID string) ([]*model.ReceiptRange, error) {
+	ranges, err := s.receiptRepo.GetRanges(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	open := []*model.ReceiptRange{}
+	for _, rr := range ranges {
+		if rr.Remaining() > 0 {
+			open = append(open, rr)
+		}
+	}
+	return open, nil
+}
+
+// GetRanges returns the ranges allocated to a device, or to every device
+// when deviceID is empty
+func (s *ReceiptService) GetRanges(deviceID string) ([]*model.ReceiptRange, error) {
+	return s.receiptRepo.GetRanges(deviceID)
+}
+
+// Audit checks receipt numbering for one device or the whole shop: each
+// device should use its numbers in order without skipping any, no number
+// should appear on two sales, and every number should come from a range
+// allocated to the device that used it.
+func (s *ReceiptService) Audit(deviceID string) (*model.ReceiptAudit, error) {
+	audit := &model.ReceiptAudit{DeviceID: deviceID, CheckedAt: time.Now(), Gaps: []*model.ReceiptGap{}}
+
+	var err error
+	if audit.Ranges, err = s.receiptRepo.GetRanges(deviceID); err != nil {
+		return nil, err
+	}
+
+	// numbers below a device's highest used number should all be used
+	highest := make(map[string]int64)
+	for _, rr := range audit.Ranges {
+		if rr.Used > 0 && rr.Next-1 > highest[rr.DeviceID] {
+			highest[rr.DeviceID] = rr.Next - 1
+		}
+	}
+	for _, rr := range audit.Ranges {
+		upper := rr.End
+		if highest[rr.DeviceID] < upper {
+			upper = highest[rr.DeviceID]
+		}
+		if upper < rr.Start {
+			continue
+		}
+		used, err := s.receiptRepo.UsedNumbers(rr.DeviceID, rr.Start, upper)
+		if err != nil {
+			return nil, err
+		}
+		expect := rr.Start
+		for _, n := range append(used, upper+1) {
+			if n > expect {
+				audit.Gaps = append(audit.Gaps, &model.ReceiptGap{DeviceID: rr.DeviceID, From: expect, To: n - 1})
+			}
+			expect = n + 1
+		}
+	}
+
+	if audit.Duplicates, err = s.receiptRepo.Duplicates(deviceID); err != nil {
+		return nil, err
+	}
+	if audit.Unallocated, err = s.receiptRepo.Unallocated(deviceID); err != nil {
+		return nil, err
+	}
+	audit.OK = len(audit.Gaps) == 0 && len(audit.Duplicates) == 0 && len(audit.Unallocated) == 0
+	return audit, nil
+}
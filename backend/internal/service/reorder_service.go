@@ -0,0 +1,109 @@
+package service
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"pesalocal/internal/model"
+	"pesalocal/internal/repo"
+)
+
+// Setting keys
+const (
+	SettingLowStockThreshold = "low_stock_threshold" // PWA user-level lowStockThreshold
+)
+
+const (
+	defaultLowStockThreshold = 5
+	DefaultVelocityWindow    = 28 // days of sales used to average velocity
+	DefaultCoverDays         = 7  // days of sales an order should cover after delivery
+)
+
+type ReorderService struct {
+	productSvc   *ProductService
+	saleItemRepo *repo.SaleItemRepo
+	settingsRepo *repo.SettingsRepo
+}
+
+func NewReorderService(ps *ProductService, sir *repo.SaleItemRepo, str *repo.SettingsRepo) *ReorderService {
+	return &ReorderService{
+		productSvc:   ps,
+		saleItemRepo: sir,
+		settingsRepo: str,
+	}
+}
+
+// GetSuggestions returns products at or below their reorder point, or
+// expected to run out before a new order could arrive, with a suggested
+// order quantity. Velocity is averaged over the last windowDays of sales;
+// orders are sized to cover the lead time plus coverDays.
+func (s *ReorderService) GetSuggestions(windowDays, coverDays int) ([]*model.ReorderSuggestion, error) {
+	if windowDays <= 0 {
+		windowDays = DefaultVelocityWindow
+	}
+	if coverDays < 0 {
+		coverDays = DefaultCoverDays
+	}
+
+	threshold, err := s.settingsRepo.GetInt(SettingLowStockThreshold, defaultLowStockThreshold)
+	if err != nil {
+		return nil, err
+	}
+	products, err := s.productSvc.GetAllProducts()
+	if err != nil {
+		return nil, err
+	}
+	sold, err := s.saleItemRepo.QuantitySoldSince(time.Now().AddDate(0, 0, -windowDays))
+	if err != nil {
+		return nil, err
+	}
+
+	suggestions := []*model.ReorderSuggestion{}
+	for _, p := range products {
+		reorderPoint := p.ReorderPoint
+		if reorderPoint == 0 {
+			reorderPoint = float64(threshold)
+		}
+		velocity := sold[p.ID] / float64(windowDays)
+
+		sg := &model.ReorderSuggestion{
+			ProductID:         p.ID,
+			Name:              p.Name,
+			Stock:             p.Stock,
+			ReorderPoint:      reorderPoint,
+			DailyVelocity:     math.Round(velocity*100) / 100,
+			LeadTimeDays:      p.LeadTimeDays,
+			BelowReorderPoint: p.Stock <= reorderPoint,
+		}
+		runsOut := false
+		if velocity > 0 {
+			sg.DaysOfStock = math.Round(p.Stock/velocity*10) / 10
+			runsOut = sg.DaysOfStock < float64(p.LeadTimeDays)
+		}
+		if !sg.BelowReorderPoint && !runsOut {
+			continue
+		}
+
+		target := velocity*float64(p.LeadTimeDays+coverDays) + reorderPoint
+		if target > p.Stock {
+			sg.SuggestedQuantity = math.Ceil(target - p.Stock)
+		}
+		suggestions = append(suggestions, sg)
+	}
+
+	// most urgent first
+	sort.Slice(suggestions, func(i, j int) bool {
+		return urgency(suggestions[i]) < urgency(suggestions[j])
+	})
+	return suggestions, nil
+}
+
+// urgency orders suggestions by days of stock left, treating products that
+// don't sell as the least urgent
+func urgency(sg *model.ReorderSuggestion) float64 {
+	if sg.DailyVelocity == 0 {
+		return math.MaxFloat64
+	}
+	return sg.DaysOfStock
+}
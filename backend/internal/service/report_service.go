@@ -0,0 +1,321 @@
+package service
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"pesalocal/internal/model"
+	"pesalocal/internal/repo"
+)
+
+var ErrInvalidDate = errors.New("date must be YYYY-MM-DD and not in the future")
+var ErrDayNotClosed = errors.New("day is still open; correct its sales instead")
+var ErrInvalidDayAdjustment = errors.New("adjustment needs a non-zero amount and a reason")
+
+// Setting keys
+const (
+	SettingTaxRate      = "tax_rate"      // percent included in prices, e.g. 16 for VAT
+	SettingOpeningFloat = "opening_float" // cash in the drawer at opening
+)
+
+// dayLayout is how trading days are written, in shop local time
+const dayLayout = "2006-01-02"
+
+// How many products a Z-report lists
+const zReportTopProducts = 10
+
+type ReportService struct {
+	reportRepo   *repo.ReportRepo
+	settingsRepo *repo.SettingsRepo
+	dayCloseRepo *repo.DayCloseRepo
+}
+
+func NewReportService(rr *repo.ReportRepo, sr *repo.SettingsRepo, dcr *repo.DayCloseRepo) *ReportService {
+	return &ReportService{
+		reportRepo:   rr,
+		settingsRepo: sr,
+		dayCloseRepo: dcr,
+	}
+}
+
+// GetSaleMargins reports the gross margin of each sale in [from, to)
+func (s *ReportService) GetSaleMargins(from, to time.Time) (*model.MarginReport, error) {
+	report, err := s.newMarginReport(from, to)
+	if err != nil {
+		return nil, err
+	}
+	report.Sales, err = s.reportRepo.SaleMargins(from, to)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range report.Sales {
+		addMargin(&report.Total, &m.Margin)
+	}
+	finishMargin(&report.Total)
+	return report, nil
+}
+
+// GetProductMargins reports the gross margin of each product sold in
+// [from, to), biggest earner first
+func (s *ReportService) GetProductMargins(from, to time.Time) (*model.MarginReport, error) {
+	report, err := s.newMarginReport(from, to)
+	if err != nil {
+		return nil, err
+	}
+	report.Products, err = s.reportRepo.ProductMargins(from, to)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range report.Products {
+		m.Quantity = model.RoundQuantity(m.Quantity)
+		addMargin(&report.Total, &m.Margin)
+	}
+	finishMargin(&report.Total)
+	sort.SliceStable(report.Products, func(i, j int) bool {
+		return report.Products[i].GrossMargin > report.Products[j].GrossMargin
+	})
+	return report, nil
+}
+
+// GetDailyMargins reports the gross margin of each day in [from, to)
+func (s *ReportService) GetDailyMargins(from, to time.Time) (*model.MarginReport, error) {
+	report, err := s.newMarginReport(from, to)
+	if err != nil {
+		return nil, err
+	}
+	report.Days, err = s.reportRepo.DailyMargins(from, to)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range report.Days {
+		addMargin(&report.Total, &m.Margin)
+	}
+	finishMargin(&report.Total)
+	return report, nil
+}
+
+// GetPromotionUsage reports what promotions and manual discounts gave
+// away on sales in [from, to)
+func (s *ReportService) GetPromotionUsage(from, to time.Time) ([]*model.PromotionUsage, error) {
+	usage, err := s.reportRepo.PromotionUsage(from, to)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range usage {
+		u.Amount = roundMoney(u.Amount)
+	}
+	return usage, nil
+}
+
+// GetFlaggedDiscounts lists manual discounts on sales in [from, to) that
+// were more than the selling user may give
+func (s *ReportService) GetFlaggedDiscounts(from, to time.Time) ([]*model.FlaggedDiscount, error) {
+	return s.reportRepo.FlaggedDiscounts(from, to)
+}
+
+// GetZReport builds the end-of-day report for a date, for the whole shop
+// or one device. openingFloat overrides the float recorded at close or
+// the shop default when given.
+func (s *ReportService) GetZReport(date, deviceID string, openingFloat *float64) (*model.ZReport, error) {
+	from, err := parseDay(date)
+	if err != nil {
+		return nil, err
+	}
+	to := from.AddDate(0, 0, 1)
+
+	report := &model.ZReport{Date: date, DeviceID: deviceID, GeneratedAt: time.Now()}
+	report.SalesCount, report.GrossSales, report.ItemsSold, err = s.reportRepo.SalesTotals(from, to, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	report.RefundCount, report.Refunds, report.Cash.CashRefunds, err = s.reportRepo.RefundTotals(from, to, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if report.Tenders, err = s.reportRepo.Tenders(from, to, deviceID); err != nil {
+		return nil, err
+	}
+	if report.TopProducts, err = s.reportRepo.TopProducts(from, to, deviceID, zReportTopProducts); err != nil {
+		return nil, err
+	}
+	if report.Adjustments, err = s.dayCloseRepo.GetAdjustments(date, deviceID); err != nil {
+		return nil, err
+	}
+	if report.Close, err = s.dayCloseRepo.Get(date, deviceID); err != nil {
+		return nil, err
+	}
+	if report.TaxRate, err = s.settingsRepo.GetFloat(SettingTaxRate, 0); err != nil {
+		return nil, err
+	}
+
+	report.NetSales = report.GrossSales - report.Refunds
+	report.Tax = roundMoney(report.NetSales * report.TaxRate / (100 + report.TaxRate))
+	report.NetOfTax = roundMoney(report.NetSales - report.Tax)
+	report.GrossSales = roundMoney(report.GrossSales)
+	report.NetSales = roundMoney(report.NetSales)
+	report.Refunds = roundMoney(report.Refunds)
+	report.ItemsSold = model.RoundQuantity(report.ItemsSold)
+
+	// Cash drawer
+	cash := &report.Cash
+	switch {
+	case openingFloat != nil:
+		cash.OpeningFloat = *openingFloat
+	case report.Close != nil:
+		cash.OpeningFloat = report.Close.OpeningFloat
+	default:
+		if cash.OpeningFloat, err = s.settingsRepo.GetFloat(SettingOpeningFloat, 0); err != nil {
+			return nil, err
+		}
+	}
+	for _, t := range report.Tenders {
+		if t.Method == model.PaymentCash {
+			cash.CashSales += t.Amount
+		}
+		t.Amount = roundMoney(t.Amount)
+	}
+	for _, a := range report.Adjustments {
+		// late sales and returns are already in the day's takings
+		if a.Method == model.PaymentCash && a.SourceType == "" {
+			cash.Adjustments += a.Amount
+		}
+	}
+	if cash.SupplierPayments, err = s.reportRepo.CashPaidToSuppliers(from, to, deviceID); err != nil {
+		return nil, err
+	}
+	cash.CashSales = roundMoney(cash.CashSales)
+	cash.CashRefunds = roundMoney(cash.CashRefunds)
+	cash.Expected = roundMoney(cash.OpeningFloat + cash.CashSales - cash.CashRefunds - cash.SupplierPayments + cash.Adjustments)
+	if report.Close != nil {
+		counted := report.Close.CountedCash
+		variance := roundMoney(counted - cash.Expected)
+		cash.Counted = &counted
+		cash.Variance = &variance
+	}
+	return report, nil
+}
+
+// CloseDay takes the Z-report for a day and locks the day against new
+// sales, for one device or (without a device) the whole shop. Replaying
+// the same close is harmless.
+func (s *ReportService) CloseDay(c *model.DayClose) (*model.ZReport, error) {
+	if _, err := parseDay(c.Date); err != nil {
+		return nil, err
+	}
+	existing, err := s.dayCloseRepo.Get(c.Date, c.DeviceID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil && (c.ID == "" || existing.ID != c.ID) {
+		return nil, ErrDayClosed
+	}
+
+	if existing == nil {
+		if c.ID == "" {
+			c.ID = newID()
+		}
+		if c.ClosedAt.IsZero() {
+			c.ClosedAt = time.Now()
+		}
+		if err := s.dayCloseRepo.Create(c); err != nil {
+			if errors.Is(err, repo.ErrDayAlreadyClosed) {
+				return nil, ErrDayClosed
+			}
+			return nil, err
+		}
+	}
+	return s.GetZReport(c.Date, c.DeviceID, nil)
+}
+
+// AddDayAdjustment corrects the takings of a closed day
+func (s *ReportService) AddDayAdjustment(a *model.DayAdjustment) error {
+	if _, err := parseDay(a.Date); err != nil {
+		return err
+	}
+	a.Reason = strings.TrimSpace(a.Reason)
+	if a.Amount == 0 || a.Reason == "" {
+		return ErrInvalidDayAdjustment
+	}
+	closed, err := s.dayCloseRepo.IsClosed(a.Date, a.DeviceID)
+	if err != nil {
+		return err
+	}
+	if !closed {
+		return ErrDayNotClosed
+	}
+
+	if a.ID == "" {
+		a.ID = newID()
+	}
+	if a.Method == "" {
+		a.Method = model.PaymentCash
+	}
+	if a.CreatedAt.IsZero() {
+		a.CreatedAt = time.Now()
+	}
+	return s.dayCloseRepo.AddAdjustment(a)
+}
+
+// lateAdjustment returns the adjustment recording a sale or return made
+// at t against its day, when that day has already been closed, or nil
+// while the day is still open
+func lateAdjustment(dcr *repo.DayCloseRepo, t time.Time, deviceID string, amount float64, method, sourceType, sourceID string) (*model.DayAdjustment, error) {
+	date := t.Local().Format(dayLayout)
+	closed, err := dcr.IsClosed(date, deviceID)
+	if err != nil || !closed {
+		return nil, err
+	}
+	return &model.DayAdjustment{
+		ID:         newID(),
+		Date:       date,
+		DeviceID:   deviceID,
+		Amount:     amount,
+		Method:     method,
+		Reason:     "Recorded after the day was closed",
+		SourceType: sourceType,
+		SourceID:   sourceID,
+		CreatedAt:  time.Now(),
+	}, nil
+}
+
+// GetDayCloses returns the days closed between two dates, inclusive
+func (s *ReportService) GetDayCloses(from, to string) ([]*model.DayClose, error) {
+	return s.dayCloseRepo.GetBetween(from, to)
+}
+
+// parseDay reads a trading day, which can't be in the future
+func parseDay(date string) (time.Time, error) {
+	day, err := time.ParseInLocation(dayLayout, date, time.Local)
+	if err != nil || day.After(time.Now()) {
+		return time.Time{}, ErrInvalidDate
+	}
+	return day, nil
+}
+
+func (s *ReportService) newMarginReport(from, to time.Time) (*model.MarginReport, error) {
+	method, err := s.settingsRepo.Get(model.SettingCostingMethod, model.CostingAverage)
+	if err != nil {
+		return nil, err
+	}
+	return &model.MarginReport{CostingMethod: method, From: from, To: to}, nil
+}
+
+// addMargin finishes line and adds it to total
+func addMargin(total, line *model.Margin) {
+	finishMargin(line)
+	total.Revenue += line.Revenue
+	total.Cost += line.Cost
+}
+
+// finishMargin rounds a margin's amounts and works out what it made
+func finishMargin(m *model.Margin) {
+	m.Revenue = roundMoney(m.Revenue)
+	m.Cost = roundMoney(m.Cost)
+	m.GrossMargin = roundMoney(m.Revenue - m.Cost)
+	m.MarginPercent = 0
+	if m.Revenue != 0 {
+		m.MarginPercent = roundMoney(m.GrossMargin / m.Revenue * 100)
+	}
+}
@@ -0,0 +1,231 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"pesalocal/internal/model"
+	"pesalocal/internal/repo"
+)
+
+var ErrSaleNotFound = errors.New("sale not found")
+var ErrReturnNotFound = errors.New("return not found")
+var ErrSaleNotPaid = errors.New("sale is awaiting payment; nothing to refund")
+var ErrInvalidReturn = errors.New("return items must be items of the sale with a positive quantity")
+var ErrReturnExceedsSale = errors.New("more returned than was sold")
+var ErrInvalidDisposition = errors.New("disposition must be restock or damaged")
+var ErrInvalidRefundMethod = errors.New("refund method must be cash or mpesa, or credit for credit sales")
+
+type ReturnService struct {
+	returnRepo   *repo.ReturnRepo
+	saleRepo     *repo.SaleRepo
+	saleItemRepo *repo.SaleItemRepo
+	dayCloseRepo *repo.DayCloseRepo
+}
+
+func NewReturnService(rr *repo.ReturnRepo, sr *repo.SaleRepo, sir *repo.SaleItemRepo, dcr *repo.DayCloseRepo) *ReturnService {
+	return &ReturnService{
+		returnRepo:   rr,
+		saleRepo:     sr,
+		saleItemRepo: sir,
+		dayCloseRepo: dcr,
+	}
+}
+
+// CreateReturn records goods coming back from a sale and the refund
+// given for them. Items are refunded at the price paid for them and may
+// return part of what was sold; with no items, everything not yet
+// returned comes back. Restocked items go back into stock at the cost
+// they left at. Replaying a return already recorded is harmless.
+func (s *ReturnService) CreateReturn(ret *model.Return) error {
+	if ret.ID == "" {
+		ret.ID = newID()
+	}
+	existing, err := s.returnRepo.GetByID(ret.ID)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		*ret = *existing
+		return nil // already recorded: a replay from sync
+	}
+
+	sale, err := s.saleRepo.GetByID(ret.SaleID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrSaleNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if sale.PaymentStatus == model.PaymentPending {
+		return ErrSaleNotPaid
+	}
+
+	// Returns are taken on the day they happen; ones made offline keep
+	// their time
+	if now := time.Now(); ret.CreatedAt.IsZero() || ret.CreatedAt.After(now) {
+		ret.CreatedAt = now
+	}
+
+	if ret.RefundMethod == "" {
+		ret.RefundMethod = sale.PaymentMethod
+	}
+	switch ret.RefundMethod {
+	case model.PaymentCash, model.PaymentMpesa:
+	case model.PaymentCredit:
+		// only reduces what a credit customer owes
+		if sale.PaymentMethod != model.PaymentCredit {
+			return ErrInvalidRefundMethod
+		}
+	default:
+		return ErrInvalidRefundMethod
+	}
+
+	if err := s.priceItems(ret); err != nil {
+		return err
+	}
+
+	// a return reaching a day already closed is still taken, and recorded
+	// against the day so its Z-report shows what changed
+	late, err := lateAdjustment(s.dayCloseRepo, ret.CreatedAt, ret.DeviceID, -ret.RefundTotal, ret.RefundMethod, "return", ret.ID)
+	if err != nil {
+		return err
+	}
+
+	ret.Version = 1
+	err = s.returnRepo.Create(ret, restockMovements(ret), late)
+	if errors.Is(err, repo.ErrReturnExists) {
+		return nil // recorded by a concurrent replay
+	}
+	if errors.Is(err, repo.ErrReturnExceedsSale) {
+		return ErrReturnExceedsSale // another return got there first
+	}
+	return err
+}
+
+// priceItems checks the items against what is left of the sale and fills
+// in their product, price, refund and cost from the sale
+func (s *ReturnService) priceItems(ret *model.Return) error {
+	saleItems, err := s.saleItemRepo.GetBySaleID(ret.SaleID)
+	if err != nil {
+		return err
+	}
+	returned, err := s.returnRepo.ReturnedQuantities(ret.SaleID)
+	if err != nil {
+		return err
+	}
+
+	if len(ret.Items) == 0 {
+		for _, si := range saleItems {
+			if left := model.RoundQuantity(si.Quantity - returned[si.ID]); left > 0 {
+				ret.Items = append(ret.Items, &model.ReturnItem{SaleItemID: si.ID, Quantity: left})
+			}
+		}
+		if len(ret.Items) == 0 {
+			return ErrReturnExceedsSale
+		}
+	}
+
+	sold := make(map[string]*model.SaleItem, len(saleItems))
+	for _, si := range saleItems {
+		sold[si.ID] = si
+	}
+
+	ret.RefundTotal = 0
+	for _, item := range ret.Items {
+		si, ok := sold[item.SaleItemID]
+		item.Quantity = model.RoundQuantity(item.Quantity)
+		if !ok || item.Quantity <= 0 {
+			return ErrInvalidReturn
+		}
+		// lines for the same sale item add up
+		returned[si.ID] = model.RoundQuantity(returned[si.ID] + item.Quantity)
+		if returned[si.ID] > si.Quantity {
+			return ErrReturnExceedsSale
+		}
+
+		if item.Disposition == "" {
+			item.Disposition = model.ReturnRestock
+		}
+		if item.Disposition != model.ReturnRestock && item.Disposition != model.ReturnDamaged {
+			return ErrInvalidDisposition
+		}
+
+		if item.ID == "" {
+			item.ID = newID()
+		}
+		item.ReturnID = ret.ID
+		item.ProductID = si.ProductID
+		// refunded at what was actually paid, after discounts
+		item.Price = roundMoney(si.Total / si.Quantity)
+		item.Total = roundMoney(item.Quantity * si.Total / si.Quantity)
+		item.UnitCost = si.UnitCost
+		item.Cost = 0
+		if item.Disposition == model.ReturnRestock {
+			item.Cost = roundMoney(item.Quantity * item.UnitCost)
+		}
+		ret.RefundTotal += item.Total
+	}
+	ret.RefundTotal = roundMoney(ret.RefundTotal)
+	return nil
+}
+
+// restockMovements returns the movements putting restocked items back
+// into stock. Movements are keyed by the return item so a replay doesn't
+// restock twice. Damaged goods never re-enter stock; their cost stays in
+// the cost of goods sold.
+func restockMovements(ret *model.Return) []*model.StockMovement {
+	var movements []*model.StockMovement
+	for _, item := range ret.Items {
+		if item.Disposition != model.ReturnRestock {
+			continue
+		}
+		movements = append(movements, &model.StockMovement{
+			ID:         item.ID,
+			ProductID:  item.ProductID,
+			Type:       model.MovementReturn,
+			Quantity:   item.Quantity,
+			UnitCost:   item.UnitCost,
+			SourceType: "return",
+			SourceID:   ret.ID,
+			DeviceID:   ret.DeviceID,
+			CreatedAt:  ret.CreatedAt,
+		})
+	}
+	return movements
+}
+
+// GetReturn returns a return with its items
+func (s *ReturnService) GetReturn(id string) (*model.Return, error) {
+	ret, err := s.returnRepo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if ret == nil {
+		return nil, ErrReturnNotFound
+	}
+	return ret, nil
+}
+
+// GetSaleReturns returns the returns made against a sale, oldest first
+func (s *ReturnService) GetSaleReturns(saleID string) ([]*model.Return, error) {
+	if _, err := s.saleRepo.GetByID(saleID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrSaleNotFound
+		}
+		return nil, err
+	}
+	return s.returnRepo.GetBySaleID(saleID)
+}
+
+// GetReturnsRecordedSince returns the returns the server recorded at or
+// after t, for devices pulling what they haven't seen
+func (s *ReturnService) GetReturnsRecordedSince(t time.Time) ([]*model.Return, error) {
+	return s.returnRepo.GetRecordedSince(t)
+}
+
+// GetReturns returns the returns made in [from, to), oldest first
+func (s *ReturnService) GetReturns(from, to time.Time) ([]*model.Return, error) {
+	return s.returnRepo.GetBetween(from, to)
+}
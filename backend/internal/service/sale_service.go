@@ -1,7 +1,9 @@
 package service
 
 import (
+	"database/sql"
 	"errors"
+	"math"
 	"time"
 
 	"pesalocal/internal/model"
@@ -9,63 +11,166 @@ import (
 )
 
 var ErrSaleConflict = errors.New("sale version conflict")
+var ErrDayClosed = errors.New("trading day is closed")
+var ErrInvalidReceiptNo = errors.New("receipt number can't be negative")
+
+// How far back a payment looks for the pending sale it settles
+const mpesaMatchWindow = 2 * time.Hour
 
 type SaleService struct {
 	saleRepo     *repo.SaleRepo
 	saleItemRepo *repo.SaleItemRepo
 	productSvc   *ProductService
+	dayCloseRepo *repo.DayCloseRepo
+	promotionSvc *PromotionService
 }
 
-func NewSaleService(sr *repo.SaleRepo, sir *repo.SaleItemRepo, ps *ProductService) *SaleService {
+func NewSaleService(sr *repo.SaleRepo, sir *repo.SaleItemRepo, ps *ProductService, dcr *repo.DayCloseRepo, prs *PromotionService) *SaleService {
 	return &SaleService{
 		saleRepo:     sr,
 		saleItemRepo: sir,
 		productSvc:   ps,
+		dayCloseRepo: dcr,
+		promotionSvc: prs,
 	}
 }
 
-// CreateSale handles creating a sale with multiple items
+// CreateSale handles creating a sale with multiple items. Items are
+// charged at the catalogue price and promotions in force when the sale
+// was made, less its manual discounts, whatever the device worked out.
 func (s *SaleService) CreateSale(sale *model.Sale, items []*model.SaleItem) error {
-	total := 0.0
-
-	// 1. Calculate totals and adjust stock
+	if sale.ID == "" {
+		sale.ID = newID()
+	}
 	for _, item := range items {
-		item.Total = float64(item.Quantity) * item.Price
-		total += item.Total
-
-		// Adjust product stock
-		err := s.productSvc.AdjustStock(item.ProductID, -item.Quantity)
-		if err != nil {
-			return err
+		if item.ID == "" {
+			item.ID = newID()
 		}
 	}
 
+	now := time.Now()
+	// Sales made offline keep the time they were made; only a missing
+	// time or one in the future is replaced
+	if sale.CreatedAt.IsZero() || sale.CreatedAt.After(now) {
+		sale.CreatedAt = now
+	}
+
+	// 0. Numbers outside the device's ranges, repeated or skipped are kept
+	// as issued and reported by the receipt audit
+	if sale.ReceiptNo < 0 {
+		return ErrInvalidReceiptNo
+	}
+
+	// 1. Price the items
+	if err := s.priceItems(sale, items, sale.CreatedAt); err != nil {
+		return err
+	}
+
 	// 2. Set sale fields
-	sale.Total = total
 	sale.Version = 1
-	sale.CreatedAt = time.Now()
+	if sale.PaymentMethod == "" {
+		sale.PaymentMethod = model.PaymentCash
+	}
+	// M-PESA sales stay pending until a confirmation is matched to them
+	if sale.PaymentMethod == model.PaymentMpesa && sale.MpesaReceipt == "" {
+		sale.PaymentStatus = model.PaymentPending
+	} else {
+		sale.PaymentStatus = model.PaymentPaid
+	}
 
-	// 3. Insert sale into DB
-	err := s.saleRepo.Create(sale)
+	// 3. Record the stock leaving the shop; the ledger costs it. Movement
+	// IDs follow the item IDs, so a replayed sale can't move stock twice.
+	movements := make([]*model.StockMovement, len(items))
+	for i, item := range items {
+		movements[i] = &model.StockMovement{
+			ID:         "sale:" + item.ID,
+			ProductID:  item.ProductID,
+			Type:       model.MovementSale,
+			Quantity:   -item.Quantity,
+			SourceType: "sale",
+			SourceID:   sale.ID,
+			DeviceID:   sale.DeviceID,
+			CreatedAt:  sale.CreatedAt,
+		}
+	}
+
+	// 4. A sale reaching a day already closed is still taken, and
+	// recorded against the day so its Z-report shows what changed
+	late, err := lateAdjustment(s.dayCloseRepo, sale.CreatedAt, sale.DeviceID, sale.Total, sale.PaymentMethod, "sale", sale.ID)
 	if err != nil {
 		return err
 	}
 
-	// 4. Insert sale items into DB
+	// 5. Insert the sale, its items and movements together
+	err = s.saleRepo.Create(sale, items, movements, late)
+	switch {
+	case errors.Is(err, repo.ErrSaleExists):
+		// already recorded: a replay from sync
+		return nil
+	case errors.Is(err, repo.ErrInsufficientStock):
+		return ErrInsufficientStock
+	}
+	return err
+}
+
+// priceItems converts items sold in other units and prices them from the
+// catalogue, promotions and discounts as they stood at t
+func (s *SaleService) priceItems(sale *model.Sale, items []*model.SaleItem, t time.Time) error {
 	for _, item := range items {
-		item.SaleID = sale.ID
-		err := s.saleItemRepo.Create(item)
+		// Items sold in another unit arrive with the quantity and price as
+		// entered; stock and totals work in the product's own unit.
+		// UnitQuantity is only set once converted, so replays don't convert twice.
+		if item.Unit != "" && item.UnitQuantity == 0 {
+			qty, price, err := s.productSvc.toBaseUnit(item.ProductID, item.Unit, item.Quantity, item.Price)
+			if err != nil {
+				return err
+			}
+			item.UnitQuantity = item.Quantity
+			item.Quantity, item.Price = qty, price
+		}
+
+		product, err := s.productSvc.GetProduct(item.ProductID)
+		if err != nil {
+			return err
+		}
+		if product == nil {
+			return repo.ErrProductNotFound
+		}
+		price, err := s.productSvc.priceAt(product, t)
 		if err != nil {
 			return err
 		}
+		if price > 0 {
+			item.Price = price
+		}
 	}
+	return s.promotionSvc.PriceSale(sale, items, t)
+}
 
+// QuoteSale prices a basket as CreateSale would, without selling it.
+// Unlike a sale, a quote can be refused a discount the user may not give.
+func (s *SaleService) QuoteSale(sale *model.Sale, items []*model.SaleItem) error {
+	if sale.ID == "" {
+		sale.ID = newID()
+	}
+	sale.CreatedAt = time.Now()
+	if err := s.priceItems(sale, items, sale.CreatedAt); err != nil {
+		return err
+	}
+	for _, a := range sale.Promotions {
+		if a.OverLimit {
+			return ErrDiscountNotAllowed
+		}
+	}
 	return nil
 }
 
 // GetSale returns a sale by ID along with its items
 func (s *SaleService) GetSale(id string) (*model.Sale, []*model.SaleItem, error) {
 	sale, err := s.saleRepo.GetByID(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, ErrSaleNotFound
+	}
 	if err != nil {
 		return nil, nil, err
 	}
@@ -74,10 +179,57 @@ func (s *SaleService) GetSale(id string) (*model.Sale, []*model.SaleItem, error)
 	if err != nil {
 		return nil, nil, err
 	}
+	if sale.Promotions, err = s.promotionSvc.GetApplied(id); err != nil {
+		return nil, nil, err
+	}
 
 	return sale, items, nil
 }
 
+// MatchMpesaPayment finds the pending M-PESA sale an incoming payment
+// settles and marks it paid. A reference naming the sale wins; otherwise
+// the payment must equal the total of exactly one recent pending sale.
+// Returns nil when no sale could be matched.
+func (s *SaleService) MatchMpesaPayment(tx *model.MpesaTransaction, reference string) (*model.Sale, error) {
+	var match *model.Sale
+
+	if reference != "" {
+		sale, err := s.saleRepo.GetByID(reference)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		if sale != nil && sale.PaymentStatus == model.PaymentPending && tx.Amount >= sale.Total {
+			match = sale
+		}
+	}
+
+	if match == nil {
+		pending, err := s.saleRepo.GetPendingMpesa(tx.CompletionTime.Add(-mpesaMatchWindow))
+		if err != nil {
+			return nil, err
+		}
+		for _, sale := range pending {
+			if math.Abs(sale.Total-tx.Amount) >= 0.01 {
+				continue
+			}
+			if match != nil {
+				return nil, nil // ambiguous, leave for manual matching
+			}
+			match = sale
+		}
+	}
+
+	if match == nil {
+		return nil, nil
+	}
+	if err := s.saleRepo.MarkPaid(match.ID, tx.ReceiptNo); err != nil {
+		return nil, err
+	}
+	match.PaymentStatus = model.PaymentPaid
+	match.MpesaReceipt = tx.ReceiptNo
+	return match, nil
+}
+
 // GetAllSales returns all sales
 func (s *SaleService) GetAllSales() ([]*model.Sale, error) {
 	return s.saleRepo.GetAll()
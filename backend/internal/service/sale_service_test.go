@@ -0,0 +1,161 @@
+package service
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"pesalocal/internal/model"
+	"pesalocal/internal/repo"
+)
+
+// mpesaMatchTestService returns a SaleService over an in-memory database
+// holding the given sales
+func mpesaMatchTestService(t *testing.T, sales []*model.Sale) (*SaleService, *repo.SaleRepo) {
+	t.Helper()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1) // every connection gets its own in-memory database
+	t.Cleanup(func() { db.Close() })
+
+	if err := repo.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	saleRepo := repo.NewSaleRepo(db)
+	for _, s := range sales {
+		s.Version = 1
+		if err := saleRepo.Create(s, nil, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return NewSaleService(saleRepo, repo.NewSaleItemRepo(db), nil, nil, nil), saleRepo
+}
+
+func TestMatchMpesaPayment(t *testing.T) {
+	// payments come in EAT, sales from devices in whatever zone they're set to
+	eat := time.FixedZone("EAT", 3*60*60)
+	paid := time.Date(2026, 10, 18, 10, 0, 0, 0, eat)
+	pending := func(id string, total float64, before time.Duration) *model.Sale {
+		return &model.Sale{
+			ID: id, Total: total, PaymentMethod: model.PaymentMpesa, PaymentStatus: model.PaymentPending,
+			CreatedAt: paid.Add(-before).UTC(),
+		}
+	}
+
+	tests := []struct {
+		name      string
+		sales     []*model.Sale
+		amount    float64
+		reference string
+		want      string // the sale matched, if any
+	}{
+		{
+			name:   "the one pending sale of that amount",
+			sales:  []*model.Sale{pending("s1", 350, 5*time.Minute), pending("s2", 120, 3*time.Minute)},
+			amount: 350,
+			want:   "s1",
+		},
+		{
+			name:  "sale made on a device set to EAT",
+			sales: []*model.Sale{{ID: "s1", Total: 350, PaymentMethod: model.PaymentMpesa, PaymentStatus: model.PaymentPending, CreatedAt: paid.Add(-time.Minute)}},
+			// stored in UTC, it must still fall inside the window
+			amount: 350,
+			want:   "s1",
+		},
+		{
+			name:   "amounts within a cent",
+			sales:  []*model.Sale{pending("s1", 349.995, time.Minute)},
+			amount: 350,
+			want:   "s1",
+		},
+		{
+			name:   "two pending sales of that amount are left to match by hand",
+			sales:  []*model.Sale{pending("s1", 350, 5*time.Minute), pending("s2", 350, 3*time.Minute)},
+			amount: 350,
+		},
+		{
+			name:      "the reference settles an ambiguous amount",
+			sales:     []*model.Sale{pending("s1", 350, 5*time.Minute), pending("s2", 350, 3*time.Minute)},
+			amount:    350,
+			reference: "s2",
+			want:      "s2",
+		},
+		{
+			name:      "the reference wins over the amount",
+			sales:     []*model.Sale{pending("s1", 350, 5*time.Minute), pending("s2", 300, 3*time.Minute)},
+			amount:    350,
+			reference: "s2",
+			want:      "s2",
+		},
+		{
+			name:      "paying less than the referenced sale falls back to the amount",
+			sales:     []*model.Sale{pending("s1", 350, 5*time.Minute), pending("s2", 400, 3*time.Minute)},
+			amount:    350,
+			reference: "s2",
+			want:      "s1",
+		},
+		{
+			name:      "unknown reference",
+			sales:     []*model.Sale{pending("s1", 350, 5*time.Minute)},
+			amount:    350,
+			reference: "INV-9",
+			want:      "s1",
+		},
+		{
+			name:   "sale older than the window",
+			sales:  []*model.Sale{pending("s1", 350, mpesaMatchWindow+time.Minute)},
+			amount: 350,
+		},
+		{
+			name: "sales already paid or paid in cash",
+			sales: []*model.Sale{
+				{ID: "s1", Total: 350, PaymentMethod: model.PaymentMpesa, PaymentStatus: model.PaymentPaid, MpesaReceipt: "SGR1A2B3C4", CreatedAt: paid.Add(-time.Minute)},
+				{ID: "s2", Total: 350, PaymentMethod: model.PaymentCash, PaymentStatus: model.PaymentPaid, CreatedAt: paid.Add(-time.Minute)},
+			},
+			amount:    350,
+			reference: "s1",
+		},
+		{
+			name:   "no amount matches",
+			sales:  []*model.Sale{pending("s1", 350, time.Minute)},
+			amount: 300,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, saleRepo := mpesaMatchTestService(t, tt.sales)
+			tx := &model.MpesaTransaction{ReceiptNo: "SGR7K2LQ4B", CompletionTime: paid, Amount: tt.amount}
+
+			sale, err := s.MatchMpesaPayment(tx, tt.reference)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want == "" {
+				if sale != nil {
+					t.Fatalf("matched %s, want no match", sale.ID)
+				}
+				return
+			}
+			if sale == nil || sale.ID != tt.want {
+				t.Fatalf("matched %+v, want %s", sale, tt.want)
+			}
+
+			stored, err := saleRepo.GetByID(tt.want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.PaymentStatus != model.PaymentPaid || stored.MpesaReceipt != tx.ReceiptNo {
+				t.Errorf("stored as %s with receipt %q", stored.PaymentStatus, stored.MpesaReceipt)
+			}
+			// the same payment can't settle a second sale
+			if again, err := s.MatchMpesaPayment(tx, tt.reference); err != nil || (again != nil && again.ID == tt.want) {
+				t.Errorf("matched again: %+v, %v", again, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,274 @@
+package service
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"pesalocal/internal/model"
+	"pesalocal/internal/repo"
+)
+
+var (
+	ErrStockTakeNotFound = errors.New("stock take not found")
+	ErrStockTakeClosed   = errors.New("stock take is not open")
+	ErrInvalidReason     = errors.New("invalid adjustment reason")
+)
+
+type StockTakeService struct {
+	stockTakeRepo *repo.StockTakeRepo
+	productSvc    *ProductService
+}
+
+func NewStockTakeService(str *repo.StockTakeRepo, ps *ProductService) *StockTakeService {
+	return &StockTakeService{
+		stockTakeRepo: str,
+		productSvc:    ps,
+	}
+}
+
+// CommitRequest gives the reason code booked against each variance.
+// Reasons overrides Reason for individual products.
+type CommitRequest struct {
+	Reason  string            `json:"reason"`
+	Reasons map[string]string `json:"reasons,omitempty"` // product ID -> reason code
+}
+
+// OpenStockTake starts a counting session. Opening a session that already
+// exists (replayed by sync) is a no-op.
+func (s *StockTakeService) OpenStockTake(t *model.StockTake) error {
+	if t.ID == "" {
+		t.ID = newID()
+	}
+	t.Status = model.StockTakeOpen
+	t.Version = 1
+	t.CommittedAt = nil
+	if t.CreatedAt.IsZero() {
+		t.CreatedAt = time.Now()
+	}
+	return s.stockTakeRepo.Create(t)
+}
+
+// RecordCounts stores counts from a device against an open session
+func (s *StockTakeService) RecordCounts(stockTakeID string, counts []*model.StockCount) error {
+	if _, err := s.openStockTake(stockTakeID); err != nil {
+		return err
+	}
+
+	for _, c := range counts {
+		if c.ID == "" {
+			c.ID = newID()
+		}
+		if c.CountedAt.IsZero() {
+			c.CountedAt = time.Now()
+		}
+		c.StockTakeID = stockTakeID
+		if err := s.stockTakeRepo.UpsertCount(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetStockTake returns a session with its counts
+func (s *StockTakeService) GetStockTake(id string) (*model.StockTake, []*model.StockCount, error) {
+	t, err := s.stockTakeRepo.GetByID(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if t == nil {
+		return nil, nil, ErrStockTakeNotFound
+	}
+
+	counts, err := s.stockTakeRepo.GetCounts(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	return t, counts, nil
+}
+
+// GetAllStockTakes returns all sessions, newest first
+func (s *StockTakeService) GetAllStockTakes() ([]*model.StockTake, error) {
+	return s.stockTakeRepo.GetAll()
+}
+
+// GetVariances compares the summed counts of each product with its stock
+// when it was first counted, so stock sold or received while the session
+// is open isn't taken for a variance
+func (s *StockTakeService) GetVariances(stockTakeID string) ([]*model.StockVariance, error) {
+	_, counts, err := s.GetStockTake(stockTakeID)
+	if err != nil {
+		return nil, err
+	}
+
+	counted := make(map[string]float64)
+	expected := make(map[string]float64)
+	for _, c := range counts {
+		if _, ok := counted[c.ProductID]; !ok {
+			expected[c.ProductID] = c.Expected // counts are oldest first
+		}
+		counted[c.ProductID] += c.Counted
+	}
+
+	variances := make([]*model.StockVariance, 0, len(counted))
+	for productID, qty := range counted {
+		product, err := s.productSvc.GetProduct(productID)
+		if err != nil {
+			return nil, err
+		}
+		if product == nil {
+			return nil, repo.ErrProductNotFound
+		}
+		variances = append(variances, &model.StockVariance{
+			ProductID: productID,
+			Name:      product.Name,
+			Expected:  expected[productID],
+			Counted:   model.RoundQuantity(qty),
+			Variance:  model.RoundQuantity(qty - expected[productID]),
+		})
+	}
+
+	sort.Slice(variances, func(i, j int) bool {
+		return variances[i].Name < variances[j].Name
+	})
+	return variances, nil
+}
+
+// CommitStockTake books every variance as a stock adjustment and closes
+// the session, atomically. Committing a session again (replayed by sync)
+// returns the adjustments booked the first time.
+func (s *StockTakeService) CommitStockTake(stockTakeID string, req *CommitRequest) ([]*model.StockMovement, error) {
+	t, err := s.openStockTake(stockTakeID)
+	if errors.Is(err, ErrStockTakeClosed) {
+		return s.committedAdjustments(stockTakeID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if req.Reason == "" {
+		req.Reason = model.ReasonCountCorrection
+	}
+
+	variances, err := s.GetVariances(stockTakeID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	adjustments := []*model.StockMovement{}
+	for _, v := range variances {
+		if v.Variance == 0 {
+			continue
+		}
+		reason := req.Reason
+		if r, ok := req.Reasons[v.ProductID]; ok {
+			reason = r
+		}
+		if !model.ValidAdjustmentReason(reason) {
+			return nil, ErrInvalidReason
+		}
+
+		adjustments = append(adjustments, &model.StockMovement{
+			ID:         newID(),
+			ProductID:  v.ProductID,
+			Type:       adjustmentType(reason, v.Variance),
+			Quantity:   v.Variance,
+			SourceType: "stock_take",
+			SourceID:   stockTakeID,
+			Reason:     reason,
+			DeviceID:   t.DeviceID,
+			CreatedAt:  now,
+		})
+	}
+
+	err = s.stockTakeRepo.Commit(stockTakeID, adjustments, now)
+	if errors.Is(err, repo.ErrStockTakeClosed) {
+		// committed or cancelled since it was read
+		return s.committedAdjustments(stockTakeID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return adjustments, nil
+}
+
+// committedAdjustments returns what a committed session booked, or
+// ErrStockTakeClosed if it was cancelled
+func (s *StockTakeService) committedAdjustments(stockTakeID string) ([]*model.StockMovement, error) {
+	t, err := s.stockTakeRepo.GetByID(stockTakeID)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return nil, ErrStockTakeNotFound
+	}
+	if t.Status != model.StockTakeCommitted {
+		return nil, ErrStockTakeClosed
+	}
+	adjustments, err := s.stockTakeRepo.Adjustments(stockTakeID)
+	if adjustments == nil && err == nil {
+		adjustments = []*model.StockMovement{}
+	}
+	return adjustments, err
+}
+
+// CancelStockTake closes a session without touching stock. Cancelling a
+// session again is a no-op.
+func (s *StockTakeService) CancelStockTake(stockTakeID string) error {
+	if _, err := s.openStockTake(stockTakeID); err != nil {
+		return s.cancelled(stockTakeID, err)
+	}
+	err := s.stockTakeRepo.Cancel(stockTakeID)
+	if errors.Is(err, repo.ErrStockTakeClosed) {
+		return s.cancelled(stockTakeID, ErrStockTakeClosed)
+	}
+	return err
+}
+
+// cancelled returns nil if the session is already cancelled, and err
+// otherwise
+func (s *StockTakeService) cancelled(stockTakeID string, err error) error {
+	if !errors.Is(err, ErrStockTakeClosed) {
+		return err
+	}
+	t, getErr := s.stockTakeRepo.GetByID(stockTakeID)
+	if getErr != nil {
+		return getErr
+	}
+	if t != nil && t.Status == model.StockTakeCancelled {
+		return nil
+	}
+	return err
+}
+
+// AdjustStock records a manual stock correction with a reason code
+func (s *StockTakeService) AdjustStock(m *model.StockMovement) error {
+	if !model.ValidAdjustmentReason(m.Reason) {
+		return ErrInvalidReason
+	}
+	m.Type = adjustmentType(m.Reason, m.Quantity)
+	return s.productSvc.RecordMovement(m)
+}
+
+func (s *StockTakeService) openStockTake(id string) (*model.StockTake, error) {
+	t, err := s.stockTakeRepo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return nil, ErrStockTakeNotFound
+	}
+	if t.Status != model.StockTakeOpen {
+		return nil, ErrStockTakeClosed
+	}
+	return t, nil
+}
+
+// adjustmentType books spoiled stock as spoilage so it shows up in loss
+// reports; everything else is a plain adjustment
+func adjustmentType(reason string, quantity float64) string {
+	if reason == model.ReasonSpoiled && quantity < 0 {
+		return model.MovementSpoilage
+	}
+	return model.MovementAdjustment
+}
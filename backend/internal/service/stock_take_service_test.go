@@ -0,0 +1,160 @@
+package service
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"pesalocal/internal/model"
+	"pesalocal/internal/repo"
+)
+
+// stockTakeTestService returns a StockTakeService over an in-memory
+// database holding sugar (10 in stock) and bread (4 in stock)
+func stockTakeTestService(t *testing.T) (*StockTakeService, *ProductService) {
+	t.Helper()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1) // every connection gets its own in-memory database
+	t.Cleanup(func() { db.Close() })
+
+	if err := repo.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	productRepo := repo.NewProductRepo(db)
+	for _, p := range []*model.Product{
+		{ID: "sugar", Name: "Sukari 1kg", Price: 200, Stock: 10},
+		{ID: "bread", Name: "Mkate", Price: 65, Stock: 4},
+	} {
+		p.Version = 1
+		if err := productRepo.CreateOrUpdate(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	productSvc := NewProductService(productRepo, repo.NewStockMovementRepo(db), nil, nil, nil, nil)
+	return NewStockTakeService(repo.NewStockTakeRepo(db), productSvc), productSvc
+}
+
+func TestCommitStockTake(t *testing.T) {
+	counted := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	sell := func(productID string, quantity float64) func(t *testing.T, ps *ProductService) {
+		return func(t *testing.T, ps *ProductService) {
+			t.Helper()
+			err := ps.RecordMovement(&model.StockMovement{ProductID: productID, Type: model.MovementSale, Quantity: -quantity})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	tests := []struct {
+		name       string
+		counts     []*model.StockCount
+		before     func(t *testing.T, ps *ProductService) // between counting and committing
+		variances  map[string]float64
+		stockAfter map[string]float64
+	}{
+		{
+			name:       "variance against the stock when counted",
+			counts:     []*model.StockCount{{ProductID: "sugar", Counted: 8, DeviceID: "d1"}},
+			variances:  map[string]float64{"sugar": -2},
+			stockAfter: map[string]float64{"sugar": 8, "bread": 4},
+		},
+		{
+			name:       "sale between count and commit stays booked",
+			counts:     []*model.StockCount{{ProductID: "sugar", Counted: 8, DeviceID: "d1"}},
+			before:     sell("sugar", 3),
+			variances:  map[string]float64{"sugar": -2},
+			stockAfter: map[string]float64{"sugar": 5, "bread": 4},
+		},
+		{
+			name: "counts from two devices add up",
+			counts: []*model.StockCount{
+				{ProductID: "sugar", Counted: 6, DeviceID: "shelf"},
+				{ProductID: "sugar", Counted: 5, DeviceID: "store"},
+			},
+			before:     sell("sugar", 1),
+			variances:  map[string]float64{"sugar": 1},
+			stockAfter: map[string]float64{"sugar": 10, "bread": 4},
+		},
+		{
+			name:       "nothing found and everything since sold",
+			counts:     []*model.StockCount{{ProductID: "bread", Counted: 0, DeviceID: "d1"}},
+			before:     sell("bread", 4),
+			variances:  map[string]float64{"bread": -4},
+			stockAfter: map[string]float64{"sugar": 10, "bread": 0},
+		},
+		{
+			name:       "counted as expected",
+			counts:     []*model.StockCount{{ProductID: "bread", Counted: 4, DeviceID: "d1"}},
+			before:     sell("bread", 1),
+			variances:  map[string]float64{"bread": 0},
+			stockAfter: map[string]float64{"sugar": 10, "bread": 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, ps := stockTakeTestService(t)
+			take := &model.StockTake{ID: "take-1", DeviceID: "d1"}
+			if err := s.OpenStockTake(take); err != nil {
+				t.Fatal(err)
+			}
+			for _, c := range tt.counts {
+				c.CountedAt = counted
+			}
+			if err := s.RecordCounts(take.ID, tt.counts); err != nil {
+				t.Fatal(err)
+			}
+			if tt.before != nil {
+				tt.before(t, ps)
+			}
+
+			variances, err := s.GetVariances(take.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(variances) != len(tt.variances) {
+				t.Fatalf("got %d variances, want %d", len(variances), len(tt.variances))
+			}
+			for _, v := range variances {
+				if v.Variance != tt.variances[v.ProductID] {
+					t.Errorf("%s: variance %v, want %v", v.ProductID, v.Variance, tt.variances[v.ProductID])
+				}
+			}
+
+			adjustments, err := s.CommitStockTake(take.ID, &CommitRequest{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, m := range adjustments {
+				if m.SourceType != "stock_take" || m.SourceID != take.ID {
+					t.Errorf("adjustment not tied to the stock take: %+v", m)
+				}
+			}
+			for id, want := range tt.stockAfter {
+				p, err := ps.GetProduct(id)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if p.Stock != want {
+					t.Errorf("%s: stock %v after commit, want %v", id, p.Stock, want)
+				}
+			}
+
+			// committing again books nothing more
+			again, err := s.CommitStockTake(take.ID, &CommitRequest{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(again) != len(adjustments) {
+				t.Errorf("second commit returned %d adjustments, want %d", len(again), len(adjustments))
+			}
+		})
+	}
+}
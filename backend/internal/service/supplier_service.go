@@ -0,0 +1,210 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"pesalocal/internal/model"
+	"pesalocal/internal/repo"
+)
+
+var ErrSupplierNotFound = errors.New("supplier not found")
+var ErrDuplicateSupplier = errors.New("supplier name already used by another supplier")
+var ErrInvalidSupplier = errors.New("supplier needs a name")
+var ErrCreditNeedsSupplier = errors.New("purchases on credit need a supplier")
+var ErrInvalidPayment = errors.New("payment must be a positive amount against one of the supplier's credit purchases")
+var ErrOverpayment = errors.New("payment is more than is owed")
+
+// Amounts within a cent of each other are treated as equal
+const paymentTolerance = 0.005
+
+type SupplierService struct {
+	supplierRepo *repo.SupplierRepo
+	paymentRepo  *repo.SupplierPaymentRepo
+	purchaseRepo *repo.PurchaseRepo
+}
+
+func NewSupplierService(sr *repo.SupplierRepo, spr *repo.SupplierPaymentRepo, pr *repo.PurchaseRepo) *SupplierService {
+	return &SupplierService{
+		supplierRepo: sr,
+		paymentRepo:  spr,
+		purchaseRepo: pr,
+	}
+}
+
+// CreateOrUpdateSupplier ensures idempotent behavior for sync
+func (s *SupplierService) CreateOrUpdateSupplier(sup *model.Supplier) error {
+	sup.Name = strings.TrimSpace(sup.Name)
+	if sup.Name == "" {
+		return ErrInvalidSupplier
+	}
+	if sup.ID == "" {
+		sup.ID = newID()
+	}
+	if sup.Version == 0 {
+		sup.Version = 1
+	}
+	// the server's time, so pulls since a server time miss nothing
+	sup.UpdatedAt = time.Now()
+
+	// A new supplier with a name already held is merged into that
+	// supplier; only renaming onto another supplier's name is refused
+	existing, err := s.supplierRepo.GetByID(sup.ID)
+	if err != nil {
+		return err
+	}
+	other, err := s.supplierRepo.GetByName(sup.Name)
+	if err != nil {
+		return err
+	}
+	if existing != nil && other != nil && other.ID != existing.ID {
+		return ErrDuplicateSupplier
+	}
+	return s.supplierRepo.CreateOrUpdate(sup)
+}
+
+// GetSupplier returns a supplier with their spend and balance owed
+func (s *SupplierService) GetSupplier(id string) (*model.SupplierSummary, error) {
+	summary, err := s.supplierRepo.GetSummary(id)
+	if err != nil {
+		return nil, err
+	}
+	if summary == nil {
+		return nil, ErrSupplierNotFound
+	}
+	return summary, nil
+}
+
+// GetAllSuppliers returns every supplier with their spend and balance owed
+func (s *SupplierService) GetAllSuppliers() ([]*model.SupplierSummary, error) {
+	return s.supplierRepo.GetSummaries()
+}
+
+// GetSuppliersUpdatedSince returns suppliers changed after t
+func (s *SupplierService) GetSuppliersUpdatedSince(t time.Time) ([]*model.Supplier, error) {
+	return s.supplierRepo.GetUpdatedSince(t)
+}
+
+// GetPurchases returns a supplier's purchases, newest first
+func (s *SupplierService) GetPurchases(supplierID string) ([]*model.Purchase, error) {
+	supplier, err := s.GetSupplier(supplierID)
+	if err != nil {
+		return nil, err
+	}
+	purchases, err := s.purchaseRepo.GetBySupplierID(supplier.ID)
+	if purchases == nil {
+		purchases = []*model.Purchase{}
+	}
+	return purchases, err
+}
+
+// GetLastPrices returns the last price paid to a supplier per product
+func (s *SupplierService) GetLastPrices(supplierID string) ([]*model.SupplierPrice, error) {
+	supplier, err := s.GetSupplier(supplierID)
+	if err != nil {
+		return nil, err
+	}
+	return s.supplierRepo.GetLastPrices(supplier.ID)
+}
+
+// GetPayments returns the payments made to a supplier, newest first
+func (s *SupplierService) GetPayments(supplierID string) ([]*model.SupplierPayment, error) {
+	supplier, err := s.GetSupplier(supplierID)
+	if err != nil {
+		return nil, err
+	}
+	return s.paymentRepo.GetBySupplierID(supplier.ID)
+}
+
+// RecordPayment records money paid to a supplier for credit purchases.
+// A payment naming a purchase can't exceed what is owed on it; one that
+// doesn't can't exceed the supplier's balance. Replayed payments are
+// ignored.
+func (s *SupplierService) RecordPayment(p *model.SupplierPayment) error {
+	if p.ID == "" {
+		p.ID = newID()
+	}
+	existing, err := s.paymentRepo.GetByID(p.ID)
+	if err != nil || existing != nil {
+		return err
+	}
+	if p.Amount <= 0 {
+		return ErrInvalidPayment
+	}
+
+	supplier, err := s.GetSupplier(p.SupplierID)
+	if err != nil {
+		return err
+	}
+	p.SupplierID = supplier.ID
+	owed := supplier.Balance
+	if p.PurchaseID != "" {
+		purchase, err := s.purchaseRepo.GetByID(p.PurchaseID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidPayment
+		}
+		if err != nil {
+			return err
+		}
+		if purchase.SupplierID != p.SupplierID || purchase.PaymentMethod != model.PaymentCredit {
+			return ErrInvalidPayment
+		}
+		paid, err := s.paymentRepo.TotalForPurchase(p.PurchaseID)
+		if err != nil {
+			return err
+		}
+		owed = purchase.TotalAmount - paid
+	}
+	if p.Amount > owed+paymentTolerance {
+		return ErrOverpayment
+	}
+
+	if p.Method == "" {
+		p.Method = model.PaymentCash
+	}
+	if p.PaidAt.IsZero() {
+		p.PaidAt = time.Now()
+	}
+	return s.paymentRepo.Create(p)
+}
+
+// resolveSupplier links a purchase to its supplier. A purchase naming a
+// supplier that isn't in the directory yet adds it, so free-text
+// suppliers from older devices keep working.
+func (s *SupplierService) resolveSupplier(p *model.Purchase) error {
+	p.Supplier = strings.TrimSpace(p.Supplier)
+	if p.PaymentMethod == "" {
+		p.PaymentMethod = model.PaymentCash
+	}
+
+	var supplier *model.Supplier
+	var err error
+	switch {
+	case p.SupplierID != "":
+		supplier, err = s.supplierRepo.GetByID(p.SupplierID)
+		if err == nil && supplier == nil {
+			err = ErrSupplierNotFound
+		}
+	case p.Supplier != "":
+		supplier, err = s.supplierRepo.GetByName(p.Supplier)
+		if err == nil && supplier == nil {
+			supplier = &model.Supplier{Name: p.Supplier}
+			err = s.CreateOrUpdateSupplier(supplier)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if supplier == nil {
+		if p.PaymentMethod == model.PaymentCredit {
+			return ErrCreditNeedsSupplier
+		}
+		return nil
+	}
+	p.SupplierID = supplier.ID
+	p.Supplier = supplier.Name
+	return nil
+}
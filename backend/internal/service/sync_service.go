@@ -18,15 +18,42 @@ type SyncService struct {
 	saleSvc       *SaleService
 	purchaseSvc   *PurchaseService
 	userSvc       *UserService
+	stockTakeSvc  *StockTakeService
+	reorderSvc    *ReorderService
+	supplierSvc   *SupplierService
+	priceSvc      *PriceService
+	returnSvc     *ReturnService
+	promotionSvc  *PromotionService
+	receiptSvc    *ReceiptService
 	maxRetryCount int
 }
 
+// PullResult is the server state a device applies after pushing
+type PullResult struct {
+	ServerTime     time.Time                  `json:"server_time"` // pass as "since" on the next pull
+	Products       []*model.Product           `json:"products"`
+	Categories     []*model.Category          `json:"categories"`               // changed since the last pull
+	Units          []*model.UnitConversion    `json:"unit_conversions"`         // always the full list
+	Suppliers      []*model.SupplierSummary   `json:"suppliers"`                // always the full list, with balances
+	Returns        []*model.Return            `json:"returns"`                  // recorded since the last pull
+	Promotions     []*model.Promotion         `json:"promotions"`               // always the full list
+	ReceiptRanges  []*model.ReceiptRange      `json:"receipt_ranges,omitempty"` // the device's unused receipt numbers
+	LowStockAlerts []*model.ReorderSuggestion `json:"low_stock_alerts"`
+}
+
 func NewSyncService(
 	sr *repo.SyncOperationRepo,
 	ps *ProductService,
 	ss *SaleService,
 	psvc *PurchaseService,
 	us *UserService,
+	sts *StockTakeService,
+	rs *ReorderService,
+	sus *SupplierService,
+	prs *PriceService,
+	rts *ReturnService,
+	pms *PromotionService,
+	rcs *ReceiptService,
 ) *SyncService {
 	return &SyncService{
 		syncRepo:      sr,
@@ -34,6 +61,13 @@ func NewSyncService(
 		saleSvc:       ss,
 		purchaseSvc:   psvc,
 		userSvc:       us,
+		stockTakeSvc:  sts,
+		reorderSvc:    rs,
+		supplierSvc:   sus,
+		priceSvc:      prs,
+		returnSvc:     rts,
+		promotionSvc:  pms,
+		receiptSvc:    rcs,
 		maxRetryCount: 5,
 	}
 }
@@ -48,28 +82,41 @@ func (s *SyncService) ProcessSyncOperation(op *model.SyncOperation) error {
 		if err = json.Unmarshal(op.Payload, &p); err != nil {
 			return err
 		}
-		// Use idempotent create-or-update
-		err = s.productSvc.productRepo.CreateOrUpdate(&p)
+		// Use idempotent create-or-update; stock changes go through the ledger
+		err = s.productSvc.CreateOrUpdateProduct(&p)
 	case "sale":
-		var sale model.Sale
-		var items []*model.SaleItem
-		if err = json.Unmarshal(op.Payload, &struct {
-			Sale  *model.Sale       `json:"sale"`
+		var payload struct {
+			Sale  model.Sale        `json:"sale"`
 			Items []*model.SaleItem `json:"items"`
-		}{Sale: &sale, Items: items}); err != nil {
+		}
+		if err = json.Unmarshal(op.Payload, &payload); err != nil {
+			return err
+		}
+		err = s.saleSvc.CreateSale(&payload.Sale, payload.Items)
+	case "return":
+		var ret model.Return
+		if err = json.Unmarshal(op.Payload, &ret); err != nil {
+			return err
+		}
+		if ret.DeviceID == "" {
+			ret.DeviceID = op.DeviceID
+		}
+		err = s.returnSvc.CreateReturn(&ret)
+	case "promotion":
+		var p model.Promotion
+		if err = json.Unmarshal(op.Payload, &p); err != nil {
 			return err
 		}
-		err = s.saleSvc.CreateSale(&sale, items)
+		err = s.promotionSvc.CreateOrUpdatePromotion(&p)
 	case "purchase":
-		var purchase model.Purchase
-		var items []*model.PurchaseItem
-		if err = json.Unmarshal(op.Payload, &struct {
-			Purchase *model.Purchase       `json:"purchase"`
+		var payload struct {
+			Purchase model.Purchase        `json:"purchase"`
 			Items    []*model.PurchaseItem `json:"items"`
-		}{Purchase: &purchase, Items: items}); err != nil {
+		}
+		if err = json.Unmarshal(op.Payload, &payload); err != nil {
 			return err
 		}
-		err = s.purchaseSvc.CreatePurchase(&purchase, items)
+		err = s.purchaseSvc.CreatePurchase(&payload.Purchase, payload.Items)
 
 	case "user":
 		var u model.User
@@ -78,6 +125,53 @@ func (s *SyncService) ProcessSyncOperation(op *model.SyncOperation) error {
 		}
 		// Use idempotent create-or-update
 		err = s.userSvc.userRepo.CreateOrUpdate(&u)
+	case "category":
+		var c model.Category
+		if err = json.Unmarshal(op.Payload, &c); err != nil {
+			return err
+		}
+		err = s.productSvc.CreateOrUpdateCategory(&c)
+	case "supplier":
+		var sup model.Supplier
+		if err = json.Unmarshal(op.Payload, &sup); err != nil {
+			return err
+		}
+		err = s.supplierSvc.CreateOrUpdateSupplier(&sup)
+	case "supplier_payment":
+		var p model.SupplierPayment
+		if err = json.Unmarshal(op.Payload, &p); err != nil {
+			return err
+		}
+		err = s.supplierSvc.RecordPayment(&p)
+	case "price_change":
+		var c model.PriceChange
+		if err = json.Unmarshal(op.Payload, &c); err != nil {
+			return err
+		}
+		err = s.priceSvc.SetPrice(&c)
+	case "unit_conversion":
+		var c model.UnitConversion
+		if err = json.Unmarshal(op.Payload, &c); err != nil {
+			return err
+		}
+		err = s.productSvc.CreateOrUpdateUnitConversion(&c)
+	case "stock_take":
+		err = s.applyStockTake(op)
+	case "stock_count":
+		var c model.StockCount
+		if err = json.Unmarshal(op.Payload, &c); err != nil {
+			return err
+		}
+		err = s.stockTakeSvc.RecordCounts(c.StockTakeID, []*model.StockCount{&c})
+	case "stock_adjustment":
+		var m model.StockMovement
+		if err = json.Unmarshal(op.Payload, &m); err != nil {
+			return err
+		}
+		if m.DeviceID == "" {
+			m.DeviceID = op.DeviceID
+		}
+		err = s.stockTakeSvc.AdjustStock(&m)
 	default:
 		return errors.New("unknown entity type")
 	}
@@ -97,6 +191,35 @@ func (s *SyncService) ProcessSyncOperation(op *model.SyncOperation) error {
 	return s.syncRepo.Delete(op.ID)
 }
 
+// applyStockTake opens, commits or cancels a stock take depending on the
+// operation
+func (s *SyncService) applyStockTake(op *model.SyncOperation) error {
+	switch op.Operation {
+	case "commit":
+		var req struct {
+			ID string `json:"id"`
+			CommitRequest
+		}
+		if err := json.Unmarshal(op.Payload, &req); err != nil {
+			return err
+		}
+		_, err := s.stockTakeSvc.CommitStockTake(req.ID, &req.CommitRequest)
+		return err
+	case "cancel":
+		var t model.StockTake
+		if err := json.Unmarshal(op.Payload, &t); err != nil {
+			return err
+		}
+		return s.stockTakeSvc.CancelStockTake(t.ID)
+	default:
+		var t model.StockTake
+		if err := json.Unmarshal(op.Payload, &t); err != nil {
+			return err
+		}
+		return s.stockTakeSvc.OpenStockTake(&t)
+	}
+}
+
 // ProcessAllSyncOperations fetches pending operations and processes them
 func (s *SyncService) ProcessAllSyncOperations() error {
 	ops, err := s.syncRepo.GetAll()
@@ -129,3 +252,62 @@ func (s *SyncService) AddSyncOperation(op *model.SyncOperation) error {
 	op.RetryCount = 0
 	return s.syncRepo.Create(op)
 }
+
+// Pull returns products and categories changed since the device last
+// pulled, and the current low-stock alerts so every device shows the same
+// list. A device that names itself also gets receipt numbers to use until
+// its next sync.
+func (s *SyncService) Pull(since time.Time, deviceID string) (*PullResult, error) {
+	now := time.Now()
+
+	products, err := s.productSvc.GetProductsUpdatedSince(since)
+	if err != nil {
+		return nil, err
+	}
+	alerts, err := s.reorderSvc.GetSuggestions(DefaultVelocityWindow, DefaultCoverDays)
+	if err != nil {
+		return nil, err
+	}
+	categories, err := s.productSvc.GetCategoriesUpdatedSince(since)
+	if err != nil {
+		return nil, err
+	}
+	units, err := s.productSvc.GetAllUnitConversions()
+	if err != nil {
+		return nil, err
+	}
+	suppliers, err := s.supplierSvc.GetAllSuppliers()
+	if err != nil {
+		return nil, err
+	}
+	returns, err := s.returnSvc.GetReturnsRecordedSince(since)
+	if err != nil {
+		return nil, err
+	}
+	promotions, err := s.promotionSvc.GetAllPromotions()
+	if err != nil {
+		return nil, err
+	}
+
+	var ranges []*model.ReceiptRange
+	if deviceID != "" {
+		if ranges, err = s.receiptSvc.EnsureRanges(deviceID); err != nil {
+			return nil, err
+		}
+	}
+
+	if products == nil {
+		products = []*model.Product{}
+	}
+	return &PullResult{
+		ServerTime:     now,
+		Products:       products,
+		Categories:     categories,
+		Units:          units,
+		Suppliers:      suppliers,
+		Returns:        returns,
+		Promotions:     promotions,
+		ReceiptRanges:  ranges,
+		LowStockAlerts: alerts,
+	}, nil
+}
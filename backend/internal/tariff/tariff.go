@@ -0,0 +1,190 @@
+package tariff
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+//go:embed data/*.json
+var builtin embed.FS
+
+var (
+	ErrNoTariff    = errors.New("no tariff in force at that time")
+	ErrUnknownType = errors.New("transaction type has no tariff")
+)
+
+// Band charges Fee for amounts up to and including UpTo. A zero UpTo means
+// the band has no upper limit.
+type Band struct {
+	UpTo float64 `json:"up_to,omitempty"`
+	Fee  float64 `json:"fee"`
+}
+
+// Table is one version of the tariff, in force from EffectiveFrom until the
+// next table takes over
+type Table struct {
+	Version       string            `json:"version"`
+	EffectiveFrom time.Time         `json:"effective_from"`
+	Description   string            `json:"description,omitempty"`
+	ExciseRate    float64           `json:"excise_rate"` // charged on top of the band fee; 0 when bands are all-in
+	Bands         map[string][]Band `json:"bands"`       // keyed by transaction type
+}
+
+func (t *Table) UnmarshalJSON(data []byte) error {
+	type table Table
+	var raw struct {
+		table
+		EffectiveFrom string `json:"effective_from"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	from, err := time.Parse("2006-01-02", raw.EffectiveFrom)
+	if err != nil {
+		return fmt.Errorf("effective_from: %w", err)
+	}
+	*t = Table(raw.table)
+	t.EffectiveFrom = from
+	return nil
+}
+
+// Quote is the fee a tariff charges for a transaction
+type Quote struct {
+	TariffVersion string  `json:"tariff_version"`
+	Type          string  `json:"type"`
+	Amount        float64 `json:"amount"`
+	BaseFee       float64 `json:"base_fee"`
+	Excise        float64 `json:"excise"`
+	Fee           float64 `json:"fee"`
+}
+
+// Engine holds every tariff version, oldest first
+type Engine struct {
+	tables []*Table
+}
+
+// Default loads the tariff tables shipped with the server
+func Default() (*Engine, error) {
+	sub, err := fs.Sub(builtin, "data")
+	if err != nil {
+		return nil, err
+	}
+	return Load(sub)
+}
+
+// LoadDir loads tariff tables from the JSON files in dir
+func LoadDir(dir string) (*Engine, error) {
+	return Load(os.DirFS(dir))
+}
+
+// Load reads every *.json file at the root of fsys as a tariff table
+func Load(fsys fs.FS) (*Engine, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Engine{}
+	for _, entry := range entries {
+		if entry.IsDir() || path.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		data, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		t := &Table{}
+		if err := json.Unmarshal(data, t); err != nil {
+			return nil, fmt.Errorf("tariff %s: %w", entry.Name(), err)
+		}
+		e.tables = append(e.tables, t)
+	}
+
+	if len(e.tables) == 0 {
+		return nil, errors.New("no tariff tables found")
+	}
+	sort.Slice(e.tables, func(i, j int) bool {
+		return e.tables[i].EffectiveFrom.Before(e.tables[j].EffectiveFrom)
+	})
+	return e, nil
+}
+
+// Tables returns all loaded tariff versions, oldest first
+func (e *Engine) Tables() []*Table {
+	return e.tables
+}
+
+// TableAt returns the tariff in force at time t
+func (e *Engine) TableAt(t time.Time) (*Table, error) {
+	var current *Table
+	for _, table := range e.tables {
+		if table.EffectiveFrom.After(t) {
+			break
+		}
+		current = table
+	}
+	if current == nil {
+		return nil, ErrNoTariff
+	}
+	return current, nil
+}
+
+// Fee computes the fee the tariff in force at time at charges for sending
+// amount as a transaction of type txType
+func (e *Engine) Fee(txType string, amount float64, at time.Time) (*Quote, error) {
+	table, err := e.TableAt(at)
+	if err != nil {
+		return nil, err
+	}
+
+	bands, ok := table.bands(txType)
+	if !ok {
+		return nil, ErrUnknownType
+	}
+
+	amount = math.Abs(amount)
+	quote := &Quote{
+		TariffVersion: table.Version,
+		Type:          txType,
+		Amount:        amount,
+	}
+	for _, band := range bands {
+		if band.UpTo == 0 || amount <= band.UpTo {
+			quote.BaseFee = band.Fee
+			break
+		}
+	}
+
+	// Rounded to whole shillings, as M-PESA charges them
+	quote.Fee = math.Round(quote.BaseFee * (1 + table.ExciseRate))
+	quote.Excise = quote.Fee - quote.BaseFee
+	return quote, nil
+}
+
+// Charges reports whether any tariff charges fees for txType
+func (e *Engine) Charges(txType string) bool {
+	for _, table := range e.tables {
+		if _, ok := table.bands(txType); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *Table) bands(txType string) ([]Band, bool) {
+	for name, bands := range t.Bands {
+		if strings.EqualFold(name, txType) {
+			return bands, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,104 @@
+package tariff
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestDefaultFee(t *testing.T) {
+	e, err := Default()
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := date("2026-10-18")
+
+	tests := []struct {
+		txType string
+		amount float64
+		want   float64
+	}{
+		{"Send Money", 50, 0},
+		{"Send Money", 100, 0}, // band limits are inclusive
+		{"Send Money", 100.5, 11},
+		{"Send Money", 2500, 30},
+		{"Send Money", 2501, 52},
+		{"Send Money", 250000, 108}, // open top band
+		{"Send Money", -600, 30},    // outgoing amounts are negative
+		{"send money", 600, 30},     // types match case-insensitively
+		{"Withdrawal", 100, 10},
+		{"Withdrawal", 20000, 67},
+		{"Paybill", 1200, 23},
+		{"Buy Goods", 3000, 53},
+	}
+	for _, tt := range tests {
+		q, err := e.Fee(tt.txType, tt.amount, at)
+		if err != nil {
+			t.Errorf("Fee(%q, %v): %v", tt.txType, tt.amount, err)
+			continue
+		}
+		if q.Fee != tt.want || q.BaseFee != tt.want || q.Excise != 0 {
+			t.Errorf("Fee(%q, %v) = %v (base %v, excise %v), want %v", tt.txType, tt.amount, q.Fee, q.BaseFee, q.Excise, tt.want)
+		}
+		if q.TariffVersion != "2023-01" {
+			t.Errorf("Fee(%q, %v) used tariff %q", tt.txType, tt.amount, q.TariffVersion)
+		}
+	}
+}
+
+func TestFeeVersionsAndExcise(t *testing.T) {
+	e, err := Load(fstest.MapFS{
+		"old.json": {Data: []byte(`{
+			"version": "v1", "effective_from": "2024-01-01", "excise_rate": 0.15,
+			"bands": {"Send Money": [{"up_to": 1000, "fee": 10}, {"fee": 20}]}
+		}`)},
+		"new.json": {Data: []byte(`{
+			"version": "v2", "effective_from": "2025-07-01",
+			"bands": {"Send Money": [{"up_to": 1000, "fee": 12}, {"fee": 25}]}
+		}`)},
+		"README": {Data: []byte("not a tariff")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		amount    float64
+		at        string
+		version   string
+		base, fee float64
+	}{
+		{"excise added and rounded", 500, "2024-06-01", "v1", 10, 12}, // 11.5
+		{"top band with excise", 5000, "2025-06-30", "v1", 20, 23},
+		{"new table from its first day", 500, "2025-07-01", "v2", 12, 12},
+		{"new table later", 5000, "2026-01-01", "v2", 25, 25},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := e.Fee("Send Money", tt.amount, date(tt.at))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if q.TariffVersion != tt.version || q.BaseFee != tt.base || q.Fee != tt.fee || q.Excise != tt.fee-tt.base {
+				t.Errorf("got %+v, want version %s base %v fee %v", q, tt.version, tt.base, tt.fee)
+			}
+		})
+	}
+
+	if _, err := e.Fee("Send Money", 500, date("2023-12-31")); !errors.Is(err, ErrNoTariff) {
+		t.Errorf("before the first table: got %v, want ErrNoTariff", err)
+	}
+	if _, err := e.Fee("Lipa Later", 500, date("2026-01-01")); !errors.Is(err, ErrUnknownType) {
+		t.Errorf("unknown type: got %v, want ErrUnknownType", err)
+	}
+}